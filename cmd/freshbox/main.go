@@ -0,0 +1,1302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/kittors/freshbox/internal/backup"
+	"github.com/kittors/freshbox/internal/checker"
+	"github.com/kittors/freshbox/internal/config"
+	"github.com/kittors/freshbox/internal/history"
+	"github.com/kittors/freshbox/internal/ledger"
+	"github.com/kittors/freshbox/internal/profile"
+	"github.com/kittors/freshbox/internal/providers"
+	"github.com/kittors/freshbox/internal/redact"
+	"github.com/kittors/freshbox/internal/secrets"
+	"github.com/kittors/freshbox/internal/tasks"
+	"github.com/kittors/freshbox/internal/ui"
+	"github.com/kittors/freshbox/internal/version"
+)
+
+const usage = `freshbox — macOS setup assistant
+
+Usage:
+  freshbox [command] [flags]
+  freshbox --profile Freshfile.toml
+
+Commands:
+  tui        Launch the interactive installer (default)
+  check      Detect installed tools and apps
+  install    Install without a TUI (flags, names or a selection file)
+  plan       Print what install would do, without doing it
+  resume     Continue an install that was interrupted or had failures
+  upgrade    Upgrade installed tools and apps that are out of date
+  history    List past install runs, or show what one of them ran
+  restore    Put back the files an install or config command changed
+  uninstall  Remove what freshbox installed, leaving everything else
+  config     Write Codex / Claude Code / MCP configuration
+  ai         Save AI provider profiles and switch between them
+  version    Print the freshbox version
+
+Run 'freshbox <command> -h' for command flags.
+`
+
+// errUsage is returned when the command line is invalid; the usage text has
+// already been printed.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run dispatches the subcommand and returns the process exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	// tokens in the environment (MCP servers read theirs from it) never
+	// reach the logs or the terminal
+	redact.AddEnv(os.Environ())
+	cmd := "tui"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "tui":
+		err = runTUI(args, stderr)
+	case "check":
+		err = runCheck(args, stdout, stderr)
+	case "install":
+		err = runInstall(args, stdout, stderr, false)
+	case "plan":
+		err = runInstall(args, stdout, stderr, true)
+	case "resume":
+		err = runResume(args, stdout, stderr)
+	case "upgrade":
+		err = runUpgrade(args, stdout, stderr)
+	case "history":
+		err = runHistory(args, stdout, stderr)
+	case "restore":
+		err = runRestore(args, stdout, stderr)
+	case "uninstall":
+		err = runUninstall(args, stdout, stderr)
+	case "config":
+		err = runConfig(args, stdout, stderr)
+	case "ai":
+		err = runAI(args, stdout, stderr)
+	case "version":
+		fmt.Fprintln(stdout, version.Version)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", cmd, usage)
+		return 2
+	}
+
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintln(stderr, "freshbox:", redact.String(err.Error()))
+		return 1
+	}
+}
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("freshbox "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseFlags parses args and maps flag errors to errUsage
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// interruptContext is cancelled by ctrl+c or SIGTERM, which kills the
+// commands running under it
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// --- tui ---
+
+func runTUI(args []string, stderr io.Writer) error {
+	fs := newFlagSet("tui", stderr)
+	profilePath := fs.String("profile", "", "pre-populate the wizard from a profile (Freshfile.toml)")
+	jobs := fs.Int("jobs", tasks.DefaultWorkers, "how many independent tasks to run at once")
+	timeout := fs.Duration("timeout", 0, "cancel any task still running after this long (default: 5-30m per task)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var p *profile.Profile
+	if *profilePath != "" {
+		var err error
+		if p, err = profile.Load(*profilePath); err != nil {
+			return err
+		}
+	}
+
+	cat, err := tasks.LoadCatalog()
+	if err != nil {
+		return err
+	}
+	m := ui.NewModel(cat)
+	m.SetWorkers(*jobs)
+	m.SetTimeout(*timeout)
+	if p != nil {
+		m.ApplyProfile(p)
+	}
+	_, err = tea.NewProgram(m, tea.WithAltScreen()).Run()
+	return err
+}
+
+// --- check ---
+
+type checkResult struct {
+	Name      string `json:"name"`
+	Category  string `json:"category"`
+	Installed bool   `json:"installed"`
+	Outdated  bool   `json:"outdated,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Semver    string `json:"semver,omitempty"` // Version parsed as major.minor.patch
+	Latest    string `json:"latest,omitempty"`
+	Min       string `json:"min_version,omitempty"`
+}
+
+// newCheckResult reports item as check prints it
+func newCheckResult(item *checker.Item) checkResult {
+	r := checkResult{
+		Name:      item.Name,
+		Category:  item.Category,
+		Installed: item.Status != checker.NotInstalled,
+		Outdated:  item.Status == checker.Outdated,
+		Version:   item.Version,
+		Latest:    item.Latest,
+		Min:       item.MinVersion,
+	}
+	if item.Semver != (checker.Semver{}) {
+		r.Semver = item.Semver.String()
+	}
+	return r
+}
+
+// upgradeTo describes what an outdated item upgrades to: the newer version a
+// package manager reported, or the minimum it falls short of
+func (r checkResult) upgradeTo() string {
+	if r.Latest != "" {
+		return r.Latest
+	}
+	return "≥ " + r.Min
+}
+
+func runCheck(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("check", stderr)
+	asJSON := fs.Bool("json", false, "print results as JSON")
+	category := fs.String("category", "", "only check one category: dev, app or ai")
+	outdated := fs.Bool("outdated", false, "also ask brew, npm and rustup for newer versions (needs the network)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	items, err := catalogItems(*category)
+	if err != nil {
+		return err
+	}
+	checker.DetectAll(items, nil)
+	if *outdated {
+		ctx, stop := interruptContext()
+		checker.CheckOutdated(ctx, items)
+		stop()
+	}
+
+	results := make([]checkResult, 0, len(items))
+	for _, item := range items {
+		results = append(results, newCheckResult(item))
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	for _, r := range results {
+		mark := "✗"
+		switch {
+		case r.Outdated:
+			mark = "↑"
+		case r.Installed:
+			mark = "✓"
+		}
+		line := fmt.Sprintf("%s %-4s %s", mark, r.Category, r.Name)
+		switch {
+		case r.Outdated:
+			line += "  (" + r.Version + " → " + r.upgradeTo() + ")"
+		case r.Version != "":
+			line += "  (" + r.Version + ")"
+		}
+		fmt.Fprintln(stdout, line)
+	}
+	return nil
+}
+
+// catalogItems returns the catalog for the given category, or all of it
+func catalogItems(category string) ([]*checker.Item, error) {
+	cat, err := tasks.LoadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	switch category {
+	case "":
+		return cat.Items(), nil
+	case "dev":
+		return cat.DevTools, nil
+	case "app":
+		return cat.Apps, nil
+	case "ai":
+		return cat.AITools, nil
+	default:
+		return nil, fmt.Errorf("unknown category %q (want dev, app or ai)", category)
+	}
+}
+
+// --- install ---
+
+const installUsage = `Usage: freshbox install [flags] [name...]
+
+Installs without a TUI. Names are matched against the catalog by name,
+command or brew name; the category flags and --file add to the selection.
+
+Flags:
+`
+
+// listFlag collects comma-separated values, and may be repeated
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*l = append(*l, part)
+		}
+	}
+	return nil
+}
+
+// envFlag collects NAME=VALUE pairs, and may be repeated
+type envFlag map[string]string
+
+func (e envFlag) String() string { return strings.Join(slices.Sorted(maps.Keys(e)), ",") }
+
+func (e envFlag) Set(v string) error {
+	name, value, ok := strings.Cut(v, "=")
+	if !ok || name == "" {
+		return errors.New("want NAME=VALUE")
+	}
+	e[name] = value
+	redact.Add(value)
+	return nil
+}
+
+// runInstall runs the headless installer; planOnly prints the plan instead (freshbox plan)
+func runInstall(args []string, stdout, stderr io.Writer, planOnly bool) error {
+	name := "install"
+	if planOnly {
+		name = "plan"
+	}
+	fs := newFlagSet(name, stderr)
+	var sel tasks.Selection
+	var dev, apps, ai, node, mcps, extra, defaults listFlag
+	fs.Var(&dev, "dev", "dev tools to install, e.g. Git,Go")
+	fs.Var(&apps, "apps", "apps to install, e.g. Zed,IINA")
+	fs.Var(&ai, "ai", "AI tools to install: Codex, Claude Code")
+	fs.Var(&node, "node", "Node.js versions to install via fnm, e.g. v22.11.0")
+	fs.Var(&mcps, "mcp", "MCP servers to register, e.g. Playwright,Context7")
+	fs.Var(&extra, "extra", "extra setup: "+strings.Join(tasks.ExtraSetupKeys(), ", "))
+	fs.Var(&defaults, "defaults", "system defaults: "+strings.Join(tasks.SysDefaultKeys(), ", "))
+	fs.StringVar(&sel.Codex.Model, "codex-model", "", "Codex model")
+	fs.StringVar(&sel.Codex.ThinkingLevel, "codex-think", "", "Codex reasoning effort")
+	fs.StringVar(&sel.Codex.BaseURL, "codex-base-url", "", "Codex API base URL")
+	fs.StringVar(&sel.Codex.APIKey, "codex-api-key", "", "Codex API key (or $FRESHBOX_CODEX_API_KEY)")
+	fs.StringVar(&sel.Claude.Model, "claude-model", "", "Claude Code model")
+	fs.StringVar(&sel.Claude.BaseURL, "claude-base-url", "", "Claude Code API base URL")
+	fs.StringVar(&sel.Claude.APIKey, "claude-api-key", "", "Claude Code API key (or $FRESHBOX_CLAUDE_API_KEY)")
+	fs.StringVar(&sel.AIProfile, "ai-profile", "", "switch Codex and Claude Code to a saved provider profile (see 'freshbox ai')")
+	mcpEnv := envFlag{}
+	fs.Var(mcpEnv, "mcp-env", "`NAME=VALUE` for a variable an MCP server needs, e.g. BRAVE_API_KEY=… (repeatable; default: the environment)")
+	plaintext := fs.Bool("plaintext-keys", false, "write API keys into the tools' config files instead of the Keychain")
+	file := fs.String("file", "", "read the selection from a JSON file or TOML profile (- for stdin)")
+	asJSON := fs.Bool("json", false, "stream progress as JSON lines (with --dry-run: print the plan as JSON)")
+	force := fs.Bool("force", false, "reinstall items that are already installed")
+	dryRun := fs.Bool("dry-run", planOnly, "print the plan without executing it")
+	jobs := fs.Int("jobs", tasks.DefaultWorkers, "how many independent tasks to run at once")
+	timeout := fs.Duration("timeout", 0, "cancel any task still running after this long (default: 5-30m per task)")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, strings.Replace(installUsage, "install", name, 1))
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *file != "" {
+		fromFile, err := readSelection(*file)
+		if err != nil {
+			return err
+		}
+		sel = mergeSelection(fromFile, sel)
+	}
+	if *plaintext {
+		sel.Codex.PlaintextKey, sel.Claude.PlaintextKey = true, true
+	}
+	sel.DevTools = append(sel.DevTools, dev...)
+	sel.Apps = append(sel.Apps, apps...)
+	sel.AITools = append(sel.AITools, ai...)
+	sel.NodeVersions = append(sel.NodeVersions, node...)
+	sel.MCPs = append(sel.MCPs, mcps...)
+	sel.ExtraSetup = append(sel.ExtraSetup, extra...)
+	sel.SysDefaults = append(sel.SysDefaults, defaults...)
+	if len(mcpEnv) > 0 && sel.MCPEnv == nil {
+		sel.MCPEnv = make(map[string]string, len(mcpEnv))
+	}
+	maps.Copy(sel.MCPEnv, mcpEnv)
+	if sel.Codex.APIKey == "" {
+		sel.Codex.APIKey = os.Getenv("FRESHBOX_CODEX_API_KEY")
+	}
+	if sel.Claude.APIKey == "" {
+		sel.Claude.APIKey = os.Getenv("FRESHBOX_CLAUDE_API_KEY")
+	}
+	redact.Add(sel.Codex.APIKey, sel.Claude.APIKey)
+
+	if fs.NArg() == 0 && reflect.DeepEqual(sel, tasks.Selection{}) {
+		fs.Usage()
+		return errUsage
+	}
+
+	cat, err := tasks.DetectCatalog()
+	if err != nil {
+		return err
+	}
+	if err := addNamedItems(&sel, cat, fs.Args()); err != nil {
+		return err
+	}
+	normalizeSelection(&sel, cat)
+	if err := sel.Validate(cat); err != nil {
+		return err
+	}
+	cat.Require(sel.MinVersions)
+	if *force {
+		markForReinstall(sel, cat)
+	}
+
+	queue, err := tasks.Build(sel, cat)
+	if err != nil {
+		return err
+	}
+	tasks.SetTimeout(queue, *timeout)
+	if *dryRun {
+		plan := tasks.NewPlan(queue)
+		if *asJSON {
+			return plan.WriteJSON(stdout)
+		}
+		plan.WriteText(stdout)
+		return nil
+	}
+	if len(queue) == 0 {
+		fmt.Fprintln(stderr, "Nothing to install.")
+		return nil
+	}
+
+	return runQueue("install", queue, tasks.NewRunState(sel, queue), *jobs, *asJSON, stdout)
+}
+
+// runQueue runs the queue headlessly, recording progress in state so an
+// interrupted run can be resumed, and every task and command in the run log.
+// Uninstall runs pass a nil state: 'freshbox uninstall' picks up what's left.
+// ctrl+c kills the running tasks and skips the rest.
+func runQueue(source string, queue []tasks.Task, state *tasks.RunState, jobs int, asJSON bool, stdout io.Writer) error {
+	report := tasks.TextReporter(stdout)
+	if asJSON {
+		report = tasks.JSONReporter(stdout)
+	}
+	if err := state.Save(); err != nil {
+		return err
+	}
+	runLog, err := history.Start(source, queue)
+	if err != nil {
+		return err
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+	ctx = backup.WithRun(ctx, backup.Start(runLog.ID))
+	failed := tasks.Run(ctx, runLog.Wrap(queue), jobs, runLog.Track(state.Track(report)))
+	what, hint := "install", "run 'freshbox resume' to "
+	if state == nil {
+		what, hint = source, "run 'freshbox "+source+"' again to "
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s interrupted (%scontinue)", what, hint)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tasks failed (%sretry)", failed, len(queue), hint)
+	}
+	return nil
+}
+
+// --- resume ---
+
+func runResume(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("resume", stderr)
+	force := fs.Bool("force", false, "also rerun tasks that already succeeded")
+	discard := fs.Bool("discard", false, "forget the unfinished run instead of resuming it")
+	asJSON := fs.Bool("json", false, "stream progress as JSON lines")
+	jobs := fs.Int("jobs", tasks.DefaultWorkers, "how many independent tasks to run at once")
+	timeout := fs.Duration("timeout", 0, "cancel any task still running after this long (default: 5-30m per task)")
+	var keys tasks.Selection
+	fs.StringVar(&keys.Codex.APIKey, "codex-api-key", os.Getenv("FRESHBOX_CODEX_API_KEY"), "Codex API key, if the run configured Codex")
+	fs.StringVar(&keys.Claude.APIKey, "claude-api-key", os.Getenv("FRESHBOX_CLAUDE_API_KEY"), "Claude Code API key, if the run configured Claude Code")
+	keys.MCPEnv = envFlag{}
+	fs.Var(envFlag(keys.MCPEnv), "mcp-env", "`NAME=VALUE` for a variable an MCP server needs, if not set in the environment (repeatable)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	redact.Add(keys.Codex.APIKey, keys.Claude.APIKey)
+
+	state, err := tasks.LoadState()
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		fmt.Fprintln(stderr, "Nothing to resume.")
+		return nil
+	}
+	if *discard {
+		return tasks.ClearState()
+	}
+
+	cat, err := tasks.DetectCatalog()
+	if err != nil {
+		return err
+	}
+	queue, dropped, err := state.Resume(cat, keys, *force)
+	if err != nil {
+		return err
+	}
+	tasks.SetTimeout(queue, *timeout)
+	for _, name := range dropped {
+		if strings.HasPrefix(name, "MCP server ") {
+			fmt.Fprintf(stderr, "Skipping %s: its variables aren't saved; set them in the environment or pass --mcp-env NAME=VALUE.\n", name)
+			continue
+		}
+		fmt.Fprintf(stderr, "Skipping %s: its API key isn't saved; pass --codex-api-key / --claude-api-key.\n", name)
+	}
+	if len(queue) == 0 {
+		fmt.Fprintln(stderr, "Nothing to resume.")
+		if len(dropped) == 0 {
+			return tasks.ClearState()
+		}
+		return nil
+	}
+	fmt.Fprintf(stderr, "Resuming install from %s: %d of %d tasks left.\n",
+		state.StartedAt.Format("2006-01-02 15:04"), len(queue), len(state.Tasks))
+	return runQueue("resume", queue, state, *jobs, *asJSON, stdout)
+}
+
+// --- upgrade ---
+
+const upgradeUsage = `Usage: freshbox upgrade [--all] [--dry-run] [name...]
+
+Lists the installed tools and apps that have a newer version. Pass names,
+or --all, to upgrade them with whatever installed them: brew upgrade,
+npm update -g or rustup update.
+
+Flags:
+`
+
+func runUpgrade(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("upgrade", stderr)
+	all := fs.Bool("all", false, "upgrade everything that is out of date")
+	asJSON := fs.Bool("json", false, "print the list or plan as JSON, or stream progress as JSON lines")
+	dryRun := fs.Bool("dry-run", false, "print the plan without executing it")
+	jobs := fs.Int("jobs", tasks.DefaultWorkers, "how many independent tasks to run at once")
+	timeout := fs.Duration("timeout", 0, "cancel any task still running after this long (default: 5-30m per task)")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, upgradeUsage)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	cat, err := tasks.DetectCatalog()
+	if err != nil {
+		return err
+	}
+	ctx, stop := interruptContext()
+	checker.CheckOutdated(ctx, cat.Items())
+	stop()
+	var outdated []*checker.Item
+	for _, item := range cat.Items() {
+		if item.Status == checker.Outdated {
+			outdated = append(outdated, item)
+		}
+	}
+
+	names := fs.Args()
+	if !*all && len(names) == 0 {
+		if len(outdated) == 0 {
+			fmt.Fprintln(stderr, "Everything is up to date.")
+			return nil
+		}
+		if *asJSON {
+			var results []checkResult
+			for _, item := range outdated {
+				results = append(results, newCheckResult(item))
+			}
+			enc := json.NewEncoder(stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(results)
+		}
+		tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tINSTALLED\tLATEST")
+		for _, item := range outdated {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", item.Name, item.Version, newCheckResult(item).upgradeTo())
+		}
+		tw.Flush()
+		fmt.Fprintln(stderr, "\nRun 'freshbox upgrade --all' or pass names to upgrade them.")
+		return nil
+	}
+
+	if *all {
+		for _, item := range outdated {
+			names = append(names, item.Name)
+		}
+	}
+	var sel tasks.Selection
+	if err := addNamedItems(&sel, cat, names); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if findItem(outdated, name) == nil {
+			return fmt.Errorf("%s is not installed or already up to date (see 'freshbox upgrade')", name)
+		}
+	}
+	normalizeSelection(&sel, cat)
+
+	queue, err := tasks.Build(sel, cat)
+	if err != nil {
+		return err
+	}
+	tasks.SetTimeout(queue, *timeout)
+	if *dryRun {
+		plan := tasks.NewPlan(queue)
+		if *asJSON {
+			return plan.WriteJSON(stdout)
+		}
+		plan.WriteText(stdout)
+		return nil
+	}
+	if len(queue) == 0 {
+		fmt.Fprintln(stderr, "Everything is up to date.")
+		return nil
+	}
+	return runQueue("upgrade", queue, tasks.NewRunState(sel, queue), *jobs, *asJSON, stdout)
+}
+
+// --- uninstall ---
+
+const uninstallUsage = `Usage: freshbox uninstall [--list] [--yes] [name...]
+
+Removes what freshbox added to this machine, and nothing that was there
+before it: Homebrew formulas and casks, the Codex / Claude Code npm
+packages, MCP servers it registered, files it created such as
+~/.local/bin/open-kaku.sh, and the Finder defaults it changed. Pass names
+(e.g. Zed, Playwright, finder) to remove only those.
+
+Without --yes the plan is printed and nothing is removed.
+
+Flags:
+`
+
+func runUninstall(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("uninstall", stderr)
+	list := fs.Bool("list", false, "list what freshbox added")
+	yes := fs.Bool("yes", false, "remove the items instead of printing the plan")
+	asJSON := fs.Bool("json", false, "print the list or plan as JSON, or stream progress as JSON lines")
+	jobs := fs.Int("jobs", tasks.DefaultWorkers, "how many independent tasks to run at once")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, uninstallUsage)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	entries, err := ledger.Load()
+	if err != nil {
+		return err
+	}
+	entries, unknown := tasks.FilterEntries(entries, fs.Args())
+	if len(unknown) > 0 {
+		return fmt.Errorf("freshbox did not add %s (see 'freshbox uninstall --list')", strings.Join(unknown, ", "))
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(stderr, "Nothing to uninstall: freshbox hasn't added anything yet.")
+		return nil
+	}
+
+	if *list {
+		if *asJSON {
+			enc := json.NewEncoder(stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(entries)
+		}
+		tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "KIND\tNAME\tRUN")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Kind, e.Title(), e.Run)
+		}
+		return tw.Flush()
+	}
+
+	queue := tasks.BuildUninstall(entries)
+	if !*yes {
+		plan := tasks.NewPlan(queue)
+		if *asJSON {
+			return plan.WriteJSON(stdout)
+		}
+		plan.WriteText(stdout)
+		fmt.Fprintln(stderr, "\nRun again with --yes to remove these.")
+		return nil
+	}
+	return runQueue("uninstall", queue, nil, *jobs, *asJSON, stdout)
+}
+
+// --- history ---
+
+const historyUsage = `Usage: freshbox history [--json] [run]
+
+Lists past install runs, newest first. Pass a run ID (or "last") to see
+every task and command it ran, with times, exit codes and errors.
+
+Flags:
+`
+
+func runHistory(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("history", stderr)
+	asJSON := fs.Bool("json", false, "print runs as JSON, or a run's raw JSON-lines records")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, historyUsage)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	if fs.NArg() == 1 {
+		records, err := history.Load(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			enc := json.NewEncoder(stdout)
+			for _, r := range records {
+				enc.Encode(r)
+			}
+			return nil
+		}
+		history.WriteRun(stdout, records)
+		return nil
+	}
+
+	runs, err := history.List()
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(runs)
+	}
+	if len(runs) == 0 {
+		fmt.Fprintln(stderr, "No runs recorded yet.")
+		return nil
+	}
+	history.WriteList(stdout, runs)
+	return nil
+}
+
+// --- restore ---
+
+const restoreUsage = `Usage: freshbox restore [--list] [run]
+
+Puts back every file a run changed, as it was before the run: config files
+are restored from ~/.freshbox/backups/<run>/ and files the run created are
+removed. Without a run ID the newest backup is restored.
+
+Flags:
+`
+
+func runRestore(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("restore", stderr)
+	list := fs.Bool("list", false, "list backups instead of restoring one")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, restoreUsage)
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errUsage
+	}
+
+	if *list {
+		all, err := backup.List()
+		if err != nil {
+			return err
+		}
+		if len(all) == 0 {
+			fmt.Fprintln(stderr, "No backups yet.")
+			return nil
+		}
+		backup.WriteList(stdout, all)
+		return nil
+	}
+
+	id := "last"
+	if fs.NArg() == 1 {
+		id = fs.Arg(0)
+	}
+	m, err := backup.Load(id)
+	if err != nil {
+		return err
+	}
+	done, err := backup.Restore(m)
+	for _, e := range done {
+		if e.Existed {
+			fmt.Fprintf(stdout, "restored %s\n", backup.Tilde(e.Path))
+		} else {
+			fmt.Fprintf(stdout, "removed  %s (created by the run)\n", backup.Tilde(e.Path))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Restored %d files from run %s\n", len(done), m.Run)
+	return nil
+}
+
+// readSelection loads a JSON selection file, or a TOML profile; "-" reads JSON from stdin
+func readSelection(path string) (tasks.Selection, error) {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		p, err := profile.Load(path)
+		if err != nil {
+			return tasks.Selection{}, err
+		}
+		return p.Selection(), nil
+	}
+
+	var sel tasks.Selection
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return sel, fmt.Errorf("read selection: %w", err)
+	}
+	if err := json.Unmarshal(data, &sel); err != nil {
+		return sel, fmt.Errorf("parse selection %s: %w", path, err)
+	}
+	return sel, nil
+}
+
+// mergeSelection overlays non-empty AI settings and profile from flags onto the file's selection
+func mergeSelection(base, flags tasks.Selection) tasks.Selection {
+	overlay := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	overlay(&base.Codex.Model, flags.Codex.Model)
+	overlay(&base.Codex.ThinkingLevel, flags.Codex.ThinkingLevel)
+	overlay(&base.Codex.BaseURL, flags.Codex.BaseURL)
+	overlay(&base.Codex.APIKey, flags.Codex.APIKey)
+	overlay(&base.Claude.Model, flags.Claude.Model)
+	overlay(&base.Claude.BaseURL, flags.Claude.BaseURL)
+	overlay(&base.Claude.APIKey, flags.Claude.APIKey)
+	overlay(&base.AIProfile, flags.AIProfile)
+	return base
+}
+
+// addNamedItems resolves positional names to catalog items and selects them
+func addNamedItems(sel *tasks.Selection, cat tasks.Catalog, names []string) error {
+	var all []*checker.Item
+	all = append(all, cat.DevTools...)
+	all = append(all, cat.Apps...)
+	all = append(all, cat.AITools...)
+	for _, name := range names {
+		item := findItem(all, name)
+		if item == nil {
+			return fmt.Errorf("unknown item %q (see 'freshbox check')", name)
+		}
+		switch item.Category {
+		case "dev":
+			sel.DevTools = append(sel.DevTools, item.Name)
+		case "app":
+			sel.Apps = append(sel.Apps, item.Name)
+		case "ai":
+			sel.AITools = append(sel.AITools, item.Name)
+		}
+	}
+	return nil
+}
+
+// normalizeSelection maps case-insensitive names onto catalog spelling and drops duplicates
+func normalizeSelection(sel *tasks.Selection, cat tasks.Catalog) {
+	canon := func(names []string, known []string) []string {
+		var out []string
+		seen := map[string]bool{}
+		for _, n := range names {
+			for _, k := range known {
+				if strings.EqualFold(n, k) {
+					n = k
+					break
+				}
+			}
+			if !seen[n] {
+				seen[n] = true
+				out = append(out, n)
+			}
+		}
+		return out
+	}
+	itemNames := func(items []*checker.Item) []string {
+		var out []string
+		for _, item := range items {
+			out = append(out, item.Name)
+		}
+		return out
+	}
+	var mcpNames []string
+	for _, s := range cat.MCPs {
+		mcpNames = append(mcpNames, s.Name)
+	}
+	sel.DevTools = canon(sel.DevTools, itemNames(cat.DevTools))
+	sel.Apps = canon(sel.Apps, itemNames(cat.Apps))
+	sel.AITools = canon(sel.AITools, itemNames(cat.AITools))
+	sel.NodeVersions = canon(sel.NodeVersions, nil)
+	sel.MCPs = canon(sel.MCPs, mcpNames)
+	sel.ExtraSetup = canon(sel.ExtraSetup, tasks.ExtraSetupKeys())
+	sel.SysDefaults = canon(sel.SysDefaults, tasks.SysDefaultKeys())
+}
+
+// markForReinstall flags selected items so Build queues them even if installed
+func markForReinstall(sel tasks.Selection, cat tasks.Catalog) {
+	var names []string
+	names = append(names, sel.DevTools...)
+	names = append(names, sel.Apps...)
+	names = append(names, sel.AITools...)
+	for _, items := range [][]*checker.Item{cat.DevTools, cat.Apps, cat.AITools} {
+		for _, item := range items {
+			if slices.Contains(names, item.Name) {
+				item.Reinstall = true
+			}
+		}
+	}
+}
+
+// findItem matches a catalog item by name, command or brew name (case-insensitive)
+func findItem(items []*checker.Item, name string) *checker.Item {
+	for _, item := range items {
+		if strings.EqualFold(item.Name, name) || strings.EqualFold(item.Cmd, name) ||
+			(item.BrewName != "" && strings.EqualFold(item.BrewName, name)) {
+			return item
+		}
+	}
+	return nil
+}
+
+// --- config ---
+
+const configUsage = `Usage:
+  freshbox config codex  [--model M] [--think LEVEL] [--base-url URL] [--api-key KEY] [--plaintext]
+  freshbox config claude [--model M] [--base-url URL] [--api-key KEY] [--plaintext]
+  freshbox config mcp    --target claude|codex [--servers a,b,c] [--env NAME=VALUE]
+`
+
+func runConfig(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, configUsage)
+		return errUsage
+	}
+	target, args := args[0], args[1:]
+	// files a config command changes are backed up like an install's
+	ctx, stop := interruptContext()
+	defer stop()
+	ctx = backup.WithRun(ctx, backup.Start(""))
+
+	switch target {
+	case "codex":
+		fs := newFlagSet("config codex", stderr)
+		model := fs.String("model", "", "model name, e.g. o4-mini")
+		think := fs.String("think", "", "reasoning effort: low, medium or high")
+		baseURL := fs.String("base-url", "", "API base URL")
+		apiKey := fs.String("api-key", "", "API key (kept in the Keychain and exported as $"+config.CodexKeyEnv+")")
+		plaintext := fs.Bool("plaintext", false, "write the API key to ~/.codex/auth.json instead")
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+		redact.Add(*apiKey)
+		cfg := config.CodexConfig{
+			Model:         *model,
+			ThinkingLevel: *think,
+			BaseURL:       *baseURL,
+		}
+		if *apiKey != "" && !*plaintext {
+			cfg.EnvKey = config.CodexKeyEnv
+		}
+		if err := config.WriteCodexConfig(ctx, cfg); err != nil {
+			return err
+		}
+		switch {
+		case *apiKey == "":
+		case *plaintext:
+			if err := config.WriteCodexAuth(ctx, config.CodexAuth{APIKey: *apiKey}); err != nil {
+				return err
+			}
+		default:
+			if err := config.StoreCodexKey(ctx, *apiKey); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "API key stored in %s; open a new shell to pick up $%s\n",
+				secrets.Default().Where(secrets.CodexAPIKey), config.CodexKeyEnv)
+		}
+		fmt.Fprintln(stdout, "Codex configuration written")
+
+	case "claude":
+		fs := newFlagSet("config claude", stderr)
+		model := fs.String("model", "", "model name, e.g. claude-sonnet-4-6")
+		baseURL := fs.String("base-url", "", "API base URL")
+		apiKey := fs.String("api-key", "", "API key (kept in the Keychain and read through apiKeyHelper)")
+		plaintext := fs.Bool("plaintext", false, "write the API key to ~/.claude/settings.json instead")
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+		redact.Add(*apiKey)
+		err := config.WriteClaudeConfig(ctx, config.ClaudeConfig{
+			Model:     *model,
+			BaseURL:   *baseURL,
+			APIKey:    *apiKey,
+			Plaintext: *plaintext,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "Claude Code configuration written")
+
+	case "mcp":
+		fs := newFlagSet("config mcp", stderr)
+		tool := fs.String("target", "", "tool to configure: claude or codex")
+		names := fs.String("servers", "", "comma-separated MCP server names (default: all)")
+		env := envFlag{}
+		fs.Var(env, "env", "`NAME=VALUE` for a variable a server needs, if not set in the environment (repeatable)")
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+		if *tool == "" {
+			fmt.Fprint(stderr, configUsage)
+			return errUsage
+		}
+		servers, err := selectMCPs(*names)
+		if err != nil {
+			return err
+		}
+		if missing := config.FillEnv(servers, env); len(missing) > 0 {
+			if *names != "" {
+				return fmt.Errorf("MCP servers need %s: set them in the environment or pass --env NAME=VALUE", strings.Join(missing, ", "))
+			}
+			// all servers: leave out the ones that can't work yet
+			servers = slices.DeleteFunc(servers, func(s config.MCPServer) bool { return len(s.EnvPairs()) < len(s.Needs) })
+			fmt.Fprintf(stderr, "Skipping MCP servers with no value for %s; set them in the environment or pass --env NAME=VALUE.\n", strings.Join(missing, ", "))
+		}
+		if err := config.WriteMCPConfig(ctx, servers, *tool); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "%d MCP servers configured for %s\n", len(servers), *tool)
+
+	default:
+		fmt.Fprintf(stderr, "unknown config target %q\n\n%s", target, configUsage)
+		return errUsage
+	}
+	return nil
+}
+
+// --- ai ---
+
+const aiUsage = `Usage:
+  freshbox ai [list]
+  freshbox ai add <profile> [--codex-model M] [--codex-think LEVEL] [--codex-base-url URL]
+                  [--codex-api-key KEY | --codex-key-ref NAME]
+                  [--claude-model M] [--claude-base-url URL]
+                  [--claude-api-key KEY | --claude-key-ref NAME]
+  freshbox ai use <profile> [--tool codex|claude]
+  freshbox ai remove <profile>
+
+Profiles are kept in ~/.freshbox/providers.json and their API keys in the
+Keychain. 'use' rewrites ~/.codex/config.toml and ~/.claude/settings.json
+together, so a failure leaves both on the previous profile.
+`
+
+func runAI(args []string, stdout, stderr io.Writer) error {
+	cmd := "list"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+	ctx, stop := interruptContext()
+	defer stop()
+
+	switch cmd {
+	case "list":
+		if len(args) > 0 {
+			fmt.Fprint(stderr, aiUsage)
+			return errUsage
+		}
+		set, err := providers.Load()
+		if err != nil {
+			return err
+		}
+		if len(set.Profiles) == 0 {
+			fmt.Fprintln(stderr, "No AI provider profiles yet; add one with 'freshbox ai add'.")
+			return nil
+		}
+		writeProfiles(stdout, set)
+
+	case "add":
+		if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+			fmt.Fprint(stderr, aiUsage)
+			return errUsage
+		}
+		name, args := args[0], args[1:]
+		fs := newFlagSet("ai add", stderr)
+		codex := providers.Settings{}
+		claude := providers.Settings{}
+		var codexKey, claudeKey string
+		fs.StringVar(&codex.Model, "codex-model", "", "Codex model, e.g. gpt-5")
+		fs.StringVar(&codex.ThinkingLevel, "codex-think", "", "Codex reasoning effort: low, medium or high")
+		fs.StringVar(&codex.BaseURL, "codex-base-url", "", "Codex API base URL (default: the OpenAI API)")
+		fs.StringVar(&codexKey, "codex-api-key", "", "Codex API key, kept in the Keychain")
+		fs.StringVar(&codex.KeyRef, "codex-key-ref", "", "name of a key already in the Keychain, e.g. "+secrets.CodexAPIKey)
+		fs.StringVar(&claude.Model, "claude-model", "", "Claude Code model, e.g. claude-sonnet-4-6")
+		fs.StringVar(&claude.BaseURL, "claude-base-url", "", "Claude Code API base URL (default: the Anthropic API)")
+		fs.StringVar(&claudeKey, "claude-api-key", "", "Claude Code API key, kept in the Keychain")
+		fs.StringVar(&claude.KeyRef, "claude-key-ref", "", "name of a key already in the Keychain, e.g. "+secrets.ClaudeAPIKey)
+		fs.Usage = func() {
+			fmt.Fprint(stderr, aiUsage+"\nFlags for add:\n")
+			fs.PrintDefaults()
+		}
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+		redact.Add(codexKey, claudeKey)
+		// a tool is part of the profile when any of its flags is given
+		set := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { set[strings.SplitN(f.Name, "-", 2)[0]] = true })
+		p := providers.Profile{Name: name}
+		if set[providers.Codex] {
+			p.Codex = &codex
+		}
+		if set[providers.Claude] {
+			p.Claude = &claude
+		}
+		if (codexKey != "" && codex.KeyRef != "") || (claudeKey != "" && claude.KeyRef != "") {
+			return errors.New("give an API key or a key reference, not both")
+		}
+		keys := map[string]string{providers.Codex: codexKey, providers.Claude: claudeKey}
+		for tool, key := range keys {
+			if key != "" && p.For(tool) != nil {
+				p.For(tool).KeyRef = providers.KeyRef(name, tool)
+			}
+		}
+		profiles, err := providers.Load()
+		if err != nil {
+			return err
+		}
+		if err := profiles.Put(p); err != nil {
+			return err
+		}
+		store := secrets.Default()
+		for tool, key := range keys {
+			if key == "" {
+				continue
+			}
+			if err := store.Set(ctx, providers.KeyRef(name, tool), key); err != nil {
+				return err
+			}
+		}
+		if err := profiles.Save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Saved AI provider profile %q; switch to it with 'freshbox ai use %s'\n", name, name)
+
+	case "use":
+		if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+			fmt.Fprint(stderr, aiUsage)
+			return errUsage
+		}
+		name, args := args[0], args[1:]
+		fs := newFlagSet("ai use", stderr)
+		tool := fs.String("tool", "", "switch only codex or claude (default: every tool the profile has)")
+		if err := parseFlags(fs, args); err != nil {
+			return err
+		}
+		var only []string
+		if *tool != "" {
+			if !slices.Contains(providers.Tools, *tool) {
+				fmt.Fprintf(stderr, "unknown tool %q\n\n%s", *tool, aiUsage)
+				return errUsage
+			}
+			only = []string{*tool}
+		}
+		// the config files are backed up like an install's
+		ctx = backup.WithRun(ctx, backup.Start(""))
+		switched, err := providers.Use(ctx, name, only...)
+		if err != nil {
+			return err
+		}
+		set, _ := providers.Load()
+		p, _ := set.Find(name)
+		for _, tool := range switched {
+			fmt.Fprintf(stdout, "%-6s → %s (%s)\n", tool, name, p.For(tool))
+		}
+		if slices.Contains(switched, providers.Codex) && p.Codex.KeyRef != "" {
+			fmt.Fprintf(stdout, "Open a new shell for Codex to pick up $%s\n", config.CodexKeyEnv)
+		}
+
+	case "remove":
+		if len(args) != 1 {
+			fmt.Fprint(stderr, aiUsage)
+			return errUsage
+		}
+		name := args[0]
+		set, err := providers.Load()
+		if err != nil {
+			return err
+		}
+		p, ok := set.Find(name)
+		if !ok {
+			return fmt.Errorf("no AI provider profile %q", name)
+		}
+		set.Remove(name)
+		if err := set.Save(); err != nil {
+			return err
+		}
+		// keys 'ai add' stored for the profile go with it; referenced ones stay
+		store := secrets.Default()
+		for _, tool := range p.Tools() {
+			if ref := providers.KeyRef(name, tool); p.For(tool).KeyRef == ref {
+				if err := store.Delete(ctx, ref); err != nil {
+					return err
+				}
+			}
+		}
+		fmt.Fprintf(stdout, "Removed AI provider profile %q; the tools' config files are unchanged\n", name)
+
+	default:
+		fmt.Fprintf(stderr, "unknown ai command %q\n\n%s", cmd, aiUsage)
+		return errUsage
+	}
+	return nil
+}
+
+// writeProfiles prints a table of profiles with a * on the one each tool uses
+func writeProfiles(w io.Writer, set providers.Set) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROFILE\tCODEX\tCLAUDE")
+	for _, p := range set.Profiles {
+		cols := []string{p.Name}
+		for _, tool := range providers.Tools {
+			col := "-"
+			if s := p.For(tool); s != nil {
+				col = s.String()
+				if set.Active[tool] == p.Name {
+					col = "* " + col
+				}
+			}
+			cols = append(cols, col)
+		}
+		fmt.Fprintln(tw, strings.Join(cols, "\t"))
+	}
+	tw.Flush()
+	for _, tool := range providers.Tools {
+		active := set.Active[tool]
+		if active == "" {
+			active = "(none)"
+		}
+		fmt.Fprintf(w, "active for %s: %s\n", tool, active)
+	}
+}
+
+// selectMCPs resolves a comma-separated list of MCP names; empty means all
+func selectMCPs(names string) ([]config.MCPServer, error) {
+	cat, err := tasks.LoadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	all := cat.MCPs
+	if strings.TrimSpace(names) == "" {
+		return all, nil
+	}
+	var out []config.MCPServer
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, s := range all {
+			if strings.EqualFold(s.Name, name) {
+				out = append(out, s)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown MCP server %q", name)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,772 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kittors/freshbox/internal/checker"
+	"github.com/kittors/freshbox/internal/ledger"
+	"github.com/kittors/freshbox/internal/runner"
+	"github.com/kittors/freshbox/internal/tasks"
+	"github.com/kittors/freshbox/internal/version"
+)
+
+func runArgs(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestVersionCommand(t *testing.T) {
+	code, out, _ := runArgs("version")
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+	if strings.TrimSpace(out) != version.Version {
+		t.Errorf("version output = %q, want %q", out, version.Version)
+	}
+}
+
+func TestHelpCommand(t *testing.T) {
+	code, out, _ := runArgs("help")
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+	for _, cmd := range []string{"tui", "check", "install", "upgrade", "config", "ai", "version"} {
+		if !strings.Contains(out, cmd) {
+			t.Errorf("usage missing command %q", cmd)
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	code, _, errOut := runArgs("frobnicate")
+	if code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+	if !strings.Contains(errOut, "unknown command") {
+		t.Errorf("stderr = %q, want unknown command message", errOut)
+	}
+}
+
+func TestCheckUnknownCategory(t *testing.T) {
+	code, _, errOut := runArgs("check", "--category", "nope")
+	if code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if !strings.Contains(errOut, "unknown category") {
+		t.Errorf("stderr = %q", errOut)
+	}
+}
+
+func TestCheckJSON(t *testing.T) {
+	code, out, _ := runArgs("check", "--category", "ai", "--json")
+	if code != 0 {
+		t.Fatalf("exit code = %d, want 0", code)
+	}
+	var results []checkResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, out)
+	}
+	if len(results) != len(checker.AITools()) {
+		t.Errorf("got %d results, want %d", len(results), len(checker.AITools()))
+	}
+	for _, r := range results {
+		if r.Category != "ai" {
+			t.Errorf("%s: category = %q, want ai", r.Name, r.Category)
+		}
+	}
+}
+
+func TestCheckReportsTooOld(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer runner.Use(runner.NewFake().
+		Path("java", "/opt/homebrew/bin/java").
+		On("/opt/homebrew/bin/java --version", runner.Response{Stdout: "openjdk 17.0.10 2024-01-16\n"}))()
+
+	code, out, _ := runArgs("check", "--category", "dev", "--json")
+	var results []checkResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil || code != 0 {
+		t.Fatalf("code=%d err=%v\n%s", code, err, out)
+	}
+	var java checkResult
+	for _, r := range results {
+		if r.Name == "Java (JDK)" {
+			java = r
+		}
+	}
+	if !java.Installed || !java.Outdated || java.Semver != "17.0.10" || java.Min != "21" {
+		t.Errorf("java = %+v", java)
+	}
+
+	if _, out, _ := runArgs("check", "--category", "dev"); !strings.Contains(out, "↑ dev  Java (JDK)  (openjdk 17.0.10 2024-01-16 → ≥ 21)") {
+		t.Errorf("text output:\n%s", out)
+	}
+}
+
+func TestTeamCatalogAddsAndHidesItems(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	team := filepath.Join(t.TempDir(), "team.toml")
+	os.WriteFile(team, []byte(`
+[[tool]]
+name = "ripgrep"
+category = "dev"
+desc = "Fast grep"
+cmd = "rg"
+install = "brew"
+package = "ripgrep"
+
+[[tool]]
+name = "Tabby"
+hidden = true
+`), 0644)
+	t.Setenv("FRESHBOX_CATALOG", team)
+
+	code, out, stderr := runArgs("plan", "--json", "ripgrep")
+	var p tasks.Plan
+	if err := json.Unmarshal([]byte(out), &p); err != nil || code != 0 {
+		t.Fatalf("code=%d err=%v stderr=%s", code, err, stderr)
+	}
+	if len(p.Steps) != 1 || p.Steps[0].Commands[0] != "brew install ripgrep" {
+		t.Errorf("plan = %+v", p)
+	}
+	if _, out, _ := runArgs("check", "--category", "app"); strings.Contains(out, "Tabby") {
+		t.Errorf("hidden app is still listed:\n%s", out)
+	}
+
+	os.WriteFile(team, []byte("[[tool]]\nname = \"ripgrep\"\n"), 0644)
+	if code, _, stderr := runArgs("check"); code != 1 || !strings.Contains(stderr, `tool "ripgrep"`) {
+		t.Errorf("invalid catalog: code=%d stderr=%s", code, stderr)
+	}
+}
+
+func TestInstallRequiresNames(t *testing.T) {
+	code, _, _ := runArgs("install")
+	if code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
+
+func TestInstallUnknownItem(t *testing.T) {
+	code, _, errOut := runArgs("install", "freshbox-not-a-tool")
+	if code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if !strings.Contains(errOut, "unknown item") {
+		t.Errorf("stderr = %q", errOut)
+	}
+}
+
+func TestPlanJSONRunsNothing(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	code, out, stderr := runArgs("plan", "--json", "--defaults", "editor_zed")
+	if code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr)
+	}
+	var p tasks.Plan
+	if err := json.Unmarshal([]byte(out), &p); err != nil {
+		t.Fatalf("invalid plan JSON: %v\n%s", err, out)
+	}
+	if len(p.Steps) != 1 || !strings.Contains(p.Steps[0].Commands[0], "dev.zed.Zed") {
+		t.Errorf("plan = %+v", p)
+	}
+}
+
+func TestInstallDryRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	code, out, _ := runArgs("install", "--dry-run", "--defaults", "editor_zed")
+	if code != 0 || !strings.Contains(out, "plan — 1 tasks") {
+		t.Errorf("dry run: code=%d out=%s", code, out)
+	}
+}
+
+func TestResumeNothingSaved(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	code, _, stderr := runArgs("resume")
+	if code != 0 || !strings.Contains(stderr, "Nothing to resume") {
+		t.Errorf("code=%d stderr=%s", code, stderr)
+	}
+}
+
+func TestResumeRunsUnfinishedTasks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := runner.NewFake()
+	defer runner.Use(f)()
+
+	sel := tasks.Selection{SysDefaults: []string{tasks.DefaultEditorZed, tasks.DefaultPlayerIINA}}
+	queue, err := tasks.Build(sel, tasks.Catalog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := tasks.NewRunState(sel, queue)
+	state.Mark(queue[0].ID, tasks.StatusOK, nil)
+	state.Mark(queue[1].ID, tasks.StatusFailed, errors.New("boom"))
+	state.Save()
+
+	code, out, stderr := runArgs("resume")
+	if code != 0 {
+		t.Fatalf("code=%d stderr=%s", code, stderr)
+	}
+	if strings.Contains(out, queue[0].Name) || !strings.Contains(out, "[ OK ] "+queue[1].Name) {
+		t.Errorf("resume should run only the failed task:\n%s", out)
+	}
+	if s, _ := tasks.LoadState(); s != nil {
+		t.Error("state should be cleared after a clean resume")
+	}
+}
+
+func TestResumeDiscard(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tasks.NewRunState(tasks.Selection{}, []tasks.Task{{ID: "x", Name: "X"}}).Save()
+	if code, _, _ := runArgs("resume", "--discard"); code != 0 {
+		t.Fatalf("exit code = %d", code)
+	}
+	if s, _ := tasks.LoadState(); s != nil {
+		t.Error("--discard should delete the state")
+	}
+}
+
+// filesContaining lists the files under root, relative to it, that contain s
+func filesContaining(t *testing.T, root, s string) []string {
+	t.Helper()
+	var found []string
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if data, _ := os.ReadFile(path); strings.Contains(string(data), s) {
+			rel, _ := filepath.Rel(root, path)
+			found = append(found, rel)
+		}
+		return nil
+	})
+	return found
+}
+
+func TestInstallKeepsKeysOutOfLogs(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	const key = "proxy-key-that-matches-no-pattern"
+	f := runner.NewFake().On("brew install --cask zed", runner.Response{
+		Stderr: "Error: download with token " + key + " rejected", ExitCode: 1,
+	})
+	defer runner.Use(f)()
+
+	code, out, stderr := runArgs("install", "--claude-api-key", key, "zed")
+	if code != 1 {
+		t.Fatalf("code=%d stderr=%s", code, stderr)
+	}
+	if strings.Contains(out+stderr, key) {
+		t.Errorf("key printed to the terminal:\n%s%s", out, stderr)
+	}
+	if !strings.Contains(out, "token [REDACTED] rejected") {
+		t.Errorf("failure should still show the masked error:\n%s", out)
+	}
+	if got := filesContaining(t, home, key); len(got) != 1 || got[0] != filepath.Join(".freshbox", "secrets", "claude-api-key") {
+		t.Errorf("key found in %v, want only the secret store", got)
+	}
+
+	// with --plaintext-keys the key's only copy is the Claude settings
+	os.RemoveAll(home)
+	if code, _, stderr := runArgs("install", "--plaintext-keys", "--claude-api-key", key, "zed"); code != 1 {
+		t.Fatalf("code=%d stderr=%s", code, stderr)
+	}
+	if got := filesContaining(t, home, key); len(got) != 1 || got[0] != filepath.Join(".claude", "settings.json") {
+		t.Errorf("key found in %v, want only .claude/settings.json", got)
+	}
+}
+
+func TestHistoryNothingRecorded(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	code, out, stderr := runArgs("history")
+	if code != 0 || out != "" || !strings.Contains(stderr, "No runs recorded") {
+		t.Errorf("code=%d out=%q stderr=%s", code, out, stderr)
+	}
+	if code, _, stderr := runArgs("history", "last"); code != 1 || !strings.Contains(stderr, "no runs") {
+		t.Errorf("history last: code=%d stderr=%s", code, stderr)
+	}
+}
+
+func TestHistoryListsAndShowsRuns(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := runner.NewFake()
+	defer runner.Use(f)()
+
+	sel := tasks.Selection{SysDefaults: []string{tasks.DefaultEditorZed}}
+	queue, err := tasks.Build(sel, tasks.Catalog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks.NewRunState(sel, queue).Save()
+	if code, _, stderr := runArgs("resume"); code != 0 {
+		t.Fatalf("resume: code=%d stderr=%s", code, stderr)
+	}
+
+	code, out, stderr := runArgs("history")
+	if code != 0 {
+		t.Fatalf("code=%d stderr=%s", code, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "resume") {
+		t.Fatalf("history should list one resume run:\n%s", out)
+	}
+	id := strings.Fields(lines[1])[0]
+
+	code, out, stderr = runArgs("history", id)
+	if code != 0 {
+		t.Fatalf("code=%d stderr=%s", code, stderr)
+	}
+	if !strings.Contains(out, "Run "+id) || !strings.Contains(out, "✓ "+queue[0].Name) || !strings.Contains(out, "$ "+f.Cmdlines()[0]) {
+		t.Errorf("history %s should show the task and its commands:\n%s", id, out)
+	}
+
+	code, out, _ = runArgs("history", "--json", "last")
+	if code != 0 || !strings.Contains(out, `"type":"command"`) || !strings.Contains(out, `"run":"`+id+`"`) {
+		t.Errorf("history --json last:\n%s", out)
+	}
+}
+
+func TestRestoreUndoesConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	settings := filepath.Join(home, ".claude", "settings.json")
+	os.MkdirAll(filepath.Dir(settings), 0755)
+	os.WriteFile(settings, []byte(`{"model": "hand-picked"}`), 0600)
+
+	if code, _, stderr := runArgs("restore"); code != 1 || !strings.Contains(stderr, "no backups") {
+		t.Errorf("restore without backups: code=%d stderr=%s", code, stderr)
+	}
+	if code, _, stderr := runArgs("config", "claude", "--model", "claude-opus-4-1"); code != 0 {
+		t.Fatalf("config: code=%d stderr=%s", code, stderr)
+	}
+	if code, _, stderr := runArgs("config", "codex", "--model", "o3"); code != 0 {
+		t.Fatalf("config: code=%d stderr=%s", code, stderr)
+	}
+
+	code, out, _ := runArgs("restore", "--list")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if code != 0 || len(lines) != 3 {
+		t.Fatalf("restore --list should show two backups:\n%s", out)
+	}
+	claudeRun := strings.Fields(lines[2])[0]
+	// the newest backup is the codex one, which created config.toml
+	code, out, stderr := runArgs("restore")
+	if code != 0 || !strings.Contains(out, "removed  ~/.codex/config.toml") {
+		t.Fatalf("restore: code=%d stderr=%s\n%s", code, stderr, out)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".codex", "config.toml")); !os.IsNotExist(err) {
+		t.Error("config.toml should be removed")
+	}
+
+	if code, out, _ := runArgs("restore", claudeRun); code != 0 || !strings.Contains(out, "restored ~/.claude/settings.json") {
+		t.Errorf("restore %s: code=%d\n%s", claudeRun, code, out)
+	}
+	if data, _ := os.ReadFile(settings); string(data) != `{"model": "hand-picked"}` {
+		t.Errorf("settings.json = %s", data)
+	}
+}
+
+func TestUninstallRemovesOnlyWhatFreshboxAdded(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	f := runner.NewFake()
+	defer runner.Use(f)()
+
+	if code, _, stderr := runArgs("uninstall"); code != 0 || !strings.Contains(stderr, "Nothing to uninstall") {
+		t.Errorf("empty ledger: code=%d stderr=%s", code, stderr)
+	}
+
+	script := filepath.Join(home, ".local", "bin", "open-kaku.sh")
+	os.MkdirAll(filepath.Dir(script), 0755)
+	os.WriteFile(script, []byte("#!/bin/bash\n"), 0755)
+	ledger.Add(context.Background(),
+		ledger.Entry{Kind: ledger.KindCask, Name: "zed", Label: "Zed"},
+		ledger.Entry{Kind: ledger.KindFile, Name: script},
+	)
+
+	code, out, _ := runArgs("uninstall", "--list")
+	if code != 0 || !strings.Contains(out, "Zed") || !strings.Contains(out, "~/.local/bin/open-kaku.sh") {
+		t.Errorf("--list: code=%d\n%s", code, out)
+	}
+	if code, _, stderr := runArgs("uninstall", "Slack"); code != 1 || !strings.Contains(stderr, "did not add Slack") {
+		t.Errorf("unknown name: code=%d stderr=%s", code, stderr)
+	}
+
+	// without --yes it only prints the plan
+	code, out, _ = runArgs("uninstall")
+	if code != 0 || !strings.Contains(out, "brew uninstall --cask zed") || len(f.Cmdlines()) != 0 {
+		t.Fatalf("plan: code=%d ran=%v\n%s", code, f.Cmdlines(), out)
+	}
+	if _, err := os.Stat(script); err != nil {
+		t.Fatal("the plan must not remove anything")
+	}
+
+	if code, _, stderr := runArgs("uninstall", "--yes", "zed"); code != 0 {
+		t.Fatalf("uninstall zed: code=%d stderr=%s", code, stderr)
+	}
+	if got := strings.Join(f.Cmdlines(), ","); got != "brew uninstall --cask zed" {
+		t.Errorf("ran %s", got)
+	}
+	if _, err := os.Stat(script); err != nil {
+		t.Error("open-kaku.sh wasn't picked and should stay")
+	}
+	if entries, _ := ledger.Load(); len(entries) != 1 || entries[0].Kind != ledger.KindFile {
+		t.Errorf("ledger = %+v", entries)
+	}
+	if s, _ := tasks.LoadState(); s != nil {
+		t.Error("an uninstall must not leave resumable install state")
+	}
+
+	if code, _, stderr := runArgs("uninstall", "--yes"); code != 0 {
+		t.Fatalf("uninstall: code=%d stderr=%s", code, stderr)
+	}
+	if _, err := os.Stat(script); !os.IsNotExist(err) {
+		t.Error("open-kaku.sh should be removed")
+	}
+}
+
+// upgradeFake has Homebrew and Git installed, with Git out of date
+func upgradeFake(outdated string) *runner.Fake {
+	return runner.NewFake().
+		Path("brew", "/opt/homebrew/bin/brew").
+		Path("git", "/opt/homebrew/bin/git").
+		On("/opt/homebrew/bin/brew --version", runner.Response{Stdout: "Homebrew 4.2.0\n"}).
+		On("/opt/homebrew/bin/git --version", runner.Response{Stdout: "git version 2.39.3\n"}).
+		On("brew outdated --json=v2", runner.Response{Stdout: outdated})
+}
+
+const gitOutdated = `{"formulae": [{"name": "git", "installed_versions": ["2.39.3"], "current_version": "2.44.0"}], "casks": []}`
+
+func TestUpgradeListsOutdated(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer runner.Use(upgradeFake(`{"formulae": [], "casks": []}`))()
+	if code, out, stderr := runArgs("upgrade"); code != 0 || out != "" || !strings.Contains(stderr, "Everything is up to date") {
+		t.Errorf("up to date: code=%d out=%s stderr=%s", code, out, stderr)
+	}
+
+	defer runner.Use(upgradeFake(gitOutdated))()
+	code, out, stderr := runArgs("upgrade")
+	if code != 0 || !strings.Contains(out, "Git") || !strings.Contains(out, "2.44.0") || !strings.Contains(stderr, "--all") {
+		t.Errorf("list: code=%d out=%s stderr=%s", code, out, stderr)
+	}
+	code, out, _ = runArgs("upgrade", "--json")
+	var results []checkResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil || code != 0 {
+		t.Fatalf("--json: code=%d err=%v\n%s", code, err, out)
+	}
+	if len(results) != 1 || !results[0].Outdated || results[0].Version != "2.39.3" || results[0].Latest != "2.44.0" {
+		t.Errorf("--json = %+v", results)
+	}
+}
+
+func TestUpgradeDryRunAndAll(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := upgradeFake(gitOutdated)
+	defer runner.Use(f)()
+
+	code, out, _ := runArgs("upgrade", "--dry-run", "--all")
+	if code != 0 || !strings.Contains(out, "Upgrade Git 2.39.3 → 2.44.0") || !strings.Contains(out, "brew upgrade git") {
+		t.Errorf("dry run: code=%d\n%s", code, out)
+	}
+	if strings.Contains(strings.Join(f.Cmdlines(), "\n"), "brew upgrade") {
+		t.Fatal("--dry-run must not upgrade anything")
+	}
+
+	if code, _, stderr := runArgs("upgrade", "Go"); code != 1 || !strings.Contains(stderr, "already up to date") {
+		t.Errorf("Go isn't outdated: code=%d stderr=%s", code, stderr)
+	}
+	if code, _, stderr := runArgs("upgrade", "frobnicate"); code != 1 || !strings.Contains(stderr, "unknown item") {
+		t.Errorf("unknown name: code=%d stderr=%s", code, stderr)
+	}
+
+	if code, _, stderr := runArgs("upgrade", "--all"); code != 0 {
+		t.Fatalf("--all: code=%d stderr=%s", code, stderr)
+	}
+	if !strings.Contains(strings.Join(f.Cmdlines(), "\n"), "brew upgrade git") {
+		t.Errorf("ran %v", f.Cmdlines())
+	}
+	if entries, _ := ledger.Load(); len(entries) != 0 {
+		t.Errorf("an upgrade adds nothing to the ledger: %+v", entries)
+	}
+
+	f.On("brew upgrade git", runner.Response{Stderr: "Error: offline", ExitCode: 1})
+	if code, out, _ := runArgs("upgrade", "git"); code != 1 || !strings.Contains(out, "[FAIL] Upgrade Git") {
+		t.Errorf("failed upgrade: code=%d, want 1\n%s", code, out)
+	}
+}
+
+func TestFindItem(t *testing.T) {
+	items, _ := catalogItems("")
+	tests := map[string]string{
+		"git":             "Git",
+		"Rust (rustup)":   "Rust (rustup)",
+		"openjdk":         "Java (JDK)",
+		"google-chrome":   "Google Chrome",
+		"CLAUDE":          "Claude Code",
+		"tw93/tap/kakuku": "Kaku",
+	}
+	for query, want := range tests {
+		item := findItem(items, query)
+		if item == nil {
+			t.Errorf("findItem(%q) = nil, want %s", query, want)
+			continue
+		}
+		if item.Name != want {
+			t.Errorf("findItem(%q) = %s, want %s", query, item.Name, want)
+		}
+	}
+}
+
+func TestListFlag(t *testing.T) {
+	var l listFlag
+	l.Set("Git, Go")
+	l.Set("Bun")
+	l.Set(" ,")
+	want := []string{"Git", "Go", "Bun"}
+	if strings.Join(l, "|") != strings.Join(want, "|") {
+		t.Errorf("listFlag = %v, want %v", l, want)
+	}
+}
+
+func TestReadSelection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sel.json")
+	os.WriteFile(path, []byte(`{"dev_tools":["Git"],"mcps":["Playwright"],"codex":{"model":"o3"}}`), 0644)
+
+	sel, err := readSelection(path)
+	if err != nil {
+		t.Fatalf("readSelection failed: %v", err)
+	}
+	if len(sel.DevTools) != 1 || sel.DevTools[0] != "Git" {
+		t.Errorf("DevTools = %v", sel.DevTools)
+	}
+	if sel.Codex.Model != "o3" {
+		t.Errorf("Codex.Model = %q", sel.Codex.Model)
+	}
+
+	os.WriteFile(path, []byte(`{not json`), 0644)
+	if _, err := readSelection(path); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestMergeSelection(t *testing.T) {
+	base := tasks.Selection{Codex: tasks.CodexSettings{Model: "o3", BaseURL: "https://a"}}
+	flags := tasks.Selection{Codex: tasks.CodexSettings{BaseURL: "https://b"}}
+	got := mergeSelection(base, flags)
+	if got.Codex.Model != "o3" {
+		t.Errorf("model from file should be kept, got %q", got.Codex.Model)
+	}
+	if got.Codex.BaseURL != "https://b" {
+		t.Errorf("flag should override base URL, got %q", got.Codex.BaseURL)
+	}
+}
+
+func TestNormalizeSelection(t *testing.T) {
+	cat := tasks.Catalog{
+		DevTools: checker.DevTools(),
+		Apps:     checker.Apps(),
+		AITools:  checker.AITools(),
+	}
+	sel := tasks.Selection{
+		DevTools:    []string{"git", "Git", "GO"},
+		AITools:     []string{"claude code"},
+		SysDefaults: []string{"EDITOR_ZED"},
+	}
+	normalizeSelection(&sel, cat)
+	if strings.Join(sel.DevTools, ",") != "Git,Go" {
+		t.Errorf("DevTools = %v, want [Git Go]", sel.DevTools)
+	}
+	if len(sel.AITools) != 1 || sel.AITools[0] != "Claude Code" {
+		t.Errorf("AITools = %v", sel.AITools)
+	}
+	if len(sel.SysDefaults) != 1 || sel.SysDefaults[0] != tasks.DefaultEditorZed {
+		t.Errorf("SysDefaults = %v", sel.SysDefaults)
+	}
+}
+
+func TestAddNamedItems(t *testing.T) {
+	cat := tasks.Catalog{
+		DevTools: checker.DevTools(),
+		Apps:     checker.Apps(),
+		AITools:  checker.AITools(),
+	}
+	var sel tasks.Selection
+	if err := addNamedItems(&sel, cat, []string{"git", "zed", "codex"}); err != nil {
+		t.Fatalf("addNamedItems failed: %v", err)
+	}
+	if len(sel.DevTools) != 1 || len(sel.Apps) != 1 || len(sel.AITools) != 1 {
+		t.Errorf("selection = %+v", sel)
+	}
+	if err := addNamedItems(&sel, cat, []string{"nope"}); err == nil {
+		t.Error("expected error for unknown item")
+	}
+}
+
+func TestConfigCodexWritesFiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	code, _, errOut := runArgs("config", "codex", "--model", "o3", "--think", "high", "--api-key", "sk-test", "--plaintext")
+	if code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, errOut)
+	}
+	data, err := os.ReadFile(filepath.Join(tmp, ".codex", "config.toml"))
+	if err != nil {
+		t.Fatalf("read config.toml: %v", err)
+	}
+	if !strings.Contains(string(data), `model = "o3"`) {
+		t.Errorf("config.toml missing model:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, ".codex", "auth.json")); err != nil {
+		t.Errorf("auth.json not written: %v", err)
+	}
+}
+
+func TestConfigKeysGoToSecretStore(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	code, out, errOut := runArgs("config", "codex", "--base-url", "https://proxy.local/v1", "--api-key", "codex-key-for-store")
+	if code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, errOut)
+	}
+	if !strings.Contains(out, "~/.freshbox/secrets/codex-api-key") {
+		t.Errorf("output should say where the key went:\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, ".codex", "auth.json")); err == nil {
+		t.Error("auth.json should only be written with --plaintext")
+	}
+	if code, _, errOut := runArgs("config", "claude", "--api-key", "claude-key-for-store"); code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, errOut)
+	}
+
+	for key, want := range map[string]string{
+		"codex-key-for-store":  filepath.Join(".freshbox", "secrets", "codex-api-key"),
+		"claude-key-for-store": filepath.Join(".freshbox", "secrets", "claude-api-key"),
+	} {
+		if got := filesContaining(t, tmp, key); len(got) != 1 || got[0] != want {
+			t.Errorf("%s found in %v, want only %s", key, got, want)
+		}
+	}
+	settings, _ := os.ReadFile(filepath.Join(tmp, ".claude", "settings.json"))
+	zshrc, _ := os.ReadFile(filepath.Join(tmp, ".zshrc"))
+	if !strings.Contains(string(settings), "apiKeyHelper") || !strings.Contains(string(zshrc), "export OPENAI_API_KEY=") {
+		t.Errorf("configs should reference the stored keys:\n%s\n%s", settings, zshrc)
+	}
+}
+
+func TestConfigClaudeWritesSettings(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	code, _, errOut := runArgs("config", "claude", "--model", "claude-opus-4-1")
+	if code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, errOut)
+	}
+	data, _ := os.ReadFile(filepath.Join(tmp, ".claude", "settings.json"))
+	if !strings.Contains(string(data), "claude-opus-4-1") {
+		t.Errorf("settings.json missing model:\n%s", data)
+	}
+}
+
+func TestConfigMCPRequiresTarget(t *testing.T) {
+	code, _, _ := runArgs("config", "mcp")
+	if code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
+
+func TestAIProfilesAddUseListRemove(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+
+	code, _, errOut := runArgs("ai", "add", "gw", "--codex-model", "gpt-5", "--codex-base-url", "https://gw/v1",
+		"--codex-api-key", "gw-codex-key", "--claude-model", "claude-sonnet-4-6", "--claude-base-url", "https://gw",
+		"--claude-api-key", "gw-claude-key")
+	if code != 0 {
+		t.Fatalf("add: exit code = %d, stderr: %s", code, errOut)
+	}
+	if code, _, errOut := runArgs("ai", "add", "official", "--codex-model", "o3", "--claude-model", "claude-opus-4-1"); code != 0 {
+		t.Fatalf("add: exit code = %d, stderr: %s", code, errOut)
+	}
+	if got := filesContaining(t, tmp, "gw-codex-key"); len(got) != 1 || got[0] != filepath.Join(".freshbox", "secrets", "ai-gw-codex") {
+		t.Errorf("key found in %v, want only the secret store", got)
+	}
+
+	code, out, errOut := runArgs("ai", "use", "gw")
+	if code != 0 {
+		t.Fatalf("use: exit code = %d, stderr: %s", code, errOut)
+	}
+	if !strings.Contains(out, "codex  → gw (gpt-5 @ https://gw/v1)") {
+		t.Errorf("use output:\n%s", out)
+	}
+	if code, _, errOut := runArgs("ai", "use", "official", "--tool", "claude"); code != 0 {
+		t.Fatalf("use: exit code = %d, stderr: %s", code, errOut)
+	}
+	settings, _ := os.ReadFile(filepath.Join(tmp, ".claude", "settings.json"))
+	codex, _ := os.ReadFile(filepath.Join(tmp, ".codex", "config.toml"))
+	if strings.Contains(string(settings), "https://gw") || !strings.Contains(string(codex), "https://gw/v1") {
+		t.Errorf("claude should be on official and codex on gw:\n%s\n%s", settings, codex)
+	}
+
+	_, out, _ = runArgs("ai", "list")
+	for _, want := range []string{"* gpt-5 @ https://gw/v1", "* claude-opus-4-1, login", "active for codex: gw", "active for claude: official"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("list missing %q:\n%s", want, out)
+		}
+	}
+
+	if code, _, _ := runArgs("ai", "remove", "gw"); code != 0 {
+		t.Fatalf("remove: exit code = %d", code)
+	}
+	if got := filesContaining(t, tmp, "gw-codex-key"); len(got) != 0 {
+		t.Errorf("the profile's key should be deleted with it, found in %v", got)
+	}
+	if code, _, _ := runArgs("ai", "use", "gw"); code != 1 {
+		t.Errorf("using a removed profile: exit code = %d, want 1", code)
+	}
+	if code, _, _ := runArgs("ai", "use", "official", "--tool", "zed"); code != 2 {
+		t.Errorf("unknown tool: exit code = %d, want 2", code)
+	}
+}
+
+func TestSelectMCPs(t *testing.T) {
+	servers, err := selectMCPs("playwright, Context7")
+	if err != nil {
+		t.Fatalf("selectMCPs failed: %v", err)
+	}
+	if len(servers) != 2 || servers[0].Name != "Playwright" || servers[1].Name != "Context7" {
+		t.Errorf("selectMCPs = %+v", servers)
+	}
+
+	if _, err := selectMCPs("Nope"); err == nil {
+		t.Error("expected error for unknown MCP server")
+	}
+
+	all, _ := selectMCPs("")
+	if len(all) != 11 {
+		t.Errorf("empty selection should return all servers, got %d", len(all))
+	}
+}
+
+func TestPlanPassesMCPEnvMasked(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("BRAVE_API_KEY", "")
+	if code, _, stderr := runArgs("plan", "--ai", "Claude Code", "--mcp", "Brave Search"); code != 1 || !strings.Contains(stderr, "Brave Search: BRAVE_API_KEY") {
+		t.Errorf("missing variable: code=%d stderr=%s", code, stderr)
+	}
+
+	code, out, stderr := runArgs("plan", "--ai", "Claude Code", "--mcp", "Brave Search", "--mcp-env", "BRAVE_API_KEY=brave-key-for-tests")
+	if code != 0 {
+		t.Fatalf("code=%d stderr=%s", code, stderr)
+	}
+	if strings.Contains(out, "brave-key-for-tests") || !strings.Contains(out, "BRAVE_API_KEY=") {
+		t.Errorf("plan should pass the key masked:\n%s", out)
+	}
+}
@@ -0,0 +1,313 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kittors/freshbox/internal/version"
+)
+
+// idLayout names backup directories when no run ID is given; it matches the
+// run IDs of `freshbox history`
+const idLayout = "20060102-150405"
+
+// manifestName lists the files of one backup
+const manifestName = "manifest.json"
+
+// filesDir holds the snapshots inside a backup directory
+const filesDir = "files"
+
+// Dir returns ~/.freshbox/backups
+func Dir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".freshbox", "backups")
+}
+
+// Entry is one file freshbox touched during a run
+type Entry struct {
+	Path    string      `json:"path"`
+	Existed bool        `json:"existed"`          // false: freshbox created it, restore removes it
+	Backup  string      `json:"backup,omitempty"` // snapshot, relative to the backup directory
+	Mode    os.FileMode `json:"mode,omitempty"`
+}
+
+// Manifest describes one backup directory
+type Manifest struct {
+	Run     string    `json:"run"`
+	Version string    `json:"version"`
+	Created time.Time `json:"created"`
+	Files   []Entry   `json:"files"`
+}
+
+// Run snapshots every file a run modifies into ~/.freshbox/backups/<id>/,
+// each file once, before its first change. The directory is created on the
+// first snapshot. It is safe for concurrent use; a nil *Run saves nothing.
+type Run struct {
+	ID string
+
+	mu       sync.Mutex
+	manifest Manifest
+	seen     map[string]bool
+}
+
+// Start returns a backup for run id, usually the ID of the run's history
+// log; an empty id picks a new timestamp
+func Start(id string) *Run {
+	now := time.Now()
+	if id == "" {
+		id = now.Format(idLayout)
+		for n := 2; ; n++ {
+			if _, err := os.Stat(filepath.Join(Dir(), id)); errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			id = fmt.Sprintf("%s-%d", now.Format(idLayout), n)
+		}
+	}
+	return &Run{
+		ID:       id,
+		manifest: Manifest{Run: id, Version: version.Version, Created: now},
+		seen:     make(map[string]bool),
+	}
+}
+
+type runKey struct{}
+
+// WithRun returns a context whose file writes are backed up by r
+func WithRun(ctx context.Context, r *Run) context.Context {
+	return context.WithValue(ctx, runKey{}, r)
+}
+
+// FromContext returns the backup set by WithRun, or nil
+func FromContext(ctx context.Context) *Run {
+	r, _ := ctx.Value(runKey{}).(*Run)
+	return r
+}
+
+// Save snapshots path before its first change in this run; later calls for
+// the same path do nothing. A missing path is recorded so that restore
+// removes it again.
+func (r *Run) Save(path string) error {
+	if r == nil {
+		return nil
+	}
+	path = resolve(path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seen[path] {
+		return nil
+	}
+
+	entry := Entry{Path: path}
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("back up %s: %w", path, err)
+	case info.IsDir():
+		return fmt.Errorf("back up %s: is a directory", path)
+	default:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("back up %s: %w", path, err)
+		}
+		entry.Existed = true
+		entry.Mode = info.Mode().Perm()
+		entry.Backup = filepath.Join(filesDir, fmt.Sprintf("%03d-%s", len(r.manifest.Files)+1, filepath.Base(path)))
+		dir := filepath.Join(Dir(), r.ID)
+		if err := os.MkdirAll(filepath.Join(dir, filesDir), 0700); err != nil {
+			return fmt.Errorf("create backup dir: %w", err)
+		}
+		if err := WriteAtomic(filepath.Join(dir, entry.Backup), data, 0600); err != nil {
+			return fmt.Errorf("back up %s: %w", path, err)
+		}
+	}
+
+	r.manifest.Files = append(r.manifest.Files, entry)
+	if err := r.writeManifest(); err != nil {
+		r.manifest.Files = r.manifest.Files[:len(r.manifest.Files)-1]
+		return err
+	}
+	r.seen[path] = true
+	return nil
+}
+
+func (r *Run) writeManifest() error {
+	dir := filepath.Join(Dir(), r.ID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("create backup dir: %w", err)
+	}
+	data, err := json.MarshalIndent(r.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal backup manifest: %w", err)
+	}
+	return WriteAtomic(filepath.Join(dir, manifestName), append(data, '\n'), 0600)
+}
+
+// Save snapshots path in the backup of ctx, if any, before it is changed by
+// something other than WriteFile, e.g. `codex mcp add`
+func Save(ctx context.Context, path string) error {
+	return FromContext(ctx).Save(path)
+}
+
+// WriteFile backs path up in the backup of ctx, then replaces it atomically:
+// data goes to a temp file in the same directory that is renamed over path,
+// so a crash never leaves a half-written file. An existing file keeps its
+// mode; symlinks are followed so dotfile links stay intact.
+func WriteFile(ctx context.Context, path string, data []byte, perm os.FileMode) error {
+	if err := Save(ctx, path); err != nil {
+		return err
+	}
+	path = resolve(path)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return WriteAtomic(path, data, perm)
+}
+
+// resolve follows symlinks in path, so writes go to the link target
+func resolve(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	return path
+}
+
+// WriteAtomic replaces path with data through a temp file and a rename,
+// without taking a backup. It is for freshbox's own files under ~/.freshbox.
+func WriteAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // no-op once renamed
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// --- Restore ---
+
+// Load reads the manifest of backup id; "last" means the newest backup
+func Load(id string) (Manifest, error) {
+	if id == "last" {
+		all, err := List()
+		if err != nil {
+			return Manifest{}, err
+		}
+		if len(all) == 0 {
+			return Manifest{}, errors.New("no backups yet")
+		}
+		return all[0], nil
+	}
+	data, err := os.ReadFile(filepath.Join(Dir(), id, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return Manifest{}, fmt.Errorf("no backup for run %q (see 'freshbox restore --list')", id)
+	}
+	if err != nil {
+		return Manifest{}, fmt.Errorf("read backup manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Manifest{}, fmt.Errorf("parse backup manifest %s: %w", id, err)
+	}
+	return m, nil
+}
+
+// List returns every backup, newest first
+func List() ([]Manifest, error) {
+	entries, err := os.ReadDir(Dir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read backups dir: %w", err)
+	}
+	var all []Manifest
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		m, err := Load(e.Name())
+		if err != nil {
+			continue
+		}
+		all = append(all, m)
+	}
+	slices.SortFunc(all, func(a, b Manifest) int { return strings.Compare(b.Run, a.Run) })
+	return all, nil
+}
+
+// Restore puts every file of m back the way it was before the run: snapshots
+// are copied back and files the run created are removed. It keeps going
+// after a failure and returns the entries it restored.
+func Restore(m Manifest) ([]Entry, error) {
+	var done []Entry
+	var errs []error
+	for _, e := range m.Files {
+		if err := restore(m.Run, e); err != nil {
+			errs = append(errs, fmt.Errorf("restore %s: %w", e.Path, err))
+			continue
+		}
+		done = append(done, e)
+	}
+	return done, errors.Join(errs...)
+}
+
+func restore(id string, e Entry) error {
+	if !e.Existed {
+		if err := os.Remove(e.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(Dir(), id, e.Backup))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(e.Path), 0755); err != nil {
+		return err
+	}
+	return WriteAtomic(e.Path, data, e.Mode)
+}
+
+// WriteList prints a table of backups
+func WriteList(w io.Writer, all []Manifest) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tVERSION\tCREATED\tFILES")
+	for _, m := range all {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", m.Run, m.Version, m.Created.Local().Format("2006-01-02 15:04"), len(m.Files))
+	}
+	tw.Flush()
+}
+
+// Tilde shortens a path under the home directory to ~/…
+func Tilde(path string) string {
+	home, _ := os.UserHomeDir()
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return "~/" + rel
+	}
+	return path
+}
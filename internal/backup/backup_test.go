@@ -0,0 +1,160 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// --- WriteFile ---
+
+func TestWriteFileBacksUpOnceAndRestores(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	karabiner := filepath.Join(home, ".config", "karabiner", "karabiner.json")
+	created := filepath.Join(home, ".local", "bin", "open-kaku.sh")
+	writeTestFile(t, karabiner, "hand-tuned")
+	os.MkdirAll(filepath.Dir(created), 0755)
+
+	run := Start("20260101-120000")
+	ctx := WithRun(context.Background(), run)
+	for _, content := range []string{"first write", "second write"} {
+		if err := WriteFile(ctx, karabiner, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteFile(ctx, created, []byte("#!/bin/bash\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, karabiner); got != "second write" {
+		t.Errorf("karabiner.json = %q", got)
+	}
+	if info, _ := os.Stat(karabiner); info.Mode().Perm() != 0600 {
+		t.Errorf("existing file mode = %v, want 0600 kept", info.Mode().Perm())
+	}
+	if info, _ := os.Stat(created); info.Mode().Perm() != 0755 {
+		t.Errorf("new file mode = %v, want 0755", info.Mode().Perm())
+	}
+
+	m, err := Load("last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Run != run.ID || len(m.Files) != 2 {
+		t.Fatalf("manifest = %+v", m)
+	}
+	if !m.Files[0].Existed || m.Files[1].Existed {
+		t.Errorf("existed = %v, %v", m.Files[0].Existed, m.Files[1].Existed)
+	}
+	if got := readTestFile(t, filepath.Join(Dir(), run.ID, m.Files[0].Backup)); got != "hand-tuned" {
+		t.Errorf("snapshot = %q, want the content before the run", got)
+	}
+
+	done, err := Restore(m)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("Restore = %v, %v", done, err)
+	}
+	if got := readTestFile(t, karabiner); got != "hand-tuned" {
+		t.Errorf("restored karabiner.json = %q", got)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Error("a file the run created should be removed")
+	}
+}
+
+func TestWriteFileWithoutRun(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := filepath.Join(home, "settings.json")
+
+	if err := WriteFile(context.Background(), path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, path); got != "{}" {
+		t.Errorf("content = %q", got)
+	}
+	if _, err := os.Stat(Dir()); !os.IsNotExist(err) {
+		t.Error("no backup dir should be created without a run")
+	}
+	entries, _ := os.ReadDir(home)
+	if len(entries) != 1 {
+		t.Errorf("temp files left behind: %v", entries)
+	}
+}
+
+func TestWriteFileFollowsSymlinks(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	target := filepath.Join(home, "dotfiles", "zshrc")
+	link := filepath.Join(home, ".zshrc")
+	writeTestFile(t, target, "# mine\n")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithRun(context.Background(), Start(""))
+	if err := WriteFile(ctx, link, []byte("# mine\nexport X=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+		t.Error("the symlink should be kept")
+	}
+	if got := readTestFile(t, target); !strings.Contains(got, "export X=1") {
+		t.Errorf("target = %q", got)
+	}
+}
+
+// --- List / Load ---
+
+func TestListNewestFirst(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if all, err := List(); err != nil || len(all) != 0 {
+		t.Errorf("List before any backup = %v, %v", all, err)
+	}
+	if _, err := Load("last"); err == nil {
+		t.Error("Load(last) without backups should fail")
+	}
+
+	for _, id := range []string{"20260101-000000", "20260102-000000"} {
+		Start(id).Save(filepath.Join(home, "file-"+id))
+	}
+	Start("20260103-000000") // nothing saved, no directory
+
+	all, err := List()
+	if err != nil || len(all) != 2 || all[0].Run != "20260102-000000" {
+		t.Errorf("List = %+v, %v", all, err)
+	}
+	if _, err := Load("nope"); err == nil || !strings.Contains(err.Error(), "no backup") {
+		t.Errorf("Load(nope) = %v", err)
+	}
+}
+
+func TestNilRunSavesNothing(t *testing.T) {
+	var r *Run
+	if err := r.Save("/etc/hosts"); err != nil {
+		t.Errorf("nil Run Save = %v", err)
+	}
+	if FromContext(context.Background()) != nil {
+		t.Error("FromContext without a run should be nil")
+	}
+}
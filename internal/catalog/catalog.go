@@ -0,0 +1,365 @@
+package catalog
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kittors/freshbox/internal/backup"
+)
+
+//go:embed catalog.toml
+var builtin string
+
+// EnvVar names extra catalog files, separated like PATH, that are layered on
+// the built-in one before ~/.freshbox/catalog.toml
+const EnvVar = "FRESHBOX_CATALOG"
+
+// Install methods
+const (
+	InstallBrew   = "brew"   // Homebrew formula
+	InstallCask   = "cask"   // Homebrew cask
+	InstallNpm    = "npm"    // global npm package
+	InstallScript = "script" // shell command run with bash -c
+)
+
+// MCP transports
+const (
+	TransportStdio = "stdio" // a local process; the default
+	TransportHTTP  = "http"  // streamable HTTP
+	TransportSSE   = "sse"   // server-sent events
+)
+
+// Categories, in display order
+var Categories = []string{"dev", "app", "ai"}
+
+// Tool is one installable item
+type Tool struct {
+	Name           string   `toml:"name"`
+	Category       string   `toml:"category"` // dev, app or ai
+	Desc           string   `toml:"desc"`
+	Cmd            string   `toml:"cmd"`                       // command that shows it is installed
+	Paths          []string `toml:"paths,omitempty"`           // where to look for Cmd before PATH
+	App            string   `toml:"app,omitempty"`             // .app bundle that shows it is installed
+	VersionFlag    string   `toml:"version_flag,omitempty"`    // e.g. "--version"; empty skips the version
+	VersionPattern string   `toml:"version_pattern,omitempty"` // regexp for the version line, when it isn't the first
+	MinVersion     string   `toml:"min_version,omitempty"`
+	Install        string   `toml:"install"`           // one of the Install methods
+	Package        string   `toml:"package,omitempty"` // formula, cask or npm package
+	Script         string   `toml:"script,omitempty"`  // for InstallScript
+	Files          []string `toml:"files,omitempty"`   // what the script creates, for plans
+	Needs          []string `toml:"needs,omitempty"`   // tools to install first, besides Homebrew or npm
+	PostInstall    []string `toml:"post_install,omitempty"`
+	Hidden         bool     `toml:"hidden,omitempty"` // in a layer: drop the item with this name
+}
+
+// MCP is an MCP server, launched over stdio or reached at a URL
+type MCP struct {
+	Name      string            `toml:"name"`
+	Transport string            `toml:"transport,omitempty"` // one of the transports; empty is stdio
+	Command   string            `toml:"command,omitempty"`   // stdio only
+	Args      []string          `toml:"args,omitempty"`      // a leading ~ is the home directory
+	URL       string            `toml:"url,omitempty"`       // http and sse only
+	Headers   map[string]string `toml:"headers,omitempty"`   // ${NAME} is the value of a variable in Env
+	Env       []MCPEnv          `toml:"env,omitempty"`       // variables the server needs to work
+	Hidden    bool              `toml:"hidden,omitempty"`
+}
+
+// Remote reports a server reached at a URL rather than launched
+func (m MCP) Remote() bool {
+	return m.Transport == TransportHTTP || m.Transport == TransportSSE
+}
+
+// MCPEnv is an environment variable an MCP server needs, asked for before
+// the server is registered
+type MCPEnv struct {
+	Name   string `toml:"name"`
+	Label  string `toml:"label,omitempty"`  // what to ask for, e.g. "Personal access token"
+	Secret bool   `toml:"secret,omitempty"` // masked while typed and kept out of logs
+}
+
+// Catalog is everything freshbox offers to install
+type Catalog struct {
+	Tools []Tool `toml:"tool"`
+	MCPs  []MCP  `toml:"mcp"`
+}
+
+// Parse decodes a catalog file, rejecting keys it doesn't know
+func Parse(data []byte) (Catalog, error) {
+	var c Catalog
+	md, err := toml.Decode(string(data), &c)
+	if err != nil {
+		return Catalog{}, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return Catalog{}, fmt.Errorf("unknown keys: %s", strings.Join(keys, ", "))
+	}
+	return c, nil
+}
+
+// Builtin returns the catalog embedded in freshbox
+func Builtin() Catalog {
+	c, err := Parse([]byte(builtin))
+	if err != nil {
+		panic("catalog: built-in catalog: " + err.Error())
+	}
+	return c
+}
+
+// LocalPath returns ~/.freshbox/catalog.toml
+func LocalPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".freshbox", "catalog.toml")
+}
+
+// Load returns the built-in catalog with the files named by $FRESHBOX_CATALOG
+// and then ~/.freshbox/catalog.toml layered on top, in that order. A missing
+// local file is fine; a missing team file is an error.
+func Load() (Catalog, error) {
+	c := Builtin()
+	layer := func(path string, optional bool) error {
+		data, err := os.ReadFile(path)
+		if optional && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read catalog: %w", err)
+		}
+		over, err := Parse(data)
+		if err != nil {
+			return fmt.Errorf("parse catalog %s: %w", path, err)
+		}
+		c = c.Layer(over)
+		// check each layer so a mistake is reported with its file
+		if err := c.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	}
+	for _, path := range filepath.SplitList(os.Getenv(EnvVar)) {
+		if path == "" {
+			continue
+		}
+		if err := layer(path, false); err != nil {
+			return Catalog{}, err
+		}
+	}
+	if err := layer(LocalPath(), true); err != nil {
+		return Catalog{}, err
+	}
+	if err := c.Validate(); err != nil {
+		return Catalog{}, err
+	}
+	return c, nil
+}
+
+// Layer returns c with over applied: an entry with a known name replaces it
+// in place, a new name is added at the end, and a hidden entry removes the
+// name. c is left unchanged.
+func (c Catalog) Layer(over Catalog) Catalog {
+	return Catalog{
+		Tools: layer(c.Tools, over.Tools, func(t Tool) (string, bool) { return t.Name, t.Hidden }),
+		MCPs:  layer(c.MCPs, over.MCPs, func(m MCP) (string, bool) { return m.Name, m.Hidden }),
+	}
+}
+
+func layer[E any](base, over []E, key func(E) (name string, hidden bool)) []E {
+	out := slices.Clone(base)
+	for _, e := range over {
+		name, hidden := key(e)
+		i := slices.IndexFunc(out, func(b E) bool { n, _ := key(b); return n == name })
+		switch {
+		case hidden && i >= 0:
+			out = slices.Delete(out, i, i+1)
+		case hidden:
+		case i >= 0:
+			out[i] = e
+		default:
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Validate reports the first entry freshbox couldn't detect or install
+func (c Catalog) Validate() error {
+	names := make(map[string]bool, len(c.Tools))
+	for _, t := range c.Tools {
+		if t.Name == "" {
+			return errors.New("catalog: tool without a name")
+		}
+		if names[t.Name] {
+			return fmt.Errorf("catalog: duplicate tool %q", t.Name)
+		}
+		names[t.Name] = true
+	}
+	for _, t := range c.Tools {
+		if err := t.validate(names); err != nil {
+			return fmt.Errorf("catalog: tool %q: %w", t.Name, err)
+		}
+	}
+	if loop := c.cycle(); loop != nil {
+		return fmt.Errorf("catalog: tools need each other: %s", strings.Join(loop, " → "))
+	}
+
+	mcps := make(map[string]bool, len(c.MCPs))
+	for _, m := range c.MCPs {
+		switch {
+		case m.Name == "":
+			return errors.New("catalog: MCP server without a name")
+		case mcps[m.Name]:
+			return fmt.Errorf("catalog: duplicate MCP server %q", m.Name)
+		case m.Transport != "" && m.Transport != TransportStdio && !m.Remote():
+			return fmt.Errorf("catalog: MCP server %q: unknown transport %q (want stdio, http or sse)", m.Name, m.Transport)
+		case m.Remote() && m.Command != "":
+			return fmt.Errorf("catalog: MCP server %q: a %s server has a url, not a command", m.Name, m.Transport)
+		case m.Remote() && !webURL(m.URL):
+			return fmt.Errorf("catalog: MCP server %q: url %q is not an http:// or https:// URL", m.Name, m.URL)
+		case !m.Remote() && m.Command == "":
+			return fmt.Errorf("catalog: MCP server %q: missing command", m.Name)
+		case !m.Remote() && (m.URL != "" || len(m.Headers) > 0):
+			return fmt.Errorf("catalog: MCP server %q: url and headers need transport = \"http\" or \"sse\"", m.Name)
+		}
+		mcps[m.Name] = true
+		vars := make(map[string]bool, len(m.Env))
+		for _, e := range m.Env {
+			if !envName.MatchString(e.Name) || vars[e.Name] {
+				return fmt.Errorf("catalog: MCP server %q: bad or duplicate env name %q", m.Name, e.Name)
+			}
+			vars[e.Name] = true
+		}
+	}
+	return nil
+}
+
+// cycle returns the tools of a needs loop, the first one repeated at the
+// end, or nil if there is none
+func (c Catalog) cycle() []string {
+	needs := make(map[string][]string, len(c.Tools))
+	for _, t := range c.Tools {
+		needs[t.Name] = t.Needs
+	}
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int, len(c.Tools))
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			i := slices.Index(path, name)
+			return append(slices.Clone(path[i:]), name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, n := range needs[name] {
+			if loop := visit(n); loop != nil {
+				return loop
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+	for _, t := range c.Tools {
+		if loop := visit(t.Name); loop != nil {
+			return loop
+		}
+	}
+	return nil
+}
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func webURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// AddLocal appends an MCP server to ~/.freshbox/catalog.toml, keeping what
+// the file already has as it is
+func AddLocal(m MCP) error {
+	if err := (Catalog{MCPs: []MCP{m}}).Validate(); err != nil {
+		return err
+	}
+	var block bytes.Buffer
+	entry := struct {
+		MCPs []MCP `toml:"mcp"`
+	}{[]MCP{m}}
+	if err := toml.NewEncoder(&block).Encode(entry); err != nil {
+		return fmt.Errorf("encode MCP server: %w", err)
+	}
+
+	path := LocalPath()
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read catalog: %w", err)
+	}
+	if len(data) > 0 {
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			data = append(data, '\n')
+		}
+		data = append(data, '\n')
+	}
+	data = append(data, block.Bytes()...)
+	c, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("parse catalog %s: %w", path, err)
+	}
+	if slices.ContainsFunc(c.MCPs[:len(c.MCPs)-1], func(o MCP) bool { return o.Name == m.Name }) {
+		return fmt.Errorf("catalog: %s already has an MCP server %q", path, m.Name)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create catalog dir: %w", err)
+	}
+	return backup.WriteAtomic(path, data, 0644)
+}
+
+func (t Tool) validate(names map[string]bool) error {
+	if !slices.Contains(Categories, t.Category) {
+		return fmt.Errorf("category %q is not one of %s", t.Category, strings.Join(Categories, ", "))
+	}
+	if t.Cmd == "" && t.App == "" {
+		return errors.New("needs cmd or app to detect it")
+	}
+	if t.VersionPattern != "" {
+		if _, err := regexp.Compile(t.VersionPattern); err != nil {
+			return fmt.Errorf("version_pattern: %w", err)
+		}
+	}
+	switch t.Install {
+	case InstallBrew, InstallCask, InstallNpm:
+		if t.Package == "" {
+			return fmt.Errorf("install = %q needs a package", t.Install)
+		}
+	case InstallScript:
+		if t.Script == "" {
+			return errors.New(`install = "script" needs a script`)
+		}
+	default:
+		return fmt.Errorf("unknown install method %q (want brew, cask, npm or script)", t.Install)
+	}
+	for _, n := range t.Needs {
+		if !names[n] || n == t.Name {
+			return fmt.Errorf("needs unknown tool %q", n)
+		}
+	}
+	return nil
+}
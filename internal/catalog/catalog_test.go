@@ -0,0 +1,270 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func names[E any](entries []E, name func(E) string) []string {
+	var out []string
+	for _, e := range entries {
+		out = append(out, name(e))
+	}
+	return out
+}
+
+func toolNames(c Catalog) string {
+	return strings.Join(names(c.Tools, func(t Tool) string { return t.Name }), ",")
+}
+
+func TestBuiltinIsValid(t *testing.T) {
+	c := Builtin()
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for _, tool := range c.Tools {
+		counts[tool.Category]++
+		if tool.Desc == "" {
+			t.Errorf("%s: missing description", tool.Name)
+		}
+	}
+	if counts["dev"] != 12 || counts["app"] != 7 || counts["ai"] != 2 {
+		t.Errorf("tools per category = %v", counts)
+	}
+	if len(c.MCPs) != 11 {
+		t.Errorf("got %d MCP servers, want 11", len(c.MCPs))
+	}
+}
+
+func TestLayer(t *testing.T) {
+	base := Catalog{
+		Tools: []Tool{{Name: "A"}, {Name: "B", Desc: "old"}, {Name: "C"}},
+		MCPs:  []MCP{{Name: "M"}, {Name: "N"}},
+	}
+	over := Catalog{
+		Tools: []Tool{{Name: "D"}, {Name: "B", Desc: "new"}, {Name: "A", Hidden: true}, {Name: "Z", Hidden: true}},
+		MCPs:  []MCP{{Name: "N", Hidden: true}},
+	}
+
+	got := base.Layer(over)
+	if toolNames(got) != "B,C,D" {
+		t.Errorf("tools = %s, want B,C,D", toolNames(got))
+	}
+	if got.Tools[0].Desc != "new" {
+		t.Errorf("B wasn't replaced: %+v", got.Tools[0])
+	}
+	if len(got.MCPs) != 1 || got.MCPs[0].Name != "M" {
+		t.Errorf("MCPs = %+v", got.MCPs)
+	}
+	if toolNames(base) != "A,B,C" || base.Tools[1].Desc != "old" {
+		t.Errorf("base was modified: %+v", base.Tools)
+	}
+}
+
+func TestParseRejectsUnknownKeys(t *testing.T) {
+	_, err := Parse([]byte("[[tool]]\nname = \"x\"\nbrew = \"x\"\n"))
+	if err == nil || !strings.Contains(err.Error(), "tool.brew") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	ok := Tool{Name: "rg", Category: "dev", Cmd: "rg", Install: InstallBrew, Package: "ripgrep"}
+	cases := []struct {
+		name string
+		edit func(*Tool)
+		want string
+	}{
+		{"category", func(t *Tool) { t.Category = "misc" }, `category "misc"`},
+		{"detect", func(t *Tool) { t.Cmd = "" }, "needs cmd or app"},
+		{"pattern", func(t *Tool) { t.VersionPattern = "(" }, "version_pattern"},
+		{"method", func(t *Tool) { t.Install = "pip" }, `unknown install method "pip"`},
+		{"package", func(t *Tool) { t.Package = "" }, `install = "brew" needs a package`},
+		{"script", func(t *Tool) { t.Install = InstallScript }, "needs a script"},
+		{"needs", func(t *Tool) { t.Needs = []string{"cargo"} }, `needs unknown tool "cargo"`},
+	}
+	if err := (Catalog{Tools: []Tool{ok}}).Validate(); err != nil {
+		t.Fatalf("valid tool: %v", err)
+	}
+	for _, tc := range cases {
+		tool := ok
+		tc.edit(&tool)
+		err := Catalog{Tools: []Tool{tool}}.Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+
+	if err := (Catalog{Tools: []Tool{ok, ok}}).Validate(); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("duplicate tool: err = %v", err)
+	}
+	foo, bar, baz := ok, ok, ok
+	foo.Name, foo.Needs = "Foo", []string{"Bar"}
+	bar.Name, bar.Needs = "Bar", []string{"Baz"}
+	baz.Name, baz.Needs = "Baz", []string{"Foo"}
+	if err := (Catalog{Tools: []Tool{ok, foo, bar, baz}}).Validate(); err == nil || !strings.Contains(err.Error(), "Foo → Bar → Baz → Foo") {
+		t.Errorf("needs loop: err = %v", err)
+	}
+	if err := (Catalog{MCPs: []MCP{{Name: "x"}}}).Validate(); err == nil || !strings.Contains(err.Error(), "missing command") {
+		t.Errorf("MCP without command: err = %v", err)
+	}
+	for _, tc := range []struct {
+		mcp  MCP
+		want string
+	}{
+		{MCP{Name: "x", Transport: "ws", URL: "https://x"}, `unknown transport "ws"`},
+		{MCP{Name: "x", Transport: TransportHTTP, URL: "https://x", Command: "npx"}, "has a url, not a command"},
+		{MCP{Name: "x", Transport: TransportSSE, URL: "mcp.example.com/sse"}, "not an http:// or https:// URL"},
+		{MCP{Name: "x", Command: "npx", URL: "https://x"}, `transport = "http" or "sse"`},
+	} {
+		if err := (Catalog{MCPs: []MCP{tc.mcp}}).Validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: err = %v, want %q", tc.mcp, err, tc.want)
+		}
+	}
+	remote := MCP{Name: "x", Transport: TransportHTTP, URL: "https://mcp.example.com/mcp", Headers: map[string]string{"Authorization": "Bearer ${X_TOKEN}"}}
+	if err := (Catalog{MCPs: []MCP{remote}}).Validate(); err != nil {
+		t.Errorf("remote server: %v", err)
+	}
+	for _, env := range [][]MCPEnv{{{Name: "API KEY"}}, {{Name: "A"}, {Name: "A"}}} {
+		mcp := MCP{Name: "x", Command: "npx", Env: env}
+		if err := (Catalog{MCPs: []MCP{mcp}}).Validate(); err == nil || !strings.Contains(err.Error(), "env name") {
+			t.Errorf("env %+v: err = %v", env, err)
+		}
+	}
+}
+
+func TestLoadLayersTeamThenLocal(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	team := filepath.Join(t.TempDir(), "team.toml")
+	os.WriteFile(team, []byte(`
+[[tool]]
+name = "ripgrep"
+category = "dev"
+desc = "Fast grep"
+cmd = "rg"
+install = "brew"
+package = "ripgrep"
+
+[[tool]]
+name = "Tabby"
+hidden = true
+`), 0644)
+	os.MkdirAll(filepath.Join(home, ".freshbox"), 0755)
+	os.WriteFile(LocalPath(), []byte(`
+[[tool]]
+name = "ripgrep"
+category = "dev"
+desc = "Mine now"
+cmd = "rg"
+install = "brew"
+package = "ripgrep"
+
+[[mcp]]
+name = "SQLite"
+hidden = true
+`), 0644)
+	t.Setenv(EnvVar, team)
+
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := toolNames(c)
+	if strings.Contains(all, "Tabby") || !strings.HasSuffix(all, ",ripgrep") {
+		t.Errorf("tools = %s", all)
+	}
+	if desc := c.Tools[len(c.Tools)-1].Desc; desc != "Mine now" {
+		t.Errorf("local file should win, got desc %q", desc)
+	}
+	if len(c.MCPs) != 10 {
+		t.Errorf("got %d MCP servers, want 10", len(c.MCPs))
+	}
+}
+
+func TestAddLocalKeepsTheFileAndLoads(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	os.MkdirAll(filepath.Dir(LocalPath()), 0755)
+	mine := "# my tools\n[[mcp]]\nname = \"SQLite\"\nhidden = true"
+	os.WriteFile(LocalPath(), []byte(mine), 0644)
+
+	linear := MCP{
+		Name:      "Linear",
+		Transport: TransportHTTP,
+		URL:       "https://mcp.linear.app/mcp",
+		Headers:   map[string]string{"Authorization": "Bearer ${LINEAR_TOKEN}"},
+		Env:       []MCPEnv{{Name: "LINEAR_TOKEN", Secret: true}},
+	}
+	if err := AddLocal(linear); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(LocalPath())
+	if !strings.HasPrefix(string(data), mine+"\n\n[[mcp]]") {
+		t.Errorf("catalog.toml:\n%s", data)
+	}
+	c, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := c.MCPs[len(c.MCPs)-1]
+	if got.Name != "Linear" || !got.Remote() || got.URL != linear.URL || got.Headers["Authorization"] != "Bearer ${LINEAR_TOKEN}" {
+		t.Errorf("loaded %+v", got)
+	}
+
+	if err := AddLocal(linear); err == nil || !strings.Contains(err.Error(), "already has") {
+		t.Errorf("adding it twice: err = %v", err)
+	}
+	if err := AddLocal(MCP{Name: "y", Transport: TransportHTTP, URL: "nope"}); err == nil {
+		t.Error("an invalid entry should be refused")
+	}
+	if after, _ := os.ReadFile(LocalPath()); string(after) != string(data) {
+		t.Error("a refused entry must leave the file alone")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	t.Setenv(EnvVar, filepath.Join(t.TempDir(), "missing.toml"))
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "read catalog") {
+		t.Errorf("missing team file: err = %v", err)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.toml")
+	os.WriteFile(bad, []byte("[[tool]]\nname = \"Git\"\ncategory = \"dev\"\ncmd = \"git\"\ninstall = \"pip\"\n"), 0644)
+	t.Setenv(EnvVar, bad)
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), `tool "Git"`) {
+		t.Errorf("invalid entry: err = %v", err)
+	}
+
+	os.MkdirAll(filepath.Dir(LocalPath()), 0755)
+	os.WriteFile(LocalPath(), []byte(`
+[[tool]]
+name = "Foo"
+category = "dev"
+cmd = "foo"
+install = "brew"
+package = "foo"
+needs = ["Bar"]
+
+[[tool]]
+name = "Bar"
+category = "dev"
+cmd = "bar"
+install = "brew"
+package = "bar"
+needs = ["Foo"]
+`), 0644)
+	t.Setenv(EnvVar, "")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), LocalPath()+": catalog: tools need each other: Foo → Bar → Foo") {
+		t.Errorf("needs loop: err = %v", err)
+	}
+
+	os.Remove(LocalPath())
+	if c, err := Load(); err != nil || len(c.Tools) != len(Builtin().Tools) {
+		t.Errorf("no layers: %d tools, err = %v", len(c.Tools), err)
+	}
+}
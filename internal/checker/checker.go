@@ -1,10 +1,15 @@
 package checker
 
 import (
+	"context"
+	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+
+	"github.com/kittors/freshbox/internal/catalog"
+	"github.com/kittors/freshbox/internal/runner"
 )
 
 type Status int
@@ -12,6 +17,7 @@ type Status int
 const (
 	NotInstalled Status = iota
 	Installed
+	Outdated // installed, with a newer version available
 )
 
 type Item struct {
@@ -22,36 +28,43 @@ type Item struct {
 	Status    Status
 	Version   string
 	Category  string
-	InstallFn func() error // custom install function, nil = use default brew
-	BrewName  string       // brew formula/cask name
+	BrewName  string // brew formula/cask name
+	NpmName   string // global npm package, for tools installed with npm
 	IsCask    bool
+	Reinstall bool   // queue it even though it is installed, e.g. install --force
+	Latest    string // newer version available when Status is Outdated
+
+	Semver     Semver // Version parsed for comparison; zero if it has no number
+	VerPattern string // regexp picking the version line when it isn't the first, e.g. Gradle's
+	MinVersion string // lowest acceptable version; anything older is Outdated
+
+	Paths       []string // where to look for Cmd before PATH; ~ is the home directory
+	App         string   // .app bundle checked by CheckApp before Cmd
+	Script      string   // shell install command, for items that aren't brew or npm packages
+	Files       []string // files or directories Script creates
+	Needs       []string // names of items to install first
+	PostInstall []string // shell commands run after installing
 }
 
-// resolveCmd finds the command binary, checking extra paths for known tools
-func resolveCmd(cmd string) string {
+// resolveCmd finds the command binary, checking paths first (before PATH,
+// which may have stubs)
+func resolveCmd(cmd string, paths ...string) string {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		home = ""
 	}
 
-	// Check tool-specific paths first (before PATH, which may have stubs)
-	// Rust: ~/.cargo/bin
-	if cmd == "rustup" || cmd == "rustc" || cmd == "cargo" {
-		cargoPath := filepath.Join(home, ".cargo", "bin", cmd)
-		if _, err := os.Stat(cargoPath); err == nil {
-			return cargoPath
+	for _, p := range paths {
+		if rest, ok := strings.CutPrefix(p, "~/"); ok {
+			p = filepath.Join(home, rest)
 		}
-	}
-	// Java: brew's openjdk (macOS /usr/bin/java is a stub that fails without JDK)
-	if cmd == "java" {
-		brewJava := "/opt/homebrew/opt/openjdk/bin/java"
-		if _, err := os.Stat(brewJava); err == nil {
-			return brewJava
+		if _, err := os.Stat(p); err == nil {
+			return p
 		}
 	}
 
 	// Try PATH
-	if p, err := exec.LookPath(cmd); err == nil {
+	if p, err := runner.LookPath(cmd); err == nil {
 		return p
 	}
 
@@ -65,7 +78,7 @@ func resolveCmd(cmd string) string {
 }
 
 func Check(item *Item) {
-	cmdPath := resolveCmd(item.Cmd)
+	cmdPath := resolveCmd(item.Cmd, item.Paths...)
 	if cmdPath == "" {
 		item.Status = NotInstalled
 		item.Version = ""
@@ -73,85 +86,125 @@ func Check(item *Item) {
 	}
 
 	if item.VerFlag != "" {
-		out, err := exec.Command(cmdPath, item.VerFlag).CombinedOutput()
+		out, err := cached(cmdPath+" "+item.VerFlag, cmdPath, func() ([]byte, error) {
+			return runner.Output(context.Background(), cmdPath, item.VerFlag)
+		})
 		if err != nil {
 			// Command exists but --version fails (e.g. macOS /usr/bin/java stub)
 			item.Status = NotInstalled
 			item.Version = ""
 			return
 		}
-		ver := strings.TrimSpace(string(out))
-		if idx := strings.Index(ver, "\n"); idx > 0 {
-			ver = ver[:idx]
-		}
-		item.Version = ver
+		item.Version, item.Semver, _ = extractVersion(string(out), item.VerPattern)
 	}
 
 	item.Status = Installed
+	checkMin(item)
 }
 
-func CheckAll(items []*Item) {
-	for _, item := range items {
-		Check(item)
+// Require sets the lowest version item accepts. An installed item that is
+// older becomes Outdated, so it is offered as an upgrade instead of being
+// locked as installed.
+func Require(item *Item, min string) {
+	item.MinVersion = min
+	if item.Status == Outdated && item.Latest == "" && !item.TooOld() {
+		item.Status = Installed
+	}
+	checkMin(item)
+}
+
+// TooOld reports whether the installed version is below MinVersion. A version
+// that can't be parsed is given the benefit of the doubt.
+func (item *Item) TooOld() bool {
+	if item.Status == NotInstalled || item.MinVersion == "" || item.Semver == (Semver{}) {
+		return false
 	}
+	min, ok := ParseSemver(item.MinVersion)
+	return ok && item.Semver.Compare(min) < 0
 }
 
-func DevTools() []*Item {
-	return []*Item{
-		{Name: "Homebrew", Desc: "macOS package manager", Cmd: "brew", VerFlag: "--version", Category: "dev", BrewName: ""},
-		{Name: "Git", Desc: "Distributed version control system", Cmd: "git", VerFlag: "--version", Category: "dev", BrewName: "git"},
-		{Name: "Java (JDK)", Desc: "Java development kit for JVM-based development", Cmd: "java", VerFlag: "--version", Category: "dev", BrewName: "openjdk"},
-		{Name: "Maven", Desc: "Java project build and dependency management", Cmd: "mvn", VerFlag: "--version", Category: "dev", BrewName: "maven"},
-		{Name: "Gradle", Desc: "Flexible build automation tool for JVM projects", Cmd: "gradle", VerFlag: "--version", Category: "dev", BrewName: "gradle"},
-		{Name: "Python", Desc: "General-purpose programming language", Cmd: "python3", VerFlag: "--version", Category: "dev", BrewName: "python"},
-		{Name: "uv", Desc: "Ultra-fast Python package manager by Astral", Cmd: "uv", VerFlag: "--version", Category: "dev", BrewName: "uv"},
-		{Name: "fnm", Desc: "Fast Node.js version manager written in Rust", Cmd: "fnm", VerFlag: "--version", Category: "dev", BrewName: "fnm"},
-		{Name: "pnpm", Desc: "Fast, disk-efficient package manager for Node.js", Cmd: "pnpm", VerFlag: "--version", Category: "dev", BrewName: "pnpm"},
-		{Name: "Bun", Desc: "All-in-one JavaScript runtime, bundler, and package manager", Cmd: "bun", VerFlag: "--version", Category: "dev", BrewName: "bun"},
-		{Name: "Rust (rustup)", Desc: "Systems programming language with memory safety", Cmd: "rustup", VerFlag: "--version", Category: "dev", BrewName: "rustup"},
-		{Name: "Go", Desc: "Statically typed language by Google for scalable systems", Cmd: "go", VerFlag: "version", Category: "dev", BrewName: "go"},
+func checkMin(item *Item) {
+	if item.Status == Installed && item.TooOld() {
+		item.Status = Outdated
 	}
 }
 
-func Apps() []*Item {
-	return []*Item{
-		{Name: "Google Chrome", Desc: "Web browser by Google", Cmd: "/Applications/Google Chrome.app/Contents/MacOS/Google Chrome", VerFlag: "--version", Category: "app", BrewName: "google-chrome", IsCask: true},
-		{Name: "Zed", Desc: "High-performance code editor by the Atom creators", Cmd: "/Applications/Zed.app/Contents/MacOS/cli", VerFlag: "--version", Category: "app", BrewName: "zed", IsCask: true},
-		{Name: "IINA", Desc: "Modern media player for macOS", Cmd: "/Applications/IINA.app/Contents/MacOS/IINA", VerFlag: "", Category: "app", BrewName: "iina", IsCask: true},
-		{Name: "Kaku", Desc: "Lightweight terminal app built on WezTerm by tw93", Cmd: "kaku", VerFlag: "--version", Category: "app", BrewName: "tw93/tap/kakuku", IsCask: true},
-		{Name: "Karabiner-Elements", Desc: "Powerful keyboard customizer for macOS", Cmd: "/Applications/Karabiner-Elements.app/Contents/MacOS/Karabiner-Elements", VerFlag: "", Category: "app", BrewName: "karabiner-elements", IsCask: true},
-		{Name: "Mole", Desc: "macOS system cleaner to free up disk space by tw93", Cmd: "mo", VerFlag: "", Category: "app", BrewName: "tw93/tap/mole", IsCask: false},
-		{Name: "Tabby", Desc: "Modern open-source terminal with SSH and serial support", Cmd: "/Applications/Tabby.app/Contents/MacOS/Tabby", VerFlag: "", Category: "app", BrewName: "tabby", IsCask: true},
+// CheckAll checks items concurrently, DetectWorkers at a time
+func CheckAll(items []*Item) {
+	each(items, Check)
+}
+
+// FromCatalog turns catalog tools into items to check, in catalog order
+func FromCatalog(tools []catalog.Tool) ([]*Item, error) {
+	items := make([]*Item, 0, len(tools))
+	for _, t := range tools {
+		if t.MinVersion != "" {
+			if _, ok := ParseSemver(t.MinVersion); !ok {
+				return nil, fmt.Errorf("catalog: tool %q: invalid min_version %q", t.Name, t.MinVersion)
+			}
+		}
+		item := &Item{
+			Name:        t.Name,
+			Desc:        t.Desc,
+			Cmd:         t.Cmd,
+			Paths:       t.Paths,
+			App:         t.App,
+			VerFlag:     t.VersionFlag,
+			VerPattern:  t.VersionPattern,
+			MinVersion:  t.MinVersion,
+			Category:    t.Category,
+			Script:      t.Script,
+			Files:       t.Files,
+			Needs:       t.Needs,
+			PostInstall: t.PostInstall,
+		}
+		switch t.Install {
+		case catalog.InstallBrew:
+			item.BrewName = t.Package
+		case catalog.InstallCask:
+			item.BrewName, item.IsCask = t.Package, true
+		case catalog.InstallNpm:
+			item.NpmName = t.Package
+		}
+		items = append(items, item)
 	}
+	return items, nil
 }
 
-func AITools() []*Item {
-	return []*Item{
-		{Name: "Codex", Desc: "OpenAI's AI coding assistant CLI", Cmd: "codex", VerFlag: "--version", Category: "ai", BrewName: ""},
-		{Name: "Claude Code", Desc: "Anthropic's AI coding assistant CLI", Cmd: "claude", VerFlag: "--version", Category: "ai", BrewName: ""},
+// builtin returns the built-in catalog's items in one category
+func builtin(category string) []*Item {
+	items, err := FromCatalog(catalog.Builtin().Tools)
+	if err != nil {
+		panic("checker: " + err.Error())
 	}
+	return slices.DeleteFunc(items, func(i *Item) bool { return i.Category != category })
 }
 
-// CheckApp checks if a macOS .app exists
+// DevTools returns the built-in dev tools
+func DevTools() []*Item { return builtin("dev") }
+
+// Apps returns the built-in apps
+func Apps() []*Item { return builtin("app") }
+
+// AITools returns the built-in AI tools
+func AITools() []*Item { return builtin("ai") }
+
+// CheckApp checks for the item's .app bundle, reading the version from its
+// Info.plist, and falls back to Check when there is none
 func CheckApp(item *Item) {
-	if item.IsCask {
-		appPaths := map[string]string{
-			"google-chrome":      "/Applications/Google Chrome.app",
-			"zed":                "/Applications/Zed.app",
-			"iina":               "/Applications/IINA.app",
-			"tw93/tap/kakuku":    "/Applications/Kaku.app",
-			"karabiner-elements": "/Applications/Karabiner-Elements.app",
-			"tabby":              "/Applications/Tabby.app",
-		}
-		if p, ok := appPaths[item.BrewName]; ok {
-			if _, err := os.Stat(p); err == nil {
-				item.Status = Installed
-				ver, verErr := exec.Command("defaults", "read", p+"/Contents/Info.plist", "CFBundleShortVersionString").CombinedOutput()
-				if verErr == nil {
-					item.Version = strings.TrimSpace(string(ver))
-				}
-				return
+	if item.App != "" {
+		if _, err := os.Stat(item.App); err == nil {
+			item.Status = Installed
+			plist := item.App + "/Contents/Info.plist"
+			ver, verErr := cached("defaults read "+plist+" CFBundleShortVersionString", plist, func() ([]byte, error) {
+				return runner.Output(context.Background(), "defaults", "read", plist, "CFBundleShortVersionString")
+			})
+			if verErr == nil {
+				item.Version = strings.TrimSpace(string(ver))
+				item.Semver, _ = ParseSemver(item.Version)
 			}
+			checkMin(item)
+			return
 		}
 	}
 	Check(item)
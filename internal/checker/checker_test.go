@@ -1,7 +1,13 @@
 package checker
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/kittors/freshbox/internal/catalog"
+	"github.com/kittors/freshbox/internal/runner"
 )
 
 func TestDevToolsReturnsExpectedItems(t *testing.T) {
@@ -141,6 +147,28 @@ func TestCheckWithNoVerFlag(t *testing.T) {
 	}
 }
 
+func TestCheckWithFakeRunner(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := runner.NewFake().
+		Path("go", "/usr/local/go/bin/go").
+		On("/usr/local/go/bin/go version", runner.Response{Stdout: "go version go1.25.0 darwin/arm64\n"}).
+		Path("java", "/usr/bin/java").
+		On("/usr/bin/java --version", runner.Response{Stderr: "No Java runtime present", ExitCode: 1})
+	defer runner.Use(f)()
+
+	goItem := &Item{Name: "Go", Cmd: "go", VerFlag: "version"}
+	Check(goItem)
+	if goItem.Status != Installed || goItem.Version != "go version go1.25.0 darwin/arm64" {
+		t.Errorf("go = %v %q", goItem.Status, goItem.Version)
+	}
+
+	javaItem := &Item{Name: "Java", Cmd: "java", VerFlag: "--version"}
+	Check(javaItem)
+	if javaItem.Status != NotInstalled {
+		t.Error("a failing version stub should count as not installed")
+	}
+}
+
 func TestResolveCmdFindsPathBinaries(t *testing.T) {
 	// bash should always be findable
 	path := resolveCmd("bash")
@@ -163,12 +191,67 @@ func TestCheckAppForNonCask(t *testing.T) {
 		BrewName: "echo",
 	}
 	CheckApp(item)
-	// Should fall through to Check() since IsCask is false
+	// Should fall through to Check() since it has no App
 	if item.Status != Installed {
 		t.Error("non-cask item with valid cmd should be installed")
 	}
 }
 
+func TestResolveCmdChecksPathsFirst(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(home, ".cargo", "bin"), 0755)
+	rustup := filepath.Join(home, ".cargo", "bin", "rustup")
+	os.WriteFile(rustup, nil, 0755)
+	defer runner.Use(runner.NewFake().Path("rustup", "/usr/local/bin/rustup"))()
+
+	if got := resolveCmd("rustup", "/nonexistent/rustup", "~/.cargo/bin/rustup"); got != rustup {
+		t.Errorf("resolveCmd = %q, want %q", got, rustup)
+	}
+	if got := resolveCmd("rustup"); got != "/usr/local/bin/rustup" {
+		t.Errorf("without paths, resolveCmd = %q, want the PATH one", got)
+	}
+}
+
+func TestCheckAppReadsBundleVersion(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	app := filepath.Join(t.TempDir(), "Zed.app")
+	os.MkdirAll(app, 0755)
+	defer runner.Use(runner.NewFake().
+		On("defaults read "+app+"/Contents/Info.plist CFBundleShortVersionString", runner.Response{Stdout: "0.160.1\n"}))()
+
+	item := &Item{Name: "Zed", Cmd: "zed", App: app, MinVersion: "0.150"}
+	CheckApp(item)
+	if item.Status != Installed || item.Version != "0.160.1" {
+		t.Errorf("item = %+v", item)
+	}
+}
+
+func TestFromCatalog(t *testing.T) {
+	items, err := FromCatalog([]catalog.Tool{
+		{Name: "Zed", Category: "app", Install: catalog.InstallCask, Package: "zed", App: "/Applications/Zed.app"},
+		{Name: "Codex", Category: "ai", Install: catalog.InstallNpm, Package: "@openai/codex"},
+		{Name: "Go", Category: "dev", Install: catalog.InstallBrew, Package: "go", MinVersion: "1.25"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z := items[0]; z.BrewName != "zed" || !z.IsCask || z.App != "/Applications/Zed.app" {
+		t.Errorf("cask = %+v", z)
+	}
+	if c := items[1]; c.NpmName != "@openai/codex" || c.BrewName != "" {
+		t.Errorf("npm = %+v", c)
+	}
+	if g := items[2]; g.BrewName != "go" || g.IsCask || g.MinVersion != "1.25" {
+		t.Errorf("brew = %+v", g)
+	}
+
+	_, err = FromCatalog([]catalog.Tool{{Name: "Go", MinVersion: "newest"}})
+	if err == nil || !strings.Contains(err.Error(), `invalid min_version "newest"`) {
+		t.Errorf("err = %v", err)
+	}
+}
+
 func TestStatusConstants(t *testing.T) {
 	if NotInstalled != 0 {
 		t.Errorf("NotInstalled should be 0, got %d", NotInstalled)
@@ -0,0 +1,139 @@
+package checker
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kittors/freshbox/internal/backup"
+)
+
+// DetectWorkers bounds how many items are checked at once; each check execs
+// a --version that can take a second or more (the JVM, gradle)
+const DetectWorkers = 8
+
+// CacheTTL is how long a cached version is trusted, even if the binary
+// hasn't changed
+const CacheTTL = 10 * time.Minute
+
+// Detect checks item by its .app bundle when it has one, and by its command
+// otherwise
+func Detect(item *Item) {
+	if item.App != "" {
+		CheckApp(item)
+		return
+	}
+	Check(item)
+}
+
+// DetectAll detects items concurrently, DetectWorkers at a time. done, if
+// not nil, is called from the worker as each item finishes.
+func DetectAll(items []*Item, done func(*Item)) {
+	each(items, func(item *Item) {
+		Detect(item)
+		if done != nil {
+			done(item)
+		}
+	})
+}
+
+// each runs fn on every item with at most DetectWorkers at a time
+func each(items []*Item, fn func(*Item)) {
+	sem := make(chan struct{}, DetectWorkers)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(item)
+		}()
+	}
+	wg.Wait()
+}
+
+// --- Cache ---
+
+// cacheEntry is the output of a version command, valid while the file it
+// came from keeps its size and modification time
+type cacheEntry struct {
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+	Output  string    `json:"output"`
+	Checked time.Time `json:"checked"`
+}
+
+// versionCache is ~/.freshbox/cache/versions.json, keyed by command line.
+// It is reloaded whenever HOME points somewhere else.
+var versionCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]cacheEntry
+}
+
+// CachePath returns where detected versions are cached
+func CachePath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".freshbox", "cache", "versions.json")
+}
+
+// cached returns the output of run for key, reusing the cached one while
+// file is unchanged and younger than CacheTTL. Only successful runs are
+// cached, and nothing is cached for a file that can't be stat'ed.
+func cached(key, file string, run func() ([]byte, error)) ([]byte, error) {
+	info, statErr := os.Stat(file)
+	if statErr == nil {
+		if e, ok := cacheGet(key); ok && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) && time.Since(e.Checked) < CacheTTL {
+			return []byte(e.Output), nil
+		}
+	}
+	out, err := run()
+	if err == nil && statErr == nil {
+		cachePut(key, cacheEntry{ModTime: info.ModTime(), Size: info.Size(), Output: string(out), Checked: time.Now()})
+	}
+	return out, err
+}
+
+// loadCache makes sure versionCache holds the file for the current HOME;
+// callers hold the lock
+func loadCache() {
+	path := CachePath()
+	if versionCache.path == path && versionCache.entries != nil {
+		return
+	}
+	versionCache.path = path
+	versionCache.entries = map[string]cacheEntry{}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &versionCache.entries)
+	}
+}
+
+func cacheGet(key string) (cacheEntry, bool) {
+	versionCache.mu.Lock()
+	defer versionCache.mu.Unlock()
+	loadCache()
+	e, ok := versionCache.entries[key]
+	return e, ok
+}
+
+// cachePut records an entry and rewrites the cache file. A cache that can't
+// be written just makes the next launch slower, so errors are dropped.
+func cachePut(key string, e cacheEntry) {
+	versionCache.mu.Lock()
+	defer versionCache.mu.Unlock()
+	loadCache()
+	versionCache.entries[key] = e
+	data, err := json.MarshalIndent(versionCache.entries, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(versionCache.path), 0755); err != nil {
+		return
+	}
+	backup.WriteAtomic(versionCache.path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,101 @@
+package checker
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kittors/freshbox/internal/runner"
+)
+
+func TestEachIsBounded(t *testing.T) {
+	var mu sync.Mutex
+	running, peak := 0, 0
+	items := make([]*Item, 3*DetectWorkers)
+	for i := range items {
+		items[i] = &Item{}
+	}
+	each(items, func(item *Item) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		item.Status = Installed
+	})
+	if peak > DetectWorkers || peak < 2 {
+		t.Errorf("peak concurrency = %d, want 2..%d", peak, DetectWorkers)
+	}
+	for _, item := range items {
+		if item.Status != Installed {
+			t.Fatal("every item should be processed")
+		}
+	}
+}
+
+func TestDetectAllReportsEachItem(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer runner.Use(runner.NewFake())()
+	items := append(DevTools(), Apps()...)
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	DetectAll(items, func(item *Item) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen[item.Name] = true
+	})
+	if len(seen) != len(items) {
+		t.Errorf("done called for %d of %d items", len(seen), len(items))
+	}
+}
+
+func TestCheckCachesVersionUntilBinaryChanges(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	bin := filepath.Join(home, "bin", "tool")
+	os.MkdirAll(filepath.Dir(bin), 0755)
+	os.WriteFile(bin, []byte("#!/bin/sh\n"), 0755)
+	f := runner.NewFake().Path("tool", bin).On(bin+" --version", runner.Response{Stdout: "tool 1.0.0\n"})
+	defer runner.Use(f)()
+
+	item := &Item{Name: "Tool", Cmd: "tool", VerFlag: "--version"}
+	Check(item)
+	f.On(bin+" --version", runner.Response{Stdout: "tool 2.0.0\n"})
+	Check(item)
+	if item.Version != "tool 1.0.0" || len(f.Cmdlines()) != 1 {
+		t.Errorf("second check should come from the cache: %q, ran %v", item.Version, f.Cmdlines())
+	}
+	if _, err := os.Stat(CachePath()); err != nil {
+		t.Errorf("cache file: %v", err)
+	}
+
+	// an upgrade replaces the binary
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(bin, later, later)
+	Check(item)
+	if item.Version != "tool 2.0.0" || item.Semver != (Semver{2, 0, 0}) {
+		t.Errorf("a changed binary should be checked again, got %q", item.Version)
+	}
+}
+
+func TestCheckDoesNotCacheFailures(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	bin := filepath.Join(home, "java")
+	os.WriteFile(bin, []byte("stub"), 0755)
+	f := runner.NewFake().Path("java", bin).On(bin+" --version", runner.Response{Stderr: "No Java runtime present", ExitCode: 1})
+	defer runner.Use(f)()
+
+	item := &Item{Name: "Java", Cmd: "java", VerFlag: "--version"}
+	Check(item)
+	f.On(bin+" --version", runner.Response{Stdout: "openjdk 21.0.2 2024-01-16\n"})
+	Check(item)
+	if item.Status != Installed || len(f.Cmdlines()) != 2 {
+		t.Errorf("a failed check should run again: %v, ran %v", item.Status, f.Cmdlines())
+	}
+}
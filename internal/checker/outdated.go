@@ -0,0 +1,151 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kittors/freshbox/internal/runner"
+)
+
+// OutdatedTimeout bounds CheckOutdated; brew, npm and rustup all go to the
+// network, and npm waits indefinitely when it is offline
+const OutdatedTimeout = 20 * time.Second
+
+// CheckOutdated marks installed items that have a newer version available as
+// Outdated, asking Homebrew, npm and rustup at the same time. A source is
+// only asked if one of its items is installed; one that is missing, fails or
+// runs past OutdatedTimeout is skipped and its items stay Installed.
+func CheckOutdated(ctx context.Context, items []*Item) {
+	ctx, cancel := context.WithTimeout(ctx, OutdatedTimeout)
+	defer cancel()
+
+	brew := map[string]*Item{}
+	npm := map[string]*Item{}
+	var rust *Item
+	for _, item := range items {
+		if item.Status == NotInstalled {
+			continue
+		}
+		switch {
+		case item.Cmd == "rustup":
+			rust = item
+		case item.NpmName != "":
+			npm[item.NpmName] = item
+		case item.BrewName != "":
+			// brew reports tapped formulas by their short name
+			brew[path.Base(item.BrewName)] = item
+		}
+	}
+	// each source marks its own items, so they can run side by side
+	var wg sync.WaitGroup
+	run := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn()
+		}()
+	}
+	if len(brew) > 0 {
+		run(func() { brewOutdated(ctx, brew) })
+	}
+	if len(npm) > 0 {
+		run(func() { npmOutdated(ctx, npm) })
+	}
+	if rust != nil {
+		run(func() { rustupOutdated(ctx, rust) })
+	}
+	wg.Wait()
+}
+
+// markOutdated records an available upgrade; from replaces the version the
+// item reported, as it is the one the package manager will upgrade
+func markOutdated(item *Item, from, to string) {
+	item.Status = Outdated
+	if from != "" {
+		item.Version = from
+		item.Semver, _ = ParseSemver(from)
+	}
+	item.Latest = to
+}
+
+// brewOutdated reads `brew outdated --json=v2` for formulas and casks
+func brewOutdated(ctx context.Context, items map[string]*Item) {
+	if resolveCmd("brew") == "" {
+		return
+	}
+	res, err := runner.Run(ctx, "brew", "outdated", "--json=v2")
+	if err != nil {
+		return
+	}
+	type pkg struct {
+		Name              string   `json:"name"`
+		InstalledVersions []string `json:"installed_versions"`
+		CurrentVersion    string   `json:"current_version"`
+	}
+	var out struct {
+		Formulae []pkg `json:"formulae"`
+		Casks    []pkg `json:"casks"`
+	}
+	if json.Unmarshal([]byte(res.Stdout), &out) != nil {
+		return
+	}
+	for _, p := range append(out.Formulae, out.Casks...) {
+		item, ok := items[path.Base(p.Name)]
+		if !ok {
+			continue
+		}
+		from := ""
+		if n := len(p.InstalledVersions); n > 0 {
+			from = p.InstalledVersions[n-1]
+		}
+		markOutdated(item, from, p.CurrentVersion)
+	}
+}
+
+// npmOutdated reads `npm outdated -g --json`, which exits 1 when anything is outdated
+func npmOutdated(ctx context.Context, items map[string]*Item) {
+	if resolveCmd("npm") == "" {
+		return
+	}
+	res, _ := runner.Run(ctx, "npm", "outdated", "-g", "--json")
+	if ctx.Err() != nil {
+		return
+	}
+	var out map[string]struct {
+		Current string `json:"current"`
+		Latest  string `json:"latest"`
+	}
+	if json.Unmarshal([]byte(res.Stdout), &out) != nil {
+		return
+	}
+	for name, p := range out {
+		if item, ok := items[name]; ok && p.Latest != "" && p.Latest != p.Current {
+			markOutdated(item, p.Current, p.Latest)
+		}
+	}
+}
+
+// rustupOutdated reads `rustup check`, e.g.
+//
+//	stable-aarch64-apple-darwin - Update available : 1.75.0 (82e1608df 2023-12-21) -> 1.76.0 (07dca489a 2024-02-04)
+func rustupOutdated(ctx context.Context, item *Item) {
+	res, err := runner.Run(ctx, resolveCmd("rustup"), "check")
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(res.Stdout, "\n") {
+		_, update, ok := strings.Cut(line, "Update available :")
+		if !ok || strings.HasPrefix(line, "rustup ") {
+			continue
+		}
+		from, to, ok := strings.Cut(update, "->")
+		if f, t := strings.Fields(from), strings.Fields(to); ok && len(f) > 0 && len(t) > 0 {
+			markOutdated(item, f[0], t[0])
+			return
+		}
+	}
+}
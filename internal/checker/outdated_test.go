@@ -0,0 +1,121 @@
+package checker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kittors/freshbox/internal/runner"
+)
+
+// outdatedFake finds brew, npm and rustup and answers their outdated checks
+func outdatedFake(brew, npm, rustup string) *runner.Fake {
+	return runner.NewFake().
+		Path("brew", "/opt/homebrew/bin/brew").
+		Path("npm", "/opt/homebrew/bin/npm").
+		Path("rustup", "/opt/homebrew/bin/rustup").
+		On("brew outdated --json=v2", runner.Response{Stdout: brew}).
+		On("npm outdated -g --json", runner.Response{Stdout: npm, ExitCode: 1}).
+		On("/opt/homebrew/bin/rustup check", runner.Response{Stdout: rustup})
+}
+
+func installedCatalog() map[string]*Item {
+	items := map[string]*Item{}
+	for _, list := range [][]*Item{DevTools(), Apps(), AITools()} {
+		for _, item := range list {
+			item.Status = Installed
+			item.Version = "raw --version line"
+			items[item.Name] = item
+		}
+	}
+	return items
+}
+
+func values(items map[string]*Item) []*Item {
+	var out []*Item
+	for _, item := range items {
+		out = append(out, item)
+	}
+	return out
+}
+
+func TestCheckOutdated_ParsesEverySource(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	brew := `{
+  "formulae": [
+    {"name": "git", "installed_versions": ["2.39.3"], "current_version": "2.44.0", "pinned": false},
+    {"name": "mole", "installed_versions": ["1.0", "1.1"], "current_version": "1.2"},
+    {"name": "not-in-catalog", "installed_versions": ["1"], "current_version": "2"}
+  ],
+  "casks": [
+    {"name": "zed", "installed_versions": ["0.150.0"], "current_version": "0.160.1"}
+  ]
+}`
+	npm := `{
+  "@openai/codex": {"current": "0.1.0", "wanted": "0.2.0", "latest": "0.2.0"},
+  "@anthropic-ai/claude-code": {"current": "1.0.0", "wanted": "1.0.0", "latest": "1.0.0"}
+}`
+	rustup := "stable-aarch64-apple-darwin - Update available : 1.75.0 (82e1608df 2023-12-21) -> 1.76.0 (07dca489a 2024-02-04)\n" +
+		"rustup - Update available : 1.26.0 -> 1.27.0\n"
+	defer runner.Use(outdatedFake(brew, npm, rustup))()
+
+	items := installedCatalog()
+	CheckOutdated(context.Background(), values(items))
+
+	want := map[string][2]string{
+		"Git":           {"2.39.3", "2.44.0"},
+		"Mole":          {"1.1", "1.2"},
+		"Zed":           {"0.150.0", "0.160.1"},
+		"Codex":         {"0.1.0", "0.2.0"},
+		"Rust (rustup)": {"1.75.0", "1.76.0"},
+	}
+	for name, item := range items {
+		w, ok := want[name]
+		switch {
+		case ok && (item.Status != Outdated || item.Version != w[0] || item.Latest != w[1]):
+			t.Errorf("%s = %v %q → %q, want %s → %s", name, item.Status, item.Version, item.Latest, w[0], w[1])
+		case !ok && item.Status != Installed:
+			t.Errorf("%s should stay installed, got %v", name, item.Status)
+		}
+	}
+}
+
+func TestCheckOutdated_EmptyOrMalformedOutput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, tc := range []struct{ name, brew, npm, rustup string }{
+		{"empty", "", "", ""},
+		{"up to date", `{"formulae":[],"casks":[]}`, `{}`, "stable-aarch64-apple-darwin - Up to date : 1.76.0\n"},
+		{"malformed", `{"formulae": [`, `npm ERR! network`, "stable - Update available : ->\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			defer runner.Use(outdatedFake(tc.brew, tc.npm, tc.rustup))()
+			items := installedCatalog()
+			CheckOutdated(context.Background(), values(items))
+			for name, item := range items {
+				if item.Status != Installed || item.Latest != "" {
+					t.Errorf("%s = %v %q", name, item.Status, item.Latest)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckOutdated_SkipsSourcesWithNothingInstalled(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := outdatedFake("", "", "")
+	defer runner.Use(f)()
+	CheckOutdated(context.Background(), append(DevTools(), AITools()...))
+	if calls := f.Cmdlines(); len(calls) != 0 {
+		t.Errorf("nothing is installed, but ran %v", calls)
+	}
+}
+
+func TestCheckOutdated_FailingSourceIsSkipped(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := outdatedFake("", "", "").On("brew outdated --json=v2", runner.Response{Stderr: "Error: offline", ExitCode: 1})
+	defer runner.Use(f)()
+	items := installedCatalog()
+	CheckOutdated(context.Background(), values(items))
+	if items["Git"].Status != Installed {
+		t.Error("a failed brew check should leave Git installed")
+	}
+}
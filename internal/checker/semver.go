@@ -0,0 +1,82 @@
+package checker
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Semver is a version reduced to major.minor.patch, enough to compare the
+// versions tools print; pre-release and build suffixes are dropped
+type Semver struct {
+	Major, Minor, Patch int
+}
+
+var (
+	dottedVersion = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+	bareVersion   = regexp.MustCompile(`\d+`)
+)
+
+// ParseSemver finds the first version number in s, e.g. 2.39.3 in
+// "git version 2.39.3 (Apple Git-145)" or 1.22.1 in "go version go1.22.1".
+// A dotted number wins over a bare one, so "openjdk 21 2023-09-19" is 21.
+func ParseSemver(s string) (Semver, bool) {
+	if m := dottedVersion.FindStringSubmatch(s); m != nil {
+		return Semver{Major: atoi(m[1]), Minor: atoi(m[2]), Patch: atoi(m[3])}, true
+	}
+	if m := bareVersion.FindString(s); m != "" {
+		return Semver{Major: atoi(m)}, true
+	}
+	return Semver{}, false
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// Compare returns -1, 0 or 1 as v is older than, equal to or newer than o
+func (v Semver) Compare(o Semver) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		switch {
+		case d < 0:
+			return -1
+		case d > 0:
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v Semver) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// extractVersion splits --version output into the line shown to the user and
+// its parsed version. Without pattern that is the first non-empty line;
+// with one, the first line it matches, parsing its last group.
+func extractVersion(out, pattern string) (raw string, v Semver, ok bool) {
+	var re *regexp.Regexp
+	if pattern != "" {
+		re = regexp.MustCompile(pattern)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if re == nil {
+			v, ok = ParseSemver(line)
+			return line, v, ok
+		}
+		if m := re.FindStringSubmatch(line); m != nil {
+			v, ok = ParseSemver(m[len(m)-1])
+			return line, v, ok
+		}
+		if raw == "" {
+			raw = line
+		}
+	}
+	return raw, Semver{}, false
+}
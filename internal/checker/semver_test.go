@@ -0,0 +1,103 @@
+package checker
+
+import (
+	"testing"
+
+	"github.com/kittors/freshbox/internal/runner"
+)
+
+func TestParseSemver(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Semver
+		ok   bool
+	}{
+		{"git version 2.39.3 (Apple Git-145)", Semver{2, 39, 3}, true},
+		{"openjdk 21.0.2 2024-01-16", Semver{21, 0, 2}, true},
+		{"openjdk 21 2023-09-19", Semver{21, 0, 0}, true},
+		{"go version go1.22.1 darwin/arm64", Semver{1, 22, 1}, true},
+		{"Apache Maven 3.9.6 (bc0240f3c744dd6b6ec2920b3cd08dcc295161ae)", Semver{3, 9, 6}, true},
+		{"rustup 1.26.0 (5af9b9484 2023-04-05)", Semver{1, 26, 0}, true},
+		{"1.0.98 (Claude Code)", Semver{1, 0, 98}, true},
+		{"Python 3.12", Semver{3, 12, 0}, true},
+		{"v22.11.0", Semver{22, 11, 0}, true},
+		{"bun", Semver{}, false},
+		{"", Semver{}, false},
+	} {
+		got, ok := ParseSemver(tc.in)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("ParseSemver(%q) = %v, %v; want %v, %v", tc.in, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	for _, tc := range []struct {
+		a, b Semver
+		want int
+	}{
+		{Semver{1, 25, 0}, Semver{1, 25, 0}, 0},
+		{Semver{1, 24, 9}, Semver{1, 25, 0}, -1},
+		{Semver{21, 0, 0}, Semver{17, 0, 12}, 1},
+		{Semver{2, 39, 3}, Semver{2, 39, 10}, -1},
+	} {
+		if got := tc.a.Compare(tc.b); got != tc.want {
+			t.Errorf("%v.Compare(%v) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestExtractVersionWithPattern(t *testing.T) {
+	gradle := "\n------------------------------------------------------------\nGradle 8.6\n------------------------------------------------------------\n\nBuild time:   2024-02-02 16:47:16 UTC\n"
+	raw, v, ok := extractVersion(gradle, `^Gradle (\S+)`)
+	if raw != "Gradle 8.6" || v != (Semver{8, 6, 0}) || !ok {
+		t.Errorf("gradle = %q %v %v", raw, v, ok)
+	}
+	if raw, _, ok := extractVersion("something else\n", `^Gradle (\S+)`); raw != "something else" || ok {
+		t.Errorf("no match = %q %v; want the first line and no version", raw, ok)
+	}
+}
+
+func TestCheckMarksTooOldAsOutdated(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := runner.NewFake().
+		Path("java", "/opt/homebrew/bin/java").
+		On("/opt/homebrew/bin/java --version", runner.Response{Stdout: "openjdk 17.0.10 2024-01-16\nOpenJDK Runtime Environment Homebrew\n"}).
+		Path("go", "/usr/local/go/bin/go").
+		On("/usr/local/go/bin/go version", runner.Response{Stdout: "go version go1.25.1 darwin/arm64\n"})
+	defer runner.Use(f)()
+
+	java := &Item{Name: "Java (JDK)", Cmd: "java", VerFlag: "--version", MinVersion: "21"}
+	Check(java)
+	if java.Status != Outdated || !java.TooOld() || java.Semver != (Semver{17, 0, 10}) {
+		t.Errorf("java 17 with minimum 21 = %v %v", java.Status, java.Semver)
+	}
+	if java.Version != "openjdk 17.0.10 2024-01-16" {
+		t.Errorf("raw version = %q", java.Version)
+	}
+
+	goItem := &Item{Name: "Go", Cmd: "go", VerFlag: "version", MinVersion: "1.25"}
+	Check(goItem)
+	if goItem.Status != Installed {
+		t.Errorf("go 1.25.1 with minimum 1.25 = %v", goItem.Status)
+	}
+	Require(goItem, "1.26")
+	if goItem.Status != Outdated {
+		t.Error("raising the minimum above 1.25.1 should make it outdated")
+	}
+	Require(goItem, "1.20")
+	if goItem.Status != Installed {
+		t.Error("lowering the minimum should make it installed again")
+	}
+}
+
+func TestTooOldNeedsAParsedVersion(t *testing.T) {
+	item := &Item{Status: Installed, Version: "unknown", MinVersion: "21"}
+	if item.TooOld() {
+		t.Error("a version that can't be parsed shouldn't count as too old")
+	}
+	item = &Item{Status: NotInstalled, MinVersion: "21"}
+	if item.TooOld() {
+		t.Error("a missing tool isn't too old, it is missing")
+	}
+}
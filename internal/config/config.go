@@ -1,19 +1,43 @@
 package config
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+
+	"github.com/kittors/freshbox/internal/backup"
+	"github.com/kittors/freshbox/internal/catalog"
+	"github.com/kittors/freshbox/internal/ledger"
+	"github.com/kittors/freshbox/internal/redact"
+	"github.com/kittors/freshbox/internal/runner"
+	"github.com/kittors/freshbox/internal/secrets"
+	"github.com/kittors/freshbox/internal/tomledit"
 )
 
+// CodexKeyEnv is the variable Codex reads its API key from when the key is
+// kept in the secret store instead of auth.json
+const CodexKeyEnv = "OPENAI_API_KEY"
+
 // CodexConfig represents Codex CLI configuration
 type CodexConfig struct {
 	Model         string
 	ThinkingLevel string
 	BaseURL       string
+	EnvKey        string // provider reads its key from this variable instead of auth.json
+	// Provider names the [model_providers.*] table written for BaseURL;
+	// empty is "freshbox"
+	Provider string
+	// KeyRef is a secret-store name exported as EnvKey from ~/.zshrc
+	KeyRef string
+	// Reset removes the settings left empty instead of keeping them, so a
+	// switched-to profile doesn't inherit the last one's model or base URL
+	Reset bool
 }
 
 // CodexAuth represents Codex auth configuration
@@ -26,6 +50,13 @@ type ClaudeConfig struct {
 	Model   string
 	BaseURL string
 	APIKey  string
+	// Plaintext writes APIKey into settings.json; otherwise it goes to the
+	// secret store and Claude fetches it through apiKeyHelper
+	Plaintext bool
+	// KeyRef is an already stored secret for apiKeyHelper, used without APIKey
+	KeyRef string
+	// Reset removes the settings left empty, as CodexConfig.Reset does
+	Reset bool
 }
 
 // MCPServer represents an MCP server configuration
@@ -33,137 +64,311 @@ type MCPServer struct {
 	Name    string   `json:"name"`
 	Command string   `json:"command"`
 	Args    []string `json:"args"`
+	// Transport is catalog.TransportHTTP or TransportSSE for a server
+	// reached at URL; empty or stdio launches Command
+	Transport string            `json:"transport,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"` // ${NAME} is filled in from Env
+	// Needs lists the environment variables the server won't work without;
+	// Env holds their values and is never marshaled
+	Needs []catalog.MCPEnv  `json:"needs,omitempty"`
+	Env   map[string]string `json:"-"`
 }
 
-// AvailableMCPs returns all popular MCP servers with correct npm package names
-func AvailableMCPs() []MCPServer {
-	home, _ := os.UserHomeDir()
-	return []MCPServer{
-		{Name: "Playwright", Command: "npx", Args: []string{"-y", "@playwright/mcp@latest", "--headless"}},
-		{Name: "Context7", Command: "npx", Args: []string{"-y", "@upstash/context7-mcp@latest"}},
-		{Name: "Filesystem", Command: "npx", Args: []string{"-y", "@modelcontextprotocol/server-filesystem@latest", home}},
-		{Name: "GitHub", Command: "npx", Args: []string{"-y", "@modelcontextprotocol/server-github@latest"}},
-		{Name: "Memory", Command: "npx", Args: []string{"-y", "@modelcontextprotocol/server-memory@latest"}},
-		{Name: "Sequential Thinking", Command: "npx", Args: []string{"-y", "@modelcontextprotocol/server-sequential-thinking@latest"}},
-		{Name: "Fetch", Command: "npx", Args: []string{"-y", "@modelcontextprotocol/server-fetch@latest"}},
-		{Name: "Brave Search", Command: "npx", Args: []string{"-y", "@modelcontextprotocol/server-brave-search@latest"}},
-		{Name: "Slack", Command: "npx", Args: []string{"-y", "@modelcontextprotocol/server-slack@latest"}},
-		{Name: "Google Maps", Command: "npx", Args: []string{"-y", "@modelcontextprotocol/server-google-maps@latest"}},
-		{Name: "SQLite", Command: "npx", Args: []string{"-y", "@modelcontextprotocol/server-sqlite@latest"}},
-	}
-}
-
-// WriteCodexConfig merges model/thinking/baseURL into existing ~/.codex/config.toml
-func WriteCodexConfig(cfg CodexConfig) error {
-	home, _ := os.UserHomeDir()
-	dir := filepath.Join(home, ".codex")
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("create codex dir: %w", err)
+// Remote reports a server reached at URL rather than launched
+func (s MCPServer) Remote() bool {
+	return s.Transport == catalog.TransportHTTP || s.Transport == catalog.TransportSSE
+}
+
+// HeaderLines returns the server's headers as "Name: value", sorted by name
+func (s MCPServer) HeaderLines() []string {
+	var lines []string
+	for _, name := range slices.Sorted(maps.Keys(s.Headers)) {
+		lines = append(lines, name+": "+s.header(name))
 	}
-	configPath := filepath.Join(dir, "config.toml")
+	return lines
+}
 
-	// Read existing config
-	existing, _ := os.ReadFile(configPath)
-	lines := strings.Split(string(existing), "\n")
-
-	// Build a map of top-level keys to update
-	updates := map[string]string{}
-	if cfg.Model != "" {
-		updates["model"] = fmt.Sprintf(`model = "%s"`, cfg.Model)
-	}
-	if cfg.ThinkingLevel != "" {
-		updates["model_reasoning_effort"] = fmt.Sprintf(`model_reasoning_effort = "%s"`, cfg.ThinkingLevel)
-	}
-
-	// Track which keys we've updated in-place
-	updated := map[string]bool{}
-	var result []string
-	inSection := false
-
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-
-		// Track if we're inside a [section]
-		if strings.HasPrefix(trimmed, "[") {
-			inSection = true
-		} else if !inSection {
-			// Only replace top-level keys (before any [section])
-			for key, newLine := range updates {
-				if strings.HasPrefix(trimmed, key+" ") || strings.HasPrefix(trimmed, key+"=") {
-					line = newLine
-					updated[key] = true
-					break
-				}
-			}
+// secretIn returns the secret variable a header value refers to as ${NAME},
+// or "" if it has none
+func (s MCPServer) secretIn(value string) string {
+	for _, e := range s.Needs {
+		if e.Secret && strings.Contains(value, "${"+e.Name+"}") {
+			return e.Name
 		}
-
-		result = append(result, line)
 	}
+	return ""
+}
 
-	// If we need to handle base_url via model_providers section
-	if cfg.BaseURL != "" {
-		providerName := "freshbox"
-		updates["model_provider"] = fmt.Sprintf(`model_provider = "%s"`, providerName)
+// header returns a header's value with ${NAME} replaced by the variable's
+func (s MCPServer) header(name string) string {
+	v := s.Headers[name]
+	for _, e := range s.Needs {
+		v = strings.ReplaceAll(v, "${"+e.Name+"}", s.Env[e.Name])
+	}
+	return v
+}
 
-		if !updated["model_provider"] {
-			result = append([]string{updates["model_provider"]}, result...)
-		} else {
-			for i, line := range result {
-				trimmed := strings.TrimSpace(line)
-				if strings.HasPrefix(trimmed, "model_provider ") || strings.HasPrefix(trimmed, "model_provider=") {
-					result[i] = updates["model_provider"]
-					break
-				}
-			}
+// EnvPairs returns the server's variables as NAME=VALUE, in the order of
+// Needs; variables without a value are left out
+func (s MCPServer) EnvPairs() []string {
+	var pairs []string
+	for _, e := range s.Needs {
+		if v := s.Env[e.Name]; v != "" {
+			pairs = append(pairs, e.Name+"="+v)
 		}
+	}
+	return pairs
+}
 
-		providerSection := fmt.Sprintf(`
-[model_providers.%s]
-name = "openai"
-base_url = "%s"
-wire_api = "responses"
-requires_openai_auth = true`, providerName, cfg.BaseURL)
+// Masked returns a copy of s with its secret values replaced by the redact
+// mask, for plans and logs
+func (s MCPServer) Masked() MCPServer {
+	if len(s.Env) == 0 {
+		return s
+	}
+	s.Env = maps.Clone(s.Env)
+	for _, e := range s.Needs {
+		if e.Secret && s.Env[e.Name] != "" {
+			s.Env[e.Name] = redact.Mask
+		}
+	}
+	return s
+}
 
-		var cleaned []string
-		skipSection := false
-		for _, line := range result {
-			trimmed := strings.TrimSpace(line)
-			if trimmed == fmt.Sprintf("[model_providers.%s]", providerName) {
-				skipSection = true
-				continue
+// FillEnv sets the variables each server needs from values, or else from
+// freshbox's own environment, and lists the ones without a value as
+// "GitHub: GITHUB_PERSONAL_ACCESS_TOKEN"
+func FillEnv(servers []MCPServer, values map[string]string) (missing []string) {
+	for i, s := range servers {
+		if len(s.Needs) == 0 {
+			continue
+		}
+		env := make(map[string]string, len(s.Needs))
+		for _, e := range s.Needs {
+			if v := cmp.Or(values[e.Name], os.Getenv(e.Name)); v != "" {
+				env[e.Name] = v
+			} else {
+				missing = append(missing, s.Name+": "+e.Name)
 			}
-			if skipSection && strings.HasPrefix(trimmed, "[") {
-				skipSection = false
+		}
+		servers[i].Env = env
+	}
+	return missing
+}
+
+// addSecrets registers the servers' secret values with redact
+func addSecrets(servers []MCPServer) {
+	for _, s := range servers {
+		for _, e := range s.Needs {
+			if e.Secret {
+				redact.Add(s.Env[e.Name])
 			}
-			if !skipSection {
-				cleaned = append(cleaned, line)
+		}
+	}
+}
+
+// AvailableMCPs returns the built-in catalog's MCP servers
+func AvailableMCPs() []MCPServer {
+	return FromCatalog(catalog.Builtin().MCPs)
+}
+
+// FromCatalog turns catalog MCP entries into servers, expanding a leading ~
+// in their args to the home directory
+func FromCatalog(mcps []catalog.MCP) []MCPServer {
+	home, _ := os.UserHomeDir()
+	servers := make([]MCPServer, 0, len(mcps))
+	for _, m := range mcps {
+		args := make([]string, len(m.Args))
+		for i, a := range m.Args {
+			if a == "~" {
+				a = home
+			} else if rest, ok := strings.CutPrefix(a, "~/"); ok {
+				a = filepath.Join(home, rest)
 			}
+			args[i] = a
+		}
+		servers = append(servers, MCPServer{
+			Name:      m.Name,
+			Command:   m.Command,
+			Args:      args,
+			Transport: m.Transport,
+			URL:       m.URL,
+			Headers:   m.Headers,
+			Needs:     m.Env,
+		})
+	}
+	return servers
+}
+
+// codexProvider is the [model_providers.*] table freshbox writes for a custom
+// base URL when CodexConfig.Provider is empty
+const codexProvider = "freshbox"
+
+// WriteCodexConfig merges model/thinking/baseURL into existing ~/.codex/config.toml,
+// leaving every other line of the file as it was
+func WriteCodexConfig(ctx context.Context, cfg CodexConfig) error {
+	edits, err := codexEdits(cfg)
+	if err != nil {
+		return err
+	}
+	return writeAll(ctx, edits)
+}
+
+// WriteAIConfig writes the Codex and Claude Code settings that aren't nil
+// together: every file is prepared first, and if one write fails the files
+// already written are put back, so the tools never end up half switched
+func WriteAIConfig(ctx context.Context, codex *CodexConfig, claude *ClaudeConfig) error {
+	var edits []fileEdit
+	if codex != nil {
+		e, err := codexEdits(*codex)
+		if err != nil {
+			return err
+		}
+		edits = append(edits, e...)
+	}
+	if claude != nil {
+		e, err := claudeEdit(ctx, *claude)
+		if err != nil {
+			return err
 		}
-		result = cleaned
-		result = append(result, providerSection)
+		edits = append(edits, e)
+	}
+	return writeAll(ctx, edits)
+}
+
+// codexEdits prepares config.toml and, for a KeyRef, the ~/.zshrc export
+func codexEdits(cfg CodexConfig) ([]fileEdit, error) {
+	home, _ := os.UserHomeDir()
+	dir := filepath.Join(home, ".codex")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create codex dir: %w", err)
+	}
+	configPath := filepath.Join(dir, "config.toml")
+	doc, err := readTOML(configPath)
+	if err != nil {
+		return nil, err
 	}
 
-	// Append any top-level keys that weren't found in existing file
-	var prepend []string
-	for key, newLine := range updates {
-		if !updated[key] && key != "model_provider" {
-			prepend = append(prepend, newLine)
+	set := func(value any, path ...string) {
+		if err == nil {
+			err = doc.Set(path, value)
+		}
+	}
+	switch {
+	case cfg.Model != "":
+		set(cfg.Model, "model")
+	case cfg.Reset:
+		doc.Delete("model")
+	}
+	switch {
+	case cfg.ThinkingLevel != "":
+		set(cfg.ThinkingLevel, "model_reasoning_effort")
+	case cfg.Reset:
+		doc.Delete("model_reasoning_effort")
+	}
+	switch {
+	case cfg.BaseURL != "":
+		name := cmp.Or(cfg.Provider, codexProvider)
+		provider := []string{"model_providers", name}
+		set(name, "model_provider")
+		set("openai", append(provider, "name")...)
+		set(cfg.BaseURL, append(provider, "base_url")...)
+		set("responses", append(provider, "wire_api")...)
+		if cfg.EnvKey != "" {
+			set(cfg.EnvKey, append(provider, "env_key")...)
+			doc.Delete(append(provider, "requires_openai_auth")...)
+		} else {
+			set(true, append(provider, "requires_openai_auth")...)
+			doc.Delete(append(provider, "env_key")...)
 		}
+	case cfg.Reset:
+		// back to Codex's built-in OpenAI provider
+		doc.Delete("model_provider")
 	}
-	if len(prepend) > 0 {
-		result = append(prepend, result...)
+	if err != nil {
+		return nil, fmt.Errorf("update %s: %w", configPath, err)
+	}
+	edits := []fileEdit{{path: configPath, data: doc.Bytes(), perm: 0644}}
+	if cfg.KeyRef != "" {
+		e, err := shellEnvEdit(cmp.Or(cfg.EnvKey, CodexKeyEnv), secrets.Default().HelperCommand(cfg.KeyRef))
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, e)
 	}
+	return edits, nil
+}
 
-	content := strings.Join(result, "\n")
-	for strings.Contains(content, "\n\n\n") {
-		content = strings.ReplaceAll(content, "\n\n\n", "\n\n")
+// readTOML parses a TOML file for editing; a missing file is an empty document
+func readTOML(path string) (*tomledit.Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	doc, err := tomledit.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
 	}
+	return doc, nil
+}
 
-	return os.WriteFile(configPath, []byte(strings.TrimSpace(content)+"\n"), 0644)
+// fileEdit is the new content of a file, prepared before anything is written
+type fileEdit struct {
+	path string
+	data []byte
+	perm os.FileMode
+}
+
+// writeAll writes every edit through backup.WriteFile. If one fails, the
+// edits already written are put back as they were before returning the error.
+func writeAll(ctx context.Context, edits []fileEdit) error {
+	type original struct {
+		path    string
+		data    []byte
+		perm    os.FileMode
+		existed bool
+	}
+	originals := make([]original, len(edits))
+	for i, e := range edits {
+		path := e.path
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			path = real
+		}
+		originals[i].path = path
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", e.path, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", e.path, err)
+		}
+		originals[i] = original{path: path, data: data, perm: info.Mode().Perm(), existed: true}
+	}
+
+	for i, e := range edits {
+		err := backup.WriteFile(ctx, e.path, e.data, e.perm)
+		if err == nil {
+			continue
+		}
+		for _, o := range slices.Backward(originals[:i]) {
+			if o.existed {
+				backup.WriteAtomic(o.path, o.data, o.perm)
+			} else {
+				os.Remove(o.path)
+			}
+		}
+		return fmt.Errorf("write %s: %w", e.path, err)
+	}
+	return nil
 }
 
 // WriteCodexAuth writes auth.json for Codex
-func WriteCodexAuth(auth CodexAuth) error {
+func WriteCodexAuth(ctx context.Context, auth CodexAuth) error {
 	home, _ := os.UserHomeDir()
 	dir := filepath.Join(home, ".codex")
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -174,15 +379,75 @@ func WriteCodexAuth(auth CodexAuth) error {
 	if err != nil {
 		return fmt.Errorf("marshal auth: %w", err)
 	}
-	return os.WriteFile(filepath.Join(dir, "auth.json"), data, 0600)
+	return backup.WriteFile(ctx, filepath.Join(dir, "auth.json"), data, 0600)
+}
+
+// StoreCodexKey puts the Codex API key in the secret store and exports it
+// from ~/.zshrc, so Codex finds it without a plaintext auth.json
+func StoreCodexKey(ctx context.Context, key string) error {
+	store := secrets.Default()
+	if err := store.Set(ctx, secrets.CodexAPIKey, key); err != nil {
+		return err
+	}
+	return WriteShellEnv(ctx, CodexKeyEnv, store.HelperCommand(secrets.CodexAPIKey))
+}
+
+// shellEnvMarker tags the ~/.zshrc lines freshbox owns
+const shellEnvMarker = "# added by freshbox"
+
+// WriteShellEnv exports name from ~/.zshrc as the output of command,
+// replacing the line an earlier run added
+func WriteShellEnv(ctx context.Context, name, command string) error {
+	e, err := shellEnvEdit(name, command)
+	if err != nil {
+		return err
+	}
+	return writeAll(ctx, []fileEdit{e})
+}
+
+func shellEnvEdit(name, command string) (fileEdit, error) {
+	home, _ := os.UserHomeDir()
+	path := filepath.Join(home, ".zshrc")
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fileEdit{}, fmt.Errorf("read .zshrc: %w", err)
+	}
+
+	line := fmt.Sprintf(`export %s="$(%s 2>/dev/null)"  %s`, name, command, shellEnvMarker)
+	prefix := "export " + name + "="
+	var lines []string
+	replaced := false
+	if len(existing) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(existing), "\n"), "\n")
+	}
+	for i, l := range lines {
+		if strings.HasPrefix(l, prefix) && strings.HasSuffix(l, shellEnvMarker) {
+			lines[i] = line
+			replaced = true
+		}
+	}
+	if !replaced {
+		lines = append(lines, line)
+	}
+	return fileEdit{path: path, data: []byte(strings.Join(lines, "\n") + "\n"), perm: 0644}, nil
+}
+
+// WriteClaudeConfig merges settings into existing ~/.claude/settings.json. The
+// API key goes to the secret store unless cfg.Plaintext is set.
+func WriteClaudeConfig(ctx context.Context, cfg ClaudeConfig) error {
+	e, err := claudeEdit(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	return writeAll(ctx, []fileEdit{e})
 }
 
-// WriteClaudeConfig merges settings into existing ~/.claude/settings.json
-func WriteClaudeConfig(cfg ClaudeConfig) error {
+// claudeEdit prepares settings.json; a new API key is stored right away
+func claudeEdit(ctx context.Context, cfg ClaudeConfig) (fileEdit, error) {
 	home, _ := os.UserHomeDir()
 	dir := filepath.Join(home, ".claude")
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("create claude dir: %w", err)
+		return fileEdit{}, fmt.Errorf("create claude dir: %w", err)
 	}
 	settingsPath := filepath.Join(dir, "settings.json")
 
@@ -193,8 +458,11 @@ func WriteClaudeConfig(cfg ClaudeConfig) error {
 	}
 
 	// Merge new values (only non-empty)
-	if cfg.Model != "" {
+	switch {
+	case cfg.Model != "":
 		existing["model"] = cfg.Model
+	case cfg.Reset:
+		delete(existing, "model")
 	}
 
 	// Build env map, preserving existing env entries
@@ -206,11 +474,36 @@ func WriteClaudeConfig(cfg ClaudeConfig) error {
 			}
 		}
 	}
-	if cfg.APIKey != "" {
+	unsetEnv := func(name string) {
+		delete(envMap, name)
+		if len(envMap) == 0 {
+			delete(existing, "env")
+		}
+	}
+	switch {
+	case cfg.APIKey != "" && cfg.Plaintext:
 		envMap["ANTHROPIC_API_KEY"] = cfg.APIKey
+		delete(existing, "apiKeyHelper")
+	case cfg.APIKey != "":
+		store := secrets.Default()
+		if err := store.Set(ctx, secrets.ClaudeAPIKey, cfg.APIKey); err != nil {
+			return fileEdit{}, err
+		}
+		existing["apiKeyHelper"] = store.HelperCommand(secrets.ClaudeAPIKey)
+		unsetEnv("ANTHROPIC_API_KEY")
+	case cfg.KeyRef != "":
+		existing["apiKeyHelper"] = secrets.Default().HelperCommand(cfg.KeyRef)
+		unsetEnv("ANTHROPIC_API_KEY")
+	case cfg.Reset:
+		// Claude Code's own login
+		delete(existing, "apiKeyHelper")
+		unsetEnv("ANTHROPIC_API_KEY")
 	}
-	if cfg.BaseURL != "" {
+	switch {
+	case cfg.BaseURL != "":
 		envMap["ANTHROPIC_BASE_URL"] = cfg.BaseURL
+	case cfg.Reset:
+		unsetEnv("ANTHROPIC_BASE_URL")
 	}
 	if len(envMap) > 0 {
 		existing["env"] = envMap
@@ -218,28 +511,82 @@ func WriteClaudeConfig(cfg ClaudeConfig) error {
 
 	data, err := json.MarshalIndent(existing, "", "  ")
 	if err != nil {
-		return fmt.Errorf("marshal settings: %w", err)
+		return fileEdit{}, fmt.Errorf("marshal settings: %w", err)
+	}
+	return fileEdit{path: settingsPath, data: data, perm: 0600}, nil
+}
+
+// ClaudeMCPAddArgs returns `claude mcp add -s user <name> [-e NAME=VALUE...]
+// -- <command> <args...>`, or for a remote server `claude mcp add --transport
+// http|sse -s user <name> <url> [-H "Name: value"...]`. -e and -H take
+// several values, so they go after the name.
+func ClaudeMCPAddArgs(s MCPServer) []string {
+	if s.Remote() {
+		args := []string{"claude", "mcp", "add", "--transport", s.Transport, "-s", "user", s.Name, s.URL}
+		for _, h := range s.HeaderLines() {
+			args = append(args, "-H", h)
+		}
+		return args
+	}
+	args := []string{"claude", "mcp", "add", "-s", "user", s.Name}
+	for _, pair := range s.EnvPairs() {
+		args = append(args, "-e", pair)
+	}
+	args = append(args, "--", s.Command)
+	return append(args, s.Args...)
+}
+
+// CodexMCPAddArgs returns `codex mcp add <name> -- <command> <args...>`; the
+// server's env goes into config.toml afterwards, see setCodexMCPEnv. Remote
+// servers are written to config.toml directly and have none.
+func CodexMCPAddArgs(s MCPServer) []string {
+	if s.Remote() {
+		return nil
+	}
+	args := []string{"codex", "mcp", "add", s.Name, "--", s.Command}
+	return append(args, s.Args...)
+}
+
+// NpmPackage returns the npm package an npx-based server runs, or "" if none
+func NpmPackage(s MCPServer) string {
+	if s.Command != "npx" {
+		return ""
+	}
+	// the package name is the arg after "-y"
+	for i, arg := range s.Args {
+		if arg == "-y" && i+1 < len(s.Args) {
+			return s.Args[i+1]
+		}
 	}
-	return os.WriteFile(settingsPath, data, 0600)
+	return ""
 }
 
 // WriteClaudeMCP adds MCP servers to Claude Code via `claude mcp add -s user`
-func WriteClaudeMCP(servers []MCPServer) error {
+func WriteClaudeMCP(ctx context.Context, servers []MCPServer) error {
+	addSecrets(servers)
+	// claude mcp add edits ~/.claude.json
+	home, _ := os.UserHomeDir()
+	if err := backup.Save(ctx, filepath.Join(home, ".claude.json")); err != nil {
+		return err
+	}
+	existing := claudeMCPNames()
 	var errs []string
+	var added []ledger.Entry
+	defer func() { ledger.Add(ctx, added...) }()
 	for _, s := range servers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		// Remove existing first (ignore errors if not found)
-		exec.Command("claude", "mcp", "remove", "-s", "user", s.Name).Run()
-
-		// claude mcp add -s user <name> -- <command> <args...>
-		args := []string{"mcp", "add", "-s", "user", s.Name, "--"}
-		args = append(args, s.Command)
-		args = append(args, s.Args...)
+		runner.Run(ctx, "claude", "mcp", "remove", "-s", "user", s.Name)
 
-		cmd := exec.Command("claude", args...)
-		out, err := cmd.CombinedOutput()
+		args := ClaudeMCPAddArgs(s)
+		out, err := runner.Output(ctx, args[0], args[1:]...)
 		if err != nil {
 			outStr := strings.TrimSpace(string(out))
 			errs = append(errs, fmt.Sprintf("%s: %s (%s)", s.Name, err.Error(), outStr))
+		} else if !existing[s.Name] {
+			added = append(added, ledger.Entry{Kind: ledger.KindClaudeMCP, Name: s.Name})
 		}
 	}
 	if len(errs) > 0 {
@@ -248,28 +595,58 @@ func WriteClaudeMCP(servers []MCPServer) error {
 	return nil
 }
 
-// WriteCodexMCP adds MCP servers to Codex via `codex mcp add` with startup_timeout_sec
-func WriteCodexMCP(servers []MCPServer) error {
+// WriteCodexMCP adds MCP servers to Codex via `codex mcp add`, then sets
+// their env tables and startup_timeout_sec
+func WriteCodexMCP(ctx context.Context, servers []MCPServer) error {
+	addSecrets(servers)
+	home, _ := os.UserHomeDir()
+	if err := backup.Save(ctx, filepath.Join(home, ".codex", "config.toml")); err != nil {
+		return err
+	}
+	existing := codexMCPNames()
 	var errs []string
+	var added []ledger.Entry
+	var remote []MCPServer
+	defer func() { ledger.Add(ctx, added...) }()
 	for _, s := range servers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		// Remove existing first (ignore errors if not found)
-		exec.Command("codex", "mcp", "remove", s.Name).Run()
-
-		// codex mcp add <name> -- <command> <args...>
-		args := []string{"mcp", "add", s.Name, "--"}
-		args = append(args, s.Command)
-		args = append(args, s.Args...)
+		runner.Run(ctx, "codex", "mcp", "remove", s.Name)
 
-		cmd := exec.Command("codex", args...)
-		out, err := cmd.CombinedOutput()
+		switch {
+		case s.Transport == catalog.TransportSSE:
+			errs = append(errs, fmt.Sprintf("%s: Codex only connects to streamable HTTP servers, not SSE", s.Name))
+			continue
+		case s.Remote():
+			remote = append(remote, s)
+			continue
+		}
+		args := CodexMCPAddArgs(s)
+		out, err := runner.Output(ctx, args[0], args[1:]...)
 		if err != nil {
 			outStr := strings.TrimSpace(string(out))
 			errs = append(errs, fmt.Sprintf("%s: %s (%s)", s.Name, err.Error(), outStr))
+		} else if !existing[s.Name] {
+			added = append(added, ledger.Entry{Kind: ledger.KindCodexMCP, Name: s.Name})
 		}
 	}
 
+	if err := setCodexRemoteMCP(ctx, remote); err != nil {
+		errs = append(errs, fmt.Sprintf("remote servers: %s", err.Error()))
+	} else {
+		for _, s := range remote {
+			if !existing[s.Name] {
+				added = append(added, ledger.Entry{Kind: ledger.KindCodexMCP, Name: s.Name})
+			}
+		}
+	}
+	if err := setCodexMCPEnv(ctx, servers); err != nil {
+		errs = append(errs, fmt.Sprintf("env config: %s", err.Error()))
+	}
 	// Add startup_timeout_sec to each MCP server in config.toml
-	if err := addCodexMCPTimeout(servers, 60); err != nil {
+	if err := addCodexMCPTimeout(ctx, servers, 60); err != nil {
 		errs = append(errs, fmt.Sprintf("timeout config: %s", err.Error()))
 	}
 
@@ -279,71 +656,196 @@ func WriteCodexMCP(servers []MCPServer) error {
 	return nil
 }
 
-// addCodexMCPTimeout adds startup_timeout_sec to each [mcp_servers.*] section in config.toml
-func addCodexMCPTimeout(servers []MCPServer, timeout int) error {
+// claudeMCPNames returns the user-scope MCP servers in ~/.claude.json
+func claudeMCPNames() map[string]bool {
+	home, _ := os.UserHomeDir()
+	var cfg struct {
+		MCPServers map[string]json.RawMessage `json:"mcpServers"`
+	}
+	data, _ := os.ReadFile(filepath.Join(home, ".claude.json"))
+	json.Unmarshal(data, &cfg)
+	names := make(map[string]bool, len(cfg.MCPServers))
+	for name := range cfg.MCPServers {
+		names[name] = true
+	}
+	return names
+}
+
+// codexMCPNames returns the [mcp_servers.*] names in ~/.codex/config.toml
+func codexMCPNames() map[string]bool {
+	home, _ := os.UserHomeDir()
+	names := map[string]bool{}
+	doc, err := readTOML(filepath.Join(home, ".codex", "config.toml"))
+	if err != nil {
+		return names
+	}
+	for _, name := range doc.Keys("mcp_servers") {
+		names[name] = true
+	}
+	return names
+}
+
+// RemoveClaudeMCP unregisters a user-scope MCP server from Claude Code
+func RemoveClaudeMCP(ctx context.Context, name string) error {
+	home, _ := os.UserHomeDir()
+	if err := backup.Save(ctx, filepath.Join(home, ".claude.json")); err != nil {
+		return err
+	}
+	if out, err := runner.Output(ctx, "claude", "mcp", "remove", "-s", "user", name); err != nil {
+		return fmt.Errorf("remove %s: %s (%s)", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// RemoveCodexMCP unregisters an MCP server from Codex
+func RemoveCodexMCP(ctx context.Context, name string) error {
+	home, _ := os.UserHomeDir()
+	if err := backup.Save(ctx, filepath.Join(home, ".codex", "config.toml")); err != nil {
+		return err
+	}
+	if out, err := runner.Output(ctx, "codex", "mcp", "remove", name); err != nil {
+		return fmt.Errorf("remove %s: %s (%s)", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// addCodexMCPTimeout adds startup_timeout_sec to the servers' [mcp_servers.*]
+// tables in config.toml, unless they already have one
+func addCodexMCPTimeout(ctx context.Context, servers []MCPServer, timeout int) error {
 	home, _ := os.UserHomeDir()
 	configPath := filepath.Join(home, ".codex", "config.toml")
 
-	data, err := os.ReadFile(configPath)
+	doc, err := readTOML(configPath)
 	if err != nil {
 		return err
 	}
+	changed := false
+	for _, s := range servers {
+		if !doc.Has("mcp_servers", s.Name) || doc.Has("mcp_servers", s.Name, "startup_timeout_sec") {
+			continue
+		}
+		if err := doc.Set([]string{"mcp_servers", s.Name, "startup_timeout_sec"}, timeout); err != nil {
+			return fmt.Errorf("update %s: %w", configPath, err)
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return backup.WriteFile(ctx, configPath, doc.Bytes(), 0644)
+}
+
+// setCodexMCPEnv writes the servers' variables into their
+// [mcp_servers.<name>.env] tables in config.toml
+func setCodexMCPEnv(ctx context.Context, servers []MCPServer) error {
+	home, _ := os.UserHomeDir()
+	configPath := filepath.Join(home, ".codex", "config.toml")
 
-	lines := strings.Split(string(data), "\n")
-	var result []string
-	timeoutLine := fmt.Sprintf("startup_timeout_sec = %d", timeout)
-
-	for i := 0; i < len(lines); i++ {
-		result = append(result, lines[i])
-		trimmed := strings.TrimSpace(lines[i])
-
-		// Check if this is an [mcp_servers.*] section header
-		if strings.HasPrefix(trimmed, "[mcp_servers.") && strings.HasSuffix(trimmed, "]") {
-			// Check if startup_timeout_sec already exists in this section
-			hasTimeout := false
-			for j := i + 1; j < len(lines); j++ {
-				nextTrimmed := strings.TrimSpace(lines[j])
-				if strings.HasPrefix(nextTrimmed, "[") {
-					break // next section
-				}
-				if strings.HasPrefix(nextTrimmed, "startup_timeout_sec") {
-					hasTimeout = true
-					break
-				}
+	doc, err := readTOML(configPath)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, s := range servers {
+		if s.Remote() || !doc.Has("mcp_servers", s.Name) {
+			continue // a remote server's variables only fill in its headers
+		}
+		for _, e := range s.Needs {
+			v := s.Env[e.Name]
+			if v == "" {
+				continue
 			}
-			if !hasTimeout {
-				result = append(result, timeoutLine)
+			if err := doc.Set([]string{"mcp_servers", s.Name, "env", e.Name}, v); err != nil {
+				return fmt.Errorf("update %s: %w", configPath, err)
 			}
+			changed = true
 		}
 	}
+	if !changed {
+		return nil
+	}
+	return backup.WriteFile(ctx, configPath, doc.Bytes(), 0644)
+}
 
-	content := strings.Join(result, "\n")
-	return os.WriteFile(configPath, []byte(content), 0644)
+// MCPKeyRef returns the secret name freshbox stores an MCP server variable under
+func MCPKeyRef(name string) string {
+	return "mcp-" + name
+}
+
+// setCodexRemoteMCP writes [mcp_servers.<name>] tables for servers Codex
+// reaches over streamable HTTP. A header holding a secret variable becomes
+// bearer_token_env_var or env_http_headers, and the variable is exported
+// from ~/.zshrc out of the secret store like the API keys, so config.toml
+// only gets the other headers in http_headers.
+func setCodexRemoteMCP(ctx context.Context, servers []MCPServer) error {
+	if len(servers) == 0 {
+		return nil
+	}
+	home, _ := os.UserHomeDir()
+	configPath := filepath.Join(home, ".codex", "config.toml")
+
+	doc, err := readTOML(configPath)
+	if err != nil {
+		return err
+	}
+	exports := make(map[string]string) // variable → value
+	for _, s := range servers {
+		if err := doc.Set([]string{"mcp_servers", s.Name, "url"}, s.URL); err != nil {
+			return fmt.Errorf("update %s: %w", configPath, err)
+		}
+		for _, name := range slices.Sorted(maps.Keys(s.Headers)) {
+			value := s.Headers[name]
+			path := []string{"mcp_servers", s.Name, "http_headers", name}
+			var set any = s.header(name)
+			secret := s.secretIn(value)
+			switch {
+			case secret == "":
+			case strings.EqualFold(name, "Authorization") && value == "Bearer ${"+secret+"}":
+				path, set = []string{"mcp_servers", s.Name, "bearer_token_env_var"}, secret
+			case value == "${"+secret+"}":
+				path, set = []string{"mcp_servers", s.Name, "env_http_headers", name}, secret
+			default:
+				return fmt.Errorf("%s: header %s: Codex reads a secret only as a whole header value or a bearer token", s.Name, name)
+			}
+			if err := doc.Set(path, set); err != nil {
+				return fmt.Errorf("update %s: %w", configPath, err)
+			}
+			if secret != "" && s.Env[secret] != "" {
+				exports[secret] = s.Env[secret]
+			}
+		}
+	}
+
+	store := secrets.Default()
+	for _, name := range slices.Sorted(maps.Keys(exports)) {
+		if err := store.Set(ctx, MCPKeyRef(name), exports[name]); err != nil {
+			return err
+		}
+		if err := WriteShellEnv(ctx, name, store.HelperCommand(MCPKeyRef(name))); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return fmt.Errorf("create codex dir: %w", err)
+	}
+	return backup.WriteFile(ctx, configPath, doc.Bytes(), 0644)
 }
 
 // PreDownloadMCPPackages pre-downloads all MCP npm packages so they're cached
 // and ready when the MCP client tries to connect (avoids startup timeouts)
-func PreDownloadMCPPackages(servers []MCPServer) error {
+func PreDownloadMCPPackages(ctx context.Context, servers []MCPServer) error {
 	var errs []string
 	for _, s := range servers {
-		if s.Command != "npx" {
-			continue
-		}
-		// Find the package name (the arg after "-y")
-		var pkg string
-		for i, arg := range s.Args {
-			if arg == "-y" && i+1 < len(s.Args) {
-				pkg = s.Args[i+1]
-				break
-			}
+		if err := ctx.Err(); err != nil {
+			return err
 		}
+		pkg := NpmPackage(s)
 		if pkg == "" {
 			continue
 		}
 
 		// Use npm cache add to pre-download without executing
-		cmd := exec.Command("npm", "cache", "add", pkg)
-		out, err := cmd.CombinedOutput()
+		out, err := runner.Output(ctx, "npm", "cache", "add", pkg)
 		if err != nil {
 			errs = append(errs, fmt.Sprintf("%s: %s", pkg, strings.TrimSpace(string(out))))
 		}
@@ -355,15 +857,15 @@ func PreDownloadMCPPackages(servers []MCPServer) error {
 }
 
 // WriteMCPConfig pre-downloads packages then writes MCP server configuration for the specified target
-func WriteMCPConfig(servers []MCPServer, target string) error {
+func WriteMCPConfig(ctx context.Context, servers []MCPServer, target string) error {
 	// Pre-download all npm packages first to avoid startup timeouts
-	_ = PreDownloadMCPPackages(servers)
+	_ = PreDownloadMCPPackages(ctx, servers)
 
 	switch target {
 	case "claude":
-		return WriteClaudeMCP(servers)
+		return WriteClaudeMCP(ctx, servers)
 	case "codex":
-		return WriteCodexMCP(servers)
+		return WriteCodexMCP(ctx, servers)
 	default:
 		return fmt.Errorf("unknown MCP target: %s", target)
 	}
@@ -0,0 +1,416 @@
+package history
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kittors/freshbox/internal/redact"
+	"github.com/kittors/freshbox/internal/runner"
+	"github.com/kittors/freshbox/internal/tasks"
+	"github.com/kittors/freshbox/internal/version"
+)
+
+// idLayout names run directories; it sorts in time order
+const idLayout = "20060102-150405"
+
+// logName is the JSON-lines file inside each run directory
+const logName = "run.jsonl"
+
+// Record types, one per line of a run log
+const (
+	TypeRunStart  = "run_start"
+	TypeTaskStart = "task_start"
+	TypeCommand   = "command"
+	TypeTaskEnd   = "task_end"
+	TypeRunEnd    = "run_end"
+)
+
+// Record is one line of a run log
+type Record struct {
+	Type     string    `json:"type"`
+	Run      string    `json:"run"`
+	Version  string    `json:"version"`
+	Source   string    `json:"source,omitempty"` // install, resume or tui
+	Task     string    `json:"task,omitempty"`
+	TaskID   string    `json:"task_id,omitempty"`
+	Command  string    `json:"command,omitempty"`
+	Start    time.Time `json:"start,omitzero"`
+	End      time.Time `json:"end,omitzero"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Status   string    `json:"status,omitempty"` // task_end: ok, failed or skipped
+	Error    string    `json:"error,omitempty"`
+	Tasks    int       `json:"tasks,omitempty"`   // run_start/run_end: queue size
+	Failed   int       `json:"failed,omitempty"`  // run_end
+	Skipped  int       `json:"skipped,omitempty"` // run_end
+}
+
+// Dir returns ~/.freshbox/runs
+func Dir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".freshbox", "runs")
+}
+
+// Log appends records for one run to ~/.freshbox/runs/<id>/run.jsonl. It is
+// safe for concurrent use; a nil *Log records nothing.
+type Log struct {
+	ID   string
+	path string
+
+	mu      sync.Mutex
+	started map[string]time.Time // running tasks, by ID or name
+}
+
+// Start creates the directory for a new run and writes its run_start record
+func Start(source string, queue []tasks.Task) (*Log, error) {
+	now := time.Now()
+	id := now.Format(idLayout)
+	dir := filepath.Join(Dir(), id)
+	// two runs in the same second get a suffix
+	for n := 2; ; n++ {
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", now.Format(idLayout), n)
+		dir = filepath.Join(Dir(), id)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create run log dir: %w", err)
+	}
+	l := &Log{ID: id, path: filepath.Join(dir, logName), started: make(map[string]time.Time)}
+	return l, l.write(Record{Type: TypeRunStart, Source: source, Start: now, Tasks: len(queue)})
+}
+
+// write appends r as one JSON line, with secrets masked
+func (l *Log) write(r Record) error {
+	r.Command = redact.String(r.Command)
+	r.Error = redact.String(r.Error)
+	r.Run = l.ID
+	r.Version = version.Version
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("marshal run record: %w", err)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("open run log: %w", err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Wrap returns queue with every task's commands recorded in the log
+func (l *Log) Wrap(queue []tasks.Task) []tasks.Task {
+	if l == nil {
+		return queue
+	}
+	out := slices.Clone(queue)
+	for i, task := range out {
+		fn := task.Fn
+		if fn == nil {
+			continue
+		}
+		out[i].Fn = func(ctx context.Context) error {
+			return fn(runner.WithObserver(ctx, func(res runner.Result, err error) {
+				l.command(task, res, err)
+			}))
+		}
+	}
+	return out
+}
+
+func (l *Log) command(task tasks.Task, res runner.Result, err error) {
+	code := res.ExitCode
+	r := Record{
+		Type:     TypeCommand,
+		Task:     task.Name,
+		TaskID:   task.ID,
+		Command:  res.Cmdline,
+		Start:    res.Start,
+		End:      res.Start.Add(res.Duration),
+		ExitCode: &code,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	l.write(r)
+}
+
+// Record logs a progress event from tasks.Run or the TUI
+func (l *Log) Record(e tasks.Event) {
+	if l == nil {
+		return
+	}
+	key := e.ID
+	if key == "" {
+		key = e.Task
+	}
+	now := time.Now()
+	switch e.Type {
+	case tasks.EventStart:
+		l.mu.Lock()
+		l.started[key] = now
+		l.mu.Unlock()
+		l.write(Record{Type: TypeTaskStart, Task: e.Task, TaskID: e.ID, Start: now})
+	case tasks.EventOK, tasks.EventFail, tasks.EventSkip:
+		l.mu.Lock()
+		start, ok := l.started[key]
+		delete(l.started, key)
+		l.mu.Unlock()
+		if !ok {
+			start = now
+		}
+		status := tasks.StatusOK
+		switch e.Type {
+		case tasks.EventFail:
+			status = tasks.StatusFailed
+		case tasks.EventSkip:
+			status = tasks.StatusSkipped
+		}
+		l.write(Record{Type: TypeTaskEnd, Task: e.Task, TaskID: e.ID, Start: start, End: now, Status: status, Error: e.Error})
+	case tasks.EventDone:
+		l.write(Record{Type: TypeRunEnd, End: now, Tasks: e.Total, Failed: e.Failed, Skipped: e.Skipped})
+	}
+}
+
+// Track wraps report so every event is also written to the log
+func (l *Log) Track(report tasks.Reporter) tasks.Reporter {
+	return func(e tasks.Event) {
+		l.Record(e)
+		if report != nil {
+			report(e)
+		}
+	}
+}
+
+// Load reads every record of run id; "last" means the newest run
+func Load(id string) ([]Record, error) {
+	if id == "last" {
+		runs, err := List()
+		if err != nil {
+			return nil, err
+		}
+		if len(runs) == 0 {
+			return nil, errors.New("no runs recorded yet")
+		}
+		id = runs[0].ID
+	}
+	f, err := os.Open(filepath.Join(Dir(), id, logName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no run %q (see 'freshbox history')", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open run log: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("parse run %s line %d: %w", id, line, err)
+		}
+		records = append(records, r)
+	}
+	return records, sc.Err()
+}
+
+// Summary describes one past run
+type Summary struct {
+	ID      string        `json:"id"`
+	Source  string        `json:"source,omitempty"`
+	Version string        `json:"version"`
+	Start   time.Time     `json:"start"`
+	End     time.Time     `json:"end,omitzero"` // zero if the run never finished
+	Tasks   int           `json:"tasks"`
+	OK      int           `json:"ok"`
+	Failed  int           `json:"failed"`
+	Skipped int           `json:"skipped"`
+	Elapsed time.Duration `json:"elapsed,omitempty"`
+}
+
+// Summarize totals a run's records. A task retried within the run counts
+// with its last outcome.
+func Summarize(records []Record) Summary {
+	var s Summary
+	var order []string
+	status := make(map[string]string)
+	for _, r := range records {
+		switch r.Type {
+		case TypeRunStart:
+			if s.ID == "" {
+				s.ID, s.Source, s.Version, s.Start, s.Tasks = r.Run, r.Source, r.Version, r.Start, r.Tasks
+			}
+		case TypeTaskEnd:
+			key := r.TaskID
+			if key == "" {
+				key = r.Task
+			}
+			if _, ok := status[key]; !ok {
+				order = append(order, key)
+			}
+			status[key] = r.Status
+		case TypeRunEnd:
+			s.End = r.End
+		}
+	}
+	for _, key := range order {
+		switch status[key] {
+		case tasks.StatusOK:
+			s.OK++
+		case tasks.StatusFailed:
+			s.Failed++
+		case tasks.StatusSkipped:
+			s.Skipped++
+		}
+	}
+	if !s.End.IsZero() {
+		s.Elapsed = s.End.Sub(s.Start)
+	}
+	return s
+}
+
+// List summarizes every recorded run, newest first. Runs whose log can't be
+// read are left out.
+func List() ([]Summary, error) {
+	entries, err := os.ReadDir(Dir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read runs dir: %w", err)
+	}
+	var runs []Summary
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		records, err := Load(e.Name())
+		if err != nil || len(records) == 0 {
+			continue
+		}
+		runs = append(runs, Summarize(records))
+	}
+	slices.SortFunc(runs, func(a, b Summary) int { return strings.Compare(b.ID, a.ID) })
+	return runs, nil
+}
+
+// WriteList prints a table of runs
+func WriteList(w io.Writer, runs []Summary) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RUN\tSOURCE\tVERSION\tSTARTED\tTASKS\tOK\tFAILED\tSKIPPED\tTOOK")
+	for _, r := range runs {
+		took := "unfinished"
+		if !r.End.IsZero() {
+			took = r.Elapsed.Round(time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\n",
+			r.ID, r.Source, r.Version, r.Start.Local().Format("2006-01-02 15:04"),
+			r.Tasks, r.OK, r.Failed, r.Skipped, took)
+	}
+	tw.Flush()
+}
+
+// taskLog gathers the records of one task for WriteRun
+type taskLog struct {
+	name     string
+	start    time.Time
+	ends     []Record // one per attempt; the TUI can retry a task in the same run
+	commands []Record
+}
+
+// WriteRun prints every task of a run in the order it started, with the
+// commands it ran, their exit codes and errors
+func WriteRun(w io.Writer, records []Record) {
+	s := Summarize(records)
+	fmt.Fprintf(w, "Run %s (%s, freshbox %s)\n", s.ID, s.Source, s.Version)
+	fmt.Fprintf(w, "Started %s", s.Start.Local().Format("2006-01-02 15:04:05"))
+	if s.End.IsZero() {
+		fmt.Fprint(w, ", never finished")
+	} else {
+		fmt.Fprintf(w, ", took %s", s.Elapsed.Round(time.Second))
+	}
+	fmt.Fprintf(w, " — %d tasks, %d ok, %d failed, %d skipped\n\n", s.Tasks, s.OK, s.Failed, s.Skipped)
+
+	var order []*taskLog
+	byKey := make(map[string]*taskLog)
+	get := func(r Record) *taskLog {
+		key := r.TaskID
+		if key == "" {
+			key = r.Task
+		}
+		t, ok := byKey[key]
+		if !ok {
+			t = &taskLog{name: r.Task, start: r.Start}
+			byKey[key] = t
+			order = append(order, t)
+		}
+		return t
+	}
+	for _, r := range records {
+		switch r.Type {
+		case TypeTaskStart:
+			get(r)
+		case TypeCommand:
+			t := get(r)
+			t.commands = append(t.commands, r)
+		case TypeTaskEnd:
+			t := get(r)
+			t.ends = append(t.ends, r)
+		}
+	}
+
+	for _, t := range order {
+		mark, took := "…", "still running when the log ends"
+		if len(t.ends) > 0 {
+			end := t.ends[len(t.ends)-1]
+			took = end.End.Sub(end.Start).Round(100 * time.Millisecond).String()
+			switch end.Status {
+			case tasks.StatusOK:
+				mark = "✓"
+			case tasks.StatusFailed:
+				mark = "✗"
+			case tasks.StatusSkipped:
+				mark, took = "⊘", end.Error
+			}
+			if len(t.ends) > 1 {
+				took += fmt.Sprintf(", %d attempts", len(t.ends))
+			}
+		}
+		fmt.Fprintf(w, "%s  %s %s  (%s)\n", t.start.Local().Format("15:04:05"), mark, t.name, took)
+		for _, c := range t.commands {
+			code := "?"
+			if c.ExitCode != nil {
+				code = fmt.Sprint(*c.ExitCode)
+			}
+			fmt.Fprintf(w, "          %s  $ %s  [exit %s, %s]\n", c.Start.Local().Format("15:04:05"), c.Command,
+				code, c.End.Sub(c.Start).Round(100*time.Millisecond))
+		}
+		for _, end := range t.ends {
+			if end.Status != tasks.StatusFailed || end.Error == "" {
+				continue
+			}
+			for _, line := range strings.Split(strings.TrimSpace(end.Error), "\n") {
+				fmt.Fprintf(w, "          ! %s\n", line)
+			}
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package history
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kittors/freshbox/internal/runner"
+	"github.com/kittors/freshbox/internal/tasks"
+	"github.com/kittors/freshbox/internal/version"
+)
+
+var ctx = context.Background()
+
+// brew runs brew like the installer does, with its output in the error
+func brew(ctx context.Context, args ...string) error {
+	out, err := runner.Output(ctx, "brew", args...)
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, out)
+	}
+	return nil
+}
+
+// testQueue is two tasks that run commands, the second of which fails, and
+// one that depends on the failure
+func testQueue() []tasks.Task {
+	return []tasks.Task{
+		{ID: "git", Name: "Git", Fn: func(ctx context.Context) error {
+			return brew(ctx, "install", "git")
+		}},
+		{ID: "zed", Name: "Zed", Fn: func(ctx context.Context) error {
+			return brew(ctx, "install", "--cask", "zed")
+		}},
+		{ID: "zed-theme", Name: "Zed theme", Needs: []string{"zed"}, Fn: func(context.Context) error {
+			return nil
+		}},
+	}
+}
+
+// recordRun runs testQueue on a fake runner and returns its log
+func recordRun(t *testing.T, source string) *Log {
+	t.Helper()
+	f := runner.NewFake().On("brew install --cask zed", runner.Response{Stderr: "Error: Download failed", ExitCode: 1})
+	defer runner.Use(f)()
+
+	queue := testQueue()
+	l, err := Start(source, queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks.Run(ctx, l.Wrap(queue), 1, l.Track(nil))
+	return l
+}
+
+func countType(records []Record, typ string) int {
+	n := 0
+	for _, r := range records {
+		if r.Type == typ {
+			n++
+		}
+	}
+	return n
+}
+
+// --- Log ---
+
+func TestLog_RecordsTasksAndCommands(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	l := recordRun(t, "install")
+
+	info, err := os.Stat(filepath.Join(Dir(), l.ID, logName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("run log mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	records, err := Load(l.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0].Type != TypeRunStart || records[0].Source != "install" || records[0].Tasks != 3 {
+		t.Errorf("first record = %+v, want run_start from install with 3 tasks", records[0])
+	}
+	if last := records[len(records)-1]; last.Type != TypeRunEnd || last.Failed != 1 || last.Skipped != 1 {
+		t.Errorf("last record = %+v, want run_end with 1 failed, 1 skipped", last)
+	}
+	for _, r := range records {
+		if r.Run != l.ID || r.Version != version.Version {
+			t.Errorf("record %+v missing run id or version", r)
+		}
+	}
+	if n := countType(records, TypeCommand); n != 2 {
+		t.Errorf("%d command records, want 2", n)
+	}
+
+	var zed *Record
+	for i, r := range records {
+		if r.Type == TypeCommand && r.TaskID == "zed" {
+			zed = &records[i]
+		}
+	}
+	if zed == nil {
+		t.Fatal("no command record for zed")
+	}
+	if zed.Command != "brew install --cask zed" || zed.ExitCode == nil || *zed.ExitCode != 1 {
+		t.Errorf("zed command = %+v, want exit 1 from brew install --cask zed", zed)
+	}
+	if zed.Start.IsZero() || zed.End.Before(zed.Start) {
+		t.Errorf("zed command times = %v..%v", zed.Start, zed.End)
+	}
+	if zed.Error != "exit status 1" {
+		t.Errorf("zed command error = %q, want exit status 1", zed.Error)
+	}
+}
+
+func TestLog_NilRecordsNothing(t *testing.T) {
+	var l *Log
+	queue := testQueue()
+	if got := l.Wrap(queue); len(got) != len(queue) {
+		t.Errorf("Wrap on nil log changed the queue")
+	}
+	called := false
+	l.Track(func(tasks.Event) { called = true })(tasks.Event{Type: tasks.EventStart})
+	if !called {
+		t.Error("Track on nil log dropped the event")
+	}
+}
+
+func TestStart_SameSecondGetsSuffix(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	a, err := Start("install", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Start("install", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID == b.ID {
+		t.Errorf("two runs share id %s", a.ID)
+	}
+}
+
+// --- Load / List ---
+
+func TestLoad_LastAndMissing(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if _, err := Load("last"); err == nil {
+		t.Error("Load(last) with no runs should fail")
+	}
+
+	first := recordRun(t, "install")
+	second := recordRun(t, "resume")
+	records, err := Load("last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records[0].Run != second.ID {
+		t.Errorf("last = %s, want %s (first was %s)", records[0].Run, second.ID, first.ID)
+	}
+
+	if _, err := Load("19990101-000000"); err == nil || !strings.Contains(err.Error(), "freshbox history") {
+		t.Errorf("missing run error = %v", err)
+	}
+}
+
+func TestList_NewestFirst(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if runs, err := List(); err != nil || len(runs) != 0 {
+		t.Fatalf("List with no runs dir = %v, %v", runs, err)
+	}
+
+	first := recordRun(t, "install")
+	second := recordRun(t, "tui")
+	// a stray file and an unreadable run are left out
+	os.WriteFile(filepath.Join(Dir(), "notes.txt"), []byte("hi"), 0600)
+	os.MkdirAll(filepath.Join(Dir(), "broken"), 0700)
+	os.WriteFile(filepath.Join(Dir(), "broken", logName), []byte("{not json\n"), 0600)
+
+	runs, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].ID != second.ID || runs[1].ID != first.ID {
+		t.Fatalf("List = %+v, want %s then %s", runs, second.ID, first.ID)
+	}
+	if r := runs[0]; r.Source != "tui" || r.Tasks != 3 || r.OK != 1 || r.Failed != 1 || r.Skipped != 1 || r.End.IsZero() {
+		t.Errorf("summary = %+v", r)
+	}
+}
+
+func TestSummarize_RetryCountsLastOutcome(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	l := recordRun(t, "tui")
+
+	// the Done page retries zed and its theme in the same run, this time working
+	retry := l.Wrap(testQueue()[1:])
+	defer runner.Use(runner.NewFake())()
+	tasks.Run(ctx, retry, 1, l.Track(nil))
+
+	records, err := Load(l.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Summarize(records)
+	if s.OK != 3 || s.Failed != 0 || s.Skipped != 0 {
+		t.Errorf("summary after retry = %+v, want 3 ok", s)
+	}
+}
+
+func TestSummarize_Unfinished(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	l, err := Start("install", testQueue())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Record(tasks.Event{Type: tasks.EventStart, Task: "Git", ID: "git"})
+
+	records, _ := Load(l.ID)
+	if s := Summarize(records); !s.End.IsZero() || s.Elapsed != 0 {
+		t.Errorf("unfinished run summary = %+v", s)
+	}
+	var buf bytes.Buffer
+	WriteRun(&buf, records)
+	for _, want := range []string{"never finished", "Git", "still running"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteRun output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+// --- Output ---
+
+func TestWriteList(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	l := recordRun(t, "install")
+	runs, _ := List()
+
+	var buf bytes.Buffer
+	WriteList(&buf, runs)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "RUN") {
+		t.Fatalf("WriteList output:\n%s", buf.String())
+	}
+	if fields := strings.Fields(lines[1]); fields[0] != l.ID || fields[1] != "install" {
+		t.Errorf("row = %q", lines[1])
+	}
+}
+
+func TestWriteRun(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	l := recordRun(t, "install")
+	records, _ := Load(l.ID)
+
+	var buf bytes.Buffer
+	WriteRun(&buf, records)
+	out := buf.String()
+	for _, want := range []string{
+		"Run " + l.ID,
+		"3 tasks, 1 ok, 1 failed, 1 skipped",
+		"✓ Git",
+		"$ brew install git  [exit 0",
+		"✗ Zed",
+		"$ brew install --cask zed  [exit 1",
+		"Download failed",
+		"⊘ Zed theme",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WriteRun output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWrap_KeepsTaskErrors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	boom := errors.New("boom")
+	l, err := Start("install", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := l.Wrap([]tasks.Task{{ID: "x", Name: "X", Fn: func(context.Context) error { return boom }}})
+	if err := queue[0].Fn(ctx); !errors.Is(err, boom) {
+		t.Errorf("wrapped Fn = %v, want %v", err, boom)
+	}
+}
@@ -1,61 +1,131 @@
 package installer
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
+	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/kittors/freshbox/internal/backup"
+	"github.com/kittors/freshbox/internal/runner"
+)
+
+// npm packages of the AI CLIs freshbox configures; the catalog installs them
+const (
+	CodexPackage      = "@openai/codex"
+	ClaudeCodePackage = "@anthropic-ai/claude-code"
 )
 
+// BrewInstallArgs returns the brew command line for installing a formula or cask
+func BrewInstallArgs(name string, isCask bool) []string {
+	args := []string{"brew", "install"}
+	if isCask {
+		args = append(args, "--cask")
+	}
+	return append(args, name)
+}
+
 // BrewInstall installs a formula or cask via Homebrew
-func BrewInstall(name string, isCask bool) error {
-	args := []string{"install"}
+func BrewInstall(ctx context.Context, name string, isCask bool) error {
+	args := BrewInstallArgs(name, isCask)
+	out, err := runner.Output(ctx, args[0], args[1:]...)
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, string(out))
+	}
+	return nil
+}
+
+// BrewUninstallArgs returns the brew command line for removing a formula or cask
+func BrewUninstallArgs(name string, isCask bool) []string {
+	args := []string{"brew", "uninstall"}
+	if isCask {
+		args = append(args, "--cask")
+	}
+	return append(args, name)
+}
+
+// BrewUninstall removes a formula or cask via Homebrew
+func BrewUninstall(ctx context.Context, name string, isCask bool) error {
+	args := BrewUninstallArgs(name, isCask)
+	out, err := runner.Output(ctx, args[0], args[1:]...)
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, string(out))
+	}
+	return nil
+}
+
+// BrewUpgradeArgs returns the brew command line for upgrading a formula or cask
+func BrewUpgradeArgs(name string, isCask bool) []string {
+	args := []string{"brew", "upgrade"}
 	if isCask {
 		args = append(args, "--cask")
 	}
-	args = append(args, name)
-	cmd := exec.Command("brew", args...)
-	out, err := cmd.CombinedOutput()
+	return append(args, name)
+}
+
+// BrewUpgrade upgrades an installed formula or cask via Homebrew
+func BrewUpgrade(ctx context.Context, name string, isCask bool) error {
+	args := BrewUpgradeArgs(name, isCask)
+	out, err := runner.Output(ctx, args[0], args[1:]...)
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, string(out))
+	}
+	return nil
+}
+
+// NpmUpdate updates a global npm package
+func NpmUpdate(ctx context.Context, pkg string) error {
+	out, err := runner.Output(ctx, "npm", "update", "-g", pkg)
 	if err != nil {
 		return fmt.Errorf("%s: %s", err, string(out))
 	}
 	return nil
 }
 
-// InstallHomebrew installs Homebrew itself
-func InstallHomebrew() error {
-	script := `/bin/bash -c "$(curl -fsSL https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh)"`
-	cmd := exec.Command("bash", "-c", script)
-	out, err := cmd.CombinedOutput()
+// NpmUninstall removes a global npm package
+func NpmUninstall(ctx context.Context, pkg string) error {
+	out, err := runner.Output(ctx, "npm", "uninstall", "-g", pkg)
 	if err != nil {
 		return fmt.Errorf("%s: %s", err, string(out))
 	}
 	return nil
 }
 
-// InstallCodex installs OpenAI Codex CLI via npm
-func InstallCodex() error {
-	cmd := exec.Command("npm", "install", "-g", "@openai/codex")
-	out, err := cmd.CombinedOutput()
+// NpmInstallArgs returns the npm command line for installing a global package
+func NpmInstallArgs(pkg string) []string {
+	return []string{"npm", "install", "-g", pkg}
+}
+
+// NpmInstall installs a global npm package
+func NpmInstall(ctx context.Context, pkg string) error {
+	args := NpmInstallArgs(pkg)
+	out, err := runner.Output(ctx, args[0], args[1:]...)
 	if err != nil {
 		return fmt.Errorf("%s: %s", err, string(out))
 	}
 	return nil
 }
 
-// InstallClaudeCode installs Claude Code via npm
-func InstallClaudeCode() error {
-	cmd := exec.Command("npm", "install", "-g", "@anthropic-ai/claude-code")
-	out, err := cmd.CombinedOutput()
+// RunScript runs a catalog install script or hook with bash -c
+func RunScript(ctx context.Context, script string) error {
+	out, err := runner.Output(ctx, "bash", "-c", script)
 	if err != nil {
 		return fmt.Errorf("%s: %s", err, string(out))
 	}
 	return nil
 }
 
-// InstallRust installs Rust via rustup
-func InstallRust() error {
-	cmd := exec.Command("bash", "-c", "curl --proto '=https' --tlsv1.2 -sSf https://sh.rustup.rs | sh -s -- -y")
-	out, err := cmd.CombinedOutput()
+// RustupUpdate updates the installed Rust toolchains and rustup itself
+func RustupUpdate(ctx context.Context) error {
+	rustup := "rustup"
+	home, _ := os.UserHomeDir()
+	// a fresh rustup install isn't on PATH until the shell is restarted
+	cargoRustup := filepath.Join(home, ".cargo", "bin", "rustup")
+	if _, err := os.Stat(cargoRustup); err == nil {
+		rustup = cargoRustup
+	}
+	out, err := runner.Output(ctx, rustup, "update")
 	if err != nil {
 		return fmt.Errorf("%s: %s", err, string(out))
 	}
@@ -63,9 +133,8 @@ func InstallRust() error {
 }
 
 // FnmInstallNode installs a specific Node.js version via fnm
-func FnmInstallNode(version string) error {
-	cmd := exec.Command("fnm", "install", version)
-	out, err := cmd.CombinedOutput()
+func FnmInstallNode(ctx context.Context, version string) error {
+	out, err := runner.Output(ctx, "fnm", "install", version)
 	if err != nil {
 		return fmt.Errorf("%s: %s", err, string(out))
 	}
@@ -73,9 +142,8 @@ func FnmInstallNode(version string) error {
 }
 
 // FnmListRemote lists available Node.js versions
-func FnmListRemote() ([]string, error) {
-	cmd := exec.Command("fnm", "list-remote")
-	out, err := cmd.CombinedOutput()
+func FnmListRemote(ctx context.Context) ([]string, error) {
+	out, err := runner.Output(ctx, "fnm", "list-remote")
 	if err != nil {
 		return nil, fmt.Errorf("%s: %s", err, string(out))
 	}
@@ -96,7 +164,7 @@ func FnmListRemote() ([]string, error) {
 }
 
 // SetDefaultBrowser sets Chrome as default browser via LSHandlers
-func SetDefaultBrowser() error {
+func SetDefaultBrowser(ctx context.Context) error {
 	// Use defaults write to set Chrome as default HTTP/HTTPS handler
 	// This avoids opening a browser window
 	types := []struct{ scheme, role string }{
@@ -104,33 +172,40 @@ func SetDefaultBrowser() error {
 		{"https", "LSHandlerURLScheme"},
 	}
 	for _, t := range types {
-		cmd := exec.Command("bash", "-c", fmt.Sprintf(
+		_, _ = runner.Run(ctx, "bash", "-c", fmt.Sprintf(
 			`defaults write com.apple.LaunchServices/com.apple.launchservices.secure LSHandlers -array-add '{"LSHandlerURLScheme"="%s";"LSHandlerRoleAll"="com.google.chrome";}'`,
 			t.scheme))
-		_ = cmd.Run()
 	}
 	return nil
 }
 
 // SetJavaHome creates the system symlink for brew-installed OpenJDK and configures JAVA_HOME
-func SetJavaHome() error {
+func SetJavaHome(ctx context.Context) error {
 	// Create symlink so system Java wrappers can find brew's OpenJDK
 	// This is required because brew openjdk is keg-only
-	symCmd := exec.Command("sudo", "ln", "-sfn",
+	if out, err := runner.Output(ctx, "sudo", "ln", "-sfn",
 		"/opt/homebrew/opt/openjdk/libexec/openjdk.jdk",
-		"/Library/Java/JavaVirtualMachines/openjdk.jdk")
-	if out, err := symCmd.CombinedOutput(); err != nil {
+		"/Library/Java/JavaVirtualMachines/openjdk.jdk"); err != nil {
 		return fmt.Errorf("create java symlink: %s %s", err, string(out))
 	}
 
 	// Add JAVA_HOME to zshrc if not already present
-	checkCmd := exec.Command("bash", "-c", `grep -q 'JAVA_HOME' ~/.zshrc 2>/dev/null`)
-	if checkCmd.Run() != nil {
-		// Not found, append it
-		cmd := exec.Command("bash", "-c", `echo '' >> ~/.zshrc && echo '# Java' >> ~/.zshrc && echo 'export JAVA_HOME=$(/usr/libexec/java_home)' >> ~/.zshrc`)
-		if out, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("write JAVA_HOME: %s %s", err, string(out))
-		}
+	home, _ := os.UserHomeDir()
+	path := filepath.Join(home, ".zshrc")
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("read .zshrc: %w", err)
+	}
+	if strings.Contains(string(existing), "JAVA_HOME") {
+		return nil
+	}
+	data := string(existing)
+	if data != "" && !strings.HasSuffix(data, "\n") {
+		data += "\n"
+	}
+	data += "\n# Java\nexport JAVA_HOME=$(/usr/libexec/java_home)\n"
+	if err := backup.WriteFile(ctx, path, []byte(data), 0644); err != nil {
+		return fmt.Errorf("write JAVA_HOME: %w", err)
 	}
 	return nil
 }
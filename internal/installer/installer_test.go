@@ -1,16 +1,19 @@
 package installer
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/kittors/freshbox/internal/runner"
 )
 
 func TestBrewInstall_FormulaArgs(t *testing.T) {
 	// We can't actually install, but we verify the function signature and
 	// that it gracefully handles a non-existent formula name
-	err := BrewInstall("freshbox-nonexistent-formula-xyz", false)
+	err := BrewInstall(context.Background(), "freshbox-nonexistent-formula-xyz", false)
 	if err == nil {
 		t.Log("brew install unexpectedly succeeded (no-op on some setups)")
 	} else {
@@ -22,7 +25,7 @@ func TestBrewInstall_FormulaArgs(t *testing.T) {
 }
 
 func TestBrewInstall_CaskArgs(t *testing.T) {
-	err := BrewInstall("freshbox-nonexistent-cask-xyz", true)
+	err := BrewInstall(context.Background(), "freshbox-nonexistent-cask-xyz", true)
 	if err == nil {
 		t.Log("brew install --cask unexpectedly succeeded")
 	}
@@ -34,7 +37,7 @@ func TestFnmListRemote(t *testing.T) {
 		t.Skip("fnm not installed, skipping")
 	}
 
-	versions, err := FnmListRemote()
+	versions, err := FnmListRemote(context.Background())
 	if err != nil {
 		t.Fatalf("FnmListRemote failed: %v", err)
 	}
@@ -55,7 +58,7 @@ func TestSetJavaHome_WritesZshrc(t *testing.T) {
 
 func TestSetDefaultBrowser_DoesNotPanic(t *testing.T) {
 	// SetDefaultBrowser swallows errors internally
-	err := SetDefaultBrowser()
+	err := SetDefaultBrowser(context.Background())
 	if err != nil {
 		t.Errorf("SetDefaultBrowser returned error: %v", err)
 	}
@@ -66,7 +69,7 @@ func TestFnmInstallNode_InvalidVersion(t *testing.T) {
 		t.Skip("fnm not installed, skipping")
 	}
 
-	err := FnmInstallNode("v0.0.1-nonexistent")
+	err := FnmInstallNode(context.Background(), "v0.0.1-nonexistent")
 	if err == nil {
 		t.Error("expected error for invalid Node.js version")
 	}
@@ -86,3 +89,74 @@ func TestSetJavaHome_ZshrcCheck(t *testing.T) {
 	hasJavaHome := strings.Contains(content, "JAVA_HOME")
 	t.Logf("JAVA_HOME in .zshrc: %v", hasJavaHome)
 }
+
+func TestSetJavaHome_AppendsToZshrcOnce(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	f := runner.NewFake()
+	defer runner.Use(f)()
+	zshrc := filepath.Join(home, ".zshrc")
+	os.WriteFile(zshrc, []byte("alias ll='ls -l'"), 0644)
+
+	for i := 0; i < 2; i++ {
+		if err := SetJavaHome(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := os.ReadFile(zshrc)
+	want := "alias ll='ls -l'\n\n# Java\nexport JAVA_HOME=$(/usr/libexec/java_home)\n"
+	if string(data) != want {
+		t.Errorf(".zshrc = %q, want %q", data, want)
+	}
+	for _, c := range f.Cmdlines() {
+		if strings.HasPrefix(c, "bash") {
+			t.Errorf("SetJavaHome should edit .zshrc itself, ran %s", c)
+		}
+	}
+}
+
+func TestBrewInstall_UsesRunner(t *testing.T) {
+	f := runner.NewFake().On("brew install --cask zed", runner.Response{Stderr: "Error: no network", ExitCode: 1})
+	defer runner.Use(f)()
+
+	err := BrewInstall(context.Background(), "zed", true)
+	if err == nil || !strings.Contains(err.Error(), "no network") {
+		t.Errorf("expected brew output in error, got %v", err)
+	}
+	if got := f.Cmdlines(); len(got) != 1 || got[0] != "brew install --cask zed" {
+		t.Errorf("commands = %v", got)
+	}
+}
+
+func TestFnmListRemote_Fake(t *testing.T) {
+	f := runner.NewFake().On("fnm list-remote", runner.Response{Stdout: "v20.0.0\nv22.0.0\n"})
+	defer runner.Use(f)()
+
+	versions, err := FnmListRemote(context.Background())
+	if err != nil {
+		t.Fatalf("FnmListRemote failed: %v", err)
+	}
+	if strings.Join(versions, ",") != "v22.0.0,v20.0.0" {
+		t.Errorf("versions = %v, want newest first", versions)
+	}
+}
+
+func TestUninstall_UsesRunner(t *testing.T) {
+	f := runner.NewFake()
+	defer runner.Use(f)()
+
+	ctx := context.Background()
+	if err := BrewUninstall(ctx, "zed", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := BrewUninstall(ctx, "go", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := NpmUninstall(ctx, ClaudeCodePackage); err != nil {
+		t.Fatal(err)
+	}
+	want := "brew uninstall --cask zed,brew uninstall go,npm uninstall -g @anthropic-ai/claude-code"
+	if got := strings.Join(f.Cmdlines(), ","); got != want {
+		t.Errorf("commands = %s", got)
+	}
+}
@@ -0,0 +1,132 @@
+package ledger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/kittors/freshbox/internal/backup"
+)
+
+// Kinds of things freshbox adds to a machine
+const (
+	KindFormula   = "formula"    // Homebrew formula
+	KindCask      = "cask"       // Homebrew cask
+	KindNpm       = "npm"        // global npm package
+	KindClaudeMCP = "claude-mcp" // MCP server registered with Claude Code
+	KindCodexMCP  = "codex-mcp"  // MCP server registered with Codex
+	KindFile      = "file"       // file that did not exist before
+	KindDefault   = "default"    // defaults(1) key
+)
+
+// Entry is one thing a run added that was not on the machine before
+type Entry struct {
+	Kind   string    `json:"kind"`
+	Name   string    `json:"name"`             // formula, cask, package, server name, path or defaults key
+	Domain string    `json:"domain,omitempty"` // defaults domain
+	Label  string    `json:"label,omitempty"`  // catalog name, e.g. "Google Chrome"
+	Run    string    `json:"run,omitempty"`
+	Added  time.Time `json:"added"`
+	// Previous is the value a defaults key had before freshbox wrote it, as
+	// `defaults write` arguments such as ["-bool", "false"]; empty if the key was unset
+	Previous []string `json:"previous,omitempty"`
+}
+
+// Title is how the entry is shown to the user
+func (e Entry) Title() string {
+	switch {
+	case e.Label != "":
+		return e.Label
+	case e.Kind == KindDefault:
+		return e.Domain + " " + e.Name
+	case e.Kind == KindFile:
+		return backup.Tilde(e.Name)
+	}
+	return e.Name
+}
+
+func (e Entry) same(o Entry) bool {
+	return e.Kind == o.Kind && e.Domain == o.Domain && e.Name == o.Name
+}
+
+// Path returns ~/.freshbox/installed.json
+func Path() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".freshbox", "installed.json")
+}
+
+// mu serializes read-modify-write cycles of concurrent tasks
+var mu sync.Mutex
+
+// Load returns everything freshbox added that has not been uninstalled yet
+func Load() ([]Entry, error) {
+	data, err := os.ReadFile(Path())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read install ledger: %w", err)
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse install ledger: %w", err)
+	}
+	return entries, nil
+}
+
+func save(entries []Entry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal install ledger: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(Path()), 0755); err != nil {
+		return fmt.Errorf("create ledger dir: %w", err)
+	}
+	if err := backup.WriteAtomic(Path(), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("write install ledger: %w", err)
+	}
+	return nil
+}
+
+// Add records entries as added by the run of ctx. An entry that is already
+// recorded keeps its original record, so Previous stays the value from
+// before freshbox first touched it.
+func Add(ctx context.Context, entries ...Entry) error {
+	mu.Lock()
+	defer mu.Unlock()
+	all, err := Load()
+	if err != nil {
+		return err
+	}
+	run := ""
+	if r := backup.FromContext(ctx); r != nil {
+		run = r.ID
+	}
+	for _, e := range entries {
+		if slices.ContainsFunc(all, e.same) {
+			continue
+		}
+		e.Run = run
+		e.Added = time.Now()
+		all = append(all, e)
+	}
+	return save(all)
+}
+
+// Remove forgets entries once they have been uninstalled
+func Remove(entries ...Entry) error {
+	mu.Lock()
+	defer mu.Unlock()
+	all, err := Load()
+	if err != nil {
+		return err
+	}
+	all = slices.DeleteFunc(all, func(e Entry) bool { return slices.ContainsFunc(entries, e.same) })
+	return save(all)
+}
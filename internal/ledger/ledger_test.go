@@ -0,0 +1,78 @@
+package ledger
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kittors/freshbox/internal/backup"
+)
+
+func TestLoadMissing(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	entries, err := Load()
+	if err != nil || entries != nil {
+		t.Errorf("Load() = %v, %v; want nothing", entries, err)
+	}
+}
+
+func TestAddKeepsFirstRecordAndRemove(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ctx := backup.WithRun(context.Background(), backup.Start("20260101-120000"))
+	finder := Entry{Kind: KindDefault, Domain: "com.apple.finder", Name: "ShowPathbar", Previous: []string{"-bool", "false"}}
+	zed := Entry{Kind: KindCask, Name: "zed", Label: "Zed"}
+	if err := Add(ctx, finder, zed); err != nil {
+		t.Fatal(err)
+	}
+	// a second run finds the key already set by freshbox
+	again := finder
+	again.Previous = []string{"-bool", "true"}
+	if err := Add(context.Background(), again); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if got := entries[0]; got.Run != "20260101-120000" || got.Previous[1] != "false" {
+		t.Errorf("first record should be kept, got %+v", got)
+	}
+	if entries[0].Title() != "com.apple.finder ShowPathbar" || entries[1].Title() != "Zed" {
+		t.Errorf("titles = %q, %q", entries[0].Title(), entries[1].Title())
+	}
+
+	if err := Remove(Entry{Kind: KindCask, Name: "zed"}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := Load(); len(entries) != 1 || entries[0].Kind != KindDefault {
+		t.Errorf("after Remove: %+v", entries)
+	}
+}
+
+func TestSaveIsAtomic(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	ctx := backup.WithRun(context.Background(), backup.Start("20260101-120000"))
+	os.MkdirAll(filepath.Dir(Path()), 0755)
+	os.WriteFile(Path(), []byte("[]\n"), 0644)
+	if err := Add(ctx, Entry{Kind: KindCask, Name: "zed"}); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := os.ReadDir(filepath.Dir(Path()))
+	for _, f := range files {
+		if strings.Contains(f.Name(), ".tmp-") {
+			t.Errorf("temp file %s left behind", f.Name())
+		}
+	}
+	if info, err := os.Stat(Path()); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("ledger mode = %v, %v; want 0600", info.Mode().Perm(), err)
+	}
+	if m, err := backup.Load("last"); err == nil && len(m.Files) > 0 {
+		t.Errorf("the ledger is freshbox's own file and shouldn't be backed up: %+v", m.Files)
+	}
+}
@@ -0,0 +1,206 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kittors/freshbox/internal/checker"
+	"github.com/kittors/freshbox/internal/tasks"
+)
+
+// CurrentVersion is the profile format version written by Save
+const CurrentVersion = 1
+
+// DefaultFileName is the conventional name for a team profile
+const DefaultFileName = "Freshfile.toml"
+
+// AISettings holds the non-secret settings for an AI tool
+type AISettings struct {
+	Model         string `toml:"model,omitempty" json:"model,omitempty"`
+	ThinkingLevel string `toml:"thinking_level,omitempty" json:"thinking_level,omitempty"`
+	BaseURL       string `toml:"base_url,omitempty" json:"base_url,omitempty"`
+}
+
+// Profile is a versioned, shareable snapshot of every wizard choice.
+// A nil list means "keep freshbox's defaults"; an empty list means "none".
+// API keys are never part of a profile.
+type Profile struct {
+	Version      int               `toml:"version" json:"version"`
+	Name         string            `toml:"name,omitempty" json:"name,omitempty"`
+	Description  string            `toml:"description,omitempty" json:"description,omitempty"`
+	DevTools     []string          `toml:"dev_tools" json:"dev_tools"`
+	Apps         []string          `toml:"apps" json:"apps"`
+	AITools      []string          `toml:"ai_tools" json:"ai_tools"`
+	NodeVersions []string          `toml:"node_versions" json:"node_versions"`
+	MCPs         []string          `toml:"mcps" json:"mcps"`
+	ExtraSetup   []string          `toml:"extra_setup" json:"extra_setup"`
+	SysDefaults  []string          `toml:"system_defaults" json:"system_defaults"`
+	MinVersions  map[string]string `toml:"min_versions,omitempty" json:"min_versions,omitempty"` // e.g. "Java (JDK)" = "21"
+	Codex        AISettings        `toml:"codex" json:"codex"`
+	Claude       AISettings        `toml:"claude" json:"claude"`
+}
+
+// FromSelection builds a profile from a selection, dropping API keys
+func FromSelection(sel tasks.Selection) Profile {
+	list := func(v []string) []string {
+		if v == nil {
+			return []string{}
+		}
+		return v
+	}
+	return Profile{
+		Version:      CurrentVersion,
+		DevTools:     list(sel.DevTools),
+		Apps:         list(sel.Apps),
+		AITools:      list(sel.AITools),
+		NodeVersions: list(sel.NodeVersions),
+		MCPs:         list(sel.MCPs),
+		ExtraSetup:   list(sel.ExtraSetup),
+		SysDefaults:  list(sel.SysDefaults),
+		MinVersions:  sel.MinVersions,
+		Codex: AISettings{
+			Model:         sel.Codex.Model,
+			ThinkingLevel: sel.Codex.ThinkingLevel,
+			BaseURL:       sel.Codex.BaseURL,
+		},
+		Claude: AISettings{
+			Model:   sel.Claude.Model,
+			BaseURL: sel.Claude.BaseURL,
+		},
+	}
+}
+
+// Selection converts the profile into a selection; nil lists stay nil
+func (p Profile) Selection() tasks.Selection {
+	return tasks.Selection{
+		DevTools:     p.DevTools,
+		Apps:         p.Apps,
+		AITools:      p.AITools,
+		NodeVersions: p.NodeVersions,
+		MCPs:         p.MCPs,
+		ExtraSetup:   p.ExtraSetup,
+		SysDefaults:  p.SysDefaults,
+		MinVersions:  p.MinVersions,
+		Codex: tasks.CodexSettings{
+			Model:         p.Codex.Model,
+			ThinkingLevel: p.Codex.ThinkingLevel,
+			BaseURL:       p.Codex.BaseURL,
+		},
+		Claude: tasks.ClaudeSettings{
+			Model:   p.Claude.Model,
+			BaseURL: p.Claude.BaseURL,
+		},
+	}
+}
+
+// Parse decodes a profile; format is "toml" or "json"
+func Parse(data []byte, format string) (*Profile, error) {
+	var p Profile
+	switch format {
+	case "toml":
+		md, err := toml.Decode(string(data), &p)
+		if err != nil {
+			return nil, fmt.Errorf("parse profile: %w", err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, k := range undecoded {
+				keys[i] = k.String()
+			}
+			return nil, fmt.Errorf("parse profile: unknown keys: %s", strings.Join(keys, ", "))
+		}
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&p); err != nil {
+			return nil, fmt.Errorf("parse profile: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown profile format %q", format)
+	}
+
+	switch {
+	case p.Version == 0:
+		return nil, fmt.Errorf("profile is missing version (expected version = %d)", CurrentVersion)
+	case p.Version > CurrentVersion:
+		return nil, fmt.Errorf("profile version %d is newer than this freshbox supports (%d)", p.Version, CurrentVersion)
+	}
+	for name, min := range p.MinVersions {
+		if _, ok := checker.ParseSemver(min); !ok {
+			return nil, fmt.Errorf("parse profile: invalid minimum version %q for %s", min, name)
+		}
+	}
+	return &p, nil
+}
+
+// Load reads a profile from disk, picking the format from the file extension
+func Load(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read profile: %w", err)
+	}
+	return Parse(data, formatFor(path))
+}
+
+// Marshal encodes the profile as TOML
+func (p Profile) Marshal() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("# freshbox profile — load with `freshbox --profile <file>`\n")
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = ""
+	if err := enc.Encode(p); err != nil {
+		return nil, fmt.Errorf("encode profile: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Save writes the profile as TOML, creating parent directories. It never
+// overwrites: if path exists the error wraps fs.ErrExist.
+func Save(p Profile, path string) error {
+	data, err := p.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create profile dir: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("write profile: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("write profile: %w", err)
+	}
+	return f.Close()
+}
+
+// DefaultExportPath returns where the TUI exports profiles: ./Freshfile.toml,
+// or ./Freshfile-2.toml, -3 and so on when that is taken
+func DefaultExportPath() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		dir, _ = os.UserHomeDir()
+	}
+	ext := filepath.Ext(DefaultFileName)
+	base := strings.TrimSuffix(DefaultFileName, ext)
+	path := filepath.Join(dir, DefaultFileName)
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(path); err != nil {
+			return path
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", base, n, ext))
+	}
+}
+
+func formatFor(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return "json"
+	}
+	return "toml"
+}
@@ -0,0 +1,170 @@
+package profile
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kittors/freshbox/internal/tasks"
+)
+
+func TestFromSelectionDropsSecrets(t *testing.T) {
+	sel := tasks.Selection{
+		DevTools: []string{"Git"},
+		Codex:    tasks.CodexSettings{Model: "o3", BaseURL: "https://gw.local/v1", APIKey: "sk-secret"},
+		Claude:   tasks.ClaudeSettings{Model: "claude-sonnet-4-6", APIKey: "sk-ant-secret"},
+	}
+	p := FromSelection(sel)
+	if p.Version != CurrentVersion {
+		t.Errorf("version = %d, want %d", p.Version, CurrentVersion)
+	}
+	if p.Apps == nil || len(p.Apps) != 0 {
+		t.Errorf("unset lists should export as empty, got %#v", p.Apps)
+	}
+
+	data, err := p.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Errorf("profile leaked an API key:\n%s", data)
+	}
+	if !strings.Contains(string(data), `base_url = "https://gw.local/v1"`) {
+		t.Errorf("profile missing codex base_url:\n%s", data)
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "team", DefaultFileName)
+	want := FromSelection(tasks.Selection{
+		DevTools:     []string{"Git", "Go"},
+		Apps:         []string{"Zed"},
+		AITools:      []string{"Claude Code"},
+		NodeVersions: []string{"v22.11.0"},
+		MCPs:         []string{"Playwright", "Context7"},
+		ExtraSetup:   []string{tasks.ExtraZedTheme},
+		SysDefaults:  []string{},
+		Codex:        tasks.CodexSettings{Model: "o4-mini", ThinkingLevel: "high"},
+	})
+	want.Name = "team"
+
+	if err := Save(want, path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got.Name != "team" || strings.Join(got.MCPs, ",") != "Playwright,Context7" {
+		t.Errorf("round trip mismatch: %+v", got)
+	}
+	if got.SysDefaults == nil || len(got.SysDefaults) != 0 {
+		t.Errorf("explicit empty list should stay empty, got %#v", got.SysDefaults)
+	}
+	if got.Codex.ThinkingLevel != "high" {
+		t.Errorf("codex thinking = %q", got.Codex.ThinkingLevel)
+	}
+}
+
+func TestParseOmittedListsStayNil(t *testing.T) {
+	p, err := Parse([]byte("version = 1\ndev_tools = [\"Git\"]\n"), "toml")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if p.Apps != nil || p.ExtraSetup != nil {
+		t.Errorf("omitted lists should be nil, got apps=%#v extra=%#v", p.Apps, p.ExtraSetup)
+	}
+	sel := p.Selection()
+	if len(sel.DevTools) != 1 || sel.Apps != nil {
+		t.Errorf("Selection() = %+v", sel)
+	}
+}
+
+func TestParseRejectsBadVersions(t *testing.T) {
+	if _, err := Parse([]byte(`dev_tools = ["Git"]`), "toml"); err == nil || !strings.Contains(err.Error(), "missing version") {
+		t.Errorf("expected missing version error, got %v", err)
+	}
+	if _, err := Parse([]byte("version = 99\n"), "toml"); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("expected newer version error, got %v", err)
+	}
+}
+
+func TestParseMinVersions(t *testing.T) {
+	p, err := Parse([]byte("version = 1\n\n[min_versions]\n\"Java (JDK)\" = \"21\"\nGo = \"1.25\"\n"), "toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sel := p.Selection(); sel.MinVersions["Java (JDK)"] != "21" || sel.MinVersions["Go"] != "1.25" {
+		t.Errorf("min versions = %v", sel.MinVersions)
+	}
+	data, _ := FromSelection(p.Selection()).Marshal()
+	if again, err := Parse(data, "toml"); err != nil || again.MinVersions["Go"] != "1.25" {
+		t.Errorf("round trip = %v, %v\n%s", again, err, data)
+	}
+
+	_, err = Parse([]byte("version = 1\n[min_versions]\nGo = \"newest\"\n"), "toml")
+	if err == nil || !strings.Contains(err.Error(), "newest") {
+		t.Errorf("expected invalid minimum version error, got %v", err)
+	}
+}
+
+func TestParseRejectsUnknownKeys(t *testing.T) {
+	_, err := Parse([]byte("version = 1\ndevtools = [\"Git\"]\n"), "toml")
+	if err == nil || !strings.Contains(err.Error(), "devtools") {
+		t.Errorf("expected unknown key error, got %v", err)
+	}
+
+	_, err = Parse([]byte(`{"version": 1, "codex": {"api_key": "sk-x"}}`), "json")
+	if err == nil {
+		t.Error("JSON profiles must not accept api_key")
+	}
+}
+
+func TestLoadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "team.json")
+	os.WriteFile(path, []byte(`{"version": 1, "apps": ["Zed"], "claude": {"model": "claude-opus-4-1"}}`), 0644)
+	p, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if p.Claude.Model != "claude-opus-4-1" || p.Apps[0] != "Zed" {
+		t.Errorf("Load = %+v", p)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	if _, err := Load(filepath.Join(t.TempDir(), "nope.toml")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestSaveNeverOverwrites(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	path := DefaultExportPath()
+	if path != filepath.Join(dir, DefaultFileName) {
+		t.Fatalf("DefaultExportPath() = %s", path)
+	}
+	os.WriteFile(path, []byte("# hand-written\n"), 0644)
+
+	if err := Save(Profile{Name: "new"}, path); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Save over an existing file: err = %v, want fs.ErrExist", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "# hand-written\n" {
+		t.Errorf("existing profile was changed: %s", data)
+	}
+
+	next := DefaultExportPath()
+	if filepath.Base(next) != "Freshfile-2.toml" {
+		t.Fatalf("next export path = %s", next)
+	}
+	if err := Save(Profile{Name: "new"}, next); err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(DefaultExportPath()) != "Freshfile-3.toml" {
+		t.Errorf("third export path = %s", DefaultExportPath())
+	}
+}
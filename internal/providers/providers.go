@@ -0,0 +1,242 @@
+package providers
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/kittors/freshbox/internal/backup"
+	"github.com/kittors/freshbox/internal/config"
+	"github.com/kittors/freshbox/internal/secrets"
+)
+
+// Tools a profile can configure
+const (
+	Codex  = "codex"
+	Claude = "claude"
+)
+
+// Tools lists every tool in display order
+var Tools = []string{Codex, Claude}
+
+// Settings is how one tool reaches its provider
+type Settings struct {
+	Model         string `json:"model,omitempty"`
+	ThinkingLevel string `json:"thinking_level,omitempty"` // Codex only
+	BaseURL       string `json:"base_url,omitempty"`       // empty: the official API
+	// KeyRef names the API key in the secret store; empty uses the tool's
+	// own login
+	KeyRef string `json:"key_ref,omitempty"`
+}
+
+// String is a one-line summary such as "gpt-5 (high) @ https://gw/v1"
+func (s Settings) String() string {
+	desc := cmp.Or(s.Model, "default model")
+	if s.ThinkingLevel != "" {
+		desc += " (" + s.ThinkingLevel + ")"
+	}
+	if s.BaseURL != "" {
+		desc += " @ " + s.BaseURL
+	}
+	if s.KeyRef == "" {
+		desc += ", login"
+	}
+	return desc
+}
+
+// Profile is a named provider setup for Codex, Claude Code or both
+type Profile struct {
+	Name   string    `json:"name"`
+	Codex  *Settings `json:"codex,omitempty"`
+	Claude *Settings `json:"claude,omitempty"`
+}
+
+// For returns the profile's settings for tool, or nil
+func (p Profile) For(tool string) *Settings {
+	switch tool {
+	case Codex:
+		return p.Codex
+	case Claude:
+		return p.Claude
+	}
+	return nil
+}
+
+// Tools returns the tools the profile configures
+func (p Profile) Tools() []string {
+	var tools []string
+	for _, tool := range Tools {
+		if p.For(tool) != nil {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Validate reports a profile that can't be written or activated
+func (p Profile) Validate() error {
+	if !validName.MatchString(p.Name) {
+		return fmt.Errorf("profile name %q: use letters, digits, '.', '_' or '-'", p.Name)
+	}
+	if len(p.Tools()) == 0 {
+		return fmt.Errorf("profile %q configures neither codex nor claude", p.Name)
+	}
+	if p.Claude != nil && p.Claude.ThinkingLevel != "" {
+		return fmt.Errorf("profile %q: claude has no thinking level", p.Name)
+	}
+	return nil
+}
+
+// KeyRef returns the secret name freshbox stores a profile's key for tool under
+func KeyRef(profile, tool string) string {
+	return "ai-" + profile + "-" + tool
+}
+
+// Set is every saved profile and the one each tool uses
+type Set struct {
+	Profiles []Profile         `json:"profiles"`
+	Active   map[string]string `json:"active,omitempty"` // tool → profile name
+}
+
+// Path returns ~/.freshbox/providers.json
+func Path() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".freshbox", "providers.json")
+}
+
+// Load reads the saved profiles; a missing file is an empty set
+func Load() (Set, error) {
+	data, err := os.ReadFile(Path())
+	if errors.Is(err, os.ErrNotExist) {
+		return Set{}, nil
+	}
+	if err != nil {
+		return Set{}, fmt.Errorf("read provider profiles: %w", err)
+	}
+	var s Set
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Set{}, fmt.Errorf("parse %s: %w", Path(), err)
+	}
+	return s, nil
+}
+
+// Save writes the set to Path
+func (s Set) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal provider profiles: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(Path()), 0755); err != nil {
+		return fmt.Errorf("create profiles dir: %w", err)
+	}
+	return backup.WriteAtomic(Path(), append(data, '\n'), 0644)
+}
+
+// Find returns the profile called name
+func (s Set) Find(name string) (Profile, bool) {
+	i := slices.IndexFunc(s.Profiles, func(p Profile) bool { return p.Name == name })
+	if i < 0 {
+		return Profile{}, false
+	}
+	return s.Profiles[i], true
+}
+
+// Put adds p, or replaces the profile with its name
+func (s *Set) Put(p Profile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if i := slices.IndexFunc(s.Profiles, func(o Profile) bool { return o.Name == p.Name }); i >= 0 {
+		s.Profiles[i] = p
+	} else {
+		s.Profiles = append(s.Profiles, p)
+	}
+	return nil
+}
+
+// Remove deletes the profile called name and reports whether there was one.
+// The tools it was active for keep their config files as they are.
+func (s *Set) Remove(name string) bool {
+	n := len(s.Profiles)
+	s.Profiles = slices.DeleteFunc(s.Profiles, func(p Profile) bool { return p.Name == name })
+	for tool, active := range s.Active {
+		if active == name {
+			delete(s.Active, tool)
+		}
+	}
+	return len(s.Profiles) < n
+}
+
+// Use activates profile name for tools, or for every tool it configures when
+// tools is empty. config.toml, ~/.zshrc and settings.json are rewritten
+// together, so a failure leaves the previous profile in place. It returns
+// the tools that were switched.
+func Use(ctx context.Context, name string, tools ...string) ([]string, error) {
+	s, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	p, ok := s.Find(name)
+	if !ok {
+		return nil, fmt.Errorf("no AI provider profile %q (see 'freshbox ai list')", name)
+	}
+	if len(tools) == 0 {
+		tools = p.Tools()
+	}
+
+	store := secrets.Default()
+	var codex *config.CodexConfig
+	var claude *config.ClaudeConfig
+	for _, tool := range tools {
+		settings := p.For(tool)
+		if settings == nil {
+			return nil, fmt.Errorf("profile %q has no %s settings", name, tool)
+		}
+		if settings.KeyRef != "" {
+			// fail before touching anything rather than point a tool at nothing
+			if _, err := store.Get(ctx, settings.KeyRef); err != nil {
+				return nil, fmt.Errorf("profile %q: %s key: %w", name, tool, err)
+			}
+		}
+		switch tool {
+		case Codex:
+			codex = &config.CodexConfig{
+				Model:         settings.Model,
+				ThinkingLevel: settings.ThinkingLevel,
+				BaseURL:       settings.BaseURL,
+				Provider:      name,
+				KeyRef:        settings.KeyRef,
+				Reset:         true,
+			}
+			if settings.KeyRef != "" {
+				codex.EnvKey = config.CodexKeyEnv
+			}
+		case Claude:
+			claude = &config.ClaudeConfig{
+				Model:   settings.Model,
+				BaseURL: settings.BaseURL,
+				KeyRef:  settings.KeyRef,
+				Reset:   true,
+			}
+		}
+	}
+	if err := config.WriteAIConfig(ctx, codex, claude); err != nil {
+		return nil, err
+	}
+
+	if s.Active == nil {
+		s.Active = make(map[string]string)
+	}
+	for _, tool := range tools {
+		s.Active[tool] = name
+	}
+	return tools, s.Save()
+}
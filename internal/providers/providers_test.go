@@ -0,0 +1,129 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kittors/freshbox/internal/secrets"
+)
+
+func gateway() Profile {
+	return Profile{
+		Name:   "gw",
+		Codex:  &Settings{Model: "gpt-5", ThinkingLevel: "high", BaseURL: "https://gw/v1", KeyRef: KeyRef("gw", Codex)},
+		Claude: &Settings{Model: "claude-sonnet-4-6", BaseURL: "https://gw", KeyRef: KeyRef("gw", Claude)},
+	}
+}
+
+func TestSetPutFindRemove(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	var s Set
+	if err := s.Put(gateway()); err != nil {
+		t.Fatal(err)
+	}
+	s.Put(Profile{Name: "official", Codex: &Settings{Model: "o3"}})
+	s.Put(Profile{Name: "gw", Codex: &Settings{Model: "gpt-5-mini"}})
+	s.Active = map[string]string{Codex: "gw", Claude: "gw"}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := loaded.Find("gw")
+	if !ok || p.Codex.Model != "gpt-5-mini" || p.Claude != nil || len(loaded.Profiles) != 2 {
+		t.Errorf("Put should replace by name: %+v", loaded.Profiles)
+	}
+	if !loaded.Remove("gw") || loaded.Remove("gw") {
+		t.Error("Remove reported the wrong result")
+	}
+	if len(loaded.Active) != 0 {
+		t.Errorf("a removed profile can't stay active: %v", loaded.Active)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, p := range []Profile{
+		{Name: "", Codex: &Settings{}},
+		{Name: "my gw", Codex: &Settings{}},
+		{Name: "gw"},
+		{Name: "gw", Claude: &Settings{ThinkingLevel: "high"}},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%+v should be invalid", p)
+		}
+	}
+	if err := gateway().Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUseSwitchesBothToolsAndMarksThemActive(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	ctx := context.Background()
+	store := secrets.Default()
+	store.Set(ctx, KeyRef("gw", Codex), "sk-codex")
+	store.Set(ctx, KeyRef("gw", Claude), "sk-ant")
+	s := Set{}
+	s.Put(gateway())
+	s.Put(Profile{Name: "official", Codex: &Settings{Model: "o3"}, Claude: &Settings{}})
+	s.Save()
+
+	tools, err := Use(ctx, "gw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(tools, ",") != "codex,claude" {
+		t.Errorf("switched %v", tools)
+	}
+	codex, _ := os.ReadFile(filepath.Join(home, ".codex", "config.toml"))
+	if !strings.Contains(string(codex), `model_provider = "gw"`) || !strings.Contains(string(codex), "[model_providers.gw]") {
+		t.Errorf("config.toml:\n%s", codex)
+	}
+	claude, _ := os.ReadFile(filepath.Join(home, ".claude", "settings.json"))
+	if !strings.Contains(string(claude), KeyRef("gw", Claude)) || strings.Contains(string(claude), "sk-ant") {
+		t.Errorf("settings.json should point at the stored key:\n%s", claude)
+	}
+
+	if _, err := Use(ctx, "official", Claude); err != nil {
+		t.Fatal(err)
+	}
+	loaded, _ := Load()
+	if loaded.Active[Codex] != "gw" || loaded.Active[Claude] != "official" {
+		t.Errorf("active = %v", loaded.Active)
+	}
+	claude, _ = os.ReadFile(filepath.Join(home, ".claude", "settings.json"))
+	if strings.Contains(string(claude), "gw") {
+		t.Errorf("the official profile kept gateway settings:\n%s", claude)
+	}
+}
+
+func TestUseWithoutStoredKeyChangesNothing(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	s := Set{}
+	s.Put(gateway())
+	s.Save()
+
+	_, err := Use(context.Background(), "gw")
+	if !errors.Is(err, secrets.ErrNotFound) {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".codex", "config.toml")); !os.IsNotExist(err) {
+		t.Error("config.toml written before the key was checked")
+	}
+	if loaded, _ := Load(); len(loaded.Active) != 0 {
+		t.Errorf("active = %v", loaded.Active)
+	}
+
+	if _, err := Use(context.Background(), "nope"); err == nil || !strings.Contains(err.Error(), "no AI provider profile") {
+		t.Errorf("unknown profile: err = %v", err)
+	}
+}
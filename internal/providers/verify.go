@@ -0,0 +1,190 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Official API base URLs, used when Settings.BaseURL is empty
+const (
+	OpenAIBaseURL    = "https://api.openai.com/v1"
+	AnthropicBaseURL = "https://api.anthropic.com"
+)
+
+// anthropicVersion is the API version header Anthropic requires
+const anthropicVersion = "2023-06-01"
+
+// ThinkingLevels are the reasoning efforts Codex accepts
+var ThinkingLevels = []string{"none", "minimal", "low", "medium", "high", "xhigh"}
+
+// claudeAliases are model names Claude Code resolves itself; no endpoint lists them
+var claudeAliases = []string{"default", "sonnet", "opus", "haiku", "opusplan", "sonnet[1m]"}
+
+var (
+	clientMu sync.Mutex
+	client   = &http.Client{Timeout: 10 * time.Second}
+)
+
+// UseClient makes Verify send its requests through c, e.g. a stand-in
+// server's client in tests. It returns a func that puts the previous one back.
+func UseClient(c *http.Client) (restore func()) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	prev := client
+	client = c
+	return func() {
+		clientMu.Lock()
+		defer clientMu.Unlock()
+		client = prev
+	}
+}
+
+func httpClient() *http.Client {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	return client
+}
+
+// Check is the outcome of validating one field
+type Check struct {
+	Done bool  // false: not checked, e.g. there was no key to ask the endpoint with
+	Err  error // why the field is wrong; nil if it passed or wasn't checked
+}
+
+// Passed reports a field that was checked and is fine
+func (c Check) Passed() bool { return c.Done && c.Err == nil }
+
+func pass() Check                         { return Check{Done: true} }
+func fail(err error) Check                { return Check{Done: true, Err: err} }
+func failf(format string, a ...any) Check { return fail(fmt.Errorf(format, a...)) }
+
+// Report is what Verify found for each field of a tool's settings
+type Report struct {
+	Model         Check
+	ThinkingLevel Check
+	BaseURL       Check
+	APIKey        Check
+}
+
+// Failed reports whether any field is wrong
+func (r Report) Failed() bool {
+	return slices.ContainsFunc([]Check{r.Model, r.ThinkingLevel, r.BaseURL, r.APIKey}, func(c Check) bool { return c.Err != nil })
+}
+
+// Verify validates s for tool before it is written: the base URL's syntax
+// and the thinking level first, then, given a key, the endpoint's models
+// list, which confirms the URL, that the key is accepted and that the model
+// is offered. Without a key only the local checks run, so nothing is sent.
+func Verify(ctx context.Context, tool string, s Settings, key string) Report {
+	var r Report
+	if s.ThinkingLevel != "" {
+		r.ThinkingLevel = pass()
+		if tool != Codex || !slices.Contains(ThinkingLevels, s.ThinkingLevel) {
+			r.ThinkingLevel = failf("want one of %s", strings.Join(ThinkingLevels, ", "))
+		}
+	}
+
+	base := s.BaseURL
+	if base == "" {
+		base = OpenAIBaseURL
+		if tool == Claude {
+			base = AnthropicBaseURL
+		}
+	}
+	u, err := url.Parse(base)
+	switch {
+	case err != nil:
+		r.BaseURL = fail(err)
+		return r
+	case u.Scheme != "http" && u.Scheme != "https", u.Host == "":
+		r.BaseURL = failf("want an http:// or https:// URL")
+		return r
+	}
+	if key == "" {
+		if s.BaseURL != "" {
+			r.BaseURL = pass()
+		}
+		return r
+	}
+
+	models, status, err := listModels(ctx, tool, base, key)
+	switch {
+	case err != nil:
+		r.BaseURL = fail(err)
+		return r
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		r.BaseURL = pass()
+		r.APIKey = failf("rejected by the endpoint (%d)", status)
+		return r
+	case status == http.StatusNotFound:
+		r.BaseURL = failf("no models list at %s (404)", u.Redacted())
+		return r
+	case status < 200 || status > 299:
+		r.BaseURL = failf("endpoint answered %d", status)
+		return r
+	}
+	r.BaseURL, r.APIKey = pass(), pass()
+
+	switch {
+	case s.Model == "", models == nil:
+		// nothing to look for, or a list we couldn't read
+	case slices.Contains(models, s.Model):
+		r.Model = pass()
+	case tool == Claude && slices.Contains(claudeAliases, s.Model):
+		// an alias Claude Code resolves on its own
+	default:
+		r.Model = failf("not offered by the endpoint")
+	}
+	return r
+}
+
+// listModels asks the endpoint for its models; models is nil if the response
+// wasn't a models list
+func listModels(ctx context.Context, tool, base, key string) (models []string, status int, err error) {
+	endpoint := strings.TrimSuffix(base, "/") + "/models"
+	if tool == Claude {
+		// ANTHROPIC_BASE_URL doesn't include the version
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/models?limit=1000"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if tool == Claude {
+		req.Header.Set("x-api-key", key)
+		req.Header.Set("anthropic-version", anthropicVersion)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return nil, 0, fmt.Errorf("can't reach the endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if resp.StatusCode/100 != 2 || json.NewDecoder(resp.Body).Decode(&list) != nil || list.Data == nil {
+		return nil, resp.StatusCode, nil
+	}
+	models = make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, m.ID)
+	}
+	return models, resp.StatusCode, nil
+}
@@ -0,0 +1,99 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// standIn serves a models list to requests carrying key, the OpenAI way
+// (Bearer, /models) or the Anthropic way (x-api-key, /v1/models)
+func standIn(t *testing.T, key string, models ...string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/models":
+			if r.Header.Get("anthropic-version") == "" {
+				http.Error(w, "missing version", http.StatusBadRequest)
+				return
+			}
+			if r.Header.Get("x-api-key") != key && r.Header.Get("Authorization") != "Bearer "+key {
+				http.Error(w, "bad key", http.StatusUnauthorized)
+				return
+			}
+		case "/openai/models":
+			if r.Header.Get("Authorization") != "Bearer "+key {
+				http.Error(w, "bad key", http.StatusUnauthorized)
+				return
+			}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		var data []string
+		for _, m := range models {
+			data = append(data, fmt.Sprintf(`{"id": %q, "object": "model"}`, m))
+		}
+		fmt.Fprintf(w, `{"object": "list", "data": [%s]}`, strings.Join(data, ","))
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(UseClient(srv.Client()))
+	return srv
+}
+
+func TestVerify(t *testing.T) {
+	srv := standIn(t, "sk-good", "gpt-5", "claude-sonnet-4-6")
+	openai := srv.URL + "/openai"
+	cases := []struct {
+		name     string
+		tool     string
+		settings Settings
+		key      string
+		want     string // per field: ✓ passed, ✗ failed, - not checked
+	}{
+		{"all good", Codex, Settings{Model: "gpt-5", ThinkingLevel: "high", BaseURL: openai}, "sk-good", "✓✓✓✓"},
+		{"unknown model", Codex, Settings{Model: "gpt-9", BaseURL: openai}, "sk-good", "✗-✓✓"},
+		{"bad key", Codex, Settings{Model: "gpt-5", BaseURL: openai}, "sk-bad", "--✓✗"},
+		{"no models list", Codex, Settings{Model: "gpt-5", BaseURL: srv.URL + "/nope"}, "sk-good", "--✗-"},
+		{"unreachable", Codex, Settings{BaseURL: "http://127.0.0.1:1"}, "sk-good", "--✗-"},
+		{"not a URL", Codex, Settings{BaseURL: "api.example.com/v1"}, "sk-good", "--✗-"},
+		{"bad thinking level", Codex, Settings{ThinkingLevel: "max", BaseURL: openai}, "", "-✗✓-"},
+		{"no key, no request", Codex, Settings{Model: "gpt-9", BaseURL: srv.URL + "/nope"}, "", "--✓-"},
+		{"claude", Claude, Settings{Model: "claude-sonnet-4-6", BaseURL: srv.URL}, "sk-good", "✓-✓✓"},
+		{"claude alias", Claude, Settings{Model: "opus", BaseURL: srv.URL + "/"}, "sk-good", "--✓✓"},
+		{"claude bad key", Claude, Settings{BaseURL: srv.URL}, "sk-bad", "--✓✗"},
+		{"claude has no thinking level", Claude, Settings{ThinkingLevel: "high"}, "", "-✗--"},
+	}
+	mark := func(c Check) string {
+		switch {
+		case !c.Done:
+			return "-"
+		case c.Err != nil:
+			return "✗"
+		}
+		return "✓"
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := Verify(context.Background(), tc.tool, tc.settings, tc.key)
+			got := mark(r.Model) + mark(r.ThinkingLevel) + mark(r.BaseURL) + mark(r.APIKey)
+			if got != tc.want {
+				t.Errorf("model/think/url/key = %s, want %s (%+v)", got, tc.want, r)
+			}
+			if r.Failed() != strings.Contains(tc.want, "✗") {
+				t.Errorf("Failed() = %v", r.Failed())
+			}
+		})
+	}
+}
+
+func TestVerifyErrorsDontLeakTheKey(t *testing.T) {
+	srv := standIn(t, "sk-good")
+	r := Verify(context.Background(), Codex, Settings{BaseURL: srv.URL + "/openai"}, "sk-leaky-key")
+	if r.APIKey.Err == nil || strings.Contains(r.APIKey.Err.Error(), "sk-leaky-key") {
+		t.Errorf("key error = %v", r.APIKey.Err)
+	}
+}
@@ -0,0 +1,110 @@
+package redact
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Mask replaces every secret in redacted text
+const Mask = "[REDACTED]"
+
+// minLen keeps short values (empty fields, "test") from masking ordinary words
+const minLen = 8
+
+// patterns match well-known key formats even if they were never registered
+var patterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`sk-[A-Za-z0-9_-]{16,}`), Mask},                                // OpenAI, Anthropic and compatible
+	{regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{20,}`), Mask},                           // GitHub tokens
+	{regexp.MustCompile(`github_pat_[A-Za-z0-9_]{20,}`), Mask},                         // GitHub fine-grained tokens
+	{regexp.MustCompile(`xox[abposr]-[A-Za-z0-9-]{10,}`), Mask},                        // Slack tokens
+	{regexp.MustCompile(`AIza[0-9A-Za-z_-]{35}`), Mask},                                // Google API keys
+	{regexp.MustCompile(`(?i)(bearer|x-api-key:)(\s+)[^\s"']{8,}`), "${1}${2}" + Mask}, // auth headers keep their name
+}
+
+// envSuffixes mark environment variables that hold secrets
+var envSuffixes = []string{"_API_KEY", "_TOKEN", "_SECRET", "_PASSWORD"}
+
+var (
+	mu      sync.RWMutex
+	secrets []string // longest first, so a key containing another is masked whole
+)
+
+// Add registers secrets collected in this session, such as API keys typed
+// into the TUI or passed as flags. Values shorter than 8 characters are ignored.
+func Add(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if len(v) < minLen || slices.Contains(secrets, v) {
+			continue
+		}
+		secrets = append(secrets, v)
+	}
+	slices.SortFunc(secrets, func(a, b string) int { return len(b) - len(a) })
+}
+
+// AddEnv registers the values of environment variables whose names look like
+// they hold a secret, e.g. GITHUB_PERSONAL_ACCESS_TOKEN or BRAVE_API_KEY
+func AddEnv(environ []string) {
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		name = strings.ToUpper(name)
+		for _, suffix := range envSuffixes {
+			if strings.HasSuffix(name, suffix) {
+				Add(value)
+				break
+			}
+		}
+	}
+}
+
+// Reset forgets every registered secret
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	secrets = nil
+}
+
+// String masks registered secrets and well-known key patterns in s
+func String(s string) string {
+	mu.RLock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+	mu.RUnlock()
+	for _, p := range patterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
+
+// Error returns err with its message masked. errors.Is and errors.As still
+// see the original error.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := String(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
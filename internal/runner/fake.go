@@ -0,0 +1,168 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Response is a scripted subprocess outcome for Fake
+type Response struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// ExitError is returned by Fake for a non-zero exit code
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+type fakeRule struct {
+	prefix string
+	resp   Response
+}
+
+// Fake answers commands from scripted responses without running anything and
+// records every call. Unmatched commands succeed with no output.
+type Fake struct {
+	mu    sync.Mutex
+	rules []fakeRule
+	paths map[string]string
+	calls []Result
+}
+
+// NewFake returns an empty Fake
+func NewFake() *Fake {
+	return &Fake{paths: make(map[string]string)}
+}
+
+// On scripts the response for command lines starting with prefix
+// (matched on whole words); later rules win
+func (f *Fake) On(prefix string, resp Response) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, fakeRule{prefix: prefix, resp: resp})
+	return f
+}
+
+// Replay scripts every recorded result so a run can be reproduced exactly
+func (f *Fake) Replay(results []Result) *Fake {
+	for _, r := range results {
+		f.On(r.Cmdline, Response{Stdout: r.Stdout, Stderr: r.Stderr, ExitCode: r.ExitCode})
+	}
+	return f
+}
+
+// Path makes LookPath find file at path
+func (f *Fake) Path(file, path string) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paths[file] = path
+	return f
+}
+
+// Run implements Runner. A cancelled ctx fails the call without recording
+// it, like a process that never started.
+func (f *Fake) Run(ctx context.Context, c Cmd) (Result, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	res := Result{Cmdline: c.String(), Stdin: c.Stdin, Start: time.Now()}
+	if err := ctx.Err(); err != nil {
+		res.ExitCode = -1
+		observe(ctx, res, err)
+		return res, err
+	}
+	for i := len(f.rules) - 1; i >= 0; i-- {
+		p := f.rules[i].prefix
+		if res.Cmdline == p || strings.HasPrefix(res.Cmdline, p+" ") {
+			resp := f.rules[i].resp
+			res.Stdout, res.Stderr, res.ExitCode = resp.Stdout, resp.Stderr, resp.ExitCode
+			res.Output = resp.Stdout + resp.Stderr
+			break
+		}
+	}
+	f.calls = append(f.calls, res)
+	if fn := outputFunc(ctx); fn != nil {
+		fn("$ " + res.Cmdline)
+		emitLines(fn, res.Stdout)
+		emitLines(fn, res.Stderr)
+	}
+
+	var err error
+	if res.ExitCode != 0 {
+		err = &ExitError{Code: res.ExitCode}
+	}
+	observe(ctx, res, err)
+	return res, err
+}
+
+// LookPath implements Runner
+func (f *Fake) LookPath(file string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.paths[file]; ok {
+		return p, nil
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+// Calls returns every command run so far
+func (f *Fake) Calls() []Result {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Result(nil), f.calls...)
+}
+
+// Cmdlines returns the command line of every call so far
+func (f *Fake) Cmdlines() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	lines := make([]string, len(f.calls))
+	for i, r := range f.calls {
+		lines[i] = r.Cmdline
+	}
+	return lines
+}
+
+// Recorder runs commands on another runner and keeps every result
+type Recorder struct {
+	Runner Runner
+
+	mu    sync.Mutex
+	calls []Result
+}
+
+// NewRecorder wraps r
+func NewRecorder(r Runner) *Recorder {
+	return &Recorder{Runner: r}
+}
+
+// Run implements Runner
+func (r *Recorder) Run(ctx context.Context, c Cmd) (Result, error) {
+	res, err := r.Runner.Run(ctx, c)
+	r.mu.Lock()
+	r.calls = append(r.calls, res)
+	r.mu.Unlock()
+	return res, err
+}
+
+// LookPath implements Runner
+func (r *Recorder) LookPath(file string) (string, error) {
+	return r.Runner.LookPath(file)
+}
+
+// Calls returns every recorded result
+func (r *Recorder) Calls() []Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Result(nil), r.calls...)
+}
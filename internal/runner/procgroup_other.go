@@ -0,0 +1,9 @@
+//go:build !unix
+
+package runner
+
+import "os/exec"
+
+// killGroupOnCancel leaves the default kill-on-cancel; there are no process
+// groups to kill
+func killGroupOnCancel(cmd *exec.Cmd) {}
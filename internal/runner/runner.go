@@ -0,0 +1,267 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cmd is a subprocess to run
+type Cmd struct {
+	Name  string
+	Args  []string
+	Env   []string // extra KEY=VALUE pairs added to the current environment
+	Stdin string   // fed to the command; unlike Args it never shows in ps or logs
+}
+
+// Command builds a Cmd, mirroring exec.Command
+func Command(name string, args ...string) Cmd {
+	return Cmd{Name: name, Args: args}
+}
+
+// String returns the shell-quoted command line
+func (c Cmd) String() string {
+	return ShellJoin(append([]string{c.Name}, c.Args...))
+}
+
+// Result captures everything a subprocess produced
+type Result struct {
+	Cmdline  string        `json:"cmdline"`
+	Stdout   string        `json:"stdout"`
+	Stderr   string        `json:"stderr"`
+	Output   string        `json:"output"` // stdout and stderr interleaved
+	Stdin    string        `json:"-"`      // may hold a secret, so never saved
+	ExitCode int           `json:"exit_code"`
+	Start    time.Time     `json:"start,omitzero"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Runner runs subprocesses; every exec in freshbox goes through one
+type Runner interface {
+	// Run starts c and waits for it; a non-zero exit is returned as an error.
+	// Cancelling ctx kills the command and anything it started.
+	Run(ctx context.Context, c Cmd) (Result, error)
+	// LookPath searches PATH for an executable, like exec.LookPath
+	LookPath(file string) (string, error)
+}
+
+var (
+	mu      sync.RWMutex
+	current Runner = Exec{}
+)
+
+// Default returns the runner used by the package-level helpers
+func Default() Runner {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Use swaps the default runner and returns a func that restores the previous one
+func Use(r Runner) (restore func()) {
+	mu.Lock()
+	prev := current
+	current = r
+	mu.Unlock()
+	return func() { Use(prev) }
+}
+
+// Run runs name with args on the default runner
+func Run(ctx context.Context, name string, args ...string) (Result, error) {
+	return Default().Run(ctx, Command(name, args...))
+}
+
+// RunCmd runs c on the default runner
+func RunCmd(ctx context.Context, c Cmd) (Result, error) {
+	return Default().Run(ctx, c)
+}
+
+type outputKey struct{}
+
+// WithOutput returns a ctx whose commands stream their output to fn one line
+// at a time, starting with "$ <cmdline>". fn may be called from several
+// goroutines at once.
+func WithOutput(ctx context.Context, fn func(line string)) context.Context {
+	return context.WithValue(ctx, outputKey{}, fn)
+}
+
+type observerKey struct{}
+
+// WithObserver returns a ctx whose commands are reported to fn once they
+// finish, or fail to start. fn may be called from several goroutines at once.
+func WithObserver(ctx context.Context, fn func(Result, error)) context.Context {
+	return context.WithValue(ctx, observerKey{}, fn)
+}
+
+// observe reports a finished command to the observer set by WithObserver
+func observe(ctx context.Context, res Result, err error) {
+	if fn, ok := ctx.Value(observerKey{}).(func(Result, error)); ok {
+		fn(res, err)
+	}
+}
+
+// outputFunc returns the line callback set by WithOutput, if any
+func outputFunc(ctx context.Context) func(string) {
+	fn, _ := ctx.Value(outputKey{}).(func(string))
+	return fn
+}
+
+// Output runs name with args and returns the combined output, like exec.Cmd.CombinedOutput
+func Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	res, err := Run(ctx, name, args...)
+	return []byte(res.Output), err
+}
+
+// LookPath searches PATH on the default runner
+func LookPath(file string) (string, error) {
+	return Default().LookPath(file)
+}
+
+// killGrace is how long Exec waits for output pipes after killing a command
+const killGrace = 2 * time.Second
+
+// Exec runs real processes via os/exec. Each command gets its own process
+// group, so cancelling also kills whatever it spawned (curl | sh, npx, ...).
+type Exec struct{}
+
+// Run implements Runner
+func (Exec) Run(ctx context.Context, c Cmd) (Result, error) {
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	killGroupOnCancel(cmd)
+	cmd.WaitDelay = killGrace
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	if c.Stdin != "" {
+		cmd.Stdin = strings.NewReader(c.Stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+	combined := &lockedBuffer{}
+	cmd.Stdout = io.MultiWriter(&stdout, combined)
+	cmd.Stderr = io.MultiWriter(&stderr, combined)
+	var outLines, errLines *lineWriter
+	if fn := outputFunc(ctx); fn != nil {
+		fn("$ " + c.String())
+		outLines, errLines = &lineWriter{fn: fn}, &lineWriter{fn: fn}
+		cmd.Stdout = io.MultiWriter(cmd.Stdout, outLines)
+		cmd.Stderr = io.MultiWriter(cmd.Stderr, errLines)
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	if outLines != nil {
+		outLines.Flush()
+		errLines.Flush()
+	}
+	res := Result{
+		Cmdline:  c.String(),
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Output:   combined.String(),
+		Stdin:    c.Stdin,
+		ExitCode: exitCode(err),
+		Start:    start,
+		Duration: time.Since(start),
+	}
+	observe(ctx, res, err)
+	return res, err
+}
+
+// LookPath implements Runner
+func (Exec) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+// exitCode maps a Run error to a process exit code; -1 means it never ran
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// lockedBuffer lets stdout and stderr copiers share one buffer
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// lineWriter calls fn for every complete line written to it. A carriage
+// return starts the line over, as on a terminal, so progress bars collapse
+// to their last state.
+type lineWriter struct {
+	fn  func(string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits a final line that had no trailing newline
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *lineWriter) emit(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if i := bytes.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+	w.fn(string(line))
+}
+
+// emitLines sends each line of text to fn, for runners that have the whole
+// output at once
+func emitLines(fn func(string), text string) {
+	w := &lineWriter{fn: fn}
+	w.Write([]byte(text))
+	w.Flush()
+}
+
+// ShellJoin quotes args so the result can be pasted into a shell
+func ShellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\n'\"$&|;<>()*?[]{}~`!#") {
+			a = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		}
+		quoted[i] = a
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,230 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var ctx = context.Background()
+
+// --- Exec ---
+
+func TestExecCapturesOutputAndExitCode(t *testing.T) {
+	res, err := Exec{}.Run(ctx, Command("sh", "-c", "echo out; echo err >&2; exit 3"))
+	if err == nil {
+		t.Fatal("expected error for non-zero exit")
+	}
+	if res.ExitCode != 3 {
+		t.Errorf("exit code = %d, want 3", res.ExitCode)
+	}
+	if res.Stdout != "out\n" || res.Stderr != "err\n" {
+		t.Errorf("stdout = %q, stderr = %q", res.Stdout, res.Stderr)
+	}
+	if !strings.Contains(res.Output, "out") || !strings.Contains(res.Output, "err") {
+		t.Errorf("combined output = %q", res.Output)
+	}
+	if res.Cmdline != `sh -c 'echo out; echo err >&2; exit 3'` {
+		t.Errorf("cmdline = %s", res.Cmdline)
+	}
+	if res.Duration <= 0 {
+		t.Error("duration should be recorded")
+	}
+}
+
+func TestExecEnv(t *testing.T) {
+	c := Command("sh", "-c", `printf %s "$FRESHBOX_TEST"`)
+	c.Env = []string{"FRESHBOX_TEST=hello"}
+	res, err := Exec{}.Run(ctx, c)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if res.Stdout != "hello" {
+		t.Errorf("stdout = %q, want hello", res.Stdout)
+	}
+}
+
+func TestExecStdin(t *testing.T) {
+	c := Command("wc", "-c")
+	c.Stdin = "secret-from-stdin"
+	res, err := Exec{}.Run(ctx, c)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if strings.TrimSpace(res.Stdout) != "17" || strings.Contains(res.Cmdline, "secret") {
+		t.Errorf("stdout = %q, cmdline = %q", res.Stdout, res.Cmdline)
+	}
+	if data, _ := json.Marshal(res); strings.Contains(string(data), "secret") {
+		t.Errorf("stdin should not be serialized: %s", data)
+	}
+}
+
+func TestExecMissingBinary(t *testing.T) {
+	res, err := Exec{}.Run(ctx, Command("freshbox-no-such-binary"))
+	if err == nil || res.ExitCode != -1 {
+		t.Errorf("missing binary: exit=%d err=%v", res.ExitCode, err)
+	}
+}
+
+func TestExecCancelKillsProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	// the grandchild sleep holds stdout open; only a group kill ends it early
+	start := time.Now()
+	_, err := Exec{}.Run(ctx, Command("sh", "-c", "sleep 30 | cat; echo unreachable"))
+	if err == nil {
+		t.Fatal("expected an error after cancel")
+	}
+	if d := time.Since(start); d >= killGrace {
+		t.Errorf("cancel took %s; the process group was not killed", d)
+	}
+}
+
+func TestExecStreamsOutputLines(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	ctx := WithOutput(context.Background(), func(line string) {
+		mu.Lock()
+		lines = append(lines, line)
+		mu.Unlock()
+	})
+	res, err := Exec{}.Run(ctx, Command("sh", "-c", `echo one; printf '10%%\r50%%\r100%%\n'; printf last`))
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	want := []string{`$ sh -c 'echo one; printf '\''10%%\r50%%\r100%%\n'\''; printf last'`, "one", "100%", "last"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+	if res.Output != "one\n10%\r50%\r100%\nlast" {
+		t.Errorf("captured output should be unchanged: %q", res.Output)
+	}
+}
+
+func TestObserverSeesEveryCommand(t *testing.T) {
+	var mu sync.Mutex
+	var seen []Result
+	ctx := WithObserver(context.Background(), func(res Result, err error) {
+		mu.Lock()
+		seen = append(seen, res)
+		mu.Unlock()
+	})
+	Exec{}.Run(ctx, Command("sh", "-c", "exit 4"))
+	Exec{}.Run(ctx, Command("freshbox-no-such-binary"))
+	NewFake().Run(ctx, Command("brew", "install", "go"))
+
+	if len(seen) != 3 {
+		t.Fatalf("observed %d commands, want 3", len(seen))
+	}
+	if seen[0].ExitCode != 4 || seen[1].ExitCode != -1 || seen[2].Cmdline != "brew install go" {
+		t.Errorf("observed = %+v", seen)
+	}
+	if seen[0].Start.IsZero() || seen[2].Start.IsZero() {
+		t.Error("start time should be recorded")
+	}
+}
+
+// --- Fake ---
+
+func TestFakeStreamsOutputLines(t *testing.T) {
+	f := NewFake().On("brew install zed", Response{Stdout: "==> Downloading\n==> Installing\n", Stderr: "warning"})
+	var lines []string
+	ctx := WithOutput(context.Background(), func(line string) { lines = append(lines, line) })
+	f.Run(ctx, Command("brew", "install", "zed"))
+	want := []string{"$ brew install zed", "==> Downloading", "==> Installing", "warning"}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %q, want %q", lines, want)
+	}
+}
+
+func TestFakeCancelled(t *testing.T) {
+	f := NewFake()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Run(ctx, Command("brew", "install", "go")); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if len(f.Calls()) != 0 {
+		t.Error("a cancelled call should not be recorded")
+	}
+}
+
+func TestFakeMatchesWholeWordPrefix(t *testing.T) {
+	f := NewFake().
+		On("brew install", Response{Stdout: "ok"}).
+		On("brew install git", Response{Stderr: "no network", ExitCode: 1})
+
+	if res, err := f.Run(ctx, Command("brew", "install", "go")); err != nil || res.Output != "ok" {
+		t.Errorf("brew install go: %+v %v", res, err)
+	}
+	res, err := f.Run(ctx, Command("brew", "install", "git"))
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 1 || res.Output != "no network" {
+		t.Errorf("brew install git: %+v %v", res, err)
+	}
+	if res, _ := f.Run(ctx, Command("brew", "install", "gitleaks")); res.Output != "ok" {
+		t.Error("prefix should only match whole words")
+	}
+	if _, err := f.Run(ctx, Command("npm", "ls")); err != nil {
+		t.Errorf("unmatched commands should succeed, got %v", err)
+	}
+
+	want := []string{"brew install go", "brew install git", "brew install gitleaks", "npm ls"}
+	if got := f.Cmdlines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Cmdlines = %v", got)
+	}
+}
+
+func TestFakeLookPath(t *testing.T) {
+	f := NewFake().Path("brew", "/opt/homebrew/bin/brew")
+	if p, err := f.LookPath("brew"); err != nil || p != "/opt/homebrew/bin/brew" {
+		t.Errorf("LookPath(brew) = %q, %v", p, err)
+	}
+	if _, err := f.LookPath("fnm"); err == nil {
+		t.Error("unknown binary should not be found")
+	}
+}
+
+func TestRecorderReplay(t *testing.T) {
+	rec := NewRecorder(Exec{})
+	rec.Run(ctx, Command("sh", "-c", "echo recorded; exit 2"))
+	calls := rec.Calls()
+	if len(calls) != 1 || calls[0].ExitCode != 2 {
+		t.Fatalf("recorded calls = %+v", calls)
+	}
+
+	f := NewFake().Replay(calls)
+	res, err := f.Run(ctx, Command("sh", "-c", "echo recorded; exit 2"))
+	if err == nil || res.Stdout != "recorded\n" || res.ExitCode != 2 {
+		t.Errorf("replay = %+v %v", res, err)
+	}
+}
+
+func TestUseRestores(t *testing.T) {
+	f := NewFake().On("git --version", Response{Stdout: "git version 9.9"})
+	restore := Use(f)
+	out, err := Output(ctx, "git", "--version")
+	restore()
+
+	if err != nil || string(out) != "git version 9.9" {
+		t.Errorf("Output via fake = %q, %v", out, err)
+	}
+	if _, ok := Default().(Exec); !ok {
+		t.Errorf("restore should put Exec back, got %T", Default())
+	}
+}
+
+// --- ShellJoin ---
+
+func TestShellJoin(t *testing.T) {
+	got := ShellJoin([]string{"echo", "it's", "a b", "plain", ""})
+	if got != `echo 'it'\''s' 'a b' plain ''` {
+		t.Errorf("ShellJoin = %s", got)
+	}
+}
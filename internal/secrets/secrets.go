@@ -0,0 +1,182 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/kittors/freshbox/internal/redact"
+	"github.com/kittors/freshbox/internal/runner"
+)
+
+// Names of the secrets freshbox stores
+const (
+	CodexAPIKey  = "codex-api-key"
+	ClaudeAPIKey = "claude-api-key"
+)
+
+// Service is the Keychain service every freshbox secret is filed under
+const Service = "freshbox"
+
+// ErrNotFound is returned by Get for a secret that was never stored
+var ErrNotFound = errors.New("secret not found")
+
+// Store keeps secrets out of config files. Tools read them back through
+// HelperCommand, a shell command that prints the secret.
+type Store interface {
+	Get(ctx context.Context, name string) (string, error)
+	Set(ctx context.Context, name, value string) error
+	Delete(ctx context.Context, name string) error
+	// HelperCommand prints the secret on stdout, e.g. for Claude's apiKeyHelper
+	HelperCommand(name string) string
+	// Where describes where name is kept, for plans and messages
+	Where(name string) string
+}
+
+// Default returns the Keychain on macOS and a file store everywhere else
+func Default() Store {
+	if runtime.GOOS == "darwin" {
+		if _, err := runner.LookPath("security"); err == nil {
+			return Keychain{Service: Service}
+		}
+	}
+	return NewFileStore()
+}
+
+// --- Keychain ---
+
+// keychainNotFound is the exit code of security(1) for a missing item
+const keychainNotFound = 44
+
+// Keychain keeps secrets as generic passwords in the login Keychain via the
+// security CLI
+type Keychain struct {
+	Service string
+}
+
+// Get implements Store. The secret is never streamed to the install log.
+func (k Keychain) Get(ctx context.Context, name string) (string, error) {
+	ctx = runner.WithOutput(ctx, nil)
+	res, err := runner.Run(ctx, "security", "find-generic-password", "-s", k.Service, "-a", name, "-w")
+	if res.ExitCode == keychainNotFound {
+		return "", fmt.Errorf("%s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("read %s from Keychain: %w", name, err)
+	}
+	value := strings.TrimSuffix(res.Stdout, "\n")
+	redact.Add(value)
+	return value, nil
+}
+
+// Set implements Store. The secret goes to security's stdin, so it never
+// appears in a command line.
+func (k Keychain) Set(ctx context.Context, name, value string) error {
+	redact.Add(value)
+	c := runner.Command("security", "-i")
+	c.Stdin = fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", quote(k.Service), quote(name), quote(value))
+	res, err := runner.RunCmd(ctx, c)
+	if err != nil {
+		return fmt.Errorf("store %s in Keychain: %w: %s", name, err, strings.TrimSpace(res.Output))
+	}
+	return nil
+}
+
+// Delete implements Store; deleting a missing secret is not an error
+func (k Keychain) Delete(ctx context.Context, name string) error {
+	res, err := runner.Run(ctx, "security", "delete-generic-password", "-s", k.Service, "-a", name)
+	if err != nil && res.ExitCode != keychainNotFound {
+		return fmt.Errorf("delete %s from Keychain: %w", name, err)
+	}
+	return nil
+}
+
+// HelperCommand implements Store
+func (k Keychain) HelperCommand(name string) string {
+	return runner.ShellJoin([]string{"/usr/bin/security", "find-generic-password", "-s", k.Service, "-a", name, "-w"})
+}
+
+// Where implements Store
+func (k Keychain) Where(name string) string {
+	return fmt.Sprintf("Keychain: %s/%s", k.Service, name)
+}
+
+// quote double-quotes s for security -i, which splits its input like a shell
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// --- File ---
+
+// FileStore keeps each secret in its own 0600 file under a 0700 directory,
+// for platforms without a Keychain and for tests
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore returns a store in ~/.freshbox/secrets
+func NewFileStore() FileStore {
+	home, _ := os.UserHomeDir()
+	return FileStore{Dir: filepath.Join(home, ".freshbox", "secrets")}
+}
+
+func (f FileStore) path(name string) string {
+	return filepath.Join(f.Dir, name)
+}
+
+// Get implements Store
+func (f FileStore) Get(_ context.Context, name string) (string, error) {
+	data, err := os.ReadFile(f.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("read secret %s: %w", name, err)
+	}
+	value := strings.TrimSuffix(string(data), "\n")
+	redact.Add(value)
+	return value, nil
+}
+
+// Set implements Store
+func (f FileStore) Set(_ context.Context, name, value string) error {
+	redact.Add(value)
+	if err := os.MkdirAll(f.Dir, 0700); err != nil {
+		return fmt.Errorf("create secrets dir: %w", err)
+	}
+	// tighten a directory created by something else
+	if err := os.Chmod(f.Dir, 0700); err != nil {
+		return fmt.Errorf("secure secrets dir: %w", err)
+	}
+	if err := os.WriteFile(f.path(name), []byte(value+"\n"), 0600); err != nil {
+		return fmt.Errorf("write secret %s: %w", name, err)
+	}
+	return os.Chmod(f.path(name), 0600)
+}
+
+// Delete implements Store; deleting a missing secret is not an error
+func (f FileStore) Delete(_ context.Context, name string) error {
+	if err := os.Remove(f.path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// HelperCommand implements Store
+func (f FileStore) HelperCommand(name string) string {
+	return runner.ShellJoin([]string{"cat", f.path(name)})
+}
+
+// Where implements Store
+func (f FileStore) Where(name string) string {
+	home, _ := os.UserHomeDir()
+	path := f.path(name)
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return "~/" + rel
+	}
+	return path
+}
@@ -0,0 +1,131 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/kittors/freshbox/internal/runner"
+)
+
+var ctx = context.Background()
+
+// --- FileStore ---
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store := NewFileStore()
+
+	if _, err := store.Get(ctx, ClaudeAPIKey); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get before Set = %v, want ErrNotFound", err)
+	}
+	if err := store.Set(ctx, ClaudeAPIKey, "sk-ant-file"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(ctx, ClaudeAPIKey)
+	if err != nil || got != "sk-ant-file" {
+		t.Errorf("Get = %q, %v", got, err)
+	}
+
+	dir, _ := os.Stat(store.Dir)
+	file, _ := os.Stat(filepath.Join(store.Dir, ClaudeAPIKey))
+	if dir.Mode().Perm() != 0700 || file.Mode().Perm() != 0600 {
+		t.Errorf("modes = %v / %v, want 0700 / 0600", dir.Mode().Perm(), file.Mode().Perm())
+	}
+	if w := store.Where(ClaudeAPIKey); w != "~/.freshbox/secrets/claude-api-key" {
+		t.Errorf("Where = %q", w)
+	}
+
+	if err := store.Delete(ctx, ClaudeAPIKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, ClaudeAPIKey); err != nil {
+		t.Errorf("deleting a missing secret = %v", err)
+	}
+}
+
+func TestFileStoreHelperCommand(t *testing.T) {
+	store := FileStore{Dir: filepath.Join(t.TempDir(), "dir with space")}
+	store.Set(ctx, CodexAPIKey, "sk-helper")
+
+	res, err := runner.Exec{}.Run(ctx, runner.Command("sh", "-c", store.HelperCommand(CodexAPIKey)))
+	if err != nil || strings.TrimSpace(res.Stdout) != "sk-helper" {
+		t.Errorf("helper printed %q, %v", res.Stdout, err)
+	}
+}
+
+func TestDefaultOffMacOSIsFileStore(t *testing.T) {
+	if runtime.GOOS == "darwin" {
+		t.Skip("uses the Keychain on macOS")
+	}
+	if _, ok := Default().(FileStore); !ok {
+		t.Errorf("Default() = %T, want FileStore", Default())
+	}
+}
+
+// --- Keychain ---
+
+func TestKeychainSetUsesStdin(t *testing.T) {
+	f := runner.NewFake()
+	defer runner.Use(f)()
+
+	if err := (Keychain{Service: Service}).Set(ctx, ClaudeAPIKey, `sk-"quoted"\key`); err != nil {
+		t.Fatal(err)
+	}
+	calls := f.Calls()
+	if len(calls) != 1 || calls[0].Cmdline != "security -i" {
+		t.Fatalf("calls = %v", f.Cmdlines())
+	}
+	want := `add-generic-password -U -s "freshbox" -a "claude-api-key" -w "sk-\"quoted\"\\key"` + "\n"
+	if calls[0].Stdin != want {
+		t.Errorf("stdin = %q, want %q", calls[0].Stdin, want)
+	}
+}
+
+func TestKeychainGet(t *testing.T) {
+	f := runner.NewFake().
+		On("security find-generic-password -s freshbox -a claude-api-key", runner.Response{Stdout: "sk-ant-keychain\n"}).
+		On("security find-generic-password -s freshbox -a codex-api-key", runner.Response{ExitCode: keychainNotFound})
+	defer runner.Use(f)()
+	k := Keychain{Service: Service}
+
+	var streamed []string
+	ctx := runner.WithOutput(ctx, func(line string) { streamed = append(streamed, line) })
+	got, err := k.Get(ctx, ClaudeAPIKey)
+	if err != nil || got != "sk-ant-keychain" {
+		t.Errorf("Get = %q, %v", got, err)
+	}
+	if len(streamed) > 0 {
+		t.Errorf("the secret should not stream to the output: %v", streamed)
+	}
+	if _, err := k.Get(ctx, CodexAPIKey); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing item = %v, want ErrNotFound", err)
+	}
+}
+
+func TestKeychainDelete(t *testing.T) {
+	f := runner.NewFake().On("security delete-generic-password", runner.Response{ExitCode: keychainNotFound})
+	defer runner.Use(f)()
+	if err := (Keychain{Service: Service}).Delete(ctx, ClaudeAPIKey); err != nil {
+		t.Errorf("deleting a missing item = %v", err)
+	}
+
+	f.On("security delete-generic-password", runner.Response{ExitCode: 1})
+	if err := (Keychain{Service: Service}).Delete(ctx, ClaudeAPIKey); err == nil {
+		t.Error("other failures should be reported")
+	}
+}
+
+func TestKeychainHelperCommand(t *testing.T) {
+	k := Keychain{Service: Service}
+	if got := k.HelperCommand(ClaudeAPIKey); got != "/usr/bin/security find-generic-password -s freshbox -a claude-api-key -w" {
+		t.Errorf("HelperCommand = %q", got)
+	}
+	if got := k.Where(ClaudeAPIKey); got != "Keychain: freshbox/claude-api-key" {
+		t.Errorf("Where = %q", got)
+	}
+}
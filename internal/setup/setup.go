@@ -1,18 +1,22 @@
 package setup
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/kittors/freshbox/internal/backup"
+	"github.com/kittors/freshbox/internal/ledger"
+	"github.com/kittors/freshbox/internal/runner"
 )
 
 // --- Zed Catppuccin Blur Theme ---
 
 // SetupZedTheme clones catppuccin-blur, applies blue tint, configures Zed settings
-func SetupZedTheme() error {
+func SetupZedTheme(ctx context.Context) error {
 	home, _ := os.UserHomeDir()
 	themeDir := filepath.Join(home, ".config", "zed", "themes")
 	themeFile := filepath.Join(themeDir, "catppuccin-blur.json")
@@ -27,9 +31,8 @@ func SetupZedTheme() error {
 	}
 	defer os.RemoveAll(tmpDir)
 
-	cmd := exec.Command("git", "clone", "--depth", "1", "--quiet",
-		"https://github.com/jenslys/zed-catppuccin-blur.git", filepath.Join(tmpDir, "repo"))
-	if out, err := cmd.CombinedOutput(); err != nil {
+	if out, err := runner.Output(ctx, "git", "clone", "--depth", "1", "--quiet",
+		"https://github.com/jenslys/zed-catppuccin-blur.git", filepath.Join(tmpDir, "repo")); err != nil {
 		return fmt.Errorf("clone theme: %s %w", string(out), err)
 	}
 
@@ -39,7 +42,7 @@ func SetupZedTheme() error {
 	if err != nil {
 		return fmt.Errorf("read theme: %w", err)
 	}
-	if err := os.WriteFile(themeFile, data, 0644); err != nil {
+	if err := backup.WriteFile(ctx, themeFile, data, 0644); err != nil {
 		return fmt.Errorf("write theme: %w", err)
 	}
 
@@ -107,10 +110,10 @@ for theme in data["themes"]:
 with open(theme_file, "w") as f:
     json.dump(data, f, indent=2, ensure_ascii=False)
 `
-	pyCmd := exec.Command("python3", "-c", pyScript)
-	pyCmd.Env = append(os.Environ(), "THEME_FILE="+themeFile)
-	if out, err := pyCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("apply tint: %s %w", string(out), err)
+	pyCmd := runner.Command("python3", "-c", pyScript)
+	pyCmd.Env = []string{"THEME_FILE=" + themeFile}
+	if res, err := runner.RunCmd(ctx, pyCmd); err != nil {
+		return fmt.Errorf("apply tint: %s %w", res.Output, err)
 	}
 
 	// Configure Zed settings
@@ -124,10 +127,10 @@ with open(theme_file, "w") as f:
 		os.MkdirAll(filepath.Dir(settingsFile), 0755)
 		settings := map[string]any{"theme": themeConfig}
 		d, _ := json.MarshalIndent(settings, "", "  ")
-		return os.WriteFile(settingsFile, append(d, '\n'), 0644)
+		return backup.WriteFile(ctx, settingsFile, append(d, '\n'), 0644)
 	}
 
-	// Update existing settings
+	// Update existing settings; the result is written back atomically
 	pyUpdate := `
 import json, re, os
 
@@ -145,24 +148,38 @@ data["theme"] = {
     "dark": "Catppuccin Mocha (Blur) [Light]"
 }
 
-with open(settings_path, "w") as f:
-    json.dump(data, f, indent=2, ensure_ascii=False)
-    f.write("\n")
+print(json.dumps(data, indent=2, ensure_ascii=False))
 `
-	pyCmd2 := exec.Command("python3", "-c", pyUpdate)
-	pyCmd2.Env = append(os.Environ(), "SETTINGS_FILE="+settingsFile)
-	if out, err := pyCmd2.CombinedOutput(); err != nil {
-		return fmt.Errorf("update settings: %s %w", string(out), err)
+	pyCmd2 := runner.Command("python3", "-c", pyUpdate)
+	pyCmd2.Env = []string{"SETTINGS_FILE=" + settingsFile}
+	res, err := runner.RunCmd(runner.WithOutput(ctx, nil), pyCmd2)
+	if err != nil {
+		return fmt.Errorf("update settings: %s %w", res.Output, err)
 	}
-
-	return nil
+	return backup.WriteFile(ctx, settingsFile, []byte(res.Stdout), 0644)
 }
 
 // --- Kaku Terminal ---
 
+// ZshPlugin is a zsh plugin cloned into Kaku's plugin dir
+type ZshPlugin struct {
+	Name string
+	Repo string
+}
+
+// KakuPlugins lists the zsh plugins SetupKaku installs
+func KakuPlugins() []ZshPlugin {
+	return []ZshPlugin{
+		{"zsh-autosuggestions", "https://github.com/zsh-users/zsh-autosuggestions.git"},
+		{"zsh-completions", "https://github.com/zsh-users/zsh-completions.git"},
+		{"zsh-syntax-highlighting", "https://github.com/zsh-users/zsh-syntax-highlighting.git"},
+		{"zsh-z", "https://github.com/agkozak/zsh-z.git"},
+	}
+}
+
 // SetupKaku initializes Kaku config and installs zsh plugins
 // Note: Kaku app installation is handled separately via brew (tw93/tap/kakuku)
-func SetupKaku() error {
+func SetupKaku(ctx context.Context) error {
 	home, _ := os.UserHomeDir()
 	kakuDir := filepath.Join(home, ".config", "kaku")
 	pluginDir := filepath.Join(kakuDir, "zsh", "plugins")
@@ -221,26 +238,18 @@ end
 
 return config
 `
-	if err := os.WriteFile(filepath.Join(kakuDir, "kaku.lua"), []byte(kakuLua), 0644); err != nil {
+	if err := backup.WriteFile(ctx, filepath.Join(kakuDir, "kaku.lua"), []byte(kakuLua), 0644); err != nil {
 		return fmt.Errorf("write kaku.lua: %w", err)
 	}
 
 	// Install zsh plugins
-	plugins := map[string]string{
-		"zsh-autosuggestions":     "https://github.com/zsh-users/zsh-autosuggestions.git",
-		"zsh-completions":         "https://github.com/zsh-users/zsh-completions.git",
-		"zsh-syntax-highlighting": "https://github.com/zsh-users/zsh-syntax-highlighting.git",
-		"zsh-z":                   "https://github.com/agkozak/zsh-z.git",
-	}
-
-	for name, repo := range plugins {
-		dest := filepath.Join(pluginDir, name)
+	for _, p := range KakuPlugins() {
+		dest := filepath.Join(pluginDir, p.Name)
 		if _, err := os.Stat(dest); err == nil {
 			continue // already exists
 		}
-		cmd := exec.Command("git", "clone", "--depth", "1", "--quiet", repo, dest)
-		if out, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("clone %s: %s %w", name, string(out), err)
+		if out, err := runner.Output(ctx, "git", "clone", "--depth", "1", "--quiet", p.Repo, dest); err != nil {
+			return fmt.Errorf("clone %s: %s %w", p.Name, string(out), err)
 		}
 	}
 
@@ -250,13 +259,16 @@ return config
 // --- Karabiner Elements ---
 
 // SetupKarabiner installs Karabiner-Elements and configures Ctrl+Opt+Cmd+T to open Kaku
-func SetupKarabiner() error {
+func SetupKarabiner(ctx context.Context) error {
 	// Install via brew cask
-	cmd := exec.Command("brew", "install", "--cask", "karabiner-elements")
-	if out, err := cmd.CombinedOutput(); err != nil {
-		if !strings.Contains(string(out), "already installed") {
-			return fmt.Errorf("install karabiner: %s %w", string(out), err)
-		}
+	var added []ledger.Entry
+	out, err := runner.Output(ctx, "brew", "install", "--cask", "karabiner-elements")
+	switch {
+	case strings.Contains(string(out), "already installed"):
+	case err != nil:
+		return fmt.Errorf("install karabiner: %s %w", string(out), err)
+	default:
+		added = append(added, ledger.Entry{Kind: ledger.KindCask, Name: "karabiner-elements", Label: "Karabiner-Elements"})
 	}
 
 	home, _ := os.UserHomeDir()
@@ -301,7 +313,10 @@ else
 fi
 `
 	scriptPath := filepath.Join(binDir, "open-kaku.sh")
-	if err := os.WriteFile(scriptPath, []byte(openKakuScript), 0755); err != nil {
+	if _, err := os.Stat(scriptPath); os.IsNotExist(err) {
+		added = append(added, ledger.Entry{Kind: ledger.KindFile, Name: scriptPath})
+	}
+	if err := backup.WriteFile(ctx, scriptPath, []byte(openKakuScript), 0755); err != nil {
 		return fmt.Errorf("write open-kaku.sh: %w", err)
 	}
 
@@ -352,13 +367,32 @@ fi
 	}
 
 	data, _ := json.MarshalIndent(karabinerConfig, "", "    ")
-	return os.WriteFile(filepath.Join(karabinerDir, "karabiner.json"), append(data, '\n'), 0644)
+	if err := backup.WriteFile(ctx, filepath.Join(karabinerDir, "karabiner.json"), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	return ledger.Add(ctx, added...)
 }
 
 // --- macOS Dev Workspace ---
 
+// FinderDefaults returns the `defaults write` commands that configure Finder,
+// opening new windows in devDir
+func FinderDefaults(devDir string) [][]string {
+	return [][]string{
+		{"defaults", "write", "com.apple.finder", "AppleShowAllFiles", "-bool", "true"},
+		{"defaults", "write", "NSGlobalDomain", "AppleShowAllExtensions", "-bool", "true"},
+		{"defaults", "write", "com.apple.finder", "ShowPathbar", "-bool", "true"},
+		{"defaults", "write", "com.apple.finder", "ShowStatusBar", "-bool", "true"},
+		{"defaults", "write", "com.apple.finder", "FXPreferredViewStyle", "-string", "Nlsv"},
+		{"defaults", "write", "com.apple.finder", "FXDefaultSearchScope", "-string", "SCcf"},
+		{"defaults", "write", "com.apple.finder", "FXEnableExtensionChangeWarning", "-bool", "false"},
+		{"defaults", "write", "com.apple.finder", "NewWindowTarget", "-string", "PfLo"},
+		{"defaults", "write", "com.apple.finder", "NewWindowTargetPath", "-string", "file://" + devDir + "/"},
+	}
+}
+
 // SetupDevWorkspace creates the developer directory structure and configures Finder
-func SetupDevWorkspace() error {
+func SetupDevWorkspace(ctx context.Context) error {
 	home, _ := os.UserHomeDir()
 	devDir := filepath.Join(home, "Developer")
 
@@ -406,7 +440,7 @@ func SetupDevWorkspace() error {
 4. 外包项目统一放 ` + "`freelance/客户名/项目名`" + `
 5. 临时实验代码放 ` + "`playground/`" + `，避免污染正式项目目录
 `
-	if err := os.WriteFile(filepath.Join(devDir, "README.md"), []byte(rootReadme), 0644); err != nil {
+	if err := backup.WriteFile(ctx, filepath.Join(devDir, "README.md"), []byte(rootReadme), 0644); err != nil {
 		return fmt.Errorf("write root README: %w", err)
 	}
 
@@ -424,31 +458,67 @@ func SetupDevWorkspace() error {
 	}
 
 	for subdir, content := range readmes {
-		if err := os.WriteFile(filepath.Join(devDir, subdir, "README.md"), []byte(content), 0644); err != nil {
+		if err := backup.WriteFile(ctx, filepath.Join(devDir, subdir, "README.md"), []byte(content), 0644); err != nil {
 			return fmt.Errorf("write %s README: %w", subdir, err)
 		}
 	}
 
-	// Configure Finder
-	finderCmds := [][]string{
-		{"defaults", "write", "com.apple.finder", "AppleShowAllFiles", "-bool", "true"},
-		{"defaults", "write", "NSGlobalDomain", "AppleShowAllExtensions", "-bool", "true"},
-		{"defaults", "write", "com.apple.finder", "ShowPathbar", "-bool", "true"},
-		{"defaults", "write", "com.apple.finder", "ShowStatusBar", "-bool", "true"},
-		{"defaults", "write", "com.apple.finder", "FXPreferredViewStyle", "-string", "Nlsv"},
-		{"defaults", "write", "com.apple.finder", "FXDefaultSearchScope", "-string", "SCcf"},
-		{"defaults", "write", "com.apple.finder", "FXEnableExtensionChangeWarning", "-bool", "false"},
-		{"defaults", "write", "com.apple.finder", "NewWindowTarget", "-string", "PfLo"},
-		{"defaults", "write", "com.apple.finder", "NewWindowTargetPath", "-string", "file://" + devDir + "/"},
-	}
-
-	for _, args := range finderCmds {
-		cmd := exec.Command(args[0], args[1:]...)
-		cmd.Run()
+	// Configure Finder, remembering each key's old value for uninstall
+	var changed []ledger.Entry
+	for _, args := range FinderDefaults(devDir) {
+		domain, key := args[2], args[3]
+		prev, ok := ReadDefault(ctx, domain, key)
+		if _, err := runner.Run(ctx, args[0], args[1:]...); err == nil && ok {
+			changed = append(changed, ledger.Entry{Kind: ledger.KindDefault, Domain: domain, Name: key, Previous: prev})
+		}
 	}
 
 	// Restart Finder
-	exec.Command("killall", "Finder").Run()
+	runner.Run(ctx, "killall", "Finder")
 
-	return nil
+	return ledger.Add(ctx, changed...)
+}
+
+// defaultsFlags maps `defaults read-type` types to `defaults write` flags
+var defaultsFlags = map[string]string{
+	"boolean": "-bool",
+	"string":  "-string",
+	"integer": "-int",
+	"float":   "-float",
+}
+
+// ReadDefault returns the value of a defaults key as `defaults write`
+// arguments, or nil if the key is unset. ok is false if the value can't be
+// written back, e.g. an array, or defaults isn't available.
+func ReadDefault(ctx context.Context, domain, key string) (value []string, ok bool) {
+	res, err := runner.Run(ctx, "defaults", "read-type", domain, key)
+	if err != nil {
+		return nil, strings.Contains(res.Output, "does not exist")
+	}
+	flag := defaultsFlags[strings.TrimPrefix(strings.TrimSpace(res.Stdout), "Type is ")]
+	if flag == "" {
+		return nil, false
+	}
+	res, err = runner.Run(ctx, "defaults", "read", domain, key)
+	if err != nil {
+		return nil, false
+	}
+	v := strings.TrimSpace(res.Stdout)
+	if b, isBool := map[string]string{"1": "true", "0": "false"}[v]; isBool && flag == "-bool" {
+		v = b
+	}
+	return []string{flag, v}, true
+}
+
+// RestoreDefault writes back a value ReadDefault returned; nil deletes the key
+func RestoreDefault(ctx context.Context, domain, key string, value []string) error {
+	args := []string{"defaults", "delete", domain, key}
+	if len(value) > 0 {
+		args = append([]string{"defaults", "write", domain, key}, value...)
+	}
+	out, err := runner.Output(ctx, args[0], args[1:]...)
+	if err != nil && len(value) > 0 {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil // deleting a key that is already gone is fine
 }
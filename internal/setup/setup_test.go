@@ -1,11 +1,15 @@
 package setup
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/kittors/freshbox/internal/backup"
+	"github.com/kittors/freshbox/internal/runner"
 )
 
 func TestSetupKaku_WritesConfig(t *testing.T) {
@@ -25,7 +29,7 @@ func TestSetupKaku_WritesConfig(t *testing.T) {
 		os.MkdirAll(filepath.Join(pluginDir, p), 0755)
 	}
 
-	err := SetupKaku()
+	err := SetupKaku(context.Background())
 	if err != nil {
 		t.Fatalf("SetupKaku failed: %v", err)
 	}
@@ -53,7 +57,7 @@ func TestSetupDevWorkspace_CreatesStructure(t *testing.T) {
 	tmp := t.TempDir()
 	t.Setenv("HOME", tmp)
 
-	err := SetupDevWorkspace()
+	err := SetupDevWorkspace(context.Background())
 	if err != nil {
 		t.Fatalf("SetupDevWorkspace failed: %v", err)
 	}
@@ -154,3 +158,32 @@ func TestSetupKarabiner_WritesConfig(t *testing.T) {
 		t.Error("karabiner config missing expected rule description")
 	}
 }
+
+func TestSetupKarabiner_BacksUpExistingConfig(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", tmp)
+	defer runner.Use(runner.NewFake())()
+
+	path := filepath.Join(tmp, ".config", "karabiner", "karabiner.json")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	handTuned := "{\"profiles\": [{\"name\": \"hand-tuned\"}]}\n"
+	os.WriteFile(path, []byte(handTuned), 0644)
+
+	run := backup.Start("")
+	if err := SetupKarabiner(backup.WithRun(context.Background(), run)); err != nil {
+		t.Fatalf("SetupKarabiner: %v", err)
+	}
+	m, err := backup.Load(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backup.Restore(m); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != handTuned {
+		t.Errorf("karabiner.json after restore = %s", data)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, ".local", "bin", "open-kaku.sh")); !os.IsNotExist(err) {
+		t.Error("open-kaku.sh was created by the run and should be removed")
+	}
+}
@@ -0,0 +1,129 @@
+package tasks
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kittors/freshbox/internal/checker"
+)
+
+// Task IDs for steps that are not tied to a catalog item
+const (
+	idCodexConfig  = "config:codex"
+	idClaudeConfig = "config:claude"
+	idAIProfile    = "config:ai-profile"
+	idClaudeMCP    = "mcp:claude"
+	idCodexMCP     = "mcp:codex"
+	idJavaHome     = "java_home"
+)
+
+func devID(name string) string    { return "dev:" + name }
+func appID(name string) string    { return "app:" + name }
+func aiID(name string) string     { return "ai:" + name }
+func nodeID(ver string) string    { return "node:" + ver }
+func extraID(key string) string   { return "extra:" + key }
+func defaultID(key string) string { return "defaults:" + key }
+
+// itemID is the task ID of a catalog item, by its category
+func itemID(item *checker.Item) string {
+	switch item.Category {
+	case "app":
+		return appID(item.Name)
+	case "ai":
+		return aiID(item.Name)
+	}
+	return devID(item.Name)
+}
+
+// Order sorts the queue so every task runs after the tasks it needs. Needs
+// that aren't in the queue (already installed, not selected) are dropped.
+// Independent tasks keep their relative order.
+func Order(queue []Task) ([]Task, error) {
+	index := make(map[string]int, len(queue))
+	for i, task := range queue {
+		if task.ID != "" {
+			index[task.ID] = i
+		}
+	}
+
+	pending := slices.Clone(queue)
+	waiting := make([]int, len(pending))
+	dependents := make([][]int, len(pending))
+	for i := range pending {
+		var needs []string
+		for _, id := range pending[i].Needs {
+			j, ok := index[id]
+			if !ok || j == i || slices.Contains(needs, id) {
+				continue
+			}
+			needs = append(needs, id)
+			waiting[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+		pending[i].Needs = needs
+	}
+
+	ordered := make([]Task, 0, len(pending))
+	placed := make([]bool, len(pending))
+	for len(ordered) < len(pending) {
+		next := -1
+		for i := range pending {
+			if !placed[i] && waiting[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var stuck []string
+			for i, task := range pending {
+				if !placed[i] {
+					stuck = append(stuck, task.Name)
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between: %s", strings.Join(stuck, ", "))
+		}
+		placed[next] = true
+		ordered = append(ordered, pending[next])
+		for _, k := range dependents[next] {
+			waiting[k]--
+		}
+	}
+	return ordered, nil
+}
+
+// SkipError marks a task that was not run because a dependency failed
+type SkipError struct {
+	Dependency string // name of the failed dependency
+}
+
+func (e *SkipError) Error() string {
+	return fmt.Sprintf("skipped (dependency failed: %s)", e.Dependency)
+}
+
+// Outcomes remembers which tasks did not succeed so their dependents can be
+// skipped. The zero value is ready to use.
+type Outcomes struct {
+	bad map[string]string // ID → name
+}
+
+// Blocked returns a *SkipError if any of the task's needs failed or was skipped
+func (o *Outcomes) Blocked(task Task) error {
+	for _, id := range task.Needs {
+		if name, ok := o.bad[id]; ok {
+			return &SkipError{Dependency: name}
+		}
+	}
+	return nil
+}
+
+// Record stores the result of running (or skipping) a task
+func (o *Outcomes) Record(task Task, err error) {
+	if err == nil || task.ID == "" {
+		return
+	}
+	if o.bad == nil {
+		o.bad = make(map[string]string)
+	}
+	o.bad[task.ID] = task.Name
+}
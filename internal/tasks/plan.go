@@ -0,0 +1,74 @@
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kittors/freshbox/internal/version"
+)
+
+// PlanStep describes one queued task without running it
+type PlanStep struct {
+	Index    int      `json:"index"`
+	Name     string   `json:"name"`
+	ID       string   `json:"id,omitempty"`
+	Needs    []string `json:"needs,omitempty"`
+	Commands []string `json:"commands,omitempty"`
+	Files    []string `json:"files,omitempty"`
+}
+
+// Plan is the reviewable form of an install queue
+type Plan struct {
+	Version string     `json:"freshbox_version"`
+	Steps   []PlanStep `json:"tasks"`
+}
+
+// NewPlan describes the queue in order
+func NewPlan(queue []Task) Plan {
+	p := Plan{Version: version.Version, Steps: []PlanStep{}}
+	for i, task := range queue {
+		p.Steps = append(p.Steps, PlanStep{
+			Index:    i + 1,
+			Name:     task.Name,
+			ID:       task.ID,
+			Needs:    task.Needs,
+			Commands: task.Commands,
+			Files:    task.Files,
+		})
+	}
+	return p
+}
+
+// WriteText prints the plan as a numbered list of commands and files
+func (p Plan) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "freshbox %s plan — %d tasks\n", p.Version, len(p.Steps))
+	names := make(map[string]string, len(p.Steps))
+	for _, step := range p.Steps {
+		names[step.ID] = step.Name
+	}
+	for _, step := range p.Steps {
+		fmt.Fprintf(w, "\n%2d. %s\n", step.Index, step.Name)
+		if len(step.Needs) > 0 {
+			var after []string
+			for _, id := range step.Needs {
+				after = append(after, names[id])
+			}
+			fmt.Fprintf(w, "      ↳ after %s\n", strings.Join(after, ", "))
+		}
+		for _, c := range step.Commands {
+			fmt.Fprintf(w, "      $ %s\n", c)
+		}
+		for _, f := range step.Files {
+			fmt.Fprintf(w, "      ✎ %s\n", f)
+		}
+	}
+}
+
+// WriteJSON prints the plan as indented JSON
+func (p Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
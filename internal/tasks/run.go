@@ -0,0 +1,125 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kittors/freshbox/internal/redact"
+)
+
+// EventType identifies a progress event emitted by Run
+type EventType string
+
+const (
+	EventStart EventType = "start"
+	EventOK    EventType = "ok"
+	EventFail  EventType = "fail"
+	EventSkip  EventType = "skip"
+	EventDone  EventType = "done"
+)
+
+// Event is a single progress update from Run
+type Event struct {
+	Type    EventType `json:"event"`
+	Task    string    `json:"task,omitempty"`
+	ID      string    `json:"id,omitempty"`
+	Index   int       `json:"index"`
+	Total   int       `json:"total"`
+	Error   string    `json:"error,omitempty"`
+	Failed  int       `json:"failed,omitempty"`
+	Skipped int       `json:"skipped,omitempty"`
+}
+
+// Reporter receives progress events
+type Reporter func(Event)
+
+// Run executes the queue without a TUI, up to workers tasks at a time, and
+// returns the number of failed tasks. Tasks whose dependencies failed are
+// skipped, not run. Events are reported from the calling goroutine, with
+// secrets masked in their errors.
+// Cancelling ctx cancels the running tasks and skips the rest.
+func Run(ctx context.Context, queue []Task, workers int, report Reporter) int {
+	if report == nil {
+		report = func(Event) {}
+	}
+	type result struct {
+		index int
+		err   error
+	}
+	sched := NewScheduler(queue, workers)
+	results := make(chan result)
+	cancelled := ctx.Done()
+	failed, skipped := 0, 0
+	for !sched.Done() {
+		start, skips := sched.Next()
+		for i, task := range queue {
+			if err, ok := skips[i]; ok {
+				skipped++
+				report(Event{Type: EventSkip, Task: task.Name, ID: task.ID, Index: i + 1, Total: len(queue), Error: redact.String(err.Error())})
+			}
+		}
+		for _, i := range start {
+			report(Event{Type: EventStart, Task: queue[i].Name, ID: queue[i].ID, Index: i + 1, Total: len(queue)})
+			go func(i int) {
+				results <- result{i, queue[i].Exec(ctx)}
+			}(i)
+		}
+		if sched.Done() {
+			break
+		}
+
+		var r result
+		select {
+		case r = <-results:
+		case <-cancelled:
+			// running tasks see ctx too; collect them, start nothing new
+			cancelled = nil
+			sched.Stop()
+			continue
+		}
+		sched.Finish(r.index, r.err)
+		task := queue[r.index]
+		if r.err != nil {
+			failed++
+			report(Event{Type: EventFail, Task: task.Name, ID: task.ID, Index: r.index + 1, Total: len(queue),
+				Error: redact.String(strings.TrimSpace(r.err.Error()))})
+			continue
+		}
+		report(Event{Type: EventOK, Task: task.Name, ID: task.ID, Index: r.index + 1, Total: len(queue)})
+	}
+	report(Event{Type: EventDone, Total: len(queue), Failed: failed, Skipped: skipped})
+	return failed
+}
+
+// TextReporter writes one plain-text line per event
+func TextReporter(w io.Writer) Reporter {
+	return func(e Event) {
+		switch e.Type {
+		case EventStart:
+			fmt.Fprintf(w, "[%d/%d] [ .. ] %s\n", e.Index, e.Total, e.Task)
+		case EventOK:
+			fmt.Fprintf(w, "[%d/%d] [ OK ] %s\n", e.Index, e.Total, e.Task)
+		case EventFail:
+			fmt.Fprintf(w, "[%d/%d] [FAIL] %s\n       %s\n", e.Index, e.Total, e.Task, e.Error)
+		case EventSkip:
+			fmt.Fprintf(w, "[%d/%d] [SKIP] %s\n       %s\n", e.Index, e.Total, e.Task, e.Error)
+		case EventDone:
+			if e.Skipped > 0 {
+				fmt.Fprintf(w, "=== %d tasks, %d failed, %d skipped ===\n", e.Total, e.Failed, e.Skipped)
+				return
+			}
+			fmt.Fprintf(w, "=== %d tasks, %d failed ===\n", e.Total, e.Failed)
+		}
+	}
+}
+
+// JSONReporter writes one JSON object per line per event
+func JSONReporter(w io.Writer) Reporter {
+	enc := json.NewEncoder(w)
+	return func(e Event) {
+		enc.Encode(e)
+	}
+}
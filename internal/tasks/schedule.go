@@ -0,0 +1,189 @@
+package tasks
+
+import "errors"
+
+// DefaultWorkers is how many tasks run at once unless configured otherwise
+const DefaultWorkers = 4
+
+// Locks shared by tasks that must not run at the same time
+const (
+	LockBrew           = "brew"           // brew holds a global lock
+	LockNpm            = "npm"            // concurrent npm -g installs clobber each other
+	LockLaunchServices = "launchservices" // defaults writes to the same plist
+)
+
+// ErrCancelled is the skip reason for tasks that never started because the
+// run was stopped
+var ErrCancelled = errors.New("cancelled before it started")
+
+type taskState int
+
+const (
+	statePending taskState = iota
+	stateRunning
+	stateDone
+)
+
+// Scheduler hands out tasks whose dependencies have succeeded, at most
+// workers at a time and never two holding the same lock. It is not safe for
+// concurrent use; one goroutine starts tasks and reports their results.
+type Scheduler struct {
+	queue    []Task
+	workers  int
+	state    []taskState
+	locks    map[string]bool
+	present  map[string]bool
+	outcomes Outcomes
+	running  int
+	left     int
+	stopped  bool
+}
+
+// NewScheduler prepares queue for execution; workers < 1 means one at a time
+func NewScheduler(queue []Task, workers int) *Scheduler {
+	s := &Scheduler{
+		queue:   queue,
+		workers: max(workers, 1),
+		state:   make([]taskState, len(queue)),
+		locks:   make(map[string]bool),
+		present: make(map[string]bool),
+		left:    len(queue),
+	}
+	for _, task := range queue {
+		if task.ID != "" {
+			s.present[task.ID] = true
+		}
+	}
+	return s
+}
+
+// Next marks tasks as running and returns their indexes in queue order.
+// Pending tasks whose dependencies failed are finished as skipped and
+// returned separately, each with its *SkipError.
+func (s *Scheduler) Next() (start []int, skipped map[int]error) {
+	if s.stopped {
+		for i := range s.queue {
+			if s.state[i] == statePending {
+				if skipped == nil {
+					skipped = make(map[int]error)
+				}
+				skipped[i] = ErrCancelled
+				s.finish(i, ErrCancelled)
+			}
+		}
+		return nil, skipped
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for i, task := range s.queue {
+			if s.state[i] != statePending || !s.settled(task) {
+				continue
+			}
+			if err := s.outcomes.Blocked(task); err != nil {
+				if skipped == nil {
+					skipped = make(map[int]error)
+				}
+				skipped[i] = err
+				s.finish(i, err)
+				changed = true // dependents of this task may now be skipped too
+				continue
+			}
+			if s.running >= s.workers || (task.Lock != "" && s.locks[task.Lock]) {
+				continue
+			}
+			s.state[i] = stateRunning
+			s.running++
+			if task.Lock != "" {
+				s.locks[task.Lock] = true
+			}
+			start = append(start, i)
+		}
+	}
+
+	// a cycle would leave tasks waiting forever; skip them instead
+	if len(start) == 0 && s.running == 0 && s.left > 0 {
+		for i, task := range s.queue {
+			if s.state[i] == statePending {
+				if skipped == nil {
+					skipped = make(map[int]error)
+				}
+				err := &SkipError{Dependency: "dependency cycle"}
+				skipped[i] = err
+				s.outcomes.Record(task, err)
+				s.state[i] = stateDone
+				s.left--
+			}
+		}
+	}
+	return start, skipped
+}
+
+// Finish records the result of a task returned by Next
+func (s *Scheduler) Finish(i int, err error) {
+	if s.state[i] != stateRunning {
+		return
+	}
+	s.running--
+	if lock := s.queue[i].Lock; lock != "" {
+		delete(s.locks, lock)
+	}
+	s.finish(i, err)
+}
+
+func (s *Scheduler) finish(i int, err error) {
+	s.state[i] = stateDone
+	s.left--
+	s.outcomes.Record(s.queue[i], err)
+}
+
+// settled reports whether every dependency in the queue has finished
+func (s *Scheduler) settled(task Task) bool {
+	for _, id := range task.Needs {
+		if !s.present[id] {
+			continue
+		}
+		for j, other := range s.queue {
+			if other.ID == id && s.state[j] != stateDone {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Stop starts no more tasks: the next call to Next skips every pending task
+// with ErrCancelled. Running tasks are left to finish.
+func (s *Scheduler) Stop() {
+	s.stopped = true
+}
+
+// Stopped reports whether Stop was called
+func (s *Scheduler) Stopped() bool {
+	return s.stopped
+}
+
+// Done reports whether every task has finished or been skipped
+func (s *Scheduler) Done() bool {
+	return s.left == 0
+}
+
+// Running returns the indexes of tasks in flight, in queue order
+func (s *Scheduler) Running() []int {
+	return s.indexes(stateRunning)
+}
+
+// Pending returns the indexes of tasks not yet started, in queue order
+func (s *Scheduler) Pending() []int {
+	return s.indexes(statePending)
+}
+
+func (s *Scheduler) indexes(want taskState) []int {
+	var out []int
+	for i, st := range s.state {
+		if st == want {
+			out = append(out, i)
+		}
+	}
+	return out
+}
@@ -0,0 +1,289 @@
+package tasks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/kittors/freshbox/internal/backup"
+	"github.com/kittors/freshbox/internal/checker"
+	"github.com/kittors/freshbox/internal/redact"
+)
+
+// stateVersion is the run state format written by Save
+const stateVersion = 1
+
+// Task states recorded in the run state
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// TaskState is the recorded progress of one planned task
+type TaskState struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RunState is an install run persisted so it can be resumed. API keys and
+// MCP server variables are stripped before the selection is written.
+type RunState struct {
+	Version   int         `json:"version"`
+	StartedAt time.Time   `json:"started_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	Selection Selection   `json:"selection"`
+	Tasks     []TaskState `json:"tasks"`
+
+	// whether the run had API keys, which must be supplied again to resume
+	CodexKey  bool `json:"codex_key,omitempty"`
+	ClaudeKey bool `json:"claude_key,omitempty"`
+}
+
+// NewRunState records the planned queue with every task pending
+func NewRunState(sel Selection, queue []Task) *RunState {
+	now := time.Now()
+	s := &RunState{
+		Version:   stateVersion,
+		StartedAt: now,
+		UpdatedAt: now,
+		CodexKey:  sel.Codex.APIKey != "",
+		ClaudeKey: sel.Claude.APIKey != "",
+	}
+	sel.Codex.APIKey = ""
+	sel.Claude.APIKey = ""
+	sel.MCPEnv = nil
+	s.Selection = sel
+	for _, task := range queue {
+		s.Tasks = append(s.Tasks, TaskState{ID: task.ID, Name: task.Name, Status: StatusPending})
+	}
+	return s
+}
+
+// StatePath returns ~/.freshbox/state.json
+func StatePath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".freshbox", "state.json")
+}
+
+// LogPath returns ~/.freshbox/install.log
+func LogPath() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".freshbox", "install.log")
+}
+
+// AppendLog writes a line to the install log, with secrets masked
+func AppendLog(line string) {
+	line = redact.String(line)
+	path := LogPath()
+	os.MkdirAll(filepath.Dir(path), 0755)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.WriteString(time.Now().Format("2006-01-02 15:04:05") + "  " + line + "\n")
+}
+
+// LoadState reads the saved run; it returns nil, nil when there is none
+func LoadState() (*RunState, error) {
+	data, err := os.ReadFile(StatePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read run state: %w", err)
+	}
+	var s RunState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse run state: %w", err)
+	}
+	if s.Version != stateVersion {
+		return nil, fmt.Errorf("run state version %d is not supported", s.Version)
+	}
+	return &s, nil
+}
+
+// Save writes the state to StatePath. A nil state, as for uninstall runs,
+// saves nothing.
+func (s *RunState) Save() error {
+	if s == nil {
+		return nil
+	}
+	s.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal run state: %w", err)
+	}
+	path := StatePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	// written on every event, so a run cut off mid-write mustn't leave half
+	// a file and lose what it recorded
+	return backup.WriteAtomic(path, append(data, '\n'), 0600)
+}
+
+// ClearState removes the saved run
+func ClearState() error {
+	err := os.Remove(StatePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Mark updates a task's status; err is recorded for failures and skips
+func (s *RunState) Mark(id, status string, err error) {
+	if s == nil {
+		return
+	}
+	for i := range s.Tasks {
+		if s.Tasks[i].ID != id {
+			continue
+		}
+		s.Tasks[i].Status = status
+		s.Tasks[i].Error = ""
+		if err != nil {
+			s.Tasks[i].Error = redact.String(err.Error())
+		}
+	}
+}
+
+// Remaining counts tasks that have not succeeded
+func (s *RunState) Remaining() int {
+	n := 0
+	for _, t := range s.Tasks {
+		if t.Status != StatusOK {
+			n++
+		}
+	}
+	return n
+}
+
+// Track wraps report so every event is recorded in the state and saved.
+// A run that finishes with nothing left clears the state. A nil state
+// returns report unchanged.
+func (s *RunState) Track(report Reporter) Reporter {
+	if s == nil {
+		return report
+	}
+	return func(e Event) {
+		switch e.Type {
+		case EventStart:
+			s.Mark(e.ID, StatusRunning, nil)
+		case EventOK:
+			s.Mark(e.ID, StatusOK, nil)
+		case EventFail:
+			s.Mark(e.ID, StatusFailed, errors.New(e.Error))
+		case EventSkip:
+			s.Mark(e.ID, StatusSkipped, errors.New(e.Error))
+		}
+		var err error
+		if e.Type == EventDone && s.Remaining() == 0 {
+			err = ClearState()
+		} else {
+			err = s.Save()
+		}
+		if err != nil {
+			AppendLog("run state: " + err.Error())
+		}
+		if report != nil {
+			report(e)
+		}
+	}
+}
+
+// IncompleteMCPs returns the MCP servers the run still has to register that
+// are missing a variable, with env and the environment as the values. Resume
+// leaves them out.
+func (s *RunState) IncompleteMCPs(cat Catalog, env map[string]string, force bool) []string {
+	pending := slices.ContainsFunc(s.Tasks, func(t TaskState) bool {
+		return (t.ID == idClaudeMCP || t.ID == idCodexMCP) && (t.Status != StatusOK || force)
+	})
+	if !pending {
+		return nil
+	}
+	sel := s.Selection
+	sel.MCPEnv = env
+	servers, _ := sel.selectedMCPs(cat)
+	var names []string
+	for _, srv := range servers {
+		if len(srv.Env) < len(srv.Needs) {
+			names = append(names, srv.Name)
+		}
+	}
+	return names
+}
+
+// Resume rebuilds the saved queue against cat. Tasks that already succeeded
+// are left out unless force is set. keys supplies the API keys the state
+// doesn't store, and the MCP server variables; config tasks whose key is
+// missing are dropped, as are MCP servers with a variable missing, and
+// their names returned so the caller can tell the user. The other servers
+// are still registered.
+func (s *RunState) Resume(cat Catalog, keys Selection, force bool) (queue []Task, dropped []string, err error) {
+	want := make(map[string]string, len(s.Tasks))
+	for _, t := range s.Tasks {
+		want[t.ID] = t.Status
+	}
+
+	// planned installs must be rebuilt even if detection now says installed,
+	// while items still outdated stay upgrades; work on copies so the
+	// caller's catalog keeps its detected state
+	reset := func(items []*checker.Item, id func(string) string) []*checker.Item {
+		out := make([]*checker.Item, len(items))
+		for i, item := range items {
+			c := *item
+			if _, ok := want[id(c.Name)]; ok && c.Status != checker.Outdated {
+				c.Reinstall = true
+			}
+			out[i] = &c
+		}
+		return out
+	}
+	cat.DevTools = reset(cat.DevTools, devID)
+	cat.Apps = reset(cat.Apps, appID)
+	cat.AITools = reset(cat.AITools, aiID)
+	cat.Require(s.Selection.MinVersions)
+
+	sel := s.Selection
+	sel.Codex.APIKey = keys.Codex.APIKey
+	sel.Claude.APIKey = keys.Claude.APIKey
+	sel.MCPEnv = keys.MCPEnv
+	missingKey := func(id string) bool {
+		return (id == idCodexConfig && s.CodexKey && sel.Codex.APIKey == "") ||
+			(id == idClaudeConfig && s.ClaudeKey && sel.Claude.APIKey == "")
+	}
+	for _, t := range s.Tasks {
+		if missingKey(t.ID) && (t.Status != StatusOK || force) {
+			dropped = append(dropped, t.Name)
+		}
+	}
+	incomplete := s.IncompleteMCPs(cat, keys.MCPEnv, force)
+	for _, name := range incomplete {
+		dropped = append(dropped, "MCP server "+name)
+	}
+	sel.MCPs = slices.DeleteFunc(slices.Clone(sel.MCPs), func(name string) bool { return slices.Contains(incomplete, name) })
+
+	all, err := Build(sel, cat)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, task := range all {
+		status, planned := want[task.ID]
+		if !planned || (status == StatusOK && !force) || missingKey(task.ID) {
+			continue
+		}
+		queue = append(queue, task)
+	}
+	return queue, dropped, nil
+}
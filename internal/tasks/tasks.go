@@ -0,0 +1,732 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/kittors/freshbox/internal/catalog"
+	"github.com/kittors/freshbox/internal/checker"
+	"github.com/kittors/freshbox/internal/config"
+	"github.com/kittors/freshbox/internal/installer"
+	"github.com/kittors/freshbox/internal/ledger"
+	"github.com/kittors/freshbox/internal/providers"
+	"github.com/kittors/freshbox/internal/runner"
+	"github.com/kittors/freshbox/internal/secrets"
+	"github.com/kittors/freshbox/internal/setup"
+)
+
+// Extra setup keys, in display order
+const (
+	ExtraZedTheme     = "zed_theme"
+	ExtraKakuInit     = "kaku_init"
+	ExtraKarabiner    = "karabiner_kaku"
+	ExtraDevWorkspace = "dev_workspace"
+)
+
+// System default keys, in display order
+const (
+	DefaultBrowserChrome = "browser_chrome"
+	DefaultEditorZed     = "editor_zed"
+	DefaultPlayerIINA    = "player_iina"
+)
+
+// ExtraSetupKeys lists every extra setup option
+func ExtraSetupKeys() []string {
+	return []string{ExtraZedTheme, ExtraKakuInit, ExtraKarabiner, ExtraDevWorkspace}
+}
+
+// SysDefaultKeys lists every system default option
+func SysDefaultKeys() []string {
+	return []string{DefaultBrowserChrome, DefaultEditorZed, DefaultPlayerIINA}
+}
+
+// CodexSettings holds the Codex CLI values collected by the wizard
+type CodexSettings struct {
+	Model         string `json:"model,omitempty"`
+	ThinkingLevel string `json:"thinking_level,omitempty"`
+	BaseURL       string `json:"base_url,omitempty"`
+	APIKey        string `json:"api_key,omitempty"`
+	PlaintextKey  bool   `json:"plaintext_key,omitempty"` // write auth.json instead of using the secret store
+}
+
+// ClaudeSettings holds the Claude Code values collected by the wizard
+type ClaudeSettings struct {
+	Model        string `json:"model,omitempty"`
+	BaseURL      string `json:"base_url,omitempty"`
+	APIKey       string `json:"api_key,omitempty"`
+	PlaintextKey bool   `json:"plaintext_key,omitempty"` // put the key in settings.json instead of the secret store
+}
+
+// Selection captures every choice the wizard makes, independent of the TUI
+type Selection struct {
+	DevTools     []string          `json:"dev_tools,omitempty"`
+	Apps         []string          `json:"apps,omitempty"`
+	AITools      []string          `json:"ai_tools,omitempty"`
+	NodeVersions []string          `json:"node_versions,omitempty"`
+	MCPs         []string          `json:"mcps,omitempty"`
+	ExtraSetup   []string          `json:"extra_setup,omitempty"`
+	SysDefaults  []string          `json:"system_defaults,omitempty"`
+	MinVersions  map[string]string `json:"min_versions,omitempty"` // item name → lowest acceptable version
+	Codex        CodexSettings     `json:"codex,omitzero"`
+	Claude       ClaudeSettings    `json:"claude,omitzero"`
+	AIProfile    string            `json:"ai_profile,omitempty"` // saved provider profile to switch to
+	// MCPEnv holds values for the variables MCP servers need, by variable
+	// name; ones left out are read from freshbox's own environment
+	MCPEnv map[string]string `json:"mcp_env,omitempty"`
+}
+
+// Catalog is the detected set of items a selection refers to
+type Catalog struct {
+	DevTools []*checker.Item
+	Apps     []*checker.Item
+	AITools  []*checker.Item
+	MCPs     []config.MCPServer
+}
+
+// Items returns the dev tools, apps and AI tools in display order
+func (c Catalog) Items() []*checker.Item {
+	var all []*checker.Item
+	all = append(all, c.DevTools...)
+	all = append(all, c.Apps...)
+	return append(all, c.AITools...)
+}
+
+// Require applies minimum versions by item name on top of the catalog's own,
+// so installed items that are too old become upgrades. Unknown names are
+// ignored; Validate reports them.
+func (c Catalog) Require(mins map[string]string) {
+	for _, item := range c.Items() {
+		if min, ok := mins[item.Name]; ok {
+			checker.Require(item, min)
+		}
+	}
+}
+
+// LoadCatalog returns the catalog, with any local or team catalog files
+// layered on the built-in one, without checking what is installed; every
+// item starts out NotInstalled
+func LoadCatalog() (Catalog, error) {
+	c, err := catalog.Load()
+	if err != nil {
+		return Catalog{}, err
+	}
+	items, err := checker.FromCatalog(c.Tools)
+	if err != nil {
+		return Catalog{}, err
+	}
+	cat := Catalog{MCPs: config.FromCatalog(c.MCPs)}
+	for _, item := range items {
+		switch item.Category {
+		case "dev":
+			cat.DevTools = append(cat.DevTools, item)
+		case "app":
+			cat.Apps = append(cat.Apps, item)
+		case "ai":
+			cat.AITools = append(cat.AITools, item)
+		}
+	}
+	return cat, nil
+}
+
+// DetectCatalog loads the catalog and checks what is installed, several
+// items at a time. It doesn't look for newer versions; see
+// checker.CheckOutdated.
+func DetectCatalog() (Catalog, error) {
+	cat, err := LoadCatalog()
+	if err != nil {
+		return Catalog{}, err
+	}
+	checker.DetectAll(cat.Items(), nil)
+	return cat, nil
+}
+
+// Validate reports names in the selection that the catalog doesn't know about
+func (s Selection) Validate(cat Catalog) error {
+	var unknown []string
+	check := func(kind string, names []string, known func(string) bool) {
+		for _, n := range names {
+			if !known(n) {
+				unknown = append(unknown, fmt.Sprintf("%s %q", kind, n))
+			}
+		}
+	}
+	hasItem := func(items []*checker.Item) func(string) bool {
+		return func(name string) bool {
+			return slices.ContainsFunc(items, func(i *checker.Item) bool { return i.Name == name })
+		}
+	}
+	check("dev tool", s.DevTools, hasItem(cat.DevTools))
+	check("app", s.Apps, hasItem(cat.Apps))
+	check("AI tool", s.AITools, hasItem(cat.AITools))
+	check("MCP server", s.MCPs, func(name string) bool {
+		return slices.ContainsFunc(cat.MCPs, func(m config.MCPServer) bool { return m.Name == name })
+	})
+	check("extra setup", s.ExtraSetup, func(k string) bool { return slices.Contains(ExtraSetupKeys(), k) })
+	check("system default", s.SysDefaults, func(k string) bool { return slices.Contains(SysDefaultKeys(), k) })
+	check("minimum version for", slices.Sorted(maps.Keys(s.MinVersions)), hasItem(cat.Items()))
+	for name, min := range s.MinVersions {
+		if _, ok := checker.ParseSemver(min); !ok {
+			return fmt.Errorf("invalid minimum version %q for %s", min, name)
+		}
+	}
+	if missing := s.MissingMCPEnv(cat); len(missing) > 0 {
+		return fmt.Errorf("MCP servers need %s: set them in the environment or pass --mcp-env NAME=VALUE", strings.Join(missing, ", "))
+	}
+	if s.AIProfile != "" {
+		profiles, err := providers.Load()
+		if err != nil {
+			return err
+		}
+		if _, ok := profiles.Find(s.AIProfile); !ok {
+			unknown = append(unknown, fmt.Sprintf("AI provider profile %q", s.AIProfile))
+		}
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown selection: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// selectedMCPs returns the selected MCP servers with the variables they need
+// filled in, and the variables that have no value; see config.FillEnv
+func (s Selection) selectedMCPs(cat Catalog) (servers []config.MCPServer, missing []string) {
+	for _, mcp := range cat.MCPs {
+		if slices.Contains(s.MCPs, mcp.Name) {
+			servers = append(servers, mcp)
+		}
+	}
+	return servers, config.FillEnv(servers, s.MCPEnv)
+}
+
+// MissingMCPEnv lists the variables selected MCP servers need that have no
+// value, as "GitHub: GITHUB_PERSONAL_ACCESS_TOKEN"
+func (s Selection) MissingMCPEnv(cat Catalog) []string {
+	_, missing := s.selectedMCPs(cat)
+	return missing
+}
+
+// Task is one step of an install run. Commands and Files describe what the
+// task will do, for plans and dry runs; they are never executed directly.
+type Task struct {
+	ID       string // stable identifier other tasks refer to in Needs
+	Name     string
+	Fn       func(ctx context.Context) error
+	Needs    []string      // IDs of tasks that must succeed first
+	Lock     string        // tasks with the same lock never run at the same time
+	Timeout  time.Duration // Fn is cancelled after this long; zero means no limit
+	Commands []string      // command lines the task runs
+	Files    []string      // files or directories the task creates or modifies
+}
+
+// Default task timeouts, picked by Build
+const (
+	brewTimeout    = 30 * time.Minute // large casks on a slow link
+	installTimeout = 15 * time.Minute // curl | sh installers, npm -g, fnm, npx downloads
+	setupTimeout   = 5 * time.Minute  // config files, defaults, git clones
+)
+
+// Exec runs Fn under ctx, cancelling it once Timeout has passed
+func (t Task) Exec(ctx context.Context) error {
+	if t.Timeout <= 0 {
+		return t.Fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	err := t.Fn(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", t.Timeout, err)
+	}
+	return err
+}
+
+// SetTimeout gives every task in queue the timeout d instead of the one
+// Build picked; d <= 0 keeps the defaults
+func SetTimeout(queue []Task, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	for i := range queue {
+		queue[i].Timeout = d
+	}
+}
+
+const lsHandlersCmd = `defaults write com.apple.LaunchServices/com.apple.launchservices.secure LSHandlers -array-add '{"%s"="%s";"LSHandlerRoleAll"="%s";}'`
+
+// Build builds the list of things to install, ordered so that every task
+// comes after the tasks it needs. The needs come partly from the catalog, so
+// a loop among them is an error.
+func Build(sel Selection, cat Catalog) ([]Task, error) {
+	var queue []Task
+
+	// brew packages need whichever item installs brew
+	var homebrew []string
+	for _, item := range cat.Items() {
+		if item.Cmd == "brew" {
+			homebrew = []string{itemID(item)}
+		}
+	}
+	// npm comes from the first Node.js version fnm installs
+	var npm []string
+	if len(sel.NodeVersions) > 0 {
+		npm = []string{nodeID(sel.NodeVersions[0])}
+	}
+
+	// Dev tools, apps and AI tools
+	for _, group := range []struct {
+		items  []*checker.Item
+		picked []string
+	}{
+		{cat.DevTools, sel.DevTools},
+		{cat.Apps, sel.Apps},
+		{cat.AITools, sel.AITools},
+	} {
+		for _, item := range group.items {
+			if !slices.Contains(group.picked, item.Name) || !queued(item) {
+				continue
+			}
+			if task, ok := upgradeTask(itemID(item), item, homebrew, npm); ok {
+				queue = append(queue, task)
+				continue
+			}
+			if task, ok := installTask(item, cat, homebrew, npm); ok {
+				queue = append(queue, task)
+			}
+		}
+	}
+
+	// fnm Node versions
+	for _, v := range sel.NodeVersions {
+		ver := v
+		queue = append(queue, Task{
+			ID:       nodeID(ver),
+			Name:     "Node.js " + ver,
+			Fn:       func(ctx context.Context) error { return installer.FnmInstallNode(ctx, ver) },
+			Needs:    []string{devID("fnm")},
+			Timeout:  installTimeout,
+			Commands: []string{runner.ShellJoin([]string{"fnm", "install", ver})},
+		})
+	}
+
+	// Codex config; the key goes to the secret store unless plaintext was asked for
+	codex := sel.Codex
+	store := secrets.Default()
+	if codex.APIKey != "" || codex.BaseURL != "" {
+		name, files := "Codex config (config.toml + auth.json)", []string{"~/.codex/config.toml", "~/.codex/auth.json"}
+		if !codex.PlaintextKey {
+			name, files = "Codex config (config.toml)", []string{"~/.codex/config.toml"}
+			if codex.APIKey != "" {
+				name = "Codex config (config.toml + stored key)"
+				files = append(files, store.Where(secrets.CodexAPIKey), "~/.zshrc")
+			}
+		}
+		queue = append(queue, Task{
+			ID:   idCodexConfig,
+			Name: name,
+			Fn: func(ctx context.Context) error {
+				cfg := config.CodexConfig{
+					Model:         codex.Model,
+					ThinkingLevel: codex.ThinkingLevel,
+					BaseURL:       codex.BaseURL,
+				}
+				if !codex.PlaintextKey && codex.APIKey != "" {
+					cfg.EnvKey = config.CodexKeyEnv
+				}
+				if err := config.WriteCodexConfig(ctx, cfg); err != nil {
+					return err
+				}
+				switch {
+				case codex.PlaintextKey:
+					return config.WriteCodexAuth(ctx, config.CodexAuth{APIKey: codex.APIKey})
+				case codex.APIKey != "":
+					return config.StoreCodexKey(ctx, codex.APIKey)
+				}
+				return nil
+			},
+			Timeout: setupTimeout,
+			Files:   files,
+		})
+	}
+
+	// Claude config
+	claude := sel.Claude
+	if claude.APIKey != "" || claude.BaseURL != "" {
+		files := []string{"~/.claude/settings.json"}
+		if claude.APIKey != "" && !claude.PlaintextKey {
+			files = append(files, store.Where(secrets.ClaudeAPIKey))
+		}
+		queue = append(queue, Task{
+			ID:   idClaudeConfig,
+			Name: "Claude Code config",
+			Fn: func(ctx context.Context) error {
+				return config.WriteClaudeConfig(ctx, config.ClaudeConfig{
+					Model:     claude.Model,
+					BaseURL:   claude.BaseURL,
+					APIKey:    claude.APIKey,
+					Plaintext: claude.PlaintextKey,
+				})
+			},
+			Timeout: setupTimeout,
+			Files:   files,
+		})
+	}
+
+	// AI provider profile; it goes after the settings above so it wins
+	var aiProfile providers.Profile
+	if sel.AIProfile != "" {
+		profiles, _ := providers.Load()
+		aiProfile, _ = profiles.Find(sel.AIProfile)
+		var files []string
+		if aiProfile.Codex != nil {
+			files = append(files, "~/.codex/config.toml")
+			if aiProfile.Codex.KeyRef != "" {
+				files = append(files, "~/.zshrc")
+			}
+		}
+		if aiProfile.Claude != nil {
+			files = append(files, "~/.claude/settings.json")
+		}
+		name := sel.AIProfile
+		queue = append(queue, Task{
+			ID:   idAIProfile,
+			Name: "Switch AI provider → " + name,
+			Fn: func(ctx context.Context) error {
+				_, err := providers.Use(ctx, name)
+				return err
+			},
+			Needs:   []string{idCodexConfig, idClaudeConfig},
+			Timeout: setupTimeout,
+			Files:   files,
+		})
+	}
+
+	// MCP servers
+	selectedMCPs, _ := sel.selectedMCPs(cat)
+	if len(selectedMCPs) > 0 {
+		var preDownload []string
+		for _, s := range selectedMCPs {
+			if pkg := config.NpmPackage(s); pkg != "" {
+				preDownload = append(preDownload, runner.ShellJoin([]string{"npm", "cache", "add", pkg}))
+			}
+		}
+
+		// Claude Code must be selected, configured, or already installed
+		claudeReady := slices.Contains(sel.AITools, "Claude Code") || claude.APIKey != "" || claude.BaseURL != "" ||
+			aiProfile.Claude != nil || isInstalled(cat.AITools, "Claude Code")
+		if claudeReady {
+			cmds := slices.Clone(preDownload)
+			for _, s := range selectedMCPs {
+				cmds = append(cmds,
+					runner.ShellJoin([]string{"claude", "mcp", "remove", "-s", "user", s.Name}),
+					runner.ShellJoin(config.ClaudeMCPAddArgs(s.Masked())))
+			}
+			queue = append(queue, Task{
+				ID:       idClaudeMCP,
+				Name:     "MCP servers for Claude Code",
+				Fn:       func(ctx context.Context) error { return config.WriteMCPConfig(ctx, selectedMCPs, "claude") },
+				Needs:    append([]string{aiID("Claude Code")}, npm...),
+				Lock:     LockNpm,
+				Timeout:  installTimeout,
+				Commands: cmds,
+			})
+		}
+
+		// Codex must be selected, configured, or already installed
+		codexReady := slices.Contains(sel.AITools, "Codex") || codex.APIKey != "" || codex.BaseURL != "" ||
+			aiProfile.Codex != nil || isInstalled(cat.AITools, "Codex")
+		if codexReady {
+			cmds := slices.Clone(preDownload)
+			files := []string{"~/.codex/config.toml"}
+			for _, s := range selectedMCPs {
+				cmds = append(cmds, runner.ShellJoin([]string{"codex", "mcp", "remove", s.Name}))
+				if args := config.CodexMCPAddArgs(s); args != nil {
+					cmds = append(cmds, runner.ShellJoin(args))
+				}
+				if s.Remote() && len(s.Needs) > 0 && !slices.Contains(files, "~/.zshrc") {
+					// secret headers are exported from there, see setCodexRemoteMCP
+					files = append(files, "~/.zshrc")
+				}
+			}
+			queue = append(queue, Task{
+				ID:   idCodexMCP,
+				Name: "MCP servers for Codex",
+				Fn:   func(ctx context.Context) error { return config.WriteMCPConfig(ctx, selectedMCPs, "codex") },
+				// the timeout pass rewrites config.toml, so it goes after the config task
+				Needs:    append([]string{aiID("Codex"), idCodexConfig, idAIProfile}, npm...),
+				Lock:     LockNpm,
+				Timeout:  installTimeout,
+				Commands: cmds,
+				Files:    files,
+			})
+		}
+	}
+
+	// System defaults
+	if slices.Contains(sel.SysDefaults, DefaultBrowserChrome) {
+		queue = append(queue, Task{
+			ID:      defaultID(DefaultBrowserChrome),
+			Name:    "Set default browser → Chrome",
+			Fn:      func(ctx context.Context) error { return installer.SetDefaultBrowser(ctx) },
+			Needs:   []string{appID("Google Chrome")},
+			Lock:    LockLaunchServices,
+			Timeout: setupTimeout,
+			Commands: []string{
+				fmt.Sprintf(lsHandlersCmd, "LSHandlerURLScheme", "http", "com.google.chrome"),
+				fmt.Sprintf(lsHandlersCmd, "LSHandlerURLScheme", "https", "com.google.chrome"),
+			},
+		})
+	}
+	if slices.Contains(sel.SysDefaults, DefaultEditorZed) {
+		queue = append(queue, Task{
+			ID:   defaultID(DefaultEditorZed),
+			Name: "Set default editor → Zed",
+			Fn: func(ctx context.Context) error {
+				_, err := runner.Run(ctx, "bash", "-c", fmt.Sprintf(lsHandlersCmd, "LSHandlerContentType", "public.plain-text", "dev.zed.Zed"))
+				return err
+			},
+			Needs:    []string{appID("Zed")},
+			Lock:     LockLaunchServices,
+			Timeout:  setupTimeout,
+			Commands: []string{fmt.Sprintf(lsHandlersCmd, "LSHandlerContentType", "public.plain-text", "dev.zed.Zed")},
+		})
+	}
+	if slices.Contains(sel.SysDefaults, DefaultPlayerIINA) {
+		types := []string{"public.movie", "public.video", "public.audio"}
+		var cmds []string
+		for _, t := range types {
+			cmds = append(cmds, fmt.Sprintf(lsHandlersCmd, "LSHandlerContentType", t, "com.colliderli.iina"))
+		}
+		queue = append(queue, Task{
+			ID:   defaultID(DefaultPlayerIINA),
+			Name: "Set default player → IINA",
+			Fn: func(ctx context.Context) error {
+				for _, c := range cmds {
+					_, _ = runner.Run(ctx, "bash", "-c", c)
+				}
+				return nil
+			},
+			Needs:    []string{appID("IINA")},
+			Lock:     LockLaunchServices,
+			Timeout:  setupTimeout,
+			Commands: cmds,
+		})
+	}
+
+	// Java JAVA_HOME
+	if slices.Contains(sel.DevTools, "Java (JDK)") {
+		queue = append(queue, Task{
+			ID:      idJavaHome,
+			Name:    "Configure JAVA_HOME",
+			Fn:      func(ctx context.Context) error { return installer.SetJavaHome(ctx) },
+			Needs:   []string{devID("Java (JDK)")},
+			Timeout: setupTimeout,
+			Commands: []string{
+				"sudo ln -sfn /opt/homebrew/opt/openjdk/libexec/openjdk.jdk /Library/Java/JavaVirtualMachines/openjdk.jdk",
+			},
+			Files: []string{"/Library/Java/JavaVirtualMachines/openjdk.jdk", "~/.zshrc"},
+		})
+	}
+
+	// Extra setup
+	if slices.Contains(sel.ExtraSetup, ExtraZedTheme) {
+		queue = append(queue, Task{
+			ID:      extraID(ExtraZedTheme),
+			Name:    "Zed Catppuccin Blur Theme",
+			Fn:      func(ctx context.Context) error { return setup.SetupZedTheme(ctx) },
+			Needs:   []string{devID("Git"), appID("Zed")},
+			Timeout: setupTimeout,
+			Commands: []string{
+				"git clone --depth 1 --quiet https://github.com/jenslys/zed-catppuccin-blur.git <tmp>/repo",
+				"python3 -c <apply blue tint to theme>",
+			},
+			Files: []string{"~/.config/zed/themes/catppuccin-blur.json", "~/.config/zed/settings.json"},
+		})
+	}
+	if slices.Contains(sel.ExtraSetup, ExtraKakuInit) {
+		var cmds []string
+		for _, p := range setup.KakuPlugins() {
+			cmds = append(cmds, fmt.Sprintf("git clone --depth 1 --quiet %s ~/.config/kaku/zsh/plugins/%s", p.Repo, p.Name))
+		}
+		queue = append(queue, Task{
+			ID:       extraID(ExtraKakuInit),
+			Name:     "Kaku Terminal Setup (config + zsh plugins)",
+			Fn:       func(ctx context.Context) error { return setup.SetupKaku(ctx) },
+			Needs:    []string{devID("Git"), appID("Kaku")},
+			Timeout:  setupTimeout,
+			Commands: cmds,
+			Files:    []string{"~/.config/kaku/kaku.lua", "~/.config/kaku/zsh/plugins/"},
+		})
+	}
+	if slices.Contains(sel.ExtraSetup, ExtraKarabiner) {
+		queue = append(queue, Task{
+			ID:       extraID(ExtraKarabiner),
+			Name:     "Karabiner ⌃⌥⌘T → Kaku shortcut",
+			Fn:       func(ctx context.Context) error { return setup.SetupKarabiner(ctx) },
+			Needs:    append([]string{appID("Karabiner-Elements")}, homebrew...),
+			Lock:     LockBrew,
+			Timeout:  brewTimeout,
+			Commands: []string{"brew install --cask karabiner-elements"},
+			Files:    []string{"~/.local/bin/open-kaku.sh", "~/.config/karabiner/karabiner.json"},
+		})
+	}
+	if slices.Contains(sel.ExtraSetup, ExtraDevWorkspace) {
+		var cmds []string
+		for _, args := range setup.FinderDefaults("~/Developer") {
+			cmds = append(cmds, runner.ShellJoin(args))
+		}
+		cmds = append(cmds, "killall Finder")
+		queue = append(queue, Task{
+			ID:       extraID(ExtraDevWorkspace),
+			Name:     "Developer Workspace + Finder config",
+			Fn:       func(ctx context.Context) error { return setup.SetupDevWorkspace(ctx) },
+			Timeout:  setupTimeout,
+			Commands: cmds,
+			Files:    []string{"~/Developer/"},
+		})
+	}
+
+	ordered, err := Order(queue)
+	if err != nil {
+		return nil, fmt.Errorf("plan install: %w", err)
+	}
+	return ordered, nil
+}
+
+// queued reports whether Build installs item: it is missing or outdated, or
+// picked for a reinstall
+func queued(item *checker.Item) bool {
+	return item.Status != checker.Installed || item.Reinstall
+}
+
+// upgradeTask upgrades an outdated item in place with the tool that installed
+// it. It keeps the install task's ID, so tasks that need the item wait for the
+// upgrade. ok is false unless a package manager reported a newer version and
+// the item isn't being reinstalled; an item that is only below its minimum
+// version is installed over instead.
+func upgradeTask(id string, item *checker.Item, homebrew, npm []string) (task Task, ok bool) {
+	if item.Status != checker.Outdated || item.Latest == "" || item.Reinstall {
+		return Task{}, false
+	}
+	task = Task{ID: id, Name: "Upgrade " + item.Name, Timeout: installTimeout}
+	if item.Version != "" && item.Latest != "" {
+		task.Name += " " + item.Version + " → " + item.Latest
+	}
+	switch {
+	case item.Cmd == "rustup":
+		task.Fn = installer.RustupUpdate
+		task.Commands = []string{"rustup update"}
+	case item.NpmName != "":
+		pkg := item.NpmName
+		task.Fn = func(ctx context.Context) error { return installer.NpmUpdate(ctx, pkg) }
+		task.Needs = npm
+		task.Lock = LockNpm
+		task.Commands = []string{runner.ShellJoin([]string{"npm", "update", "-g", pkg})}
+	case item.BrewName != "":
+		brewName, isCask := item.BrewName, item.IsCask
+		task.Fn = func(ctx context.Context) error { return installer.BrewUpgrade(ctx, brewName, isCask) }
+		task.Needs = homebrew
+		task.Lock = LockBrew
+		task.Timeout = brewTimeout
+		task.Commands = []string{runner.ShellJoin(installer.BrewUpgradeArgs(brewName, isCask))}
+	default:
+		return Task{}, false
+	}
+	return task, true
+}
+
+// installTask installs item the way its catalog entry says: a script, an npm
+// package or a Homebrew formula or cask, then its post-install hooks
+func installTask(item *checker.Item, cat Catalog, homebrew, npm []string) (task Task, ok bool) {
+	task = Task{ID: itemID(item), Name: item.Name, Timeout: installTimeout}
+	switch {
+	case item.Script != "":
+		script := item.Script
+		task.Fn = func(ctx context.Context) error { return installer.RunScript(ctx, script) }
+		task.Commands = []string{script}
+		task.Files = item.Files
+		if item.Cmd == "brew" {
+			task.Lock = LockBrew
+			task.Timeout = brewTimeout
+		}
+	case item.NpmName != "":
+		pkg := item.NpmName
+		task.Fn = recordAdded(item, ledger.Entry{Kind: ledger.KindNpm, Name: pkg, Label: item.Name}, func(ctx context.Context) error {
+			return installer.NpmInstall(ctx, pkg)
+		})
+		task.Needs = npm
+		task.Lock = LockNpm
+		task.Commands = []string{runner.ShellJoin(installer.NpmInstallArgs(pkg))}
+	case item.BrewName != "":
+		brewName, isCask := item.BrewName, item.IsCask
+		task.Fn = recordAdded(item, brewEntry(item), func(ctx context.Context) error {
+			return installer.BrewInstall(ctx, brewName, isCask)
+		})
+		task.Needs = homebrew
+		task.Lock = LockBrew
+		task.Timeout = brewTimeout
+		task.Commands = []string{runner.ShellJoin(installer.BrewInstallArgs(brewName, isCask))}
+	default:
+		return Task{}, false
+	}
+
+	task.Needs = slices.Clone(task.Needs)
+	for _, name := range item.Needs {
+		if i := slices.IndexFunc(cat.Items(), func(c *checker.Item) bool { return c.Name == name }); i >= 0 {
+			task.Needs = append(task.Needs, itemID(cat.Items()[i]))
+		}
+	}
+	if hooks := item.PostInstall; len(hooks) > 0 {
+		install := task.Fn
+		task.Fn = func(ctx context.Context) error {
+			if err := install(ctx); err != nil {
+				return err
+			}
+			for _, hook := range hooks {
+				if err := installer.RunScript(ctx, hook); err != nil {
+					return fmt.Errorf("post-install %q: %w", hook, err)
+				}
+			}
+			return nil
+		}
+		task.Commands = append(task.Commands, hooks...)
+	}
+	return task, true
+}
+
+// brewEntry is the ledger entry for a Homebrew item
+func brewEntry(item *checker.Item) ledger.Entry {
+	kind := ledger.KindFormula
+	if item.IsCask {
+		kind = ledger.KindCask
+	}
+	return ledger.Entry{Kind: kind, Name: item.BrewName, Label: item.Name}
+}
+
+// recordAdded wraps an install so that, once it succeeds, entry is written to
+// the ledger for `freshbox uninstall`. Items that were already installed
+// before the run are never recorded.
+func recordAdded(item *checker.Item, entry ledger.Entry, fn func(context.Context) error) func(context.Context) error {
+	if item.Status != checker.NotInstalled {
+		return fn
+	}
+	return func(ctx context.Context) error {
+		if err := fn(ctx); err != nil {
+			return err
+		}
+		return ledger.Add(ctx, entry)
+	}
+}
+
+func isInstalled(items []*checker.Item, name string) bool {
+	for _, item := range items {
+		if item.Name == name && item.Status != checker.NotInstalled {
+			return true
+		}
+	}
+	return false
+}
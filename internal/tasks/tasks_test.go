@@ -0,0 +1,1238 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kittors/freshbox/internal/catalog"
+	"github.com/kittors/freshbox/internal/checker"
+	"github.com/kittors/freshbox/internal/config"
+	"github.com/kittors/freshbox/internal/installer"
+	"github.com/kittors/freshbox/internal/ledger"
+	"github.com/kittors/freshbox/internal/providers"
+	"github.com/kittors/freshbox/internal/runner"
+)
+
+var ctx = context.Background()
+
+// testCatalog returns the built-in catalog with everything marked not installed
+func testCatalog() Catalog {
+	return Catalog{
+		DevTools: checker.DevTools(),
+		Apps:     checker.Apps(),
+		AITools:  checker.AITools(),
+		MCPs:     config.AvailableMCPs(),
+	}
+}
+
+// build is Build for a catalog whose needs have no loop
+func build(t *testing.T, sel Selection, cat Catalog) []Task {
+	t.Helper()
+	queue, err := Build(sel, cat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return queue
+}
+
+func taskNames(queue []Task) []string {
+	var names []string
+	for _, task := range queue {
+		names = append(names, task.Name)
+	}
+	return names
+}
+
+func containsName(queue []Task, substr string) bool {
+	for _, task := range queue {
+		if strings.Contains(task.Name, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+// --- Build ---
+
+func TestBuild_Empty(t *testing.T) {
+	queue := build(t, Selection{}, testCatalog())
+	if len(queue) != 0 {
+		t.Errorf("empty selection should produce empty queue, got %v", taskNames(queue))
+	}
+}
+
+func TestBuild_EveryCatalogItemHasTask(t *testing.T) {
+	cat := testCatalog()
+	var sel Selection
+	for _, item := range cat.DevTools {
+		sel.DevTools = append(sel.DevTools, item.Name)
+	}
+	for _, item := range cat.Apps {
+		sel.Apps = append(sel.Apps, item.Name)
+	}
+	for _, item := range cat.AITools {
+		sel.AITools = append(sel.AITools, item.Name)
+	}
+
+	queue := build(t, sel, cat)
+	for _, item := range cat.DevTools {
+		if !containsName(queue, item.Name) {
+			t.Errorf("dev tool %s has no task", item.Name)
+		}
+	}
+	for _, item := range cat.Apps {
+		if !containsName(queue, item.Name) {
+			t.Errorf("app %s has no task", item.Name)
+		}
+	}
+	if !containsName(queue, "Codex") || !containsName(queue, "Claude Code") {
+		t.Errorf("AI tools missing from queue: %v", taskNames(queue))
+	}
+	if !containsName(queue, "JAVA_HOME") {
+		t.Error("selecting Java should queue JAVA_HOME setup")
+	}
+}
+
+func TestBuild_SkipsInstalled(t *testing.T) {
+	cat := testCatalog()
+	for _, item := range cat.DevTools {
+		if item.Name == "Git" {
+			item.Status = checker.Installed
+		}
+	}
+	queue := build(t, Selection{DevTools: []string{"Git", "Go"}}, cat)
+	if containsName(queue, "Git") {
+		t.Error("installed Git should not be queued")
+	}
+	if !containsName(queue, "Go") {
+		t.Error("Go should be queued")
+	}
+}
+
+func TestBuild_NodeVersionsInOrder(t *testing.T) {
+	queue := build(t, Selection{NodeVersions: []string{"v20.1.0", "v22.3.0"}}, testCatalog())
+	got := strings.Join(taskNames(queue), ",")
+	if got != "Node.js v20.1.0,Node.js v22.3.0" {
+		t.Errorf("queue = %s", got)
+	}
+}
+
+func TestBuild_AIConfigNeedsKeyOrURL(t *testing.T) {
+	sel := Selection{Codex: CodexSettings{Model: "o3"}}
+	if containsName(build(t, sel, testCatalog()), "Codex config") {
+		t.Error("model alone should not queue Codex config")
+	}
+	sel.Codex.APIKey = "sk-test"
+	sel.Claude.BaseURL = "https://proxy.local"
+	queue := build(t, sel, testCatalog())
+	if !containsName(queue, "Codex config") {
+		t.Error("Codex config should be queued when a key is set")
+	}
+	if !containsName(queue, "Claude Code config") {
+		t.Error("Claude config should be queued when a base URL is set")
+	}
+}
+
+func TestBuild_MCPRequiresReadyTool(t *testing.T) {
+	cat := testCatalog()
+	sel := Selection{MCPs: []string{"Playwright"}}
+	if len(build(t, sel, cat)) != 0 {
+		t.Error("MCPs should not be queued without Claude Code or Codex")
+	}
+
+	sel.AITools = []string{"Claude Code"}
+	queue := build(t, sel, cat)
+	if !containsName(queue, "MCP servers for Claude Code") {
+		t.Error("MCP servers for Claude Code should be queued")
+	}
+	if containsName(queue, "MCP servers for Codex") {
+		t.Error("MCP servers for Codex should not be queued")
+	}
+
+	for _, item := range cat.AITools {
+		if item.Name == "Codex" {
+			item.Status = checker.Installed
+		}
+	}
+	if !containsName(build(t, sel, cat), "MCP servers for Codex") {
+		t.Error("installed Codex should receive MCP servers")
+	}
+}
+
+func TestBuild_MCPEnvFromSelectionOrEnvironment(t *testing.T) {
+	t.Setenv("SLACK_TEAM_ID", "T0123")
+	t.Setenv("SLACK_BOT_TOKEN", "")
+	cat := testCatalog()
+	sel := Selection{AITools: []string{"Claude Code"}, MCPs: []string{"Slack", "Fetch"}}
+	if missing := sel.MissingMCPEnv(cat); strings.Join(missing, ",") != "Slack: SLACK_BOT_TOKEN" {
+		t.Errorf("missing = %v", missing)
+	}
+	if err := sel.Validate(cat); err == nil || !strings.Contains(err.Error(), "SLACK_BOT_TOKEN") {
+		t.Errorf("err = %v", err)
+	}
+
+	sel.MCPEnv = map[string]string{"SLACK_BOT_TOKEN": "bot-token-for-tests"}
+	if err := sel.Validate(cat); err != nil {
+		t.Fatal(err)
+	}
+	i := slices.IndexFunc(build(t, sel, cat), func(task Task) bool { return task.ID == idClaudeMCP })
+	if i < 0 {
+		t.Fatal("no Claude MCP task")
+	}
+	cmds := strings.Join(build(t, sel, cat)[i].Commands, "\n")
+	if strings.Contains(cmds, "bot-token-for-tests") || !strings.Contains(cmds, "SLACK_BOT_TOKEN=[REDACTED]") ||
+		!strings.Contains(cmds, "-e SLACK_TEAM_ID=T0123") {
+		t.Errorf("commands should pass the variables with secrets masked:\n%s", cmds)
+	}
+}
+
+func TestBuild_RemoteMCP(t *testing.T) {
+	cat := testCatalog()
+	cat.MCPs = append(cat.MCPs, config.MCPServer{
+		Name:      "Linear",
+		Transport: catalog.TransportHTTP,
+		URL:       "https://mcp.linear.app/mcp",
+		Headers:   map[string]string{"Authorization": "Bearer ${LINEAR_TOKEN}"},
+		Needs:     []catalog.MCPEnv{{Name: "LINEAR_TOKEN", Secret: true}},
+	})
+	sel := Selection{
+		AITools: []string{"Claude Code", "Codex"},
+		MCPs:    []string{"Linear"},
+		MCPEnv:  map[string]string{"LINEAR_TOKEN": "linear-token-for-tests"},
+	}
+	queue := build(t, sel, cat)
+	commands := func(id string) string {
+		i := slices.IndexFunc(queue, func(task Task) bool { return task.ID == id })
+		if i < 0 {
+			t.Fatalf("no %s task", id)
+		}
+		return strings.Join(queue[i].Commands, "\n")
+	}
+	claude := commands(idClaudeMCP)
+	if !strings.Contains(claude, "claude mcp add --transport http -s user Linear https://mcp.linear.app/mcp -H 'Authorization: Bearer [REDACTED]'") {
+		t.Errorf("claude commands:\n%s", claude)
+	}
+	if codex := commands(idCodexMCP); strings.Contains(codex, "codex mcp add") {
+		t.Errorf("remote servers go straight into config.toml:\n%s", codex)
+	}
+}
+
+func TestBuild_AIProfileSwitchesAfterTypedSettings(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	set := providers.Set{}
+	set.Put(providers.Profile{Name: "gw", Codex: &providers.Settings{Model: "gpt-5", BaseURL: "https://gw/v1"}})
+	set.Save()
+
+	cat := testCatalog()
+	sel := Selection{AIProfile: "gw", MCPs: []string{"Playwright"}, Claude: ClaudeSettings{BaseURL: "https://proxy.local"}}
+	if err := sel.Validate(cat); err != nil {
+		t.Fatal(err)
+	}
+	queue, err := Order(build(t, sel, cat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := strings.Join(taskNames(queue), ",")
+	if !strings.Contains(names, "Claude Code config,Switch AI provider → gw") {
+		t.Errorf("the profile should switch after the typed settings: %s", names)
+	}
+	// a Codex profile makes Codex ready for MCP servers, after the switch
+	for _, task := range queue {
+		if task.ID == idAIProfile && strings.Join(task.Files, ",") != "~/.codex/config.toml" {
+			t.Errorf("files = %v", task.Files)
+		}
+		if task.ID == idCodexMCP && !slices.Contains(task.Needs, idAIProfile) {
+			t.Errorf("Codex MCP servers need %v", task.Needs)
+		}
+	}
+	if !containsName(queue, "MCP servers for Codex") {
+		t.Error("MCP servers for Codex should be queued")
+	}
+
+	sel.AIProfile = "nope"
+	if err := sel.Validate(cat); err == nil || !strings.Contains(err.Error(), `AI provider profile "nope"`) {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestBuild_ExtraSetupAndDefaults(t *testing.T) {
+	sel := Selection{
+		ExtraSetup:  ExtraSetupKeys(),
+		SysDefaults: SysDefaultKeys(),
+	}
+	queue := build(t, sel, testCatalog())
+	if len(queue) != len(ExtraSetupKeys())+len(SysDefaultKeys()) {
+		t.Errorf("queue = %v", taskNames(queue))
+	}
+}
+
+func TestBuild_DescribesCommandsAndFiles(t *testing.T) {
+	sel := Selection{
+		Apps:   []string{"Zed"},
+		Codex:  CodexSettings{APIKey: "sk-test"},
+		Claude: ClaudeSettings{BaseURL: "https://proxy.local"},
+	}
+	queue := build(t, sel, testCatalog())
+	for _, task := range queue {
+		if len(task.Commands) == 0 && len(task.Files) == 0 {
+			t.Errorf("task %q describes no commands or files", task.Name)
+		}
+	}
+	if queue[0].Commands[0] != "brew install --cask zed" {
+		t.Errorf("zed command = %q", queue[0].Commands[0])
+	}
+	if !containsFile(queue, "~/.codex/config.toml") || !containsFile(queue, "~/.claude/settings.json") {
+		t.Errorf("AI config files missing from plan: %+v", queue)
+	}
+}
+
+func TestBuild_CodexKeyStorage(t *testing.T) {
+	sel := Selection{Codex: CodexSettings{APIKey: "sk-test"}}
+	queue := build(t, sel, testCatalog())
+	if !containsName(queue, "Codex config (config.toml + stored key)") || !containsFile(queue, "~/.zshrc") {
+		t.Errorf("stored key plan = %+v", queue)
+	}
+	if containsFile(queue, "~/.codex/auth.json") {
+		t.Error("auth.json should only be written for plaintext keys")
+	}
+
+	sel.Codex.PlaintextKey = true
+	queue = build(t, sel, testCatalog())
+	if !containsName(queue, "Codex config (config.toml + auth.json)") || !containsFile(queue, "~/.codex/auth.json") {
+		t.Errorf("plaintext plan = %+v", queue)
+	}
+}
+
+func containsFile(queue []Task, file string) bool {
+	for _, task := range queue {
+		for _, f := range task.Files {
+			if f == file {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestBuild_OrderComesFromDependencies(t *testing.T) {
+	sel := Selection{
+		DevTools:     []string{"Homebrew", "fnm"},
+		AITools:      []string{"Claude Code"},
+		NodeVersions: []string{"v22.0.0"},
+		MCPs:         []string{"Playwright"},
+	}
+	got := strings.Join(taskNames(build(t, sel, testCatalog())), ",")
+	want := "Homebrew,fnm,Node.js v22.0.0,Claude Code,MCP servers for Claude Code"
+	if got != want {
+		t.Errorf("order = %s, want %s", got, want)
+	}
+}
+
+func TestBuild_DropsNeedsOutsideQueue(t *testing.T) {
+	queue := build(t, Selection{DevTools: []string{"Git"}}, testCatalog())
+	if len(queue) != 1 || len(queue[0].Needs) != 0 {
+		t.Errorf("Git without Homebrew in the queue should need nothing, got %+v", queue)
+	}
+}
+
+// --- Catalog ---
+
+func TestBuild_FollowsCatalogEntries(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := runner.NewFake().On("bash -c 'rg --version'", runner.Response{ExitCode: 1})
+	defer runner.Use(f)()
+	items, err := checker.FromCatalog([]catalog.Tool{
+		{Name: "Brew", Category: "dev", Cmd: "brew", Install: catalog.InstallScript, Script: "install-brew"},
+		{Name: "Rust", Category: "dev", Cmd: "rustup", Install: catalog.InstallScript, Script: "install-rust", Files: []string{"~/.cargo/"}},
+		{Name: "cargo-watch", Category: "dev", Cmd: "cargo-watch", Install: catalog.InstallScript, Script: "cargo install cargo-watch", Needs: []string{"Rust"}},
+		{Name: "ripgrep", Category: "dev", Cmd: "rg", Install: catalog.InstallBrew, Package: "ripgrep", PostInstall: []string{"rg --version"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sel := Selection{DevTools: []string{"Brew", "Rust", "cargo-watch", "ripgrep"}}
+	queue := build(t, sel, Catalog{DevTools: items})
+
+	byID := map[string]Task{}
+	for _, task := range queue {
+		byID[task.ID] = task
+	}
+	if brew := byID[devID("Brew")]; brew.Lock != LockBrew || brew.Commands[0] != "install-brew" {
+		t.Errorf("the item that installs brew = %+v", brew)
+	}
+	if rust := byID[devID("Rust")]; rust.Lock != "" || len(rust.Files) != 1 {
+		t.Errorf("Rust = %+v", rust)
+	}
+	if w := byID[devID("cargo-watch")]; strings.Join(w.Needs, ",") != devID("Rust") {
+		t.Errorf("cargo-watch needs %v, want Rust", w.Needs)
+	}
+	rg := byID[devID("ripgrep")]
+	if strings.Join(rg.Needs, ",") != devID("Brew") || strings.Join(rg.Commands, "; ") != "brew install ripgrep; rg --version" {
+		t.Errorf("ripgrep = %+v", rg)
+	}
+
+	var failed []string
+	Run(ctx, queue, 1, func(e Event) {
+		if e.Error != "" {
+			failed = append(failed, e.Task+": "+e.Error)
+		}
+	})
+	if len(failed) != 1 || !strings.HasPrefix(failed[0], `ripgrep: post-install "rg --version"`) {
+		t.Errorf("failed = %v", failed)
+	}
+	want := "bash -c install-brew\nbash -c install-rust\nbash -c 'cargo install cargo-watch'\nbrew install ripgrep\nbash -c 'rg --version'"
+	if got := strings.Join(f.Cmdlines(), "\n"); got != want {
+		t.Errorf("ran:\n%s\nwant:\n%s", got, want)
+	}
+	// the package was installed, so it is still recorded for uninstall
+	if entries, _ := ledger.Load(); len(entries) != 1 || entries[0].Name != "ripgrep" {
+		t.Errorf("ledger = %+v", entries)
+	}
+}
+
+func TestLoadCatalogLayersLocalFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(catalog.EnvVar, "")
+	os.MkdirAll(home+"/.freshbox", 0755)
+	os.WriteFile(catalog.LocalPath(), []byte(`
+[[tool]]
+name = "Tabby"
+hidden = true
+
+[[tool]]
+name = "Gemini CLI"
+category = "ai"
+desc = "Google's AI coding assistant CLI"
+cmd = "gemini"
+install = "npm"
+package = "@google/gemini-cli"
+`), 0644)
+
+	cat, err := LoadCatalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cat.Apps) != 6 || isInstalled(cat.Apps, "Tabby") {
+		t.Errorf("apps = %d, Tabby should be hidden", len(cat.Apps))
+	}
+	if len(cat.AITools) != 3 || cat.AITools[2].NpmName != "@google/gemini-cli" {
+		t.Fatalf("AI tools = %+v", cat.AITools)
+	}
+	queue := build(t, Selection{AITools: []string{"Gemini CLI"}}, cat)
+	if len(queue) != 1 || queue[0].ID != aiID("Gemini CLI") || queue[0].Commands[0] != "npm install -g @google/gemini-cli" {
+		t.Errorf("queue = %+v", queue)
+	}
+
+	os.WriteFile(catalog.LocalPath(), []byte("[[tool]]\nname = \"Go\"\ncategory = \"dev\"\ncmd = \"go\"\ninstall = \"brew\"\npackage = \"go\"\nmin_version = \"latest\"\n"), 0644)
+	if _, err := LoadCatalog(); err == nil || !strings.Contains(err.Error(), "invalid min_version") {
+		t.Errorf("bad min_version: err = %v", err)
+	}
+}
+
+func TestBuild_NeedsLoopIsAnError(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer runner.Use(runner.NewFake())()
+	// a catalog that skipped validation
+	items, err := checker.FromCatalog([]catalog.Tool{
+		{Name: "Foo", Category: "dev", Cmd: "foo", Install: catalog.InstallBrew, Package: "foo", Needs: []string{"Bar"}},
+		{Name: "Bar", Category: "dev", Cmd: "bar", Install: catalog.InstallBrew, Package: "bar", Needs: []string{"Foo"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Build(Selection{DevTools: []string{"Foo", "Bar"}}, Catalog{DevTools: items})
+	if err == nil || !strings.Contains(err.Error(), "dependency cycle between: Foo, Bar") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+// --- Graph ---
+
+func TestOrder_StableTopological(t *testing.T) {
+	queue := []Task{
+		{ID: "c", Name: "C", Needs: []string{"b"}},
+		{ID: "a", Name: "A"},
+		{ID: "b", Name: "B", Needs: []string{"a", "a", "missing"}},
+		{ID: "d", Name: "D"},
+	}
+	ordered, err := Order(queue)
+	if err != nil {
+		t.Fatalf("Order failed: %v", err)
+	}
+	if got := strings.Join(taskNames(ordered), ","); got != "A,B,C,D" {
+		t.Errorf("order = %s, want A,B,C,D", got)
+	}
+	if len(ordered[1].Needs) != 1 {
+		t.Errorf("duplicate and unknown needs should be pruned, got %v", ordered[1].Needs)
+	}
+	if len(queue[2].Needs) != 3 {
+		t.Error("Order must not modify its input")
+	}
+}
+
+func TestOrder_Cycle(t *testing.T) {
+	_, err := Order([]Task{
+		{ID: "a", Name: "A", Needs: []string{"b"}},
+		{ID: "b", Name: "B", Needs: []string{"a"}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "A, B") {
+		t.Errorf("expected cycle error naming both tasks, got %v", err)
+	}
+}
+
+// --- Schedule ---
+
+func TestScheduler_LocksAndWorkerLimit(t *testing.T) {
+	queue := []Task{
+		{ID: "git", Name: "Git", Lock: LockBrew},
+		{ID: "go", Name: "Go", Lock: LockBrew},
+		{ID: "ws", Name: "Workspace"},
+		{ID: "theme", Name: "Theme", Needs: []string{"git"}},
+		{ID: "kaku", Name: "Kaku"},
+	}
+	s := NewScheduler(queue, 3)
+
+	start, _ := s.Next()
+	if fmt.Sprint(start) != "[0 2 4]" {
+		t.Fatalf("first batch = %v, want [0 2 4]", start)
+	}
+	if start, _ := s.Next(); len(start) != 0 {
+		t.Errorf("nothing else may start while workers are busy, got %v", start)
+	}
+
+	// Go takes the brew lock and the last free worker; Theme waits
+	s.Finish(0, nil)
+	start, _ = s.Next()
+	if fmt.Sprint(start) != "[1]" {
+		t.Errorf("after Git: %v, want [1]", start)
+	}
+	s.Finish(2, nil)
+	start, _ = s.Next()
+	if fmt.Sprint(start) != "[3]" {
+		t.Errorf("after Workspace: %v, want [3]", start)
+	}
+	for _, i := range []int{1, 3, 4} {
+		s.Finish(i, nil)
+	}
+	if !s.Done() {
+		t.Error("scheduler should be done")
+	}
+}
+
+func TestScheduler_SkipsTransitively(t *testing.T) {
+	queue := []Task{
+		{ID: "brew", Name: "Homebrew"},
+		{ID: "fnm", Name: "fnm", Needs: []string{"brew"}},
+		{ID: "node", Name: "Node.js", Needs: []string{"fnm"}},
+	}
+	s := NewScheduler(queue, 4)
+	s.Next()
+	s.Finish(0, errors.New("offline"))
+	start, skipped := s.Next()
+	if len(start) != 0 || len(skipped) != 2 {
+		t.Fatalf("start = %v, skipped = %v", start, skipped)
+	}
+	if skipped[2].Error() != "skipped (dependency failed: fnm)" {
+		t.Errorf("node skip = %v", skipped[2])
+	}
+	if !s.Done() {
+		t.Error("scheduler should be done")
+	}
+}
+
+func TestScheduler_Stop(t *testing.T) {
+	queue := []Task{
+		{ID: "a", Name: "A"},
+		{ID: "b", Name: "B"},
+		{ID: "c", Name: "C", Needs: []string{"a"}},
+	}
+	s := NewScheduler(queue, 1)
+	if start, _ := s.Next(); len(start) != 1 || start[0] != 0 {
+		t.Fatalf("start = %v", start)
+	}
+
+	s.Stop()
+	start, skipped := s.Next()
+	if len(start) != 0 || len(skipped) != 2 || skipped[1] != ErrCancelled || skipped[2] != ErrCancelled {
+		t.Fatalf("start = %v, skipped = %v", start, skipped)
+	}
+	if s.Done() || len(s.Running()) != 1 {
+		t.Error("the running task should be left to finish")
+	}
+	s.Finish(0, nil)
+	if !s.Done() {
+		t.Error("scheduler should be done")
+	}
+}
+
+func TestRun_Concurrent(t *testing.T) {
+	// both tasks must be in flight at once for either to finish
+	var wg sync.WaitGroup
+	wg.Add(2)
+	meet := func(context.Context) error {
+		wg.Done()
+		wg.Wait()
+		return nil
+	}
+	done := make(chan int)
+	go func() {
+		done <- Run(ctx, []Task{{Name: "a", Fn: meet}, {Name: "b", Fn: meet}}, 2, nil)
+	}()
+	select {
+	case failed := <-done:
+		if failed != 0 {
+			t.Errorf("failed = %d", failed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("independent tasks did not run concurrently")
+	}
+}
+
+// --- State ---
+
+func TestRunState_StripsKeysAndRoundTrips(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	sel := Selection{DevTools: []string{"Git"}, Codex: CodexSettings{APIKey: "sk-secret", BaseURL: "https://gw"}}
+	queue := build(t, sel, testCatalog())
+	if err := NewRunState(sel, queue).Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(StatePath())
+	if strings.Contains(string(data), "sk-secret") {
+		t.Errorf("state file leaked an API key:\n%s", data)
+	}
+	state, err := LoadState()
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if !state.CodexKey || state.Selection.Codex.BaseURL != "https://gw" || len(state.Tasks) != len(queue) {
+		t.Errorf("state = %+v", state)
+	}
+}
+
+func TestLoadState_Missing(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if state, err := LoadState(); state != nil || err != nil {
+		t.Errorf("LoadState = %v, %v; want nil, nil", state, err)
+	}
+}
+
+func TestRunState_TrackClearsWhenAllSucceed(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	queue := []Task{
+		{ID: "a", Name: "A", Fn: func(context.Context) error { return nil }},
+		{ID: "b", Name: "B", Fn: func(context.Context) error { return errors.New("boom") }},
+	}
+	state := NewRunState(Selection{}, queue)
+	Run(ctx, queue, 1, state.Track(nil))
+
+	saved, _ := LoadState()
+	if saved == nil || saved.Tasks[0].Status != StatusOK || saved.Tasks[1].Status != StatusFailed ||
+		saved.Tasks[1].Error != "boom" {
+		t.Fatalf("saved = %+v", saved)
+	}
+
+	queue[1].Fn = func(context.Context) error { return nil }
+	Run(ctx, queue[1:], 1, saved.Track(nil))
+	if again, _ := LoadState(); again != nil {
+		t.Errorf("finished run should clear the state, got %+v", again)
+	}
+}
+
+func TestRunState_SaveIsAtomicAndTrackLogsErrors(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	state := NewRunState(Selection{}, []Task{{ID: "a", Name: "A"}})
+	state.Save()
+	state.Mark("a", StatusOK, nil)
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(StatePath()))
+	if len(entries) != 1 || entries[0].Name() != "state.json" {
+		t.Errorf("~/.freshbox has %v, want only state.json", entries)
+	}
+
+	// a directory where state.json goes: every save fails
+	os.Remove(StatePath())
+	os.Mkdir(StatePath(), 0755)
+	state.Track(nil)(Event{Type: EventStart, Task: "A", ID: "a"})
+	data, _ := os.ReadFile(LogPath())
+	if !strings.Contains(string(data), "run state: ") {
+		t.Errorf("install.log should note the failed save:\n%s", data)
+	}
+}
+
+func TestRunState_Resume(t *testing.T) {
+	cat := testCatalog()
+	sel := Selection{
+		Apps:        []string{"Zed"},
+		SysDefaults: []string{DefaultEditorZed},
+		Claude:      ClaudeSettings{APIKey: "sk-ant"},
+	}
+	state := NewRunState(sel, build(t, sel, cat))
+	state.Mark(appID("Zed"), StatusOK, nil)
+
+	// Zed is now detected as installed; the resumed run must not care
+	for _, item := range cat.Apps {
+		if item.Name == "Zed" {
+			item.Status = checker.Installed
+		}
+	}
+
+	queue, dropped, _ := state.Resume(cat, Selection{}, false)
+	if got := strings.Join(taskNames(queue), ","); got != "Set default editor → Zed" {
+		t.Errorf("resumed queue = %s", got)
+	}
+	if len(dropped) != 1 || dropped[0] != "Claude Code config" {
+		t.Errorf("dropped = %v", dropped)
+	}
+
+	queue, dropped, _ = state.Resume(cat, Selection{Claude: ClaudeSettings{APIKey: "sk-ant"}}, true)
+	if len(queue) != 3 || len(dropped) != 0 {
+		t.Errorf("forced resume = %v, dropped %v", taskNames(queue), dropped)
+	}
+	for _, item := range cat.Apps {
+		if item.Name == "Zed" && item.Status != checker.Installed {
+			t.Error("Resume must not modify the caller's catalog")
+		}
+	}
+}
+
+func TestRunState_ResumeNeedsMCPEnvAgain(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("BRAVE_API_KEY", "")
+	cat := testCatalog()
+	sel := Selection{
+		AITools: []string{"Claude Code"},
+		MCPs:    []string{"Brave Search", "Fetch"},
+		MCPEnv:  map[string]string{"BRAVE_API_KEY": "brave-key-for-tests"},
+	}
+	state := NewRunState(sel, build(t, sel, cat))
+	state.Save()
+	if data, _ := os.ReadFile(StatePath()); strings.Contains(string(data), "brave-key-for-tests") {
+		t.Errorf("state file leaked an MCP variable:\n%s", data)
+	}
+	if got := state.IncompleteMCPs(cat, nil, false); strings.Join(got, ",") != "Brave Search" {
+		t.Errorf("IncompleteMCPs = %v", got)
+	}
+
+	// only the server without its variable is left out
+	queue, dropped, _ := state.Resume(cat, Selection{}, false)
+	mcp := slices.IndexFunc(queue, func(task Task) bool { return task.ID == idClaudeMCP })
+	if mcp < 0 || strings.Join(dropped, ",") != "MCP server Brave Search" {
+		t.Fatalf("queue = %v, dropped = %v", taskNames(queue), dropped)
+	}
+	if cmds := strings.Join(queue[mcp].Commands, "\n"); strings.Contains(cmds, "Brave") || !strings.Contains(cmds, "Fetch") {
+		t.Errorf("commands:\n%s", cmds)
+	}
+	queue, dropped, _ = state.Resume(cat, Selection{MCPEnv: sel.MCPEnv}, false)
+	mcp = slices.IndexFunc(queue, func(task Task) bool { return task.ID == idClaudeMCP })
+	if mcp < 0 || !strings.Contains(strings.Join(queue[mcp].Commands, "\n"), "Brave") || len(dropped) != 0 {
+		t.Errorf("queue = %v, dropped = %v", taskNames(queue), dropped)
+	}
+
+	// nothing to ask for once the MCP task has succeeded
+	state.Mark(idClaudeMCP, StatusOK, nil)
+	if got := state.IncompleteMCPs(cat, nil, false); got != nil {
+		t.Errorf("IncompleteMCPs = %v", got)
+	}
+}
+
+// --- Plan ---
+
+func TestPlanWriteText(t *testing.T) {
+	queue := []Task{{Name: "Git", Commands: []string{"brew install git"}, Files: []string{"~/.gitconfig"}}}
+	var buf bytes.Buffer
+	NewPlan(queue).WriteText(&buf)
+	out := buf.String()
+	for _, want := range []string{"1 tasks", " 1. Git", "$ brew install git", "✎ ~/.gitconfig"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("plan missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestPlanWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewPlan(nil).WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	var p Plan
+	if err := json.Unmarshal(buf.Bytes(), &p); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if p.Steps == nil || len(p.Steps) != 0 {
+		t.Errorf("empty plan should encode an empty task list: %s", buf.String())
+	}
+}
+
+// --- Validate ---
+
+func TestValidate(t *testing.T) {
+	cat := testCatalog()
+	ok := Selection{
+		DevTools:    []string{"Git"},
+		Apps:        []string{"Zed"},
+		AITools:     []string{"Codex"},
+		MCPs:        []string{"Playwright"},
+		ExtraSetup:  []string{ExtraZedTheme},
+		SysDefaults: []string{DefaultEditorZed},
+	}
+	if err := ok.Validate(cat); err != nil {
+		t.Errorf("valid selection rejected: %v", err)
+	}
+
+	bad := Selection{DevTools: []string{"Cobol"}, MCPs: []string{"Nope"}}
+	err := bad.Validate(cat)
+	if err == nil {
+		t.Fatal("expected error for unknown names")
+	}
+	if !strings.Contains(err.Error(), "Cobol") || !strings.Contains(err.Error(), "Nope") {
+		t.Errorf("error should list every unknown name, got: %v", err)
+	}
+
+	if err := (Selection{MinVersions: map[string]string{"Go": "1.25"}}).Validate(cat); err != nil {
+		t.Errorf("valid minimum version rejected: %v", err)
+	}
+	if err := (Selection{MinVersions: map[string]string{"Cobol": "1"}}).Validate(cat); err == nil || !strings.Contains(err.Error(), "Cobol") {
+		t.Errorf("minimum version for an unknown item: %v", err)
+	}
+	if err := (Selection{MinVersions: map[string]string{"Go": "latest"}}).Validate(cat); err == nil || !strings.Contains(err.Error(), "latest") {
+		t.Errorf("unparsable minimum version: %v", err)
+	}
+}
+
+func TestSelectionJSONRoundTrip(t *testing.T) {
+	sel := Selection{
+		DevTools:     []string{"Git"},
+		NodeVersions: []string{"v22.0.0"},
+		Claude:       ClaudeSettings{Model: "claude-sonnet-4-6"},
+	}
+	data, err := json.Marshal(sel)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	if strings.Contains(string(data), `"codex"`) {
+		t.Errorf("empty codex settings should be omitted: %s", data)
+	}
+	var back Selection
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if back.Claude.Model != "claude-sonnet-4-6" || back.NodeVersions[0] != "v22.0.0" {
+		t.Errorf("round trip lost data: %+v", back)
+	}
+}
+
+// --- Run ---
+
+func TestRun_ReportsProgressAndFailures(t *testing.T) {
+	queue := []Task{
+		{Name: "one", Fn: func(context.Context) error { return nil }},
+		{Name: "two", Fn: func(context.Context) error { return errors.New("boom\n") }},
+		{Name: "three", Fn: func(context.Context) error { return nil }},
+	}
+	var events []Event
+	failed := Run(ctx, queue, 1, func(e Event) { events = append(events, e) })
+
+	if failed != 1 {
+		t.Errorf("failed = %d, want 1", failed)
+	}
+	if len(events) != 7 {
+		t.Fatalf("got %d events, want 7", len(events))
+	}
+	if events[3].Type != EventFail || events[3].Error != "boom" {
+		t.Errorf("fail event = %+v", events[3])
+	}
+	last := events[len(events)-1]
+	if last.Type != EventDone || last.Failed != 1 || last.Total != 3 {
+		t.Errorf("done event = %+v", last)
+	}
+}
+
+func TestRun_ReplaysOnFakeRunner(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := runner.NewFake().On("brew install --cask zed", runner.Response{Stderr: "Error: Download failed", ExitCode: 1})
+	defer runner.Use(f)()
+
+	queue := build(t, Selection{DevTools: []string{"Git"}, Apps: []string{"Zed"}, NodeVersions: []string{"v22.0.0"}}, testCatalog())
+	failed := Run(ctx, queue, 1, func(Event) {})
+	if failed != 1 {
+		t.Errorf("failed = %d, want 1", failed)
+	}
+
+	// what ran is exactly what the plan promised
+	var planned []string
+	for _, task := range queue {
+		planned = append(planned, task.Commands...)
+	}
+	if got := f.Cmdlines(); strings.Join(got, "\n") != strings.Join(planned, "\n") {
+		t.Errorf("ran %v, planned %v", got, planned)
+	}
+}
+
+func TestRun_SkipsDependentsOfFailures(t *testing.T) {
+	ran := map[string]bool{}
+	fn := func(name string, err error) func(context.Context) error {
+		return func(context.Context) error { ran[name] = true; return err }
+	}
+	queue := []Task{
+		{ID: "brew", Name: "Homebrew", Fn: fn("brew", errors.New("curl failed"))},
+		{ID: "fnm", Name: "fnm", Needs: []string{"brew"}, Fn: fn("fnm", nil)},
+		{ID: "node", Name: "Node.js", Needs: []string{"fnm"}, Fn: fn("node", nil)},
+		{ID: "ws", Name: "Workspace", Fn: fn("ws", nil)},
+	}
+	var events []Event
+	failed := Run(ctx, queue, 1, func(e Event) { events = append(events, e) })
+
+	if failed != 1 {
+		t.Errorf("failed = %d, want 1", failed)
+	}
+	if ran["fnm"] || ran["node"] || !ran["ws"] {
+		t.Errorf("ran = %v", ran)
+	}
+	var skips []Event
+	for _, e := range events {
+		if e.Type == EventSkip {
+			skips = append(skips, e)
+		}
+	}
+	if len(skips) != 2 || skips[0].Error != "skipped (dependency failed: Homebrew)" ||
+		skips[1].Error != "skipped (dependency failed: fnm)" {
+		t.Errorf("skip events = %+v", skips)
+	}
+	if last := events[len(events)-1]; last.Skipped != 2 {
+		t.Errorf("done event = %+v", last)
+	}
+
+	var buf bytes.Buffer
+	Run(ctx, queue, 1, TextReporter(&buf))
+	if !strings.Contains(buf.String(), "[SKIP] fnm") || !strings.Contains(buf.String(), "2 skipped") {
+		t.Errorf("text output:\n%s", buf.String())
+	}
+}
+
+func TestRun_CancelStopsRunningAndSkipsRest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	queue := []Task{
+		{ID: "a", Name: "A", Fn: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+		{ID: "b", Name: "B", Fn: func(context.Context) error { t.Error("B must not start"); return nil }},
+	}
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	var events []Event
+	failed := Run(ctx, queue, 1, func(e Event) { events = append(events, e) })
+	if failed != 1 {
+		t.Errorf("failed = %d, want 1", failed)
+	}
+	var types []EventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	want := []EventType{EventStart, EventSkip, EventFail, EventDone}
+	if fmt.Sprint(types) != fmt.Sprint(want) {
+		t.Errorf("events = %v, want %v", types, want)
+	}
+	if events[1].Error != ErrCancelled.Error() {
+		t.Errorf("skip reason = %q", events[1].Error)
+	}
+}
+
+func TestTask_ExecTimeout(t *testing.T) {
+	task := Task{Name: "hang", Timeout: 10 * time.Millisecond, Fn: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	err := task.Exec(ctx)
+	if err == nil || !strings.HasPrefix(err.Error(), "timed out after 10ms") {
+		t.Errorf("err = %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("timeout error should wrap context.DeadlineExceeded")
+	}
+
+	task.Timeout = 0
+	task.Fn = func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); ok {
+			return errors.New("unexpected deadline")
+		}
+		return nil
+	}
+	if err := task.Exec(ctx); err != nil {
+		t.Errorf("no timeout: %v", err)
+	}
+}
+
+func TestBuild_TimeoutsAndOverride(t *testing.T) {
+	queue := build(t, Selection{
+		DevTools:     []string{"Homebrew", "Git", "fnm"},
+		NodeVersions: []string{"v22.0.0"},
+		SysDefaults:  []string{DefaultEditorZed},
+	}, testCatalog())
+	for _, task := range queue {
+		if task.Timeout <= 0 {
+			t.Errorf("%s has no timeout", task.Name)
+		}
+	}
+	SetTimeout(queue, time.Minute)
+	for _, task := range queue {
+		if task.Timeout != time.Minute {
+			t.Errorf("%s timeout = %s after SetTimeout", task.Name, task.Timeout)
+		}
+	}
+}
+
+func TestTextReporter(t *testing.T) {
+	var buf bytes.Buffer
+	Run(ctx, []Task{{Name: "Git", Fn: func(context.Context) error { return errors.New("no network") }}}, 1, TextReporter(&buf))
+	out := buf.String()
+	for _, want := range []string{"[1/1] [ .. ] Git", "[FAIL] Git", "no network", "1 failed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+	Run(ctx, []Task{{Name: "Git", Fn: func(context.Context) error { return nil }}}, 1, JSONReporter(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3:\n%s", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		var e Event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Errorf("invalid JSON line %q: %v", line, err)
+		}
+	}
+}
+
+// --- Upgrade ---
+
+func markOutdated(items []*checker.Item, name, from, to string) {
+	for _, item := range items {
+		if item.Name == name {
+			item.Status, item.Version, item.Latest = checker.Outdated, from, to
+		}
+	}
+}
+
+func TestQueued(t *testing.T) {
+	for _, tc := range []struct {
+		status    checker.Status
+		reinstall bool
+		want      bool
+	}{
+		{checker.NotInstalled, false, true},
+		{checker.Installed, false, false},
+		{checker.Installed, true, true},
+		{checker.Outdated, false, true},
+		{checker.Outdated, true, true},
+	} {
+		item := &checker.Item{Status: tc.status, Reinstall: tc.reinstall}
+		if got := queued(item); got != tc.want {
+			t.Errorf("queued(%v, reinstall=%v) = %v, want %v", tc.status, tc.reinstall, got, tc.want)
+		}
+	}
+}
+
+func TestBuild_UpgradesOutdatedInPlace(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := runner.NewFake()
+	defer runner.Use(f)()
+	cat := testCatalog()
+	for _, name := range []string{"Homebrew"} {
+		for _, item := range cat.DevTools {
+			if item.Name == name {
+				item.Status = checker.Installed
+			}
+		}
+	}
+	markOutdated(cat.DevTools, "Git", "2.39.3", "2.44.0")
+	markOutdated(cat.DevTools, "Rust (rustup)", "1.75.0", "1.76.0")
+	markOutdated(cat.Apps, "Zed", "0.150.0", "0.160.1")
+	markOutdated(cat.AITools, "Codex", "0.1.0", "0.2.0")
+	sel := Selection{DevTools: []string{"Git", "Rust (rustup)"}, Apps: []string{"Zed"}, AITools: []string{"Codex"}}
+	queue := build(t, sel, cat)
+
+	want := map[string]struct{ name, cmd string }{
+		devID("Git"):           {"Upgrade Git 2.39.3 → 2.44.0", "brew upgrade git"},
+		devID("Rust (rustup)"): {"Upgrade Rust (rustup) 1.75.0 → 1.76.0", "rustup update"},
+		appID("Zed"):           {"Upgrade Zed 0.150.0 → 0.160.1", "brew upgrade --cask zed"},
+		aiID("Codex"):          {"Upgrade Codex 0.1.0 → 0.2.0", "npm update -g @openai/codex"},
+	}
+	for _, task := range queue {
+		w, ok := want[task.ID]
+		if !ok {
+			continue
+		}
+		delete(want, task.ID)
+		if task.Name != w.name || strings.Join(task.Commands, "\n") != w.cmd {
+			t.Errorf("%s = %q %v, want %q %q", task.ID, task.Name, task.Commands, w.name, w.cmd)
+		}
+	}
+	for id := range want {
+		t.Errorf("no upgrade task with ID %s in %v", id, taskNames(queue))
+	}
+
+	if failed := Run(ctx, queue, 1, func(Event) {}); failed != 0 {
+		t.Fatalf("failed = %d", failed)
+	}
+	calls := strings.Join(f.Cmdlines(), "\n")
+	for _, c := range []string{"brew upgrade git", "brew upgrade --cask zed", "npm update -g @openai/codex", "rustup update"} {
+		if !strings.Contains(calls, c) {
+			t.Errorf("run is missing %q:\n%s", c, calls)
+		}
+	}
+	if entries, _ := ledger.Load(); len(entries) != 0 {
+		t.Errorf("upgrades shouldn't be recorded as added: %v", entries)
+	}
+}
+
+func TestBuild_ReinstallBeatsUpgrade(t *testing.T) {
+	cat := testCatalog()
+	markOutdated(cat.DevTools, "Git", "2.39.3", "2.44.0")
+	for _, item := range cat.DevTools {
+		if item.Name == "Git" {
+			item.Reinstall = true
+		}
+	}
+	queue := build(t, Selection{DevTools: []string{"Git"}}, cat)
+	if containsName(queue, "Upgrade Git") || !containsName(queue, "Git") {
+		t.Errorf("a reinstall should install, not upgrade: %v", taskNames(queue))
+	}
+}
+
+func TestBuild_InstallsOverTooOldItems(t *testing.T) {
+	cat := testCatalog()
+	for _, item := range cat.DevTools {
+		if item.Name == "Go" {
+			item.Status, item.Version, item.Semver = checker.Installed, "go version go1.22.1 darwin/arm64", checker.Semver{Major: 1, Minor: 22, Patch: 1}
+		}
+	}
+	queue := build(t, Selection{DevTools: []string{"Go"}}, cat)
+	if containsName(queue, "Go") {
+		t.Fatalf("installed Go should not be queued, got %v", taskNames(queue))
+	}
+
+	cat.Require(map[string]string{"Go": "1.24", "Cobol": "1"})
+	queue = build(t, Selection{DevTools: []string{"Go"}}, cat)
+	if len(queue) != 1 || queue[0].ID != devID("Go") || !strings.Contains(strings.Join(queue[0].Commands, ""), "brew install go") {
+		t.Errorf("Go below its minimum should be installed over, got %v", NewPlan(queue).Steps)
+	}
+}
+
+// --- Uninstall ---
+
+func TestBuild_RecordsOnlyWhatItAdded(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer runner.Use(runner.NewFake())()
+	cat := testCatalog()
+	for _, item := range cat.Apps {
+		if item.Name == "Zed" {
+			item.Status = checker.Installed
+			item.Reinstall = true // install --force
+		}
+	}
+	queue := build(t, Selection{DevTools: []string{"Git"}, Apps: []string{"Zed"}}, cat)
+	if !containsName(queue, "Zed") {
+		t.Fatal("a forced reinstall should be queued")
+	}
+	if failed := Run(ctx, queue, 1, func(Event) {}); failed != 0 {
+		t.Fatalf("failed = %d", failed)
+	}
+	entries, _ := ledger.Load()
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Title())
+	}
+	if strings.Join(names, ",") != "Git" {
+		t.Errorf("ledger = %v, want only Git; Zed was there before", names)
+	}
+}
+
+func TestBuildUninstall_MCPsBeforeTheirCLI(t *testing.T) {
+	entries := []ledger.Entry{
+		{Kind: ledger.KindNpm, Name: installer.ClaudeCodePackage, Label: "Claude Code"},
+		{Kind: ledger.KindCask, Name: "zed", Label: "Zed"},
+		{Kind: ledger.KindClaudeMCP, Name: "Fetch"},
+		{Kind: ledger.KindDefault, Domain: "com.apple.finder", Name: "ShowPathbar"},
+		{Kind: ledger.KindDefault, Domain: "com.apple.finder", Name: "AppleShowAllFiles", Previous: []string{"-bool", "false"}},
+	}
+	queue := BuildUninstall(entries)
+	got := strings.Join(taskNames(queue), ",")
+	want := "Uninstall Zed,Remove MCP server Fetch from Claude Code,Uninstall Claude Code,Revert Finder defaults"
+	if got != want {
+		t.Errorf("queue = %s", got)
+	}
+	var cmds []string
+	for _, task := range queue {
+		cmds = append(cmds, task.Commands...)
+	}
+	for _, c := range []string{
+		"brew uninstall --cask zed",
+		"npm uninstall -g @anthropic-ai/claude-code",
+		"defaults delete com.apple.finder ShowPathbar",
+		"defaults write com.apple.finder AppleShowAllFiles -bool false",
+	} {
+		if !strings.Contains(strings.Join(cmds, "\n"), c) {
+			t.Errorf("plan is missing %q", c)
+		}
+	}
+}
+
+func TestBuildUninstall_ForgetsRemovedEntries(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	f := runner.NewFake().On("brew uninstall --cask zed", runner.Response{Stderr: "Error: in use", ExitCode: 1})
+	defer runner.Use(f)()
+	ledger.Add(ctx,
+		ledger.Entry{Kind: ledger.KindCask, Name: "zed", Label: "Zed"},
+		ledger.Entry{Kind: ledger.KindFormula, Name: "git", Label: "Git"},
+	)
+	entries, _ := ledger.Load()
+	if failed := Run(ctx, BuildUninstall(entries), 1, func(Event) {}); failed != 1 {
+		t.Fatalf("failed = %d, want 1", failed)
+	}
+	if left, _ := ledger.Load(); len(left) != 1 || left[0].Name != "zed" {
+		t.Errorf("ledger = %+v, want only the failed Zed", left)
+	}
+}
+
+func TestFilterEntries(t *testing.T) {
+	entries := []ledger.Entry{
+		{Kind: ledger.KindCask, Name: "zed", Label: "Zed"},
+		{Kind: ledger.KindClaudeMCP, Name: "Playwright"},
+		{Kind: ledger.KindDefault, Domain: "com.apple.finder", Name: "ShowPathbar"},
+	}
+	kept, unknown := FilterEntries(entries, []string{"zed", "finder", "Slack"})
+	if len(kept) != 2 || kept[0].Name != "zed" || kept[1].Kind != ledger.KindDefault {
+		t.Errorf("kept = %+v", kept)
+	}
+	if strings.Join(unknown, ",") != "Slack" {
+		t.Errorf("unknown = %v", unknown)
+	}
+	if kept, _ := FilterEntries(entries, nil); len(kept) != 3 {
+		t.Error("no names should keep everything")
+	}
+}
@@ -0,0 +1,161 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/kittors/freshbox/internal/config"
+	"github.com/kittors/freshbox/internal/installer"
+	"github.com/kittors/freshbox/internal/ledger"
+	"github.com/kittors/freshbox/internal/runner"
+	"github.com/kittors/freshbox/internal/setup"
+)
+
+// idFinderDefaults reverts every recorded defaults key in one task
+const idFinderDefaults = "uninstall:defaults"
+
+func uninstallID(e ledger.Entry) string { return "uninstall:" + e.Kind + ":" + e.Name }
+
+// BuildUninstall builds the tasks that remove entries from the ledger. MCP
+// servers are unregistered before the CLI they belong to is uninstalled;
+// each task forgets its entry once it succeeds.
+func BuildUninstall(entries []ledger.Entry) []Task {
+	var queue []Task
+	var defaults []ledger.Entry
+	// MCP servers need their CLI until they are removed
+	var claudeMCPs, codexMCPs []string
+
+	for _, e := range entries {
+		task := Task{ID: uninstallID(e), Timeout: setupTimeout}
+		switch e.Kind {
+		case ledger.KindFormula, ledger.KindCask:
+			name, isCask := e.Name, e.Kind == ledger.KindCask
+			task.Name = "Uninstall " + e.Title()
+			task.Fn = func(ctx context.Context) error { return installer.BrewUninstall(ctx, name, isCask) }
+			task.Lock = LockBrew
+			task.Timeout = brewTimeout
+			task.Commands = []string{runner.ShellJoin(installer.BrewUninstallArgs(name, isCask))}
+		case ledger.KindNpm:
+			pkg := e.Name
+			task.Name = "Uninstall " + e.Title()
+			task.Fn = func(ctx context.Context) error { return installer.NpmUninstall(ctx, pkg) }
+			task.Lock = LockNpm
+			task.Timeout = installTimeout
+			task.Commands = []string{runner.ShellJoin([]string{"npm", "uninstall", "-g", pkg})}
+		case ledger.KindClaudeMCP:
+			name := e.Name
+			task.Name = "Remove MCP server " + name + " from Claude Code"
+			task.Fn = func(ctx context.Context) error { return config.RemoveClaudeMCP(ctx, name) }
+			task.Lock = LockNpm
+			task.Commands = []string{runner.ShellJoin([]string{"claude", "mcp", "remove", "-s", "user", name})}
+			claudeMCPs = append(claudeMCPs, task.ID)
+		case ledger.KindCodexMCP:
+			name := e.Name
+			task.Name = "Remove MCP server " + name + " from Codex"
+			task.Fn = func(ctx context.Context) error { return config.RemoveCodexMCP(ctx, name) }
+			task.Lock = LockNpm
+			task.Commands = []string{runner.ShellJoin([]string{"codex", "mcp", "remove", name})}
+			task.Files = []string{"~/.codex/config.toml"}
+			codexMCPs = append(codexMCPs, task.ID)
+		case ledger.KindFile:
+			path := e.Name
+			task.Name = "Remove " + e.Title()
+			task.Fn = func(context.Context) error {
+				if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+				return nil
+			}
+			task.Commands = []string{runner.ShellJoin([]string{"rm", "-f", path})}
+			task.Files = []string{e.Title()}
+		case ledger.KindDefault:
+			defaults = append(defaults, e)
+			continue
+		default:
+			continue
+		}
+		entry := e
+		fn := task.Fn
+		task.Fn = func(ctx context.Context) error {
+			if err := fn(ctx); err != nil {
+				return err
+			}
+			return ledger.Remove(entry)
+		}
+		queue = append(queue, task)
+	}
+
+	// the CLIs go after their MCP servers
+	for i, task := range queue {
+		switch task.ID {
+		case uninstallID(ledger.Entry{Kind: ledger.KindNpm, Name: installer.ClaudeCodePackage}):
+			queue[i].Needs = claudeMCPs
+		case uninstallID(ledger.Entry{Kind: ledger.KindNpm, Name: installer.CodexPackage}):
+			queue[i].Needs = codexMCPs
+		}
+	}
+
+	if len(defaults) > 0 {
+		var cmds []string
+		for _, e := range defaults {
+			if len(e.Previous) == 0 {
+				cmds = append(cmds, runner.ShellJoin([]string{"defaults", "delete", e.Domain, e.Name}))
+			} else {
+				cmds = append(cmds, runner.ShellJoin(append([]string{"defaults", "write", e.Domain, e.Name}, e.Previous...)))
+			}
+		}
+		cmds = append(cmds, "killall Finder")
+		queue = append(queue, Task{
+			ID:   idFinderDefaults,
+			Name: "Revert Finder defaults",
+			Fn: func(ctx context.Context) error {
+				for _, e := range defaults {
+					if err := setup.RestoreDefault(ctx, e.Domain, e.Name, e.Previous); err != nil {
+						return err
+					}
+				}
+				runner.Run(ctx, "killall", "Finder")
+				return ledger.Remove(defaults...)
+			},
+			Timeout:  setupTimeout,
+			Commands: cmds,
+		})
+	}
+
+	ordered, err := Order(queue)
+	if err != nil {
+		panic("tasks: " + err.Error())
+	}
+	return ordered
+}
+
+// FilterEntries keeps the entries whose title, name or label matches one of
+// names ("finder" picks the Finder defaults); no names keeps everything.
+// Names that match nothing are returned in unknown.
+func FilterEntries(entries []ledger.Entry, names []string) (kept []ledger.Entry, unknown []string) {
+	if len(names) == 0 {
+		return entries, nil
+	}
+	matched := make([]bool, len(names))
+	for _, e := range entries {
+		hit := false
+		for i, n := range names {
+			if strings.EqualFold(e.Title(), n) || strings.EqualFold(e.Name, n) ||
+				(e.Kind == ledger.KindDefault && strings.EqualFold(n, "finder")) {
+				matched[i] = true
+				hit = true
+			}
+		}
+		if hit {
+			kept = append(kept, e)
+		}
+	}
+	for i, n := range names {
+		if !matched[i] {
+			unknown = append(unknown, n)
+		}
+	}
+	return kept, unknown
+}
@@ -0,0 +1,742 @@
+package tomledit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed TOML file that can be edited in place. Set and Delete
+// touch only the bytes of the values they change; comments, blank lines,
+// key order and formatting everywhere else come back byte-identical.
+type Document struct {
+	src     []byte
+	tables  []table
+	entries []entry
+	inlines []inline
+}
+
+// table is the root or a [header] and the lines up to the next header
+type table struct {
+	path      []string
+	array     bool // [[header]]; its keys are never edited
+	bodyStart int  // offset just past the header line
+}
+
+// entry is one key = value, possibly inside an inline table
+type entry struct {
+	path     []string // full path from the root
+	table    int      // index into tables
+	inline   int      // index into inlines, or -1 for a line of its own
+	line     int      // offset of the start of the line
+	key      int      // offset of the key
+	valStart int
+	valEnd   int
+	lineEnd  int // offset just past the newline ending the entry, or len(src)
+}
+
+// inline is an inline table value, { ... }
+type inline struct {
+	path  []string
+	table int
+	open  int // offset of '{'
+	close int // offset of '}'
+}
+
+// Parse reads a TOML document. It checks structure (keys, strings, arrays
+// and tables) rather than every rule of the spec.
+func Parse(data []byte) (*Document, error) {
+	d := &Document{src: slices.Clone(data)}
+	if err := d.parse(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Bytes returns the document, with any edits
+func (d *Document) Bytes() []byte {
+	return slices.Clone(d.src)
+}
+
+// Has reports whether path is a key or a table in the document
+func (d *Document) Has(path ...string) bool {
+	for _, t := range d.tables {
+		if hasPrefix(t.path, path) {
+			return true
+		}
+	}
+	for _, e := range d.entries {
+		if hasPrefix(e.path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys returns the names directly under path, from table headers and keys,
+// in the order they first appear
+func (d *Document) Keys(path ...string) []string {
+	var keys []string
+	add := func(p []string) {
+		if len(p) > len(path) && hasPrefix(p, path) && !slices.Contains(keys, p[len(path)]) {
+			keys = append(keys, p[len(path)])
+		}
+	}
+	type found struct {
+		at   int
+		path []string
+	}
+	var all []found
+	for _, t := range d.tables {
+		all = append(all, found{t.bodyStart, t.path})
+	}
+	for _, e := range d.entries {
+		all = append(all, found{e.key, e.path})
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].at < all[j].at })
+	for _, f := range all {
+		add(f.path)
+	}
+	return keys
+}
+
+// String returns the value at path if it is a string
+func (d *Document) String(path ...string) (string, bool) {
+	e, ok := d.find(path)
+	if !ok {
+		return "", false
+	}
+	v := d.src[e.valStart:e.valEnd]
+	if v[0] != '"' && v[0] != '\'' || bytes.HasPrefix(v, []byte(`"""`)) || bytes.HasPrefix(v, []byte(`'''`)) {
+		return "", false // not a one-line string
+	}
+	p := &parser{src: d.src, pos: e.valStart}
+	s, err := p.simpleKey()
+	return s, err == nil
+}
+
+// Set gives the key at path a value: a string, bool, int, []string or
+// map[string]string (written as an inline table). An existing value is
+// replaced where it stands, keeping any comment after it. A new key goes
+// after the last key of its table; a new table goes after its siblings, or
+// at the end.
+func (d *Document) Set(path []string, value any) error {
+	if len(path) == 0 {
+		return errors.New("tomledit: empty path")
+	}
+	text, err := format(value)
+	if err != nil {
+		return fmt.Errorf("tomledit: %s: %w", strings.Join(path, "."), err)
+	}
+	if e, ok := d.find(path); ok {
+		return d.splice(e.valStart, e.valEnd, text)
+	}
+	parent, key := path[:len(path)-1], path[len(path)-1]
+
+	// an inline table: add to its braces
+	for _, in := range d.inlines {
+		if slices.Equal(in.path, parent) && !d.tables[in.table].array {
+			members := d.members(in)
+			if len(members) == 0 {
+				return d.splice(in.open+1, in.close, " "+formatKey([]string{key})+" = "+text+" ")
+			}
+			last := members[len(members)-1]
+			return d.splice(last.valEnd, last.valEnd, ", "+formatKey([]string{key})+" = "+text)
+		}
+	}
+	for _, e := range d.entries {
+		if hasPrefix(path, e.path) && !d.tables[e.table].array {
+			return fmt.Errorf("tomledit: %s is not a table", formatKey(e.path))
+		}
+	}
+
+	// a [table] with that path
+	for i, t := range d.tables {
+		if !t.array && slices.Equal(t.path, parent) {
+			return d.insertLine(d.tableEnd(i, nil), formatKey([]string{key})+" = "+text)
+		}
+	}
+
+	// a table defined by dotted keys, e.g. a.b = 1 defines a
+	for i, t := range d.tables {
+		if t.array || !hasPrefix(parent, t.path) {
+			continue
+		}
+		if d.definedIn(i, parent) {
+			return d.insertLine(d.tableEnd(i, parent), formatKey(path[len(t.path):])+" = "+text)
+		}
+	}
+
+	// a new [table], after the last table sharing the longest prefix
+	text = "[" + formatKey(parent) + "]\n" + formatKey([]string{key}) + " = " + text
+	best, bestLen := -1, 0
+	for i, t := range d.tables {
+		if n := commonPrefix(t.path, parent); i > 0 && n > 0 && n >= bestLen {
+			best, bestLen = i, n
+		}
+	}
+	if best < 0 {
+		return d.appendTable(text)
+	}
+	at := d.tableEnd(best, nil)
+	if at > 0 && d.src[at-1] != '\n' {
+		text = "\n" + text
+	}
+	return d.splice(at, at, "\n"+text+"\n")
+}
+
+// Delete removes the key at path, with its line and any comment after it.
+// It reports whether the key was there.
+func (d *Document) Delete(path ...string) bool {
+	e, ok := d.find(path)
+	if !ok {
+		return false
+	}
+	if e.inline < 0 {
+		d.splice(e.line, e.lineEnd, "")
+		return true
+	}
+	members := d.members(d.inlines[e.inline])
+	i := slices.IndexFunc(members, func(m entry) bool { return m.key == e.key })
+	switch {
+	case len(members) == 1:
+		d.splice(e.key, e.valEnd, "")
+	case i < len(members)-1:
+		d.splice(e.key, members[i+1].key, "")
+	default:
+		prev := members[i-1]
+		d.splice(prev.valEnd, e.valEnd, "")
+	}
+	return true
+}
+
+// find returns the entry at exactly path, outside array tables
+func (d *Document) find(path []string) (entry, bool) {
+	for _, e := range d.entries {
+		if slices.Equal(e.path, path) && !d.tables[e.table].array {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+// members returns the entries directly inside an inline table
+func (d *Document) members(in inline) []entry {
+	var out []entry
+	for _, e := range d.entries {
+		if e.inline >= 0 && d.inlines[e.inline].open == in.open {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// definedIn reports whether table i has a dotted key defining path
+func (d *Document) definedIn(i int, path []string) bool {
+	for _, e := range d.entries {
+		if e.table == i && e.inline < 0 && len(e.path) > len(path) && hasPrefix(e.path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableEnd returns where a new line goes in table i: after its last key (the
+// last one under within, if given), or just past its header
+func (d *Document) tableEnd(i int, within []string) int {
+	at := d.tables[i].bodyStart
+	for _, e := range d.entries {
+		if e.table == i && e.inline < 0 && (within == nil || hasPrefix(e.path, within)) {
+			at = max(at, e.lineEnd)
+		}
+	}
+	return at
+}
+
+// insertLine puts line at offset at, which starts a line or ends the file
+func (d *Document) insertLine(at int, line string) error {
+	if at > 0 && d.src[at-1] != '\n' {
+		line = "\n" + line
+	}
+	// a first root key in front of a table gets a blank line after it
+	if at == 0 && len(d.src) > 0 && d.src[0] == '[' {
+		line += "\n"
+	}
+	return d.splice(at, at, line+"\n")
+}
+
+// appendTable adds text as a table at the end, after a blank line
+func (d *Document) appendTable(text string) error {
+	var b strings.Builder
+	if n := len(d.src); n > 0 {
+		if d.src[n-1] != '\n' {
+			b.WriteByte('\n')
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteString(text + "\n")
+	return d.splice(len(d.src), len(d.src), b.String())
+}
+
+// splice replaces src[start:end] with text and parses the result again
+func (d *Document) splice(start, end int, text string) error {
+	src := slices.Concat(d.src[:start:start], []byte(text), d.src[end:])
+	next := &Document{src: src}
+	if err := next.parse(); err != nil {
+		return fmt.Errorf("tomledit: edit produced invalid TOML: %w", err)
+	}
+	*d = *next
+	return nil
+}
+
+func hasPrefix(path, prefix []string) bool {
+	return len(path) >= len(prefix) && slices.Equal(path[:len(prefix)], prefix)
+}
+
+func commonPrefix(a, b []string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// formatKey writes a dotted key, quoting the parts that aren't bare keys
+func formatKey(path []string) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = p
+		if p == "" || strings.IndexFunc(p, func(r rune) bool { return !isBare(r) }) >= 0 {
+			parts[i] = quote(p)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func isBare(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-'
+}
+
+// format writes a Go value as a TOML value
+func format(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return quote(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case []string:
+		parts := make([]string, len(v))
+		for i, s := range v {
+			parts[i] = quote(s)
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case map[string]string:
+		if len(v) == 0 {
+			return "{}", nil
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, k := range keys {
+			parts[i] = formatKey([]string{k}) + " = " + quote(v[k])
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	}
+	return "", fmt.Errorf("unsupported value type %T", v)
+}
+
+// quote writes a TOML basic string
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// --- parser ---
+
+type parser struct {
+	src []byte
+	pos int
+}
+
+func (d *Document) parse() error {
+	p := &parser{src: d.src}
+	d.tables = []table{{}}
+	cur := 0
+	for {
+		p.skipSpace(true)
+		if p.eof() {
+			return nil
+		}
+		line := bytes.LastIndexByte(d.src[:p.pos], '\n') + 1
+		if d.src[p.pos] == '[' {
+			array := p.peek(1) == '['
+			p.pos++
+			if array {
+				p.pos++
+			}
+			path, err := p.key()
+			if err != nil {
+				return err
+			}
+			if !p.consume("]") || array && !p.consume("]") {
+				return p.errorf("expected ] after table name")
+			}
+			if err := p.endLine(); err != nil {
+				return err
+			}
+			d.tables = append(d.tables, table{path: path, array: array, bodyStart: p.pos})
+			cur = len(d.tables) - 1
+			continue
+		}
+
+		idx, err := d.keyValue(p, cur, -1, d.tables[cur].path, line)
+		if err != nil {
+			return err
+		}
+		if err := p.endLine(); err != nil {
+			return err
+		}
+		d.entries[idx].lineEnd = p.pos
+	}
+}
+
+// keyValue parses key = value, recording it under base, and returns its
+// index in entries
+func (d *Document) keyValue(p *parser, tbl, in int, base []string, line int) (int, error) {
+	start := p.pos
+	rel, err := p.key()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace(false)
+	if !p.consume("=") {
+		return 0, p.errorf("expected = after key")
+	}
+	p.skipSpace(false)
+	path := slices.Concat(base, rel)
+	e := entry{path: path, table: tbl, inline: in, line: line, key: start, valStart: p.pos}
+	d.entries = append(d.entries, e)
+	idx := len(d.entries) - 1
+	if err := d.value(p, tbl, path, true); err != nil {
+		return 0, err
+	}
+	d.entries[idx].valEnd = p.pos
+	return idx, nil
+}
+
+// value parses any value; record keeps the keys of inline tables
+func (d *Document) value(p *parser, tbl int, path []string, record bool) error {
+	if p.eof() {
+		return p.errorf("expected a value")
+	}
+	switch c := p.src[p.pos]; {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		p.pos++
+		for {
+			p.skipSpace(true)
+			if p.consume("]") {
+				return nil
+			}
+			if err := d.value(p, tbl, nil, false); err != nil {
+				return err
+			}
+			p.skipSpace(true)
+			if !p.consume(",") {
+				p.skipSpace(true)
+				if !p.consume("]") {
+					return p.errorf("expected , or ] in array")
+				}
+				return nil
+			}
+		}
+	case c == '{':
+		in := len(d.inlines)
+		if record {
+			d.inlines = append(d.inlines, inline{path: path, table: tbl, open: p.pos})
+		}
+		p.pos++
+		for {
+			p.skipSpace(true)
+			if p.consume("}") {
+				break
+			}
+			if record {
+				if _, err := d.keyValue(p, tbl, in, path, p.pos); err != nil {
+					return err
+				}
+			} else {
+				if _, err := p.key(); err != nil {
+					return err
+				}
+				p.skipSpace(false)
+				if !p.consume("=") {
+					return p.errorf("expected = after key")
+				}
+				p.skipSpace(false)
+				if err := d.value(p, tbl, nil, false); err != nil {
+					return err
+				}
+			}
+			p.skipSpace(true)
+			if !p.consume(",") {
+				p.skipSpace(true)
+				if !p.consume("}") {
+					return p.errorf("expected , or } in inline table")
+				}
+				break
+			}
+		}
+		if record {
+			d.inlines[in].close = p.pos - 1
+		}
+		return nil
+	default:
+		start := p.pos
+		for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.src[p.pos])) {
+			p.pos++
+		}
+		if p.pos == start {
+			return p.errorf("expected a value")
+		}
+		return nil
+	}
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek(n int) byte {
+	if p.pos+n < len(p.src) {
+		return p.src[p.pos+n]
+	}
+	return 0
+}
+
+func (p *parser) consume(s string) bool {
+	if bytes.HasPrefix(p.src[p.pos:], []byte(s)) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	line := bytes.Count(p.src[:min(p.pos, len(p.src))], []byte("\n")) + 1
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips blanks and comments, and newlines too if newlines is set
+func (p *parser) skipSpace(newlines bool) {
+	for !p.eof() {
+		switch p.src[p.pos] {
+		case ' ', '\t':
+			p.pos++
+		case '\r', '\n':
+			if !newlines {
+				return
+			}
+			p.pos++
+		case '#':
+			if !newlines {
+				return
+			}
+			for !p.eof() && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endLine allows a comment, then expects the end of the line
+func (p *parser) endLine() error {
+	p.skipSpace(false)
+	if !p.eof() && p.src[p.pos] == '#' {
+		for !p.eof() && p.src[p.pos] != '\n' {
+			p.pos++
+		}
+	}
+	p.consume("\r")
+	if p.eof() || p.consume("\n") {
+		return nil
+	}
+	return p.errorf("expected the end of the line")
+}
+
+// key parses a possibly dotted key
+func (p *parser) key() ([]string, error) {
+	var path []string
+	for {
+		p.skipSpace(false)
+		part, err := p.simpleKey()
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, part)
+		p.skipSpace(false)
+		if !p.consume(".") {
+			return path, nil
+		}
+	}
+}
+
+func (p *parser) simpleKey() (string, error) {
+	if p.eof() {
+		return "", p.errorf("expected a key")
+	}
+	switch p.src[p.pos] {
+	case '"':
+		start := p.pos
+		if err := p.str(); err != nil {
+			return "", err
+		}
+		return unescape(string(p.src[start+1 : p.pos-1]))
+	case '\'':
+		start := p.pos
+		if err := p.str(); err != nil {
+			return "", err
+		}
+		return string(p.src[start+1 : p.pos-1]), nil
+	}
+	start := p.pos
+	for !p.eof() {
+		r, _ := utf8.DecodeRune(p.src[p.pos:])
+		if !isBare(r) {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expected a key")
+	}
+	return string(p.src[start:p.pos]), nil
+}
+
+// str skips a basic, literal or multi-line string
+func (p *parser) str() error {
+	q := p.src[p.pos]
+	triple := string([]byte{q, q, q})
+	if p.consume(triple) {
+		for !p.eof() {
+			if q == '"' && p.src[p.pos] == '\\' {
+				p.pos += 2
+				continue
+			}
+			if p.consume(triple) {
+				// up to two more quotes belong to the content
+				for i := 0; i < 2 && !p.eof() && p.src[p.pos] == q; i++ {
+					p.pos++
+				}
+				return nil
+			}
+			p.pos++
+		}
+		return p.errorf("unterminated multi-line string")
+	}
+	p.pos++
+	for !p.eof() {
+		switch c := p.src[p.pos]; {
+		case c == '\\' && q == '"':
+			p.pos += 2
+		case c == q:
+			p.pos++
+			return nil
+		case c == '\n':
+			return p.errorf("newline in string")
+		default:
+			p.pos++
+		}
+	}
+	return p.errorf("unterminated string")
+}
+
+// unescape decodes the escapes of a basic string
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return "", errors.New("bad escape at end of string")
+		}
+		switch s[i] {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'f':
+			b.WriteByte('\f')
+		case 'r':
+			b.WriteByte('\r')
+		case '"':
+			b.WriteByte('"')
+		case '\\':
+			b.WriteByte('\\')
+		case 'u', 'U':
+			n := 4
+			if s[i] == 'U' {
+				n = 8
+			}
+			if i+n >= len(s) {
+				return "", fmt.Errorf("short \\%c escape", s[i])
+			}
+			code, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("bad \\%c escape", s[i])
+			}
+			b.WriteRune(rune(code))
+			i += n
+		default:
+			return "", fmt.Errorf("bad escape \\%c", s[i])
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,206 @@
+package tomledit
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func mustParse(t *testing.T, src string) *Document {
+	t.Helper()
+	d, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Parse: %v\n%s", err, src)
+	}
+	return d
+}
+
+// decode checks the document is valid TOML for a real parser
+func decode(t *testing.T, d *Document) map[string]any {
+	t.Helper()
+	var v map[string]any
+	if _, err := toml.Decode(string(d.Bytes()), &v); err != nil {
+		t.Fatalf("edited document is invalid: %v\n%s", err, d.Bytes())
+	}
+	return v
+}
+
+func TestUntouchedIsByteIdentical(t *testing.T) {
+	src := "# top comment\r\nmodel = \"o3\"   # trailing\n\n\n" +
+		"a.b.c = 1\n" +
+		"s = '''\nmulti [not a table]\nline'''\n" +
+		"t = \"\"\"\nquote \\\"\"\" inside\"\"\"\n" +
+		"arr = [\n  1, # one\n  2,\n]\n" +
+		"[ mcp_servers . \"name with space\" ] # header comment\n" +
+		"env = { KEY = \"v\", nested = { x = [1, {y = 2}] } }\n" +
+		"[[profiles]]\nname = 'x'\n"
+	d := mustParse(t, src)
+	decode(t, d)
+	if got := string(d.Bytes()); got != src {
+		t.Errorf("round trip changed the document:\n%q\nwant\n%q", got, src)
+	}
+}
+
+func TestSet(t *testing.T) {
+	cases := []struct {
+		name  string
+		src   string
+		path  []string
+		value any
+		want  string
+	}{
+		{
+			"replace keeps comment",
+			"model = \"o3\" # pinned\n\n[x]\nmodel = \"y\"\n",
+			[]string{"model"}, "gpt-5",
+			"model = \"gpt-5\" # pinned\n\n[x]\nmodel = \"y\"\n",
+		},
+		{
+			"new top-level key after the last one",
+			"# mine\nmodel = \"o3\"\n\n\n[tui]\nx = 1\n",
+			[]string{"model_reasoning_effort"}, "high",
+			"# mine\nmodel = \"o3\"\nmodel_reasoning_effort = \"high\"\n\n\n[tui]\nx = 1\n",
+		},
+		{
+			"first top-level key before a table",
+			"[tui]\nx = 1\n",
+			[]string{"model"}, "o3",
+			"model = \"o3\"\n\n[tui]\nx = 1\n",
+		},
+		{
+			"into an existing table",
+			"[model_providers.gw]\nname = \"gw\" # keep\n\n# about the next one\n[other]\n",
+			[]string{"model_providers", "gw", "base_url"}, "https://gw/v1",
+			"[model_providers.gw]\nname = \"gw\" # keep\nbase_url = \"https://gw/v1\"\n\n# about the next one\n[other]\n",
+		},
+		{
+			"quoted table name",
+			"[mcp_servers.\"name with space\"]\ncommand = \"npx\"\n",
+			[]string{"mcp_servers", "name with space", "startup_timeout_sec"}, 60,
+			"[mcp_servers.\"name with space\"]\ncommand = \"npx\"\nstartup_timeout_sec = 60\n",
+		},
+		{
+			"table defined by dotted keys",
+			"model_providers.gw.name = \"gw\"\nmodel = \"o3\"\n",
+			[]string{"model_providers", "gw", "base_url"}, "https://gw/v1",
+			"model_providers.gw.name = \"gw\"\nmodel_providers.gw.base_url = \"https://gw/v1\"\nmodel = \"o3\"\n",
+		},
+		{
+			"dotted key value",
+			"[mcp_servers]\nfoo.command = \"npx\"\n",
+			[]string{"mcp_servers", "foo", "command"}, "uvx",
+			"[mcp_servers]\nfoo.command = \"uvx\"\n",
+		},
+		{
+			"inline table",
+			"[mcp_servers.x]\nenv = { A = \"1\" }\n",
+			[]string{"mcp_servers", "x", "env", "B"}, "2",
+			"[mcp_servers.x]\nenv = { A = \"1\", B = \"2\" }\n",
+		},
+		{
+			"empty inline table",
+			"env = {}\n",
+			[]string{"env", "B"}, "2",
+			"env = { B = \"2\" }\n",
+		},
+		{
+			"new table goes after its siblings",
+			"[mcp_servers.a]\ncommand = \"a\"\n\n[mcp_servers.a.env]\nK = \"v\"\n\n[tui]\nx = 1\n",
+			[]string{"mcp_servers", "b", "command"}, "b",
+			"[mcp_servers.a]\ncommand = \"a\"\n\n[mcp_servers.a.env]\nK = \"v\"\n\n[mcp_servers.b]\ncommand = \"b\"\n\n[tui]\nx = 1\n",
+		},
+		{
+			"new table at the end",
+			"model = \"o3\"",
+			[]string{"model_providers", "my gw", "name"}, "gw",
+			"model = \"o3\"\n\n[model_providers.\"my gw\"]\nname = \"gw\"\n",
+		},
+		{
+			"multi-line string isn't mistaken for a table",
+			"instructions = \"\"\"\n[mcp_servers.fake]\n\"\"\"\n",
+			[]string{"mcp_servers", "real", "command"}, "npx",
+			"instructions = \"\"\"\n[mcp_servers.fake]\n\"\"\"\n\n[mcp_servers.real]\ncommand = \"npx\"\n",
+		},
+		{
+			"array of tables is left alone",
+			"[[mcp_servers.x]]\nmodel = \"a\"\n",
+			[]string{"model"}, "b",
+			"model = \"b\"\n\n[[mcp_servers.x]]\nmodel = \"a\"\n",
+		},
+		{
+			"values",
+			"",
+			[]string{"args"}, []string{"-y", `a "b"`, "c\\d"},
+			"args = [\"-y\", \"a \\\"b\\\"\", \"c\\\\d\"]\n",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := mustParse(t, tc.src)
+			if err := d.Set(tc.path, tc.value); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(d.Bytes()); got != tc.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tc.want)
+			}
+			decode(t, d)
+		})
+	}
+}
+
+func TestSetScalarParentFails(t *testing.T) {
+	d := mustParse(t, "model = \"o3\"\n")
+	if err := d.Set([]string{"model", "x"}, "y"); err == nil || !strings.Contains(err.Error(), "model is not a table") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	d := mustParse(t, "[p]\nname = \"a\"\nrequires_openai_auth = true # old\nwire_api = \"responses\"\nenv = { A = \"1\", B = \"2\", C = \"3\" }\n")
+	if !d.Delete("p", "requires_openai_auth") || d.Delete("p", "nope") {
+		t.Error("Delete reported the wrong result")
+	}
+	d.Delete("p", "env", "B")
+	d.Delete("p", "env", "C")
+	want := "[p]\nname = \"a\"\nwire_api = \"responses\"\nenv = { A = \"1\" }\n"
+	if got := string(d.Bytes()); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	decode(t, d)
+}
+
+func TestKeysAndString(t *testing.T) {
+	d := mustParse(t, "mcp_servers.dotted.command = 'npx'\n[mcp_servers.a]\ncommand = \"np\\u0078\"\n[mcp_servers.\"b c\".env]\nK = 1\n[mcp_servers.a.env]\n")
+	if got := d.Keys("mcp_servers"); !slices.Equal(got, []string{"dotted", "a", "b c"}) {
+		t.Errorf("Keys = %q", got)
+	}
+	if s, ok := d.String("mcp_servers", "a", "command"); !ok || s != "npx" {
+		t.Errorf("String = %q, %v", s, ok)
+	}
+	if s, ok := d.String("mcp_servers", "dotted", "command"); !ok || s != "npx" {
+		t.Errorf("literal String = %q, %v", s, ok)
+	}
+	if _, ok := d.String("mcp_servers", "b c", "env", "K"); ok {
+		t.Error("an integer isn't a string")
+	}
+	if !d.Has("mcp_servers", "b c") || d.Has("mcp_servers", "d") {
+		t.Error("Has is wrong")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"model = \"unterminated\n",
+		"model \"o3\"\n",
+		"[table\n",
+		"a = [1, 2\n",
+		"a = 1 b = 2\n",
+		"s = '''never closed\n",
+	} {
+		if _, err := Parse([]byte(src)); err == nil {
+			t.Errorf("Parse(%q) should fail", src)
+		}
+	}
+}
@@ -16,11 +16,14 @@ type T struct {
 	PageApps        string
 	PageNodeVer     string
 	PageAITools     string
+	PageAIProfile   string
 	PageCodexCfg    string
 	PageClaudeCfg   string
 	PageMCP         string
+	PageMCPEnv      string
 	PageExtraSetup  string
 	PageSysDefaults string
+	PageReview      string
 	PageInstalling  string
 	PageDone        string
 
@@ -35,6 +38,7 @@ type T struct {
 	WelcomeSys      string
 	WelcomeStart    string
 	WelcomeQuit     string
+	WelcomeUninstall string
 
 	// Language selection
 	LangTitle       string
@@ -43,12 +47,29 @@ type T struct {
 	// Section titles
 	TitleDevTools   string
 	TitleApps       string
+	NeedsUpgrade    string // %s: the minimum version
+	Detecting       string
 	TitleAITools    string
 	TitleFnmVer     string
 	TitleMCP        string
 	TitleMCPDesc    string
+	TitleMCPEnv     string
+	TitleMCPEnvDesc string
+	MCPEnvRequired  string
+	MCPEnvMissing   string
+	AddMCP          string
+	TitleAddMCP     string
+	TitleAddMCPDesc string
+	AddMCPName      string
+	AddMCPURL       string
+	AddMCPTransport string
+	AddMCPToken     string
+	AddMCPExists    string // %s: server name
 	TitleSysDefault string
+	TitleReview     string
+	TitleUninstall  string
 	TitleInstalling string
+	TitleUninstalling string
 	TitleDone       string
 
 	// Extra setup
@@ -68,6 +89,16 @@ type T struct {
 	CfgThinkLevel   string
 	CfgBaseURL      string
 	CfgAPIKey       string
+	CfgKeyStored    string
+	CfgKeyPlain     string
+	CfgVerifying    string
+	CfgVerifyFailed string
+
+	// AI provider profiles
+	TitleAIProfile  string
+	AIProfileDesc   string
+	AIProfileManual string
+	AIProfileActive string // %s: the tools it is active for
 
 	// System defaults
 	DefBrowser      string
@@ -81,6 +112,16 @@ type T struct {
 	FnmHint         string
 	FnmLTSHint      string
 
+	// Review
+	ReviewDesc      string
+	ReviewEmpty     string
+
+	// Resume
+	ResumeFound     string
+	ResumeLeft      string
+	ResumeKeys      string
+	ResumeNeedsKey  string
+
 	// Install
 	InstallPrepare  string
 
@@ -88,10 +129,29 @@ type T struct {
 	DoneMsg         string
 	DoneReady       string
 	DoneExit        string
+	DoneExportHint  string
+	DoneExported    string
+	DoneExportFail  string
+	DoneRetry       string
+	DoneUninstalled string
+	InstallStopping string
+	InstallAborting string
+	InstallRunning  string
+	UninstallRunning string
+	InstallNextUp   string
+	OutputTitle     string
+	OutputEmpty     string
+	OutputEarlier   string // %d: lines scrolled out of the pane
 
 	// Footer
 	FooterNav       string
 	FooterForm      string
+	FooterAddMCP    string
+	FooterReview    string
+	FooterUninstall string
+	FooterDone      string
+	FooterDetecting string // %d: items left to detect
+	FooterInstalling string
 }
 
 var texts = map[Lang]T{
@@ -101,10 +161,13 @@ var texts = map[Lang]T{
 		PageApps:        "Apps",
 		PageNodeVer:     "Node.js Versions",
 		PageAITools:     "AI Tools",
+		PageAIProfile:   "AI Provider",
 		PageCodexCfg:    "Codex Config",
 		PageClaudeCfg:   "Claude Config",
 		PageMCP:         "MCP Servers",
+		PageMCPEnv:      "MCP Credentials",
 		PageSysDefaults: "System Defaults",
+		PageReview:      "Review",
 		PageInstalling:  "Installing...",
 		PageDone:        "Done!",
 
@@ -118,18 +181,36 @@ var texts = map[Lang]T{
 		WelcomeSys:      "System defaults + Zed theme, Kaku setup, dev workspace",
 		WelcomeStart:    "Press Enter to get started",
 		WelcomeQuit:     "q to quit",
+		WelcomeUninstall: "u to remove the %d items freshbox added",
 
 		LangTitle:       "Language / 语言",
 		LangPrompt:      "Select your language / 选择语言",
 
 		TitleDevTools:   "Development Tools",
 		TitleApps:       "Applications",
+		NeedsUpgrade:    "needs upgrade to ≥ %s",
+		Detecting:       "detecting…",
 		TitleAITools:    "AI Tools",
 		TitleFnmVer:     "Select Node.js Versions to Install",
 		TitleMCP:        "MCP Servers",
 		TitleMCPDesc:    "Select MCP servers to configure for your AI tools",
+		TitleMCPEnv:     "MCP Server Credentials",
+		TitleMCPEnvDesc: "These servers won't work without the values below; they are passed to claude mcp add -e and Codex's env table",
+		MCPEnvRequired:  "required",
+		MCPEnvMissing:   "Fill in the fields marked ✗, or go back and deselect their servers",
+		AddMCP:          "Add a remote server by URL",
+		TitleAddMCP:     "Add a Remote MCP Server",
+		TitleAddMCPDesc: "Saved to ~/.freshbox/catalog.toml; the token is passed as an Authorization: Bearer header and isn't saved there",
+		AddMCPName:      "Name",
+		AddMCPURL:       "URL",
+		AddMCPTransport: "Transport",
+		AddMCPToken:     "Bearer token (optional)",
+		AddMCPExists:    "There is already an MCP server called %q",
 		TitleSysDefault: "System Defaults",
+		TitleReview:     "Review Install Plan",
+		TitleUninstall:  "Review Uninstall Plan",
 		TitleInstalling: "Installing...",
+		TitleUninstalling: "Uninstalling...",
 		TitleDone:       "All done!",
 
 		TitleExtraSetup:       "Extra Setup",
@@ -149,6 +230,15 @@ var texts = map[Lang]T{
 		CfgThinkLevel:   "Thinking Level",
 		CfgBaseURL:      "Base URL",
 		CfgAPIKey:       "API Key",
+		CfgKeyStored:    "🔒 The key is kept in %s, not in the config file (ctrl+p: write it in plaintext)",
+		CfgKeyPlain:     "⚠ The key will be written in plaintext to the config file (ctrl+p: keep it in %s)",
+		CfgVerifying:    "Checking the endpoint…",
+		CfgVerifyFailed: "Fix the fields marked ✗, or press enter again to keep them",
+
+		TitleAIProfile:  "AI Provider Profile",
+		AIProfileDesc:   "Switch Codex and Claude Code to a saved profile, or type the settings in",
+		AIProfileManual: "Enter settings on the next pages",
+		AIProfileActive: "active for %s",
 
 		DefBrowser:      "Default Browser → Google Chrome",
 		DefBrowserDesc:  "Set Chrome as system default browser",
@@ -160,14 +250,41 @@ var texts = map[Lang]T{
 		FnmHint:         "fnm will be installed first, then you can select Node versions.",
 		FnmLTSHint:      "Showing common LTS versions:",
 
+		ReviewDesc:      "Nothing runs until you press Enter. Commands ($) and files (✎) per task:",
+		ReviewEmpty:     "Nothing selected — press Enter to finish.",
+
+		ResumeFound:     "Unfinished install from",
+		ResumeLeft:      "tasks left",
+		ResumeKeys:      "r resume • f rerun everything • x discard",
+		ResumeNeedsKey:  "not resumed — its API key isn't saved (set $FRESHBOX_CODEX_API_KEY / $FRESHBOX_CLAUDE_API_KEY)",
+
 		InstallPrepare:  "Preparing installation...",
 
 		DoneMsg:         "Your Mac is set up and ready to go.",
 		DoneReady:       "All done!",
 		DoneExit:        "Press Enter or q to exit.",
+		DoneExportHint:  "Press e to export these choices as a profile (Freshfile.toml).",
+		DoneExported:    "Profile exported to",
+		DoneExportFail:  "Profile export failed",
+		DoneRetry:       "Failed tasks — space to select, r to retry the selected ones:",
+		DoneUninstalled: "What freshbox added has been removed; everything else is untouched.",
+		InstallStopping: "Cancelling: waiting for the running tasks to finish…",
+		InstallAborting: "Aborting: killing the running commands… (ctrl+c again to quit)",
+		InstallRunning:  "Installing",
+		UninstallRunning: "Uninstalling",
+		InstallNextUp:   "Next up:",
+		OutputTitle:     "Output",
+		OutputEmpty:     "(no output yet)",
+		OutputEarlier:   "... %d earlier lines in ~/.freshbox/install.log",
 
 		FooterNav:       "↑/↓ navigate • space toggle • a all • n none • tab next • shift+tab back • q quit",
-		FooterForm:      "↑/↓ navigate fields • tab next field • enter confirm • shift+tab back",
+		FooterForm:      "↑/↓ navigate fields • tab next field • enter confirm • ctrl+p plaintext key • shift+tab back",
+		FooterAddMCP:    "↑/↓ navigate fields • tab next field • enter on the last field add • esc cancel",
+		FooterReview:    "↑/↓ scroll • enter start install • shift+tab back • q back",
+		FooterUninstall: "↑/↓ scroll • enter remove these • shift+tab back • q back",
+		FooterDone:      "↑/↓ navigate • space toggle • a all • n none • o output • r retry selected • e export • enter/q exit",
+		FooterDetecting: "Detecting installed tools… %d left",
+		FooterInstalling: "↑/↓ pick task • o show output • c cancel after the running tasks • ctrl+c abort now (kills running commands)",
 	},
 	LangZH: {
 		PageWelcome:     "欢迎",
@@ -175,10 +292,13 @@ var texts = map[Lang]T{
 		PageApps:        "应用程序",
 		PageNodeVer:     "Node.js 版本",
 		PageAITools:     "AI 工具",
+		PageAIProfile:   "AI 服务商",
 		PageCodexCfg:    "Codex 配置",
 		PageClaudeCfg:   "Claude 配置",
 		PageMCP:         "MCP 服务",
+		PageMCPEnv:      "MCP 凭据",
 		PageSysDefaults: "系统默认",
+		PageReview:      "确认计划",
 		PageInstalling:  "安装中...",
 		PageDone:        "完成！",
 
@@ -192,18 +312,36 @@ var texts = map[Lang]T{
 		WelcomeSys:      "系统默认设置 + Zed 主题、Kaku 配置、开发工作区",
 		WelcomeStart:    "按 Enter 开始",
 		WelcomeQuit:     "q 退出",
+		WelcomeUninstall: "u 移除 freshbox 添加的 %d 项内容",
 
 		LangTitle:       "Language / 语言",
 		LangPrompt:      "Select your language / 选择语言",
 
 		TitleDevTools:   "开发工具",
 		TitleApps:       "应用程序",
+		NeedsUpgrade:    "需要升级到 ≥ %s",
+		Detecting:       "检测中…",
 		TitleAITools:    "AI 工具",
 		TitleFnmVer:     "选择要安装的 Node.js 版本",
 		TitleMCP:        "MCP 服务",
 		TitleMCPDesc:    "选择要为 AI 工具配置的 MCP 服务",
+		TitleMCPEnv:     "MCP 服务凭据",
+		TitleMCPEnvDesc: "以下服务需要这些值才能工作，会通过 claude mcp add -e 和 Codex 的 env 表传入",
+		MCPEnvRequired:  "必填",
+		MCPEnvMissing:   "请填写标记 ✗ 的字段，或返回取消选择对应服务",
+		AddMCP:          "通过 URL 添加远程服务",
+		TitleAddMCP:     "添加远程 MCP 服务",
+		TitleAddMCPDesc: "保存到 ~/.freshbox/catalog.toml；令牌以 Authorization: Bearer 请求头传入，不会写入该文件",
+		AddMCPName:      "名称",
+		AddMCPURL:       "URL",
+		AddMCPTransport: "传输方式",
+		AddMCPToken:     "Bearer 令牌（可选）",
+		AddMCPExists:    "已存在名为 %q 的 MCP 服务",
 		TitleSysDefault: "系统默认设置",
+		TitleReview:     "确认安装计划",
+		TitleUninstall:  "确认卸载计划",
 		TitleInstalling: "安装中...",
+		TitleUninstalling: "卸载中...",
 		TitleDone:       "全部完成！",
 
 		TitleExtraSetup:       "额外配置",
@@ -223,6 +361,15 @@ var texts = map[Lang]T{
 		CfgThinkLevel:   "思考级别",
 		CfgBaseURL:      "接口地址",
 		CfgAPIKey:       "API 密钥",
+		CfgKeyStored:    "🔒 密钥保存在 %s，不写入配置文件（ctrl+p：改为明文写入）",
+		CfgKeyPlain:     "⚠ 密钥将以明文写入配置文件（ctrl+p：改为保存在 %s）",
+		CfgVerifying:    "正在检查服务端点…",
+		CfgVerifyFailed: "请修改标记 ✗ 的字段，或再按一次 enter 保留当前设置",
+
+		TitleAIProfile:  "AI 服务商配置",
+		AIProfileDesc:   "将 Codex 和 Claude Code 切换到已保存的配置，或手动填写",
+		AIProfileManual: "在接下来的页面中手动填写",
+		AIProfileActive: "%s 正在使用",
 
 		DefBrowser:      "默认浏览器 → Google Chrome",
 		DefBrowserDesc:  "将 Chrome 设为系统默认浏览器",
@@ -234,14 +381,41 @@ var texts = map[Lang]T{
 		FnmHint:         "fnm 将先被安装，之后你可以选择 Node 版本。",
 		FnmLTSHint:      "显示常用 LTS 版本：",
 
+		ReviewDesc:      "按 Enter 之前不会执行任何操作。每个任务的命令（$）和文件（✎）：",
+		ReviewEmpty:     "未选择任何内容 — 按 Enter 完成。",
+
+		ResumeFound:     "发现未完成的安装，开始于",
+		ResumeLeft:      "个任务未完成",
+		ResumeKeys:      "r 继续 • f 全部重新执行 • x 放弃",
+		ResumeNeedsKey:  "未继续 — API Key 未保存（请设置 $FRESHBOX_CODEX_API_KEY / $FRESHBOX_CLAUDE_API_KEY）",
+
 		InstallPrepare:  "正在准备安装...",
 
 		DoneMsg:         "你的 Mac 已配置完成，准备就绪。",
 		DoneReady:       "全部完成！",
 		DoneExit:        "按 Enter 或 q 退出。",
+		DoneExportHint:  "按 e 将当前选择导出为配置档案（Freshfile.toml）。",
+		DoneExported:    "配置档案已导出至",
+		DoneExportFail:  "配置档案导出失败",
+		DoneRetry:       "失败的任务 — 空格选择，按 r 重试所选任务：",
+		DoneUninstalled: "freshbox 添加的内容已移除，其他内容保持不变。",
+		InstallStopping: "正在取消：等待正在运行的任务完成…",
+		InstallAborting: "正在中止：终止正在运行的命令…（再按 ctrl+c 退出）",
+		InstallRunning:  "安装中",
+		UninstallRunning: "卸载中",
+		InstallNextUp:   "接下来：",
+		OutputTitle:     "输出",
+		OutputEmpty:     "（暂无输出）",
+		OutputEarlier:   "... 更早的 %d 行见 ~/.freshbox/install.log",
 
 		FooterNav:       "↑/↓ 导航 • 空格 切换 • a 全选 • n 全不选 • tab 下一步 • shift+tab 上一步 • q 退出",
-		FooterForm:      "↑/↓ 切换字段 • tab 下一字段 • enter 确认 • shift+tab 返回",
+		FooterForm:      "↑/↓ 切换字段 • tab 下一字段 • enter 确认 • ctrl+p 明文密钥 • shift+tab 返回",
+		FooterAddMCP:    "↑/↓ 切换字段 • tab 下一字段 • 在最后一个字段按 enter 添加 • esc 取消",
+		FooterReview:    "↑/↓ 滚动 • enter 开始安装 • shift+tab 返回 • q 返回",
+		FooterUninstall: "↑/↓ 滚动 • enter 移除以上内容 • shift+tab 返回 • q 返回",
+		FooterDone:      "↑/↓ 导航 • 空格 切换 • a 全选 • n 全不选 • o 输出 • r 重试所选 • e 导出 • enter/q 退出",
+		FooterDetecting: "正在检测已安装的工具… 剩余 %d 项",
+		FooterInstalling: "↑/↓ 选择任务 • o 显示输出 • c 在当前任务完成后取消 • ctrl+c 立即中止（终止正在运行的命令）",
 	},
 }
 
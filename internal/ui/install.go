@@ -1,288 +1,298 @@
 package ui
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/kittors/freshbox/internal/checker"
-	"github.com/kittors/freshbox/internal/config"
-	"github.com/kittors/freshbox/internal/installer"
-	"github.com/kittors/freshbox/internal/setup"
+	"github.com/kittors/freshbox/internal/backup"
+	"github.com/kittors/freshbox/internal/history"
+	"github.com/kittors/freshbox/internal/ledger"
+	"github.com/kittors/freshbox/internal/providers"
+	"github.com/kittors/freshbox/internal/redact"
+	"github.com/kittors/freshbox/internal/runner"
+	"github.com/kittors/freshbox/internal/tasks"
 )
 
 // installDoneMsg signals all installs are complete
 type installDoneMsg struct{}
 
+// maxOutputLines is how much of a task's output the UI keeps; the install
+// log has all of it
+const maxOutputLines = 500
+
+// taskOutput is the output of one task, streamed in while it runs
+type taskOutput struct {
+	lines   []string // the last maxOutputLines lines
+	dropped int      // earlier lines no longer kept
+}
+
+func (o *taskOutput) add(line string) {
+	o.lines = append(o.lines, line)
+	if len(o.lines) > maxOutputLines {
+		o.dropped += len(o.lines) - maxOutputLines
+		o.lines = slices.Clone(o.lines[len(o.lines)-maxOutputLines:])
+	}
+}
+
+// last returns up to n of the most recent lines
+func (o *taskOutput) last(n int) []string {
+	if o == nil {
+		return nil
+	}
+	return o.lines[max(len(o.lines)-n, 0):]
+}
+
+// outputLineMsg carries one line of a running task's output
+type outputLineMsg struct {
+	out  *taskOutput
+	line string
+}
+
+// waitForOutput delivers the next output line from ch
+func waitForOutput(ch <-chan outputLineMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-ch
+	}
+}
+
 // spinnerTickMsg wraps spinner tick
 type spinnerTickMsg struct {
 	msg tea.Msg
 }
 
 // buildInstallQueue builds the ordered list of things to install
-func (m *Model) buildInstallQueue() []installTask {
-	var queue []installTask
+func (m *Model) buildInstallQueue() ([]installTask, error) {
+	return tasks.Build(m.selection(), m.catalog())
+}
 
-	// 1. Dev tools
-	for _, item := range m.devTools {
-		if !m.selected[item.Name] || item.Status == checker.Installed {
-			continue
-		}
-		task := installTask{name: item.Name}
-		switch item.Name {
-		case "Homebrew":
-			task.fn = func() error { return installer.InstallHomebrew() }
-		case "Rust (rustup)":
-			task.fn = func() error { return installer.InstallRust() }
-		default:
-			brewName := item.BrewName
-			isCask := item.IsCask
-			if brewName != "" {
-				task.fn = func() error { return installer.BrewInstall(brewName, isCask) }
-			}
-		}
-		if task.fn != nil {
-			queue = append(queue, task)
-		}
-	}
+// installTask is one step of the install queue
+type installTask = tasks.Task
 
-	// 2. Apps
-	for _, item := range m.apps {
-		if !m.selected[item.Name] || item.Status == checker.Installed {
-			continue
+// startInstallSequence kicks off the install with progress reporting,
+// running the queue the user reviewed
+func (m *Model) startInstallSequence() tea.Cmd {
+	queue := m.reviewQueue
+	if queue == nil {
+		var err error
+		if queue, err = m.buildInstallQueue(); err != nil {
+			appendLog("install not started: " + err.Error())
+			return func() tea.Msg { return installDoneMsg{} }
 		}
-		brewName := item.BrewName
-		isCask := item.IsCask
-		task := installTask{
-			name: item.Name,
-			fn:   func() error { return installer.BrewInstall(brewName, isCask) },
+	}
+	if len(queue) == 0 {
+		return func() tea.Msg {
+			return installDoneMsg{}
 		}
-		queue = append(queue, task)
 	}
 
-	// 3. AI tools
-	for _, item := range m.aiTools {
-		if !m.selected[item.Name] || item.Status == checker.Installed {
-			continue
-		}
-		switch item.Name {
-		case "Codex":
-			queue = append(queue, installTask{
-				name: "Codex CLI",
-				fn:   func() error { return installer.InstallCodex() },
-			})
-		case "Claude Code":
-			queue = append(queue, installTask{
-				name: "Claude Code",
-				fn:   func() error { return installer.InstallClaudeCode() },
-			})
-		}
+	// write log header; retries from the Done page add to the same run log
+	what, source := "install", "tui"
+	if m.uninstall {
+		what, source = "uninstall", "tui uninstall"
 	}
+	appendLog(fmt.Sprintf("=== freshbox %s started (%d tasks) ===", what, len(queue)))
+	runLog, err := history.Start(source, queue)
+	if err != nil {
+		appendLog("run log unavailable: " + err.Error())
+	}
+	m.runLog = runLog
+	id := ""
+	if runLog != nil {
+		id = runLog.ID
+	}
+	m.backups = backup.Start(id)
+	return m.runInstallQueue(queue)
+}
+
+// runInstallQueue schedules queue and starts the first tasks; entries
+// already in the install log are kept above the new results
+func (m *Model) runInstallQueue(queue []installTask) tea.Cmd {
+	tasks.SetTimeout(queue, m.timeout)
+	queue = m.runLog.Wrap(queue)
+	m.installCtx, m.abortInstall = context.WithCancel(backup.WithRun(context.Background(), m.backups))
+	m.aborting = false
+	m.installQueue = queue
+	m.installTotal = len(queue)
+	m.installBase = len(m.installLog)
+	m.sched = tasks.NewScheduler(queue, m.workers)
+	m.outputs = make(map[int]*taskOutput)
+	m.logCursor = -1
+	// an uninstall isn't resumable: what's left stays in the ledger
+	if m.runState == nil && !m.uninstall {
+		m.runState = tasks.NewRunState(m.selection(), queue)
+	}
+	logStateErr(m.runState.Save())
+
+	// start spinner + first installs concurrently
+	cmds := []tea.Cmd{m.spinner.Tick, m.dispatchInstalls()}
+	if !m.listening {
+		// one listener for the model's lifetime, re-armed after each line
+		m.listening = true
+		cmds = append(cmds, waitForOutput(m.outputCh))
+	}
+	return tea.Batch(cmds...)
+}
 
-	// 4. fnm Node versions
-	for v, sel := range m.fnmSelected {
-		if !sel {
-			continue
+// taskContext is the context task i runs under: its output goes to the
+// install log, tagged with the task name, and to the UI
+func (m *Model) taskContext(i int) context.Context {
+	name := m.installQueue[i].Name
+	out := &taskOutput{}
+	m.outputs[i] = out
+	ch := m.outputCh
+	return runner.WithOutput(m.installCtx, func(line string) {
+		line = redact.String(line)
+		appendLog(fmt.Sprintf("[%s] %s", name, line))
+		select {
+		case ch <- outputLineMsg{out: out, line: line}:
+		default: // the UI is behind; the log still has the line
 		}
-		ver := v
-		queue = append(queue, installTask{
-			name: "Node.js " + ver,
-			fn:   func() error { return installer.FnmInstallNode(ver) },
-		})
-	}
+	})
+}
 
-	// 5. Codex config
-	if m.codexKey != "" || m.codexURL != "" {
-		queue = append(queue, installTask{
-			name: "Codex config (config.toml + auth.json)",
-			fn: func() error {
-				err := config.WriteCodexConfig(config.CodexConfig{
-					Model:         m.codexModel,
-					ThinkingLevel: m.codexThink,
-					BaseURL:       m.codexURL,
-				})
-				if err != nil {
-					return err
-				}
-				return config.WriteCodexAuth(config.CodexAuth{APIKey: m.codexKey})
-			},
-		})
+// retryable returns the install log indexes of tasks that failed or were skipped
+func (m Model) retryable() []int {
+	var out []int
+	for i, entry := range m.installLog {
+		if !entry.success {
+			out = append(out, i)
+		}
 	}
+	return out
+}
 
-	// 6. Claude config
-	if m.claudeKey != "" || m.claudeURL != "" {
-		queue = append(queue, installTask{
-			name: "Claude Code config",
-			fn: func() error {
-				return config.WriteClaudeConfig(config.ClaudeConfig{
-					Model:   m.claudeModel,
-					BaseURL: m.claudeURL,
-					APIKey:  m.claudeKey,
-				})
-			},
-		})
+// selectRetries selects or clears every failed task on the Done page
+func (m *Model) selectRetries(on bool) {
+	m.retrySelected = make(map[int]bool)
+	for _, i := range m.retryable() {
+		m.retrySelected[i] = on
 	}
+}
 
-	// 7. MCP servers
-	var selectedMCPs []config.MCPServer
-	for _, mcp := range m.mcps {
-		if m.mcpSelected[mcp.Name] {
-			selectedMCPs = append(selectedMCPs, mcp)
+// retryFailed reruns the tasks selected on the Done page, with the failed or
+// skipped tasks they need: Order drops needs outside the queue, so a skipped
+// task retried alone would run without them. Their old log entries are
+// replaced by the new results; everything else stays as it was.
+func (m Model) retryFailed() (tea.Model, tea.Cmd) {
+	unfinished := make(map[string]int)
+	for i, entry := range m.installLog {
+		if !entry.success && entry.task.ID != "" {
+			unfinished[entry.task.ID] = i
 		}
 	}
-	if len(selectedMCPs) > 0 {
-		// Check if Claude Code is selected, configured, or already installed
-		claudeReady := m.selected["Claude Code"] || m.claudeKey != "" || m.claudeURL != ""
-		if !claudeReady {
-			for _, item := range m.aiTools {
-				if item.Name == "Claude Code" && item.Status == checker.Installed {
-					claudeReady = true
-					break
-				}
-			}
-		}
-		if claudeReady {
-			queue = append(queue, installTask{
-				name: "MCP servers for Claude Code",
-				fn:   func() error { return config.WriteMCPConfig(selectedMCPs, "claude") },
-			})
+	retry := make(map[int]bool)
+	var pull func(i int)
+	pull = func(i int) {
+		if retry[i] {
+			return
 		}
-
-		// Check if Codex is selected, configured, or already installed
-		codexReady := m.selected["Codex"] || m.codexKey != "" || m.codexURL != ""
-		if !codexReady {
-			for _, item := range m.aiTools {
-				if item.Name == "Codex" && item.Status == checker.Installed {
-					codexReady = true
-					break
-				}
+		retry[i] = true
+		for _, id := range m.installLog[i].task.Needs {
+			if j, ok := unfinished[id]; ok {
+				pull(j)
 			}
 		}
-		if codexReady {
-			queue = append(queue, installTask{
-				name: "MCP servers for Codex",
-				fn:   func() error { return config.WriteMCPConfig(selectedMCPs, "codex") },
-			})
-		}
-	}
-
-	// 8. System defaults
-	if m.sysDefaults["browser_chrome"] {
-		queue = append(queue, installTask{
-			name: "Set default browser → Chrome",
-			fn:   func() error { return installer.SetDefaultBrowser() },
-		})
-	}
-	if m.sysDefaults["editor_zed"] {
-		queue = append(queue, installTask{
-			name: "Set default editor → Zed",
-			fn: func() error {
-				cmd := exec.Command("bash", "-c", `defaults write com.apple.LaunchServices/com.apple.launchservices.secure LSHandlers -array-add '{"LSHandlerContentType"="public.plain-text";"LSHandlerRoleAll"="dev.zed.Zed";}'`)
-				return cmd.Run()
-			},
-		})
-	}
-	if m.sysDefaults["player_iina"] {
-		queue = append(queue, installTask{
-			name: "Set default player → IINA",
-			fn: func() error {
-				types := []string{"public.movie", "public.video", "public.audio"}
-				for _, t := range types {
-					cmd := exec.Command("bash", "-c", fmt.Sprintf(`defaults write com.apple.LaunchServices/com.apple.launchservices.secure LSHandlers -array-add '{"LSHandlerContentType"="%s";"LSHandlerRoleAll"="com.colliderli.iina";}'`, t))
-					_ = cmd.Run()
-				}
-				return nil
-			},
-		})
 	}
-
-	// 9. Java JAVA_HOME
-	if m.selected["Java (JDK)"] {
-		queue = append(queue, installTask{
-			name: "Configure JAVA_HOME",
-			fn:   func() error { return installer.SetJavaHome() },
-		})
+	for _, i := range m.retryable() {
+		if m.retrySelected[i] {
+			pull(i)
+		}
 	}
 
-	// 10. Extra setup
-	if m.extraSetup["zed_theme"] {
-		queue = append(queue, installTask{
-			name: "Zed Catppuccin Blur Theme",
-			fn:   func() error { return setup.SetupZedTheme() },
-		})
-	}
-	if m.extraSetup["kaku_init"] {
-		queue = append(queue, installTask{
-			name: "Kaku Terminal Setup (config + zsh plugins)",
-			fn:   func() error { return setup.SetupKaku() },
-		})
+	var queue []installTask
+	var kept []installLogEntry
+	for i, entry := range m.installLog {
+		if retry[i] {
+			queue = append(queue, entry.task)
+		} else {
+			kept = append(kept, entry)
+		}
 	}
-	if m.extraSetup["karabiner_kaku"] {
-		queue = append(queue, installTask{
-			name: "Karabiner ⌃⌥⌘T → Kaku shortcut",
-			fn:   func() error { return setup.SetupKarabiner() },
-		})
+	if len(queue) == 0 {
+		return m, nil
 	}
-	if m.extraSetup["dev_workspace"] {
-		queue = append(queue, installTask{
-			name: "Developer Workspace + Finder config",
-			fn:   func() error { return setup.SetupDevWorkspace() },
-		})
+	if ordered, err := tasks.Order(queue); err == nil {
+		queue = ordered
 	}
 
-	return queue
+	appendLog(fmt.Sprintf("=== freshbox retry started (%d tasks) ===", len(queue)))
+	m.installLog = kept
+	m.retrySelected = nil
+	m.page = PageInstalling
+	m.installing = true
+	m.installDone = false
+	m.cursor = 0
+	return m, m.runInstallQueue(queue)
 }
 
-type installTask struct {
-	name string
-	fn   func() error
-}
-
-// startInstallSequence kicks off the install with progress reporting
-func (m *Model) startInstallSequence() tea.Cmd {
-	queue := m.buildInstallQueue()
-	if len(queue) == 0 {
-		return func() tea.Msg {
-			return installDoneMsg{}
+// dispatchInstalls starts every task the scheduler allows and logs the ones
+// it skips because a dependency failed
+func (m *Model) dispatchInstalls() tea.Cmd {
+	start, skipped := m.sched.Next()
+	for i, task := range m.installQueue {
+		if err, ok := skipped[i]; ok {
+			err = redact.Error(err)
+			m.runState.Mark(task.ID, tasks.StatusSkipped, err)
+			m.runLog.Record(tasks.Event{Type: tasks.EventSkip, Task: task.Name, ID: task.ID, Error: err.Error()})
+			appendLog(fmt.Sprintf("[SKIP] %s\n       %s", task.Name, err.Error()))
+			m.installLog = append(m.installLog, installLogEntry{
+				task:    task,
+				name:    task.Name,
+				skipped: true,
+				errMsg:  err.Error(),
+				fullErr: err.Error(),
+			})
 		}
 	}
-
-	m.installQueue = queue
-	m.installIdx = 0
-	m.installTotal = len(queue)
-	m.currentTask = queue[0].name
-
-	// write log header
-	appendLog(fmt.Sprintf("=== freshbox install started (%d tasks) ===", len(queue)))
-
-	// start spinner + first install concurrently
-	return tea.Batch(m.spinner.Tick, m.runNextInstall())
-}
-
-func (m *Model) runNextInstall() tea.Cmd {
-	if m.installIdx >= len(m.installQueue) {
+	if m.sched.Done() {
+		m.abortInstall()
+		m.recordRunEnd()
+		switch {
+		case m.uninstall:
+			m.added = loadAdded()
+		case m.runState.Remaining() == 0:
+			logStateErr(tasks.ClearState())
+		default:
+			logStateErr(m.runState.Save())
+		}
 		return func() tea.Msg { return installDoneMsg{} }
 	}
 
-	task := m.installQueue[m.installIdx]
-
-	return func() tea.Msg {
-		time.Sleep(80 * time.Millisecond)
-		err := task.fn()
-		return InstallMsg{Name: task.name, Err: err}
+	var cmds []tea.Cmd
+	for _, i := range start {
+		task := m.installQueue[i]
+		m.runState.Mark(task.ID, tasks.StatusRunning, nil)
+		m.runLog.Record(tasks.Event{Type: tasks.EventStart, Task: task.Name, ID: task.ID})
+		ctx := m.taskContext(i)
+		cmds = append(cmds, func() tea.Msg {
+			return InstallMsg{Index: i, Name: task.Name, Err: task.Exec(ctx)}
+		})
 	}
+	logStateErr(m.runState.Save())
+	return tea.Batch(cmds...)
 }
 
-// HandleInstallMsg processes install results and triggers next install
+// HandleInstallMsg processes install results and starts whatever is unblocked
 func (m *Model) HandleInstallMsg(msg InstallMsg) tea.Cmd {
+	m.sched.Finish(msg.Index, msg.Err)
+	task := m.installQueue[msg.Index]
 	if msg.Err != nil {
-		fullErr := strings.TrimSpace(msg.Err.Error())
+		m.runState.Mark(task.ID, tasks.StatusFailed, msg.Err)
+		m.runLog.Record(tasks.Event{Type: tasks.EventFail, Task: task.Name, ID: task.ID, Error: strings.TrimSpace(msg.Err.Error())})
+	} else {
+		m.runState.Mark(task.ID, tasks.StatusOK, nil)
+		m.runLog.Record(tasks.Event{Type: tasks.EventOK, Task: task.Name, ID: task.ID})
+	}
+
+	if msg.Err != nil {
+		fullErr := redact.String(strings.TrimSpace(msg.Err.Error()))
 		// write full error to log file
 		appendLog(fmt.Sprintf("[FAIL] %s\n       %s", msg.Name, fullErr))
 
@@ -291,50 +301,237 @@ func (m *Model) HandleInstallMsg(msg InstallMsg) tea.Cmd {
 			errMsg = errMsg[:60] + "..."
 		}
 		m.installLog = append(m.installLog, installLogEntry{
+			task:    m.installQueue[msg.Index],
 			name:    msg.Name,
 			success: false,
 			errMsg:  errMsg,
+			fullErr: fullErr,
+			output:  m.outputs[msg.Index],
 		})
 	} else {
 		appendLog(fmt.Sprintf("[ OK ] %s", msg.Name))
 		m.installLog = append(m.installLog, installLogEntry{
+			task:    m.installQueue[msg.Index],
 			name:    msg.Name,
 			success: true,
+			output:  m.outputs[msg.Index],
 		})
 	}
+	delete(m.outputs, msg.Index)
 
-	m.installIdx++
-	if m.installIdx >= len(m.installQueue) {
-		m.currentTask = ""
-		return func() tea.Msg { return installDoneMsg{} }
+	return m.dispatchInstalls()
+}
+
+// recordRunEnd closes this attempt in the run log with its totals
+func (m *Model) recordRunEnd() {
+	failed, skipped := 0, 0
+	for _, entry := range m.installLog[m.installBase:] {
+		switch {
+		case entry.skipped:
+			skipped++
+		case !entry.success:
+			failed++
+		}
+	}
+	m.runLog.Record(tasks.Event{Type: tasks.EventDone, Total: m.installTotal, Failed: failed, Skipped: skipped})
+}
+
+// stopInstall lets running tasks finish and skips the rest; abort also
+// cancels the running tasks, killing their commands
+func (m *Model) stopInstall(abort bool) tea.Cmd {
+	m.sched.Stop()
+	if abort {
+		m.aborting = true
+		m.abortInstall()
+		appendLog("=== install aborted ===")
+	} else {
+		appendLog("=== install cancelled after the running tasks ===")
 	}
+	return m.dispatchInstalls()
+}
+
+// outputTarget is a task whose output the progress page can show
+type outputTarget struct {
+	name string
+	out  *taskOutput
+}
 
-	m.currentTask = m.installQueue[m.installIdx].name
-	return m.runNextInstall()
+// outputTargets lists finished tasks from the install log, then the running
+// ones, in the order the progress page shows them
+func (m Model) outputTargets() []outputTarget {
+	var targets []outputTarget
+	for _, entry := range m.installLog {
+		targets = append(targets, outputTarget{entry.name, entry.output})
+	}
+	if m.sched != nil {
+		for _, i := range m.sched.Running() {
+			targets = append(targets, outputTarget{m.installQueue[i].Name, m.outputs[i]})
+		}
+	}
+	return targets
+}
+
+// outputFocus returns the index into outputTargets shown in the output pane:
+// the one picked with the cursor, or else the first running task
+func (m Model) outputFocus() int {
+	n := len(m.outputTargets())
+	if m.logCursor >= 0 && m.logCursor < n {
+		return m.logCursor
+	}
+	if m.sched != nil && len(m.sched.Running()) > 0 {
+		return len(m.installLog)
+	}
+	return n - 1
+}
+
+// moveLogCursor steps the output pane to another task; stepping past the
+// end goes back to following the current task
+func (m *Model) moveLogCursor(delta int) {
+	n := len(m.outputTargets())
+	cur := m.outputFocus()
+	switch next := cur + delta; {
+	case next < 0:
+		m.logCursor = 0
+	case next >= n:
+		m.logCursor = -1
+	default:
+		m.logCursor = next
+	}
+}
+
+// renderOutputPane shows the last lines of a task's output in a box
+func (m Model) renderOutputPane(name string, out *taskOutput, height int) string {
+	width := max(m.width-12, 40)
+	var b strings.Builder
+	b.WriteString(SubtitleStyle.Render(m.t.OutputTitle+" — "+name) + "\n")
+	lines := out.last(height)
+	if len(lines) == 0 {
+		b.WriteString(DimStyle.Render(m.t.OutputEmpty))
+	}
+	if out != nil && len(out.lines)+out.dropped > len(lines) {
+		b.WriteString(DimStyle.Render(fmt.Sprintf(m.t.OutputEarlier, len(out.lines)+out.dropped-len(lines))) + "\n")
+	}
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(DimStyle.Render(truncate(line, width)))
+	}
+	return lipgloss.NewStyle().
+		Border(lipgloss.NormalBorder()).
+		BorderForeground(Gray).
+		Padding(0, 1).
+		Render(b.String())
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+// loadResumeState returns the saved run if it has unfinished tasks
+func loadResumeState() *tasks.RunState {
+	state, err := tasks.LoadState()
+	if err != nil {
+		appendLog("unfinished run not resumable: " + err.Error())
+		return nil
+	}
+	if state == nil || state.Remaining() == 0 {
+		return nil
+	}
+	return state
+}
+
+// resumeRun rebuilds the unfinished run and shows it on the review page;
+// force reruns tasks that already succeeded
+func (m Model) resumeRun(force bool) (tea.Model, tea.Cmd) {
+	if len(m.detecting) > 0 {
+		// Resume rebuilds the plan from what is installed
+		m.resumePending, m.resumeForce = true, force
+		return m, nil
+	}
+	if len(m.resume.IncompleteMCPs(m.catalog(), m.mcpEnv, force)) > 0 {
+		// the servers' variables aren't saved with the run: ask for them
+		// again rather than leave the servers out
+		m.mcpSelected = make(map[string]bool)
+		for _, name := range m.resume.Selection.MCPs {
+			m.mcpSelected[name] = true
+		}
+		m.resumeEnv, m.resumeForce = true, force
+		m.page = PageMCPEnv
+		m.initMCPEnvInputs()
+		return m, nil
+	}
+	keys := tasks.Selection{
+		Codex:  tasks.CodexSettings{APIKey: os.Getenv("FRESHBOX_CODEX_API_KEY")},
+		Claude: tasks.ClaudeSettings{APIKey: os.Getenv("FRESHBOX_CLAUDE_API_KEY")},
+		MCPEnv: m.mcpEnv,
+	}
+	queue, dropped, err := m.resume.Resume(m.catalog(), keys, force)
+	m.reviewQueue, m.reviewErr = queue, err
+	m.resumeDropped = dropped
+	m.runState = m.resume
+	m.resume = nil
+	m.page = PageReview
+	m.cursor = 0
+	return m, nil
+}
+
+// loadAdded returns what earlier runs added and is still on the machine
+func loadAdded() []ledger.Entry {
+	entries, err := ledger.Load()
+	if err != nil {
+		return nil
+	}
+	return entries
+}
+
+// loadAIProfiles returns the saved provider profiles; an unreadable file
+// just hides the profile page
+func loadAIProfiles() providers.Set {
+	set, err := providers.Load()
+	if err != nil {
+		return providers.Set{}
+	}
+	return set
+}
+
+// reviewUninstall shows the plan for removing everything freshbox added on
+// the review page
+func (m Model) reviewUninstall() (tea.Model, tea.Cmd) {
+	m.reviewQueue, m.reviewErr = tasks.BuildUninstall(m.added), nil
+	m.uninstall = true
+	m.runState = nil
+	m.resumeDropped = nil
+	m.page = PageReview
+	m.cursor = 0
+	return m, nil
 }
 
 type installLogEntry struct {
+	task    installTask // kept so the Done page can retry it
 	name    string
 	success bool
-	errMsg  string
+	skipped bool   // a dependency failed, so the task never ran
+	errMsg  string // truncated for the progress log
+	fullErr string
+	output  *taskOutput // nil for skipped tasks
 }
 
-// logFilePath returns the path to the install error log
-func logFilePath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".freshbox", "install.log")
+// appendLog writes a line to the install log file, with secrets masked
+func appendLog(line string) {
+	tasks.AppendLog(line)
 }
 
-// appendLog writes a line to the install log file
-func appendLog(line string) {
-	path := logFilePath()
-	os.MkdirAll(filepath.Dir(path), 0755)
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+// logStateErr notes a run state that couldn't be saved or cleared: the
+// install goes on, but may not be resumable
+func logStateErr(err error) {
 	if err != nil {
-		return
+		appendLog("run state: " + err.Error())
 	}
-	defer f.Close()
-	f.WriteString(time.Now().Format("2006-01-02 15:04:05") + "  " + line + "\n")
 }
 
 // NewSpinner creates a styled spinner
@@ -352,14 +549,18 @@ func (m Model) renderInstallProgress() string {
 	var b strings.Builder
 
 	total := m.installTotal
-	done := len(m.installLog)
+	done := len(m.installLog) - m.installBase
 	pct := 0
 	if total > 0 {
 		pct = done * 100 / total
 	}
 
 	// Title with progress count
-	title := fmt.Sprintf("⏳ %s  [%d/%d]", m.t.TitleInstalling, done, total)
+	what := m.t.TitleInstalling
+	if m.uninstall {
+		what = m.t.TitleUninstalling
+	}
+	title := fmt.Sprintf("⏳ %s  [%d/%d]", what, done, total)
 	b.WriteString(SubtitleStyle.Render(title) + "\n\n")
 
 	// Progress bar
@@ -378,15 +579,30 @@ func (m Model) renderInstallProgress() string {
 		DimStyle.Render(fmt.Sprintf(" %d%%", pct))
 	b.WriteString("  " + bar + "\n\n")
 
+	var running, upcoming []int
+	if m.sched != nil {
+		running = m.sched.Running()
+		upcoming = m.sched.Pending()
+	}
+	if len(upcoming) > 3 {
+		upcoming = upcoming[:3]
+	}
+
+	// Output pane for the focused task, a third of the screen when open
+	focus := m.outputFocus()
+	paneLines := 0
+	if m.showOutput {
+		paneLines = max(m.height/3, 5)
+	}
+
 	// Calculate how many log entries we can show based on terminal height
-	// Fixed lines: header(~6) + title(2) + bar(2) + current task(3) + upcoming(~5) + footer(3) + box border(2)
-	fixedLines := 23
-	upcomingCount := 0
-	for i := m.installIdx + 1; i < len(m.installQueue) && upcomingCount < 3; i++ {
-		upcomingCount++
+	// Fixed lines: header(~6) + title(2) + bar(2) + running tasks + upcoming(~5) + footer(3) + box border(2)
+	fixedLines := 21 + 2*len(running)
+	if len(upcoming) > 0 {
+		fixedLines += len(upcoming) + 1
 	}
-	if upcomingCount > 0 {
-		fixedLines += upcomingCount + 1
+	if m.showOutput {
+		fixedLines += paneLines + 4
 	}
 
 	maxLogLines := m.height - fixedLines
@@ -400,41 +616,72 @@ func (m Model) renderInstallProgress() string {
 		logStart = len(m.installLog) - maxLogLines
 		b.WriteString(DimStyle.Render(fmt.Sprintf("  ... %d more above\n", logStart)))
 	}
+	marker := func(i int) string {
+		if m.showOutput && i == focus {
+			return CursorStyle.Render("▸")
+		}
+		return " "
+	}
 	for i := logStart; i < len(m.installLog); i++ {
 		entry := m.installLog[i]
+		b.WriteString(marker(i))
 		if entry.success {
-			b.WriteString(fmt.Sprintf("  %s %s\n",
+			b.WriteString(fmt.Sprintf(" %s %s\n",
 				SuccessStyle.Render("✓"),
 				DimStyle.Render(entry.name)))
+		} else if entry.skipped {
+			b.WriteString(fmt.Sprintf(" %s %s  %s\n",
+				DimStyle.Render("⊘"),
+				DimStyle.Render(entry.name),
+				DimStyle.Render(entry.errMsg)))
 		} else {
-			b.WriteString(fmt.Sprintf("  %s %s  %s\n",
+			b.WriteString(fmt.Sprintf(" %s %s  %s\n",
 				ErrorStyle.Render("✗"),
 				entry.name,
 				ErrorStyle.Render(entry.errMsg)))
 		}
 	}
 
-	// Current task with spinner
-	if m.currentTask != "" {
+	// In-flight tasks, one spinner each
+	if len(running) > 0 {
+		b.WriteString("\n")
+	}
+	verb := m.t.InstallRunning
+	if m.uninstall {
+		verb = m.t.UninstallRunning
+	}
+	for n, i := range running {
 		spinnerView := ProgressStyle.Render(m.spinner.View())
-		taskName := lipgloss.NewStyle().Foreground(Cyan).Bold(true).Render(m.currentTask)
-		b.WriteString(fmt.Sprintf("\n  %s %s %s\n",
+		taskName := lipgloss.NewStyle().Foreground(Cyan).Bold(true).Render(m.installQueue[i].Name)
+		b.WriteString(fmt.Sprintf("%s %s %s %s\n",
+			marker(len(m.installLog)+n),
 			spinnerView,
-			lipgloss.NewStyle().Foreground(Yellow).Render("Installing"),
+			lipgloss.NewStyle().Foreground(Yellow).Render(verb),
 			taskName))
+		// latest output line, so long installs show what they're doing
+		if last := m.outputs[i].last(1); len(last) > 0 {
+			b.WriteString(DimStyle.Render("    │ "+truncate(last[0], max(m.width-16, 40))) + "\n")
+		}
 	}
 
-	// Upcoming tasks preview (next 3)
-	upcoming := []string{}
-	for i := m.installIdx + 1; i < len(m.installQueue) && len(upcoming) < 3; i++ {
-		upcoming = append(upcoming, m.installQueue[i].name)
+	switch {
+	case m.aborting:
+		b.WriteString("\n" + ErrorStyle.Render("  "+m.t.InstallAborting) + "\n")
+	case m.sched != nil && m.sched.Stopped():
+		b.WriteString("\n" + lipgloss.NewStyle().Foreground(Yellow).Render("  "+m.t.InstallStopping) + "\n")
 	}
+
+	// Upcoming tasks preview (next 3)
 	if len(upcoming) > 0 {
-		b.WriteString("\n" + DimStyle.Render("  Next up:") + "\n")
-		for _, name := range upcoming {
-			b.WriteString(DimStyle.Render("    ○ "+name) + "\n")
+		b.WriteString("\n" + DimStyle.Render("  "+m.t.InstallNextUp) + "\n")
+		for _, i := range upcoming {
+			b.WriteString(DimStyle.Render("    ○ "+m.installQueue[i].Name) + "\n")
 		}
 	}
 
+	if targets := m.outputTargets(); m.showOutput && focus >= 0 && focus < len(targets) {
+		b.WriteString("\n" + m.renderOutputPane(targets[focus].name, targets[focus].out, paneLines) + "\n")
+	}
+
 	return BoxStyle.Render(b.String())
 }
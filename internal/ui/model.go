@@ -1,11 +1,28 @@
 package ui
 
 import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/kittors/freshbox/internal/backup"
+	"github.com/kittors/freshbox/internal/catalog"
 	"github.com/kittors/freshbox/internal/checker"
 	"github.com/kittors/freshbox/internal/config"
+	"github.com/kittors/freshbox/internal/history"
+	"github.com/kittors/freshbox/internal/ledger"
+	"github.com/kittors/freshbox/internal/profile"
+	"github.com/kittors/freshbox/internal/providers"
+	"github.com/kittors/freshbox/internal/redact"
+	"github.com/kittors/freshbox/internal/tasks"
 )
 
 // Page represents the current TUI page
@@ -18,11 +35,14 @@ const (
 	PageApps
 	PageFnmVersions
 	PageAITools
+	PageAIProfile
 	PageCodexConfig
 	PageClaudeConfig
 	PageMCP
+	PageMCPEnv
 	PageExtraSetup
 	PageSystemDefaults
+	PageReview
 	PageInstalling
 	PageDone
 )
@@ -35,11 +55,14 @@ func pageNames(t T) []string {
 		t.PageApps,
 		t.PageNodeVer,
 		t.PageAITools,
+		t.PageAIProfile,
 		t.PageCodexCfg,
 		t.PageClaudeCfg,
 		t.PageMCP,
+		t.PageMCPEnv,
 		t.PageExtraSetup,
 		t.PageSysDefaults,
+		t.PageReview,
 		t.PageInstalling,
 		t.PageDone,
 	}
@@ -47,8 +70,9 @@ func pageNames(t T) []string {
 
 // InstallMsg is sent when an install completes
 type InstallMsg struct {
-	Name string
-	Err  error
+	Index int // position in the install queue
+	Name  string
+	Err   error
 }
 
 // FnmVersionsMsg is sent when fnm versions are fetched
@@ -92,34 +116,110 @@ type Model struct {
 	claudeURL   string
 	claudeKey   string
 
+	// write API keys into the config files instead of the secret store
+	plaintextKeys bool
+
+	// endpoint check of the config form and the input values it ran on; a
+	// form with failures moves on when advanced again unchanged
+	verifying    bool
+	verifyReport *providers.Report
+	verifyValues []string
+
+	// values typed in for the variables selected MCP servers need, by
+	// variable name; mcpEnvMissing marks empty fields after a try to move on
+	mcpEnv        map[string]string
+	mcpEnvMissing bool
+
+	// form for a remote MCP server on the MCP page, and why the last try to
+	// add one failed
+	addingMCP bool
+	addMCPErr error
+
+	// saved provider profiles, and the one to switch to instead of the
+	// config forms; empty means the forms
+	aiProfiles providers.Set
+	aiProfile  string
+
+	// profile the wizard was started with, and its minimum versions, kept in
+	// the selection and exports
+	prof        *profile.Profile
+	minVersions map[string]string
+
+	// profile export from the Done page
+	exportPath string
+	exportErr  error
+
+	// plan shown on the review page, run as-is on confirm, and why there is
+	// none when the catalog's needs don't make one
+	reviewQueue []installTask
+	reviewErr   error
+
+	// unfinished run found at startup, and the state of the current run
+	resume        *tasks.RunState
+	resumeDropped []string
+	runState      *tasks.RunState
+	runLog        *history.Log // nil if the run log couldn't be created
+	backups       *backup.Run  // snapshots of the files this run changes
+
+	// what earlier runs added, offered for removal on the welcome page;
+	// uninstall is set while the review and progress pages remove it
+	added     []ledger.Entry
+	uninstall bool
+
 	// install progress
 	installLog   []installLogEntry
 	installing   bool
 	installDone  bool
 	installQueue []installTask
-	installIdx   int
+	sched        *tasks.Scheduler
+	workers      int
 	installTotal int
-	currentTask  string
+	installBase  int // log entries from earlier attempts, before a retry
 	spinner      spinner.Model
 
+	// cancelling the install: abortInstall kills running tasks, timeout
+	// overrides every task's own limit when set
+	installCtx   context.Context
+	abortInstall context.CancelFunc
+	aborting     bool
+	timeout      time.Duration
+
+	// task output streamed from running commands; logCursor picks the task
+	// shown in the output pane on the progress page, -1 follows the current one
+	outputCh   chan outputLineMsg
+	listening  bool
+	outputs    map[int]*taskOutput // running tasks, by queue index
+	showOutput bool
+	logCursor  int
+
+	// items still being detected, and where their results arrive; a review
+	// or resume asked for meanwhile waits for the last one
+	detecting     map[string]bool
+	detectCh      chan *checker.Item
+	reviewPending bool
+	resumePending bool
+	resumeForce   bool
+
+	// the MCP Credentials page was opened to resume a run whose servers
+	// need variables the state doesn't keep
+	resumeEnv bool
+
+	// failed tasks picked on the Done page, by install log index
+	retrySelected map[int]bool
+
 	// error
 	err error
 }
 
-func NewModel() Model {
-	devTools := checker.DevTools()
-	checker.CheckAll(devTools)
-
-	apps := checker.Apps()
-	for _, a := range apps {
-		checker.CheckApp(a)
+// NewModel returns the wizard for cat, with detection still to run; Init
+// starts it
+func NewModel(cat tasks.Catalog) Model {
+	devTools, apps, aiTools, mcps := cat.DevTools, cat.Apps, cat.AITools, cat.MCPs
+	detecting := make(map[string]bool)
+	for _, item := range cat.Items() {
+		detecting[item.Name] = true
 	}
 
-	aiTools := checker.AITools()
-	checker.CheckAll(aiTools)
-
-	mcps := config.AvailableMCPs()
-
 	m := Model{
 		page:        PageLang,
 		lang:        LangEN,
@@ -129,48 +229,311 @@ func NewModel() Model {
 		aiTools:     aiTools,
 		mcps:        mcps,
 		spinner:     NewSpinner(),
+		workers:     tasks.DefaultWorkers,
+		outputCh:    make(chan outputLineMsg, 1024),
+		detecting:   detecting,
+		detectCh:    make(chan *checker.Item, len(detecting)),
+		resume:      loadResumeState(),
+		added:       loadAdded(),
+		aiProfiles:  loadAIProfiles(),
 		selected:    make(map[string]bool),
 		fnmSelected: make(map[string]bool),
 		mcpSelected: make(map[string]bool),
 		sysDefaults: map[string]bool{
-			"browser_chrome": true,
-			"editor_zed":     true,
-			"player_iina":    true,
+			tasks.DefaultBrowserChrome: true,
+			tasks.DefaultEditorZed:     true,
+			tasks.DefaultPlayerIINA:    true,
 		},
 		extraSetup: map[string]bool{
-			"zed_theme":      true,
-			"kaku_init":      true,
-			"karabiner_kaku": true,
-			"dev_workspace":  true,
+			tasks.ExtraZedTheme:     true,
+			tasks.ExtraKakuInit:     true,
+			tasks.ExtraKarabiner:    true,
+			tasks.ExtraDevWorkspace: true,
 		},
 	}
 
-	// pre-select uninstalled items
-	for _, item := range devTools {
-		if item.Status == checker.NotInstalled {
-			m.selected[item.Name] = true
+	// pre-select popular MCPs
+	for _, mcp := range mcps[:min(4, len(mcps))] {
+		m.mcpSelected[mcp.Name] = true
+	}
+
+	return m
+}
+
+// selection snapshots the wizard's choices for the install queue
+func (m Model) selection() tasks.Selection {
+	sel := tasks.Selection{
+		MinVersions: m.minVersions,
+		AIProfile:   m.aiProfile,
+		Codex: tasks.CodexSettings{
+			Model:         m.codexModel,
+			ThinkingLevel: m.codexThink,
+			BaseURL:       m.codexURL,
+			APIKey:        m.codexKey,
+			PlaintextKey:  m.plaintextKeys,
+		},
+		Claude: tasks.ClaudeSettings{
+			Model:        m.claudeModel,
+			BaseURL:      m.claudeURL,
+			APIKey:       m.claudeKey,
+			PlaintextKey: m.plaintextKeys,
+		},
+	}
+	for _, item := range m.devTools {
+		if m.selected[item.Name] {
+			sel.DevTools = append(sel.DevTools, item.Name)
 		}
 	}
-	for _, item := range apps {
-		if item.Status == checker.NotInstalled {
-			m.selected[item.Name] = true
+	for _, item := range m.apps {
+		if m.selected[item.Name] {
+			sel.Apps = append(sel.Apps, item.Name)
 		}
 	}
-	for _, item := range aiTools {
-		if item.Status == checker.NotInstalled {
-			m.selected[item.Name] = true
+	for _, item := range m.aiTools {
+		if m.selected[item.Name] {
+			sel.AITools = append(sel.AITools, item.Name)
 		}
 	}
-	// pre-select popular MCPs
-	for _, mcp := range mcps[:4] {
-		m.mcpSelected[mcp.Name] = true
+	for v, on := range m.fnmSelected {
+		if on {
+			sel.NodeVersions = append(sel.NodeVersions, v)
+		}
+	}
+	sort.Strings(sel.NodeVersions)
+	for _, mcp := range m.mcps {
+		if m.mcpSelected[mcp.Name] {
+			sel.MCPs = append(sel.MCPs, mcp.Name)
+		}
 	}
+	for _, f := range m.mcpEnvFields() {
+		if v := m.mcpEnv[f.env.Name]; v != "" {
+			if sel.MCPEnv == nil {
+				sel.MCPEnv = make(map[string]string)
+			}
+			sel.MCPEnv[f.env.Name] = v
+		}
+	}
+	for _, k := range tasks.ExtraSetupKeys() {
+		if m.extraSetup[k] {
+			sel.ExtraSetup = append(sel.ExtraSetup, k)
+		}
+	}
+	for _, k := range tasks.SysDefaultKeys() {
+		if m.sysDefaults[k] {
+			sel.SysDefaults = append(sel.SysDefaults, k)
+		}
+	}
+	return sel
+}
 
-	return m
+// SetWorkers sets how many independent install tasks run at once
+func (m *Model) SetWorkers(n int) {
+	m.workers = max(n, 1)
+}
+
+// SetTimeout cancels any install task still running after d; zero keeps
+// each task's default
+func (m *Model) SetTimeout(d time.Duration) {
+	m.timeout = d
+}
+
+// ApplyProfile pre-populates the wizard from a profile. Installed items stay
+// locked unless they are older than the profile's minimum version, and lists
+// the profile leaves out keep their defaults. Items still being detected are
+// picked once they are.
+func (m *Model) ApplyProfile(p *profile.Profile) {
+	m.prof = p
+	m.minVersions = p.MinVersions
+	m.catalog().Require(p.MinVersions)
+	for _, item := range m.catalog().Items() {
+		if !m.detecting[item.Name] {
+			m.preselect(item)
+		}
+	}
+	applyKeys := func(dst map[string]bool, keys, names []string) {
+		if names == nil {
+			return
+		}
+		for _, k := range keys {
+			dst[k] = slices.Contains(names, k)
+		}
+	}
+
+	if p.NodeVersions != nil {
+		m.fnmSelected = make(map[string]bool)
+		for _, v := range p.NodeVersions {
+			m.fnmSelected[v] = true
+		}
+	}
+	if p.MCPs != nil {
+		var names []string
+		for _, mcp := range m.mcps {
+			names = append(names, mcp.Name)
+		}
+		applyKeys(m.mcpSelected, names, p.MCPs)
+	}
+	applyKeys(m.extraSetup, tasks.ExtraSetupKeys(), p.ExtraSetup)
+	applyKeys(m.sysDefaults, tasks.SysDefaultKeys(), p.SysDefaults)
+
+	if p.Codex.Model != "" {
+		m.codexModel = p.Codex.Model
+	}
+	if p.Codex.ThinkingLevel != "" {
+		m.codexThink = p.Codex.ThinkingLevel
+	}
+	if p.Codex.BaseURL != "" {
+		m.codexURL = p.Codex.BaseURL
+	}
+	if p.Claude.Model != "" {
+		m.claudeModel = p.Claude.Model
+	}
+	if p.Claude.BaseURL != "" {
+		m.claudeURL = p.Claude.BaseURL
+	}
+}
+
+// preselect picks a detected item: missing items by default or, for a list
+// the profile sets, the profile's items that aren't installed
+func (m *Model) preselect(item *checker.Item) {
+	var names []string
+	if m.prof != nil {
+		switch item.Category {
+		case "dev":
+			names = m.prof.DevTools
+		case "app":
+			names = m.prof.Apps
+		case "ai":
+			names = m.prof.AITools
+		}
+	}
+	if names == nil {
+		m.selected[item.Name] = item.Status == checker.NotInstalled
+		return
+	}
+	m.selected[item.Name] = item.Status != checker.Installed && slices.Contains(names, item.Name)
+}
+
+// profile snapshots the wizard as a shareable profile. Installed items count
+// as selected, so a fully set-up machine exports its whole toolset.
+func (m Model) profile() profile.Profile {
+	sel := m.selection()
+	addInstalled := func(names []string, items []*checker.Item) []string {
+		for _, item := range items {
+			if item.Status != checker.NotInstalled && !slices.Contains(names, item.Name) {
+				names = append(names, item.Name)
+			}
+		}
+		return names
+	}
+	sel.DevTools = addInstalled(sel.DevTools, m.devTools)
+	sel.Apps = addInstalled(sel.Apps, m.apps)
+	sel.AITools = addInstalled(sel.AITools, m.aiTools)
+	return profile.FromSelection(sel)
+}
+
+// exportProfile writes the current choices to ./Freshfile.toml, or the next
+// free name if that exists
+func (m *Model) exportProfile() {
+	m.exportPath = profile.DefaultExportPath()
+	m.exportErr = profile.Save(m.profile(), m.exportPath)
+}
+
+// catalog returns the detected items the wizard is working with
+func (m Model) catalog() tasks.Catalog {
+	return tasks.Catalog{DevTools: m.devTools, Apps: m.apps, AITools: m.aiTools, MCPs: m.mcps}
 }
 
 func (m Model) Init() tea.Cmd {
-	return nil
+	return tea.Batch(detectItems(m.detectCh, m.catalog().Items()), waitForDetected(m.detectCh))
+}
+
+// detectedMsg carries one detected item; detectDoneMsg follows the last
+type (
+	detectedMsg   struct{ item *checker.Item }
+	detectDoneMsg struct{}
+)
+
+// detectItems detects copies of items in the background, sending each to ch
+// as it finishes so the checklist fills in progressively
+func detectItems(ch chan<- *checker.Item, items []*checker.Item) tea.Cmd {
+	copies := make([]*checker.Item, len(items))
+	for i, item := range items {
+		c := *item
+		copies[i] = &c
+	}
+	return func() tea.Msg {
+		checker.DetectAll(copies, func(item *checker.Item) { ch <- item })
+		close(ch)
+		return nil
+	}
+}
+
+// waitForDetected delivers the next detected item from ch
+func waitForDetected(ch <-chan *checker.Item) tea.Cmd {
+	return func() tea.Msg {
+		item, ok := <-ch
+		if !ok {
+			return detectDoneMsg{}
+		}
+		return detectedMsg{item}
+	}
+}
+
+// applyDetected copies a detection result onto the wizard's item, applies
+// the profile's minimum version and preselects it
+func (m *Model) applyDetected(found *checker.Item) {
+	for _, item := range m.catalog().Items() {
+		if item.Name != found.Name {
+			continue
+		}
+		item.Status, item.Version, item.Semver = found.Status, found.Version, found.Semver
+		if min, ok := m.minVersions[item.Name]; ok {
+			checker.Require(item, min)
+		}
+		delete(m.detecting, item.Name)
+		m.preselect(item)
+	}
+}
+
+// verifiedMsg carries the endpoint check of config form values
+type verifiedMsg struct {
+	values []string
+	report providers.Report
+}
+
+// outdatedMsg carries copies of the installed items, checked for newer
+// versions in the background after startup
+type outdatedMsg struct {
+	items []*checker.Item
+}
+
+// checkOutdated looks for upgrades on copies of items, so the wizard can be
+// used while brew, npm and rustup answer
+func checkOutdated(items []*checker.Item) tea.Cmd {
+	copies := make([]*checker.Item, len(items))
+	for i, item := range items {
+		c := *item
+		copies[i] = &c
+	}
+	return func() tea.Msg {
+		checker.CheckOutdated(context.Background(), copies)
+		return outdatedMsg{items: copies}
+	}
+}
+
+// applyOutdated marks the items found outdated; the install queue picks them
+// up as upgrades once the user selects them
+func (m *Model) applyOutdated(msg outdatedMsg) {
+	for _, found := range msg.items {
+		if found.Status != checker.Outdated {
+			continue
+		}
+		for _, item := range m.catalog().Items() {
+			if item.Name == found.Name && item.Status != checker.NotInstalled {
+				item.Status, item.Version, item.Latest = found.Status, found.Version, found.Latest
+			}
+		}
+	}
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -188,8 +551,14 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.installing = false
 		m.installDone = true
 		m.page = PageDone
+		m.cursor = 0
+		m.selectRetries(true)
 		return m, nil
 
+	case outputLineMsg:
+		msg.out.add(msg.line)
+		return m, waitForOutput(m.outputCh)
+
 	case spinner.TickMsg:
 		if m.installing {
 			var cmd tea.Cmd
@@ -198,6 +567,41 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		return m, nil
 
+	case detectedMsg:
+		m.applyDetected(msg.item)
+		return m, waitForDetected(m.detectCh)
+
+	case detectDoneMsg:
+		// upgrades can only be looked for once we know what is installed
+		outdated := checkOutdated(m.catalog().Items())
+		switch {
+		case m.resumePending:
+			m.resumePending = false
+			updated, cmd := m.resumeRun(m.resumeForce)
+			return updated, tea.Batch(outdated, cmd)
+		case m.reviewPending && m.page == PageSystemDefaults:
+			m.reviewPending = false
+			updated, cmd := m.nextPage()
+			return updated, tea.Batch(outdated, cmd)
+		}
+		return m, outdated
+
+	case outdatedMsg:
+		m.applyOutdated(msg)
+		return m, nil
+
+	case verifiedMsg:
+		if !m.verifying || !slices.Equal(msg.values, m.verifyValues) {
+			return m, nil // a check of values since left behind
+		}
+		m.verifying = false
+		m.verifyReport = &msg.report
+		onForm := m.page == PageCodexConfig || m.page == PageClaudeConfig
+		if onForm && !msg.report.Failed() && slices.Equal(msg.values, m.inputValues()) {
+			return m.nextPage()
+		}
+		return m, nil
+
 	case FnmVersionsMsg:
 		if msg.Err != nil {
 			m.err = msg.Err
@@ -224,6 +628,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.langCursor < 1 {
 					m.langCursor++
 				}
+			case "r", "f":
+				if m.resume != nil {
+					return m.resumeRun(msg.String() == "f")
+				}
+			case "x":
+				if m.resume != nil {
+					logStateErr(tasks.ClearState())
+					m.resume = nil
+				}
 			case "enter", " ":
 				if m.langCursor == 0 {
 					m.lang = LangEN
@@ -237,6 +650,34 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
+		// The add-server form takes every key; esc closes it
+		if m.addingMCP {
+			return m.updateAddMCP(msg)
+		}
+
+		// While installing: c/q stop after the running tasks, ctrl+c kills
+		// them; a second ctrl+c quits even if a task ignores the abort
+		if m.installing && m.sched != nil {
+			switch msg.String() {
+			case "c", "q":
+				if !m.sched.Stopped() {
+					return m, m.stopInstall(false)
+				}
+			case "ctrl+c":
+				if m.aborting {
+					return m, tea.Quit
+				}
+				return m, m.stopInstall(true)
+			case "o", "enter":
+				m.showOutput = !m.showOutput
+			case "up", "k":
+				m.moveLogCursor(-1)
+			case "down", "j":
+				m.moveLogCursor(1)
+			}
+			return m, nil
+		}
+
 		switch msg.String() {
 		case "ctrl+c", "q":
 			if m.page == PageWelcome || m.page == PageDone {
@@ -244,8 +685,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			// on other pages, q goes back
 			if m.page > PageWelcome && !m.installing {
-				m.page--
-				m.cursor = 0
+				m.prevPage()
 				return m, nil
 			}
 			return m, tea.Quit
@@ -257,8 +697,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		case "shift+tab", "left", "h":
 			if !m.installing && m.page > PageWelcome {
-				m.page--
-				m.cursor = 0
+				m.prevPage()
 			}
 
 		case "up", "k":
@@ -281,6 +720,28 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case "n":
 			m.selectNone()
 
+		case "e":
+			if m.page == PageDone && !m.uninstall {
+				m.exportProfile()
+				return m, nil
+			}
+
+		case "r":
+			if m.page == PageDone {
+				return m.retryFailed()
+			}
+
+		case "u":
+			if m.page == PageWelcome && len(m.added) > 0 {
+				return m.reviewUninstall()
+			}
+
+		case "o":
+			if m.page == PageDone {
+				m.showOutput = !m.showOutput
+				return m, nil
+			}
+
 		case "enter":
 			if m.page == PageWelcome {
 				m.page = PageDevTools
@@ -290,11 +751,18 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.page == PageDone {
 				return m, tea.Quit
 			}
+			if m.page == PageAIProfile {
+				m.toggleCurrent()
+			}
+			if m.page == PageMCP && m.cursor == len(m.mcps) {
+				m.initAddMCPInputs()
+				return m, nil
+			}
 			return m.nextPage()
 		}
 
 		// handle text input on config pages
-		if m.page == PageCodexConfig || m.page == PageClaudeConfig {
+		if m.page == PageCodexConfig || m.page == PageClaudeConfig || m.page == PageMCPEnv {
 			return m.updateInputs(msg)
 		}
 	}
@@ -316,16 +784,22 @@ func (m Model) nextPage() (Model, tea.Cmd) {
 	case PageFnmVersions:
 		m.page = PageAITools
 	case PageAITools:
-		if m.selected["Codex"] {
-			m.page = PageCodexConfig
-			m.initCodexInputs()
-		} else if m.selected["Claude Code"] {
-			m.page = PageClaudeConfig
-			m.initClaudeInputs()
+		if len(m.aiProfiles.Profiles) > 0 {
+			m.page = PageAIProfile
 		} else {
+			m.toConfigForms()
+		}
+	case PageAIProfile:
+		if m.aiProfile != "" {
+			// the profile replaces the config forms
 			m.page = PageMCP
+		} else {
+			m.toConfigForms()
 		}
 	case PageCodexConfig:
+		if cmd, wait := m.verifyForm(); wait {
+			return m, cmd
+		}
 		m.saveCodexInputs()
 		if m.selected["Claude Code"] {
 			m.page = PageClaudeConfig
@@ -334,13 +808,44 @@ func (m Model) nextPage() (Model, tea.Cmd) {
 			m.page = PageMCP
 		}
 	case PageClaudeConfig:
+		if cmd, wait := m.verifyForm(); wait {
+			return m, cmd
+		}
 		m.saveClaudeInputs()
 		m.page = PageMCP
 	case PageMCP:
 		m.page = PageExtraSetup
+		if len(m.mcpEnvFields()) > 0 {
+			m.page = PageMCPEnv
+			m.initMCPEnvInputs()
+		}
+	case PageMCPEnv:
+		m.saveMCPEnvInputs()
+		m.mcpEnvMissing = slices.ContainsFunc(m.mcpEnvFields(), func(f mcpEnvField) bool { return m.mcpEnv[f.env.Name] == "" })
+		if m.mcpEnvMissing {
+			return m, nil
+		}
+		if m.resumeEnv {
+			m.resumeEnv = false
+			updated, cmd := m.resumeRun(m.resumeForce)
+			return updated.(Model), cmd
+		}
+		m.page = PageExtraSetup
 	case PageExtraSetup:
 		m.page = PageSystemDefaults
 	case PageSystemDefaults:
+		if len(m.detecting) > 0 {
+			m.reviewPending = true // the plan needs to know what is installed
+			return m, nil
+		}
+		m.page = PageReview
+		m.reviewQueue, m.reviewErr = m.buildInstallQueue()
+		m.runState = nil
+		m.resumeDropped = nil
+	case PageReview:
+		if m.reviewErr != nil {
+			return m, nil
+		}
 		m.page = PageInstalling
 		m.installing = true
 		return m, m.startInstallSequence()
@@ -353,10 +858,54 @@ func (m Model) nextPage() (Model, tea.Cmd) {
 	return m, nil
 }
 
+// prevPage goes back a page; the uninstall plan goes back to the welcome page
+func (m *Model) prevPage() {
+	if m.resumeEnv {
+		// back to the resume prompt
+		m.resumeEnv = false
+		m.page = PageLang
+		m.cursor = 0
+		return
+	}
+	m.page--
+	if m.page == PageMCPEnv {
+		if len(m.mcpEnvFields()) > 0 {
+			m.initMCPEnvInputs()
+		} else {
+			m.page = PageMCP
+		}
+	}
+	if m.uninstall {
+		m.page = PageWelcome
+		m.uninstall = false
+		m.reviewQueue = nil
+	}
+	m.cursor = 0
+}
+
+// toConfigForms goes to the first config form for the selected AI tools, or
+// past them when there is none
+func (m *Model) toConfigForms() {
+	if m.selected["Codex"] {
+		m.page = PageCodexConfig
+		m.initCodexInputs()
+	} else if m.selected["Claude Code"] {
+		m.page = PageClaudeConfig
+		m.initClaudeInputs()
+	} else {
+		m.page = PageMCP
+	}
+}
+
 func (m *Model) initCodexInputs() {
 	m.inputs = make([]textinput.Model, 4)
 	placeholders := []string{"Model (e.g. o4-mini)", "Thinking level (low/medium/high)", "Base URL", "API Key"}
 	defaults := []string{"o4-mini", "medium", "https://api.openai.com/v1", ""}
+	for i, v := range []string{m.codexModel, m.codexThink, m.codexURL, m.codexKey} {
+		if v != "" {
+			defaults[i] = v
+		}
+	}
 	for i := range m.inputs {
 		t := textinput.New()
 		t.Placeholder = placeholders[i]
@@ -371,12 +920,18 @@ func (m *Model) initCodexInputs() {
 	}
 	m.inputFocus = 0
 	m.inputPage = PageCodexConfig
+	m.verifying, m.verifyReport, m.verifyValues = false, nil, nil
 }
 
 func (m *Model) initClaudeInputs() {
 	m.inputs = make([]textinput.Model, 3)
 	placeholders := []string{"Model (e.g. claude-sonnet-4-6)", "Base URL", "API Key"}
 	defaults := []string{"claude-sonnet-4-6", "https://api.anthropic.com", ""}
+	for i, v := range []string{m.claudeModel, m.claudeURL, m.claudeKey} {
+		if v != "" {
+			defaults[i] = v
+		}
+	}
 	for i := range m.inputs {
 		t := textinput.New()
 		t.Placeholder = placeholders[i]
@@ -391,6 +946,209 @@ func (m *Model) initClaudeInputs() {
 	}
 	m.inputFocus = 0
 	m.inputPage = PageClaudeConfig
+	m.verifying, m.verifyReport, m.verifyValues = false, nil, nil
+}
+
+// mcpEnvField is a variable a selected MCP server needs
+type mcpEnvField struct {
+	server string
+	env    catalog.MCPEnv
+}
+
+// mcpEnvFields lists the variables the selected MCP servers need, each once
+func (m Model) mcpEnvFields() []mcpEnvField {
+	var fields []mcpEnvField
+	for _, mcp := range m.mcps {
+		if !m.mcpSelected[mcp.Name] {
+			continue
+		}
+		for _, e := range mcp.Needs {
+			if !slices.ContainsFunc(fields, func(f mcpEnvField) bool { return f.env.Name == e.Name }) {
+				fields = append(fields, mcpEnvField{server: mcp.Name, env: e})
+			}
+		}
+	}
+	return fields
+}
+
+// initMCPEnvInputs sets up one input per variable, filled in with what was
+// typed before or else freshbox's own environment
+func (m *Model) initMCPEnvInputs() {
+	fields := m.mcpEnvFields()
+	m.inputs = make([]textinput.Model, len(fields))
+	for i, f := range fields {
+		t := textinput.New()
+		t.Placeholder = f.env.Name
+		t.SetValue(cmp.Or(m.mcpEnv[f.env.Name], os.Getenv(f.env.Name)))
+		if f.env.Secret {
+			t.EchoMode = textinput.EchoPassword
+		}
+		if i == 0 {
+			t.Focus()
+		}
+		m.inputs[i] = t
+	}
+	m.inputFocus = 0
+	m.inputPage = PageMCPEnv
+	m.mcpEnvMissing = false
+}
+
+func (m *Model) saveMCPEnvInputs() {
+	if m.mcpEnv == nil {
+		m.mcpEnv = make(map[string]string)
+	}
+	for i, f := range m.mcpEnvFields() {
+		if i < len(m.inputs) {
+			m.mcpEnv[f.env.Name] = strings.TrimSpace(m.inputs[i].Value())
+			if f.env.Secret {
+				redact.Add(m.mcpEnv[f.env.Name])
+			}
+		}
+	}
+}
+
+// initAddMCPInputs opens the form for a remote MCP server: name, URL,
+// transport and an optional bearer token
+func (m *Model) initAddMCPInputs() {
+	m.inputs = make([]textinput.Model, 4)
+	placeholders := []string{"my-server", "https://mcp.example.com/mcp", catalog.TransportHTTP + " / " + catalog.TransportSSE, ""}
+	for i := range m.inputs {
+		t := textinput.New()
+		t.Placeholder = placeholders[i]
+		if i == 2 {
+			t.SetValue(catalog.TransportHTTP)
+		}
+		if i == 3 {
+			t.EchoMode = textinput.EchoPassword
+		}
+		if i == 0 {
+			t.Focus()
+		}
+		m.inputs[i] = t
+	}
+	m.inputFocus = 0
+	m.inputPage = PageMCP
+	m.addingMCP, m.addMCPErr = true, nil
+}
+
+func (m Model) updateAddMCP(msg tea.KeyMsg) (Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.addingMCP, m.addMCPErr, m.inputs = false, nil, nil
+		return m, nil
+	case "ctrl+p":
+		return m, nil // no key to keep in plaintext here
+	case "enter":
+		if m.inputFocus == len(m.inputs)-1 {
+			if m.addMCPErr = m.addRemoteMCP(); m.addMCPErr == nil {
+				m.addingMCP, m.inputs = false, nil
+			}
+			return m, nil
+		}
+	}
+	return m.updateInputs(msg)
+}
+
+// addRemoteMCP saves the server in the form to the local catalog and selects
+// it. A bearer token becomes an Authorization header filled in from a
+// variable, so the token itself is kept out of catalog.toml.
+func (m *Model) addRemoteMCP() error {
+	v := m.inputValues()
+	for i := range v {
+		v[i] = strings.TrimSpace(v[i])
+	}
+	name, url, transport, token := v[0], v[1], cmp.Or(v[2], catalog.TransportHTTP), v[3]
+	if slices.ContainsFunc(m.mcps, func(s config.MCPServer) bool { return s.Name == name }) {
+		return fmt.Errorf(m.t.AddMCPExists, name)
+	}
+	entry := catalog.MCP{Name: name, Transport: transport, URL: url}
+	if token != "" {
+		env := tokenEnvName(name)
+		entry.Headers = map[string]string{"Authorization": "Bearer ${" + env + "}"}
+		entry.Env = []catalog.MCPEnv{{Name: env, Label: "Bearer token", Secret: true}}
+	}
+	if err := catalog.AddLocal(entry); err != nil {
+		return err
+	}
+	m.mcps = append(m.mcps, config.FromCatalog([]catalog.MCP{entry})...)
+	m.mcpSelected[name] = true
+	if token != "" {
+		if m.mcpEnv == nil {
+			m.mcpEnv = make(map[string]string)
+		}
+		m.mcpEnv[entry.Env[0].Name] = token
+		redact.Add(token)
+	}
+	m.cursor = len(m.mcps) - 1
+	return nil
+}
+
+// tokenEnvName names the variable holding a server's bearer token, e.g.
+// LINEAR_TOKEN for "linear"
+func tokenEnvName(server string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, server) + "_TOKEN"
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "MCP_" + name
+	}
+	return name
+}
+
+func (m Model) inputValues() []string {
+	values := make([]string, len(m.inputs))
+	for i, input := range m.inputs {
+		values[i] = input.Value()
+	}
+	return values
+}
+
+// formSettings reads the config form being edited
+func (m Model) formSettings() (tool string, s providers.Settings, key string) {
+	v := m.inputValues()
+	switch {
+	case m.inputPage == PageCodexConfig && len(v) >= 4:
+		return providers.Codex, providers.Settings{Model: v[0], ThinkingLevel: v[1], BaseURL: v[2]}, v[3]
+	case m.inputPage == PageClaudeConfig && len(v) >= 3:
+		return providers.Claude, providers.Settings{Model: v[0], BaseURL: v[1]}, v[2]
+	}
+	return "", providers.Settings{}, ""
+}
+
+// verifyForm checks the config form before it is saved. It reports wait
+// while the endpoint is being asked or when a field failed; advancing again
+// with the same values keeps them anyway. Without a key only the local
+// checks run, right away.
+func (m *Model) verifyForm() (cmd tea.Cmd, wait bool) {
+	if m.verifying {
+		return nil, true
+	}
+	values := m.inputValues()
+	if m.verifyReport != nil && slices.Equal(values, m.verifyValues) {
+		return nil, false
+	}
+	tool, settings, key := m.formSettings()
+	if tool == "" {
+		return nil, false
+	}
+	m.verifyValues = values
+	if key == "" {
+		report := providers.Verify(context.Background(), tool, settings, "")
+		m.verifyReport = &report
+		return nil, report.Failed()
+	}
+	m.verifying, m.verifyReport = true, nil
+	return func() tea.Msg {
+		return verifiedMsg{values: values, report: providers.Verify(context.Background(), tool, settings, key)}
+	}, true
 }
 
 func (m *Model) saveCodexInputs() {
@@ -399,6 +1157,7 @@ func (m *Model) saveCodexInputs() {
 		m.codexThink = m.inputs[1].Value()
 		m.codexURL = m.inputs[2].Value()
 		m.codexKey = m.inputs[3].Value()
+		redact.Add(m.codexKey)
 	}
 }
 
@@ -407,11 +1166,15 @@ func (m *Model) saveClaudeInputs() {
 		m.claudeModel = m.inputs[0].Value()
 		m.claudeURL = m.inputs[1].Value()
 		m.claudeKey = m.inputs[2].Value()
+		redact.Add(m.claudeKey)
 	}
 }
 
 func (m Model) updateInputs(msg tea.KeyMsg) (Model, tea.Cmd) {
 	switch msg.String() {
+	case "ctrl+p":
+		m.plaintextKeys = !m.plaintextKeys
+		return m, nil
 	case "tab", "down":
 		m.inputFocus++
 		if m.inputFocus >= len(m.inputs) {
@@ -454,21 +1217,21 @@ func (m *Model) toggleCurrent() {
 	case PageDevTools:
 		if m.cursor < len(m.devTools) {
 			item := m.devTools[m.cursor]
-			if item.Status == checker.NotInstalled {
+			if item.Status != checker.Installed && !m.detecting[item.Name] {
 				m.selected[item.Name] = !m.selected[item.Name]
 			}
 		}
 	case PageApps:
 		if m.cursor < len(m.apps) {
 			item := m.apps[m.cursor]
-			if item.Status == checker.NotInstalled {
+			if item.Status != checker.Installed && !m.detecting[item.Name] {
 				m.selected[item.Name] = !m.selected[item.Name]
 			}
 		}
 	case PageAITools:
 		if m.cursor < len(m.aiTools) {
 			item := m.aiTools[m.cursor]
-			if item.Status == checker.NotInstalled {
+			if item.Status != checker.Installed && !m.detecting[item.Name] {
 				m.selected[item.Name] = !m.selected[item.Name]
 			}
 		}
@@ -477,21 +1240,37 @@ func (m *Model) toggleCurrent() {
 			v := m.fnmVersions[m.cursor]
 			m.fnmSelected[v] = !m.fnmSelected[v]
 		}
+	case PageAIProfile:
+		// one choice: row 0 is the config forms, then the profiles
+		m.aiProfile = ""
+		if m.cursor > 0 && m.cursor <= len(m.aiProfiles.Profiles) {
+			m.aiProfile = m.aiProfiles.Profiles[m.cursor-1].Name
+		}
 	case PageMCP:
 		if m.cursor < len(m.mcps) {
 			name := m.mcps[m.cursor].Name
 			m.mcpSelected[name] = !m.mcpSelected[name]
+		} else {
+			m.initAddMCPInputs()
 		}
 	case PageSystemDefaults:
-		keys := []string{"browser_chrome", "editor_zed", "player_iina"}
+		keys := tasks.SysDefaultKeys()
 		if m.cursor < len(keys) {
 			m.sysDefaults[keys[m.cursor]] = !m.sysDefaults[keys[m.cursor]]
 		}
 	case PageExtraSetup:
-		keys := []string{"zed_theme", "kaku_init", "karabiner_kaku", "dev_workspace"}
+		keys := tasks.ExtraSetupKeys()
 		if m.cursor < len(keys) {
 			m.extraSetup[keys[m.cursor]] = !m.extraSetup[keys[m.cursor]]
 		}
+	case PageDone:
+		if failed := m.retryable(); m.cursor < len(failed) {
+			if m.retrySelected == nil {
+				m.retrySelected = make(map[int]bool)
+			}
+			i := failed[m.cursor]
+			m.retrySelected[i] = !m.retrySelected[i]
+		}
 	}
 }
 
@@ -499,13 +1278,13 @@ func (m *Model) selectAll() {
 	switch m.page {
 	case PageDevTools:
 		for _, item := range m.devTools {
-			if item.Status == checker.NotInstalled {
+			if item.Status != checker.Installed && !m.detecting[item.Name] {
 				m.selected[item.Name] = true
 			}
 		}
 	case PageApps:
 		for _, item := range m.apps {
-			if item.Status == checker.NotInstalled {
+			if item.Status != checker.Installed && !m.detecting[item.Name] {
 				m.selected[item.Name] = true
 			}
 		}
@@ -513,6 +1292,8 @@ func (m *Model) selectAll() {
 		for _, mcp := range m.mcps {
 			m.mcpSelected[mcp.Name] = true
 		}
+	case PageDone:
+		m.selectRetries(true)
 	}
 }
 
@@ -530,6 +1311,8 @@ func (m *Model) selectNone() {
 		for _, mcp := range m.mcps {
 			m.mcpSelected[mcp.Name] = false
 		}
+	case PageDone:
+		m.selectRetries(false)
 	}
 }
 
@@ -543,12 +1326,18 @@ func (m Model) currentListLen() int {
 		return len(m.aiTools)
 	case PageFnmVersions:
 		return len(m.fnmVersions)
+	case PageAIProfile:
+		return len(m.aiProfiles.Profiles) + 1
 	case PageMCP:
-		return len(m.mcps)
+		return len(m.mcps) + 1 // the last row adds a remote server
 	case PageSystemDefaults:
 		return 3
 	case PageExtraSetup:
 		return 4
+	case PageReview:
+		return max(len(m.reviewQueue), 1)
+	case PageDone:
+		return max(len(m.retryable()), 1)
 	default:
 		return 1
 	}
@@ -39,6 +39,10 @@ var (
 	NotInstalledStyle = lipgloss.NewStyle().
 				Foreground(Yellow)
 
+	OutdatedStyle = lipgloss.NewStyle().
+			Foreground(Cyan).
+			Italic(true)
+
 	SelectedStyle = lipgloss.NewStyle().
 			Foreground(Cyan).
 			Bold(true)
@@ -1,17 +1,32 @@
 package ui
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/kittors/freshbox/internal/checker"
+	"github.com/kittors/freshbox/internal/config"
+	"github.com/kittors/freshbox/internal/history"
+	"github.com/kittors/freshbox/internal/ledger"
+	"github.com/kittors/freshbox/internal/profile"
+	"github.com/kittors/freshbox/internal/providers"
+	"github.com/kittors/freshbox/internal/runner"
+	"github.com/kittors/freshbox/internal/tasks"
 )
 
 // --- Model Creation ---
 
 func TestNewModel(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 
 	if m.page != PageLang {
 		t.Errorf("initial page = %d, want PageLang (%d)", m.page, PageLang)
@@ -69,17 +84,150 @@ func TestNewModel(t *testing.T) {
 }
 
 func TestModelInit(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
+	if m.Init() == nil {
+		t.Error("Init should start detection")
+	}
+}
+
+func TestOutdatedCheckMarksItems(t *testing.T) {
+	f := runner.NewFake().
+		Path("brew", "/opt/homebrew/bin/brew").
+		On("brew outdated --json=v2", runner.Response{Stdout: `{"formulae":[{"name":"git","installed_versions":["2.39.3"],"current_version":"2.44.0"}],"casks":[]}`})
+	defer runner.Use(f)()
+	m := createModelOnPage(PageDevTools)
+	var git *checker.Item
+	for _, item := range m.devTools {
+		item.Status = checker.NotInstalled
+		if item.Name == "Git" {
+			item.Status, git = checker.Installed, item
+		}
+	}
+
+	msg := checkOutdated(m.catalog().Items())()
+	if git.Status != checker.Installed {
+		t.Fatal("the check must work on copies, not the model's items")
+	}
+	updated, _ := m.Update(msg)
+	m = updated.(Model)
+	if git.Status != checker.Outdated || git.Version != "2.39.3" || git.Latest != "2.44.0" {
+		t.Fatalf("git = %v %q → %q", git.Status, git.Version, git.Latest)
+	}
+	if !strings.Contains(m.View(), "2.39.3 → 2.44.0") {
+		t.Error("checklist should show old → new")
+	}
+	for i, item := range m.devTools {
+		if item == git {
+			m.cursor = i
+		}
+	}
+	m.selected = map[string]bool{}
+	m.toggleCurrent()
+	if !m.selected["Git"] {
+		t.Error("an outdated item should be selectable")
+	}
+	if queue, err := m.buildInstallQueue(); err != nil || queue[0].ID != "dev:Git" || queue[0].Commands[0] != "brew upgrade git" {
+		t.Errorf("first task = %+v, want the Git upgrade", queue[0])
+	}
+}
+
+func TestProfileMinVersionUnlocksTooOldItem(t *testing.T) {
+	m := createModelOnPage(PageDevTools)
+	m.width = 160
+	var java *checker.Item
+	for _, item := range m.devTools {
+		item.Status = checker.NotInstalled
+		if item.Name == "Java (JDK)" {
+			item.Status, item.Version, item.Semver = checker.Installed, "openjdk 17.0.10 2024-01-16", checker.Semver{Major: 17, Patch: 10}
+			java = item
+		}
+	}
+	m.ApplyProfile(&profile.Profile{Version: 1, DevTools: []string{"Java (JDK)"}, MinVersions: map[string]string{"Java (JDK)": "21"}})
+	if java.Status != checker.Outdated || !m.selected["Java (JDK)"] {
+		t.Fatalf("java 17 below the profile's 21: status=%v selected=%v", java.Status, m.selected["Java (JDK)"])
+	}
+	if !strings.Contains(m.View(), "needs upgrade to ≥ 21") {
+		t.Errorf("checklist should say it needs an upgrade:\n%s", m.View())
+	}
+	if m.selection().MinVersions["Java (JDK)"] != "21" || m.profile().MinVersions["Java (JDK)"] != "21" {
+		t.Error("the minimum should carry into the selection and exports")
+	}
+	if queue, err := m.buildInstallQueue(); err != nil || queue[0].ID != "dev:Java (JDK)" || queue[0].Commands[0] != "brew install openjdk" {
+		t.Errorf("first task = %+v, want Java installed over the old one", queue[0])
+	}
+}
+
+func TestDetectionFillsInProgressively(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer runner.Use(runner.NewFake().
+		Path("git", "/opt/homebrew/bin/git").
+		On("/opt/homebrew/bin/git --version", runner.Response{Stdout: "git version 2.44.0\n"}))()
+
+	m := NewModel(testCatalog())
+	m.page, m.width, m.height = PageDevTools, 120, 40
+	m.ApplyProfile(&profile.Profile{Version: 1, DevTools: []string{"Git", "Go"}})
+	if len(m.detecting) != len(m.catalog().Items()) || !strings.Contains(m.View(), "detecting…") {
+		t.Fatal("every item should start out detecting")
+	}
+	m.toggleCurrent()
+	if m.selected["Homebrew"] {
+		t.Error("an item can't be toggled while it is being detected")
+	}
+
+	// results arrive one at a time through Update
 	cmd := m.Init()
-	if cmd != nil {
-		t.Error("Init should return nil")
+	if cmd == nil {
+		t.Fatal("Init should start detection")
+	}
+	detectItems(m.detectCh, m.catalog().Items())()
+	for {
+		msg := waitForDetected(m.detectCh)()
+		updated, next := m.Update(msg)
+		m = updated.(Model)
+		if _, done := msg.(detectDoneMsg); done {
+			if next == nil {
+				t.Error("the outdated check should start once detection is done")
+			}
+			break
+		}
+		if next == nil {
+			t.Fatal("each result should wait for the next")
+		}
+	}
+
+	if len(m.detecting) != 0 || strings.Contains(m.View(), "detecting…") {
+		t.Error("detection should be finished")
+	}
+	if !m.selected["Go"] || m.selected["Git"] || m.selected["Homebrew"] {
+		t.Errorf("the profile should apply as items are detected: %v", m.selected)
+	}
+	for _, item := range m.devTools {
+		if item.Name == "Git" && (item.Status != checker.Installed || item.Semver != (checker.Semver{Major: 2, Minor: 44})) {
+			t.Errorf("git = %v %v", item.Status, item.Semver)
+		}
+	}
+}
+
+func TestReviewWaitsForDetection(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer runner.Use(runner.NewFake())()
+	m := NewModel(testCatalog())
+	m.page = PageSystemDefaults
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	if m.page != PageSystemDefaults || !m.reviewPending {
+		t.Fatalf("review should wait for detection, page=%d", m.page)
+	}
+	updated, _ = detected(m).Update(detectDoneMsg{})
+	if m = updated.(Model); m.page != PageReview || len(m.reviewQueue) == 0 {
+		t.Errorf("review should open once detection is done, page=%d", m.page)
 	}
 }
 
 // --- Language Selection ---
 
 func TestLangSelection(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 
 	// Start on language page
 	if m.page != PageLang {
@@ -119,7 +267,7 @@ func TestLangSelection(t *testing.T) {
 }
 
 func TestLangSelectionChinese(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 
 	// Move to Chinese
 	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyDown})
@@ -330,7 +478,7 @@ func TestToggleSystemDefaults(t *testing.T) {
 // --- currentListLen ---
 
 func TestCurrentListLen(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 	m.lang = LangEN
 	m.t = GetText(LangEN)
 
@@ -359,7 +507,7 @@ func TestCurrentListLen(t *testing.T) {
 // --- Window Size ---
 
 func TestWindowSizeMsg(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 	updated, _ := m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
 	m = updated.(Model)
 	if m.width != 120 || m.height != 40 {
@@ -370,7 +518,7 @@ func TestWindowSizeMsg(t *testing.T) {
 // --- View Rendering ---
 
 func TestViewLoadingState(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 	m.width = 0 // simulates no WindowSizeMsg yet
 	view := m.View()
 	if view != "Loading..." {
@@ -379,7 +527,7 @@ func TestViewLoadingState(t *testing.T) {
 }
 
 func TestViewRendersWithSize(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 	m.width = 80
 	m.height = 24
 	m.page = PageWelcome
@@ -409,7 +557,7 @@ func TestRenderCheckList(t *testing.T) {
 // --- Config Form ---
 
 func TestInitCodexInputs(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 	m.initCodexInputs()
 
 	if len(m.inputs) != 4 {
@@ -431,7 +579,7 @@ func TestInitCodexInputs(t *testing.T) {
 }
 
 func TestInitClaudeInputs(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 	m.initClaudeInputs()
 
 	if len(m.inputs) != 3 {
@@ -446,7 +594,7 @@ func TestInitClaudeInputs(t *testing.T) {
 }
 
 func TestSaveCodexInputs(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 	m.initCodexInputs()
 	m.inputs[0].SetValue("gpt-4")
 	m.inputs[1].SetValue("high")
@@ -469,7 +617,7 @@ func TestSaveCodexInputs(t *testing.T) {
 }
 
 func TestSaveClaudeInputs(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 	m.initClaudeInputs()
 	m.inputs[0].SetValue("claude-3")
 	m.inputs[1].SetValue("https://custom.url")
@@ -487,10 +635,296 @@ func TestSaveClaudeInputs(t *testing.T) {
 	}
 }
 
+func TestConfigFormTogglesPlaintextKeys(t *testing.T) {
+	m := createModelOnPage(PageClaudeConfig)
+	m.initClaudeInputs()
+	if m.plaintextKeys || !strings.Contains(m.View(), "not in the config file") {
+		t.Fatal("keys should go to the secret store by default")
+	}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlP})
+	m = updated.(Model)
+	if !m.plaintextKeys || !strings.Contains(m.View(), "plaintext") {
+		t.Error("ctrl+p should switch to plaintext keys")
+	}
+	if !m.selection().Claude.PlaintextKey || !m.selection().Codex.PlaintextKey {
+		t.Error("plaintext choice should reach the selection")
+	}
+}
+
+func TestAIProfilePageReplacesConfigForms(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	set := providers.Set{Active: map[string]string{providers.Claude: "gw"}}
+	set.Put(providers.Profile{
+		Name:   "gw",
+		Codex:  &providers.Settings{Model: "gpt-5", BaseURL: "https://gw/v1"},
+		Claude: &providers.Settings{Model: "claude-sonnet-4-6", BaseURL: "https://gw"},
+	})
+	set.Save()
+
+	m := createModelOnPage(PageAITools)
+	m.selected["Codex"] = true
+	m, _ = m.nextPage()
+	if m.page != PageAIProfile {
+		t.Fatalf("page = %v, want the profile page", m.page)
+	}
+	view := m.View()
+	for _, want := range []string{"Enter settings on the next pages", "gpt-5 @ https://gw/v1", "active for claude"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view missing %q", want)
+		}
+	}
+
+	// enter on the profile row picks it and skips the config forms
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	updated, _ = updated.(Model).Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	if m.page != PageMCP || m.selection().AIProfile != "gw" {
+		t.Errorf("page = %v, profile = %q", m.page, m.selection().AIProfile)
+	}
+	found := false
+	queue, err := m.buildInstallQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range queue {
+		found = found || task.Name == "Switch AI provider → gw"
+	}
+	if !found {
+		t.Error("the switch should be queued")
+	}
+
+	// the first row goes back to typing the settings in
+	m.page, m.cursor = PageAIProfile, 0
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	if m.page != PageCodexConfig || m.aiProfile != "" {
+		t.Errorf("page = %v, profile = %q", m.page, m.aiProfile)
+	}
+}
+
+func TestNoAIProfilesSkipsThePage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := createModelOnPage(PageAITools)
+	m.selected["Codex"], m.selected["Claude Code"] = false, true
+	m, _ = m.nextPage()
+	if m.page != PageClaudeConfig {
+		t.Errorf("page = %v, want the Claude form", m.page)
+	}
+}
+
+// gatewayStandIn answers an OpenAI-style models list for the key sk-good
+func gatewayStandIn(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-good" {
+			http.Error(w, "bad key", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"data": [{"id": "gpt-5"}]}`)
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(providers.UseClient(srv.Client()))
+	return srv
+}
+
+func TestCodexFormChecksTheEndpoint(t *testing.T) {
+	srv := gatewayStandIn(t)
+	m := createModelOnPage(PageCodexConfig)
+	m.selected["Claude Code"] = false
+	m.initCodexInputs()
+	m.inputs[0].SetValue("gpt-5")
+	m.inputs[1].SetValue("high")
+	m.inputs[2].SetValue(srv.URL)
+	m.inputs[3].SetValue("sk-bad")
+
+	m, cmd := m.nextPage()
+	if m.page != PageCodexConfig || !m.verifying || cmd == nil {
+		t.Fatalf("page = %v, verifying = %v: the form should wait for the check", m.page, m.verifying)
+	}
+	if !strings.Contains(m.View(), "Checking the endpoint") {
+		t.Error("view should say the check is running")
+	}
+	updated, _ := m.Update(cmd())
+	m = updated.(Model)
+	view := m.View()
+	if m.page != PageCodexConfig || !strings.Contains(view, "✗ rejected by the endpoint (401)") || !strings.Contains(view, "press enter again") {
+		t.Fatalf("a rejected key should keep the form open:\n%s", view)
+	}
+	if strings.Contains(view, "sk-bad") {
+		t.Error("the key leaked into the view")
+	}
+
+	// fixing the key checks again and moves on by itself
+	m.inputs[3].SetValue("sk-good")
+	m, cmd = m.nextPage()
+	updated, _ = m.Update(cmd())
+	m = updated.(Model)
+	if m.page != PageMCP || m.codexKey != "sk-good" || m.codexURL != srv.URL {
+		t.Errorf("page = %v, key = %q, url = %q", m.page, m.codexKey, m.codexURL)
+	}
+}
+
+func TestConfigFormKeepsFailingValuesOnSecondEnter(t *testing.T) {
+	m := createModelOnPage(PageClaudeConfig)
+	m.initClaudeInputs()
+	m.inputs[1].SetValue("gw.example.com")
+
+	// no key: only the local checks run, without a request
+	m, cmd := m.nextPage()
+	if m.page != PageClaudeConfig || cmd != nil || m.verifying {
+		t.Fatalf("page = %v: a bad URL should keep the form open", m.page)
+	}
+	if !strings.Contains(m.View(), "✗ want an http:// or https:// URL") {
+		t.Error("the URL should be marked")
+	}
+
+	m, _ = m.nextPage()
+	if m.page != PageMCP || m.claudeURL != "gw.example.com" {
+		t.Errorf("page = %v, url = %q: enter again should keep the value", m.page, m.claudeURL)
+	}
+}
+
+func TestStaleCheckIsIgnored(t *testing.T) {
+	srv := gatewayStandIn(t)
+	m := createModelOnPage(PageCodexConfig)
+	m.initCodexInputs()
+	m.inputs[2].SetValue(srv.URL)
+	m.inputs[3].SetValue("sk-good")
+	m, cmd := m.nextPage()
+	msg := cmd()
+
+	// back out and in again before the answer arrives
+	m.page = PageAITools
+	m.initCodexInputs()
+	m.page = PageCodexConfig
+	updated, _ := m.Update(msg)
+	m = updated.(Model)
+	if m.page != PageCodexConfig || m.verifyReport != nil {
+		t.Errorf("page = %v: a check of earlier values should be dropped", m.page)
+	}
+}
+
+func TestMCPEnvPageAsksForCredentials(t *testing.T) {
+	t.Setenv("GITHUB_PERSONAL_ACCESS_TOKEN", "")
+	t.Setenv("SLACK_BOT_TOKEN", "")
+	t.Setenv("SLACK_TEAM_ID", "T0123")
+	m := createModelOnPage(PageMCP)
+	m.mcpSelected["GitHub"], m.mcpSelected["Slack"] = true, true
+
+	m, _ = m.nextPage()
+	if m.page != PageMCPEnv || len(m.inputs) != 3 {
+		t.Fatalf("page = %v with %d inputs, want the credentials form", m.page, len(m.inputs))
+	}
+	view := m.View()
+	for _, want := range []string{"GitHub · Personal access token", "SLACK_BOT_TOKEN", "T0123"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("view missing %q", want)
+		}
+	}
+
+	m, _ = m.nextPage()
+	if m.page != PageMCPEnv || !strings.Contains(m.View(), "✗ required") {
+		t.Fatal("empty fields should keep the form open")
+	}
+
+	m.inputs[0].SetValue("gh-token-for-tests")
+	m.inputs[1].SetValue("slack-token-for-tests")
+	if strings.Contains(m.View(), "gh-token-for-tests") {
+		t.Error("secret values should be masked")
+	}
+	m, _ = m.nextPage()
+	env := m.selection().MCPEnv
+	if m.page != PageExtraSetup || env["GITHUB_PERSONAL_ACCESS_TOKEN"] != "gh-token-for-tests" || env["SLACK_TEAM_ID"] != "T0123" {
+		t.Errorf("page = %v, env = %v", m.page, env)
+	}
+
+	// back again shows what was typed; without such servers the page is skipped
+	m.prevPage()
+	if m.page != PageMCPEnv || m.inputs[1].Value() != "slack-token-for-tests" {
+		t.Errorf("page = %v", m.page)
+	}
+	m.page = PageMCP
+	m.mcpSelected["GitHub"], m.mcpSelected["Slack"] = false, false
+	if m, _ = m.nextPage(); m.page != PageExtraSetup {
+		t.Errorf("page = %v, want extra setup", m.page)
+	}
+	if m.prevPage(); m.page != PageMCP {
+		t.Errorf("back went to %v", m.page)
+	}
+	if m.selection().MCPEnv != nil {
+		t.Error("values of deselected servers should be left out")
+	}
+}
+
+func TestAddRemoteMCPFromTheList(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	m := createModelOnPage(PageMCP)
+	n := len(m.mcps)
+	m.cursor = n
+	if !strings.Contains(m.View(), "+ Add a remote server by URL") {
+		t.Fatal("the list should end with the add row")
+	}
+	press := func(msg tea.KeyMsg) {
+		updated, _ := m.Update(msg)
+		m = updated.(Model)
+	}
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if !m.addingMCP || !strings.Contains(m.View(), "Add a Remote MCP Server") {
+		t.Fatal("enter on the add row should open the form")
+	}
+	// list keys are typed into the form rather than navigating
+	for _, r := range "linear-qa" {
+		press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	if m.page != PageMCP || m.inputs[0].Value() != "linear-qa" {
+		t.Fatalf("page = %v, name = %q", m.page, m.inputs[0].Value())
+	}
+	m.inputs[1].SetValue("mcp.linear.app")
+	m.inputs[3].SetValue("linear-token-for-tests")
+	m.inputFocus = 3
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if !m.addingMCP || !strings.Contains(m.View(), "not an http:// or https:// URL") {
+		t.Fatal("a bad URL should keep the form open with the reason")
+	}
+
+	m.inputs[1].SetValue("https://mcp.linear.app/mcp")
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.addingMCP || len(m.mcps) != n+1 || !m.mcpSelected["linear-qa"] {
+		t.Fatalf("adding = %v, %d servers", m.addingMCP, len(m.mcps))
+	}
+	if view := m.View(); !strings.Contains(view, "(http https://mcp.linear.app/mcp)") {
+		t.Errorf("view:\n%s", view)
+	}
+	data, _ := os.ReadFile(filepath.Join(home, ".freshbox", "catalog.toml"))
+	if !strings.Contains(string(data), "${LINEAR_QA_TOKEN}") || strings.Contains(string(data), "linear-token-for-tests") {
+		t.Errorf("catalog.toml should refer to the token, not hold it:\n%s", data)
+	}
+	if env := m.selection().MCPEnv; env["LINEAR_QA_TOKEN"] != "linear-token-for-tests" {
+		t.Errorf("env = %v", env)
+	}
+
+	// the same name again is refused; esc leaves the list as it was
+	m.cursor = len(m.mcps)
+	press(tea.KeyMsg{Type: tea.KeySpace})
+	m.inputs[0].SetValue("linear-qa")
+	m.inputs[1].SetValue("https://example.com/mcp")
+	m.inputFocus = 3
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if !m.addingMCP || m.addMCPErr == nil || !strings.Contains(m.addMCPErr.Error(), "already an MCP server") {
+		t.Errorf("err = %v", m.addMCPErr)
+	}
+	press(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.addingMCP || len(m.mcps) != n+1 || m.page != PageMCP {
+		t.Errorf("esc: adding = %v, page = %v", m.addingMCP, m.page)
+	}
+}
+
 // --- Install Queue ---
 
 func TestBuildInstallQueue_Empty(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 	// Deselect everything
 	for k := range m.selected {
 		m.selected[k] = false
@@ -505,14 +939,17 @@ func TestBuildInstallQueue_Empty(t *testing.T) {
 		m.extraSetup[k] = false
 	}
 
-	queue := m.buildInstallQueue()
+	queue, err := m.buildInstallQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
 	if len(queue) != 0 {
 		t.Errorf("empty selection should produce empty queue, got %d items", len(queue))
 	}
 }
 
 func TestBuildInstallQueue_WithSysDefaults(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 	// Deselect all except system defaults
 	for k := range m.selected {
 		m.selected[k] = false
@@ -529,10 +966,13 @@ func TestBuildInstallQueue_WithSysDefaults(t *testing.T) {
 		"player_iina":    false,
 	}
 
-	queue := m.buildInstallQueue()
+	queue, err := m.buildInstallQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
 	found := false
 	for _, task := range queue {
-		if strings.Contains(task.name, "Chrome") {
+		if strings.Contains(task.Name, "Chrome") {
 			found = true
 		}
 	}
@@ -542,7 +982,7 @@ func TestBuildInstallQueue_WithSysDefaults(t *testing.T) {
 }
 
 func TestBuildInstallQueue_WithExtraSetup(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 	for k := range m.selected {
 		m.selected[k] = false
 	}
@@ -559,10 +999,13 @@ func TestBuildInstallQueue_WithExtraSetup(t *testing.T) {
 		"dev_workspace":  true,
 	}
 
-	queue := m.buildInstallQueue()
+	queue, err := m.buildInstallQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
 	names := []string{}
 	for _, task := range queue {
-		names = append(names, task.name)
+		names = append(names, task.Name)
 	}
 
 	foundZed := false
@@ -583,6 +1026,597 @@ func TestBuildInstallQueue_WithExtraSetup(t *testing.T) {
 	}
 }
 
+// --- Review ---
+
+func TestSystemDefaultsGoesToReview(t *testing.T) {
+	m := createModelOnPage(PageSystemDefaults)
+	for k := range m.selected {
+		m.selected[k] = false
+	}
+	m.mcpSelected = map[string]bool{}
+	m.sysDefaults = map[string]bool{"editor_zed": true}
+	m.extraSetup = map[string]bool{}
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyTab})
+	m = updated.(Model)
+	if m.page != PageReview {
+		t.Fatalf("page = %d, want PageReview", m.page)
+	}
+	if m.installing || cmd != nil {
+		t.Error("review page must not start installing")
+	}
+	if len(m.reviewQueue) == 0 || !strings.Contains(m.reviewQueue[0].Name, "Zed") {
+		t.Errorf("reviewQueue = %v", m.reviewQueue)
+	}
+
+	view := m.View()
+	if !strings.Contains(view, "defaults write") {
+		t.Error("review page should show command lines")
+	}
+}
+
+func TestReviewConfirmStartsInstall(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := createModelOnPage(PageReview)
+	m.reviewQueue = []installTask{{Name: "noop", Fn: func(context.Context) error { return nil }}}
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	if m.page != PageInstalling || !m.installing {
+		t.Errorf("enter on review should start installing, page = %d", m.page)
+	}
+	if cmd == nil {
+		t.Error("expected install command")
+	}
+	if m.installTotal != 1 || len(m.sched.Running()) != 1 {
+		t.Errorf("install should run the reviewed queue, total=%d", m.installTotal)
+	}
+}
+
+func TestInstallSkipsDependentsOfFailedTask(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := createModelOnPage(PageReview)
+	m.reviewQueue = []installTask{
+		{ID: "brew", Name: "Homebrew", Fn: func(context.Context) error { return errors.New("offline") }},
+		{ID: "git", Name: "Git", Needs: []string{"brew"}, Fn: func(context.Context) error { t.Error("Git must not run"); return nil }},
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+
+	cmd := m.HandleInstallMsg(InstallMsg{Index: 0, Name: "Homebrew", Err: errors.New("offline")})
+	if _, ok := cmd().(installDoneMsg); !ok {
+		t.Error("install should finish once the dependent is skipped")
+	}
+
+	if len(m.installLog) != 2 || !m.installLog[1].skipped {
+		t.Fatalf("installLog = %+v", m.installLog)
+	}
+	if !strings.Contains(m.installLog[1].errMsg, "dependency failed: Homebrew") {
+		t.Errorf("skip reason = %q", m.installLog[1].errMsg)
+	}
+}
+
+func TestInstallRunsIndependentTasksConcurrently(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := createModelOnPage(PageReview)
+	m.SetWorkers(2)
+	noop := func(context.Context) error { return nil }
+	m.reviewQueue = []installTask{
+		{ID: "git", Name: "Git", Lock: tasks.LockBrew, Fn: noop},
+		{ID: "go", Name: "Go", Lock: tasks.LockBrew, Fn: noop},
+		{ID: "ws", Name: "Workspace", Fn: noop},
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+
+	// Git and Workspace run together; Go waits for the brew lock
+	if got := m.sched.Running(); len(got) != 2 || got[0] != 0 || got[1] != 2 {
+		t.Errorf("running = %v, want [0 2]", got)
+	}
+	view := m.renderInstallProgress()
+	if strings.Count(view, "Installing") < 2 {
+		t.Errorf("expected a spinner per running task:\n%s", view)
+	}
+
+	m.HandleInstallMsg(InstallMsg{Index: 0, Name: "Git"})
+	if got := m.sched.Running(); len(got) != 2 || got[0] != 1 {
+		t.Errorf("Go should start once Git releases brew, running = %v", got)
+	}
+}
+
+func TestInstallCancelAfterCurrentTask(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := createModelOnPage(PageReview)
+	m.width, m.height = 120, 60
+	m.SetWorkers(1)
+	noop := func(context.Context) error { return nil }
+	m.reviewQueue = []installTask{
+		{ID: "a", Name: "A", Fn: noop},
+		{ID: "b", Name: "B", Fn: noop},
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("c")})
+	m = updated.(Model)
+	if !m.sched.Stopped() || m.aborting {
+		t.Fatal("c should stop scheduling without aborting")
+	}
+	if m.installCtx.Err() != nil {
+		t.Error("the running task must not be cancelled")
+	}
+	if len(m.installLog) != 1 || !m.installLog[0].skipped || m.installLog[0].errMsg != tasks.ErrCancelled.Error() {
+		t.Errorf("B should be skipped as cancelled: %+v", m.installLog)
+	}
+	if !strings.Contains(m.View(), m.t.InstallStopping) {
+		t.Error("progress page should say it is stopping")
+	}
+
+	cmd := m.HandleInstallMsg(InstallMsg{Index: 0, Name: "A"})
+	if _, ok := cmd().(installDoneMsg); !ok {
+		t.Error("install should finish once the running task does")
+	}
+}
+
+func TestInstallAbortCancelsRunningTasks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := createModelOnPage(PageReview)
+	m.SetWorkers(1)
+	m.reviewQueue = []installTask{
+		{ID: "a", Name: "A", Fn: func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }},
+		{ID: "b", Name: "B", Fn: func(context.Context) error { return nil }},
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	ctx := m.installCtx
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	m = updated.(Model)
+	if !m.aborting || ctx.Err() == nil {
+		t.Fatal("ctrl+c should cancel the running tasks")
+	}
+	if len(m.installLog) != 1 || !m.installLog[0].skipped {
+		t.Errorf("B should be skipped: %+v", m.installLog)
+	}
+
+	// A returns once its context is cancelled
+	err := m.installQueue[0].Exec(ctx)
+	cmd := m.HandleInstallMsg(InstallMsg{Index: 0, Name: "A", Err: err})
+	if _, ok := cmd().(installDoneMsg); !ok {
+		t.Error("install should finish after the abort")
+	}
+	if state, _ := tasks.LoadState(); state == nil || state.Remaining() != 2 {
+		t.Error("an aborted run should be saved for resume")
+	}
+}
+
+func TestInstallSecondCtrlCQuits(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := createModelOnPage(PageReview)
+	m.reviewQueue = []installTask{
+		{ID: "a", Name: "A", Fn: func(context.Context) error { return nil }},
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	m = updated.(Model)
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	if cmd == nil {
+		t.Fatal("second ctrl+c should quit")
+	}
+	if _, ok := cmd().(tea.QuitMsg); !ok {
+		t.Error("second ctrl+c should quit")
+	}
+}
+
+func TestInstallTimeoutOverride(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := createModelOnPage(PageReview)
+	m.SetTimeout(time.Minute)
+	m.reviewQueue = []installTask{
+		{ID: "a", Name: "A", Timeout: time.Hour, Fn: func(context.Context) error { return nil }},
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	if m.installQueue[0].Timeout != time.Minute {
+		t.Errorf("timeout = %s, want 1m", m.installQueue[0].Timeout)
+	}
+}
+
+// --- Output ---
+
+// drainOutput applies every output line waiting on the model's channel
+func drainOutput(m Model) Model {
+	for len(m.outputCh) > 0 {
+		updated, _ := m.Update(<-m.outputCh)
+		m = updated.(Model)
+	}
+	return m
+}
+
+func TestInstallStreamsTaskOutput(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	fake := runner.NewFake().On("brew install --cask zed", runner.Response{Stdout: "==> Downloading zed\n==> Installing zed\n"})
+	defer runner.Use(fake)()
+
+	m := createModelOnPage(PageReview)
+	m.width, m.height = 120, 60
+	m.reviewQueue = []installTask{{ID: "zed", Name: "Zed", Fn: func(ctx context.Context) error {
+		_, err := runner.Run(ctx, "brew", "install", "--cask", "zed")
+		return err
+	}}}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+
+	// run the task under the context dispatch gives it
+	err := m.installQueue[0].Exec(m.taskContext(0))
+	m = drainOutput(m)
+	if got := m.outputs[0].last(1); len(got) != 1 || got[0] != "==> Installing zed" {
+		t.Fatalf("running output = %v", got)
+	}
+	if view := m.renderInstallProgress(); !strings.Contains(view, "│ ==> Installing zed") {
+		t.Errorf("progress should show the latest line under the spinner:\n%s", view)
+	}
+
+	// o opens the pane for the running task
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("o")})
+	m = updated.(Model)
+	if view := m.renderInstallProgress(); !strings.Contains(view, "$ brew install --cask zed") || !strings.Contains(view, "==> Downloading zed") {
+		t.Errorf("output pane should show the full output:\n%s", view)
+	}
+
+	m.HandleInstallMsg(InstallMsg{Index: 0, Name: "Zed", Err: err})
+	if out := m.installLog[0].output; out == nil || len(out.lines) != 3 {
+		t.Errorf("finished entry should keep its output: %+v", out)
+	}
+
+	data, err := os.ReadFile(filepath.Join(home, ".freshbox", "install.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "[Zed] ==> Downloading zed") {
+		t.Errorf("install.log should have the output tagged by task:\n%s", data)
+	}
+}
+
+func TestOutputPaneFollowsCursor(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := createModelOnPage(PageInstalling)
+	m.width, m.height = 120, 60
+	m.installing = true
+	m.installQueue = []installTask{{Name: "C"}}
+	m.sched = tasks.NewScheduler(m.installQueue, 1)
+	m.sched.Next()
+	m.outputs = map[int]*taskOutput{0: {lines: []string{"c output"}}}
+	m.installLog = []installLogEntry{
+		{name: "A", success: true, output: &taskOutput{lines: []string{"a output"}}},
+		{name: "B", success: true, output: &taskOutput{lines: []string{"b output"}}},
+	}
+	m.logCursor = -1
+	m.showOutput = true
+
+	if f := m.outputFocus(); f != 2 {
+		t.Fatalf("focus = %d, want the running task", f)
+	}
+	m.moveLogCursor(-1)
+	if !strings.Contains(m.renderInstallProgress(), "b output") {
+		t.Error("up should show the previous task's output")
+	}
+	m.moveLogCursor(-1)
+	m.moveLogCursor(-1)
+	if m.logCursor != 0 {
+		t.Errorf("cursor = %d, want to stop at the first task", m.logCursor)
+	}
+	m.moveLogCursor(1)
+	m.moveLogCursor(1)
+	m.moveLogCursor(1)
+	if m.logCursor != -1 {
+		t.Errorf("moving past the end should follow the running task again, cursor = %d", m.logCursor)
+	}
+}
+
+func TestInstallProgressIsTranslated(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	for _, tc := range []struct {
+		lang      Lang
+		uninstall bool
+		want      []string
+	}{
+		{LangEN, false, []string{"Installing", "Next up:", "... 5 earlier lines"}},
+		{LangEN, true, []string{"Uninstalling", "Next up:"}},
+		{LangZH, false, []string{"安装中", "接下来：", "更早的 5 行"}},
+		{LangZH, true, []string{"卸载中", "接下来："}},
+	} {
+		m := createModelOnPage(PageInstalling)
+		m.t = GetText(tc.lang)
+		m.uninstall = tc.uninstall
+		m.width, m.height = 120, 60
+		m.installing = true
+		m.installQueue = []installTask{{Name: "A"}, {Name: "B"}}
+		m.sched = tasks.NewScheduler(m.installQueue, 1)
+		m.sched.Next()
+		m.outputs = map[int]*taskOutput{0: {lines: []string{"a output"}, dropped: 5}}
+		m.showOutput = true
+
+		view := m.renderInstallProgress()
+		for _, w := range tc.want {
+			if !strings.Contains(view, w) {
+				t.Errorf("%v uninstall=%v: view is missing %q:\n%s", tc.lang, tc.uninstall, w, view)
+			}
+		}
+		if tc.lang == LangZH && (strings.Contains(view, "Installing") || strings.Contains(view, "Next up")) {
+			t.Errorf("ZH view has English text:\n%s", view)
+		}
+		if !tc.uninstall && strings.Contains(view, "Uninstalling") || tc.uninstall && strings.Contains(view, " Installing ") {
+			t.Errorf("uninstall=%v: wrong running verb:\n%s", tc.uninstall, view)
+		}
+	}
+}
+
+func TestDoneShowsFailedTaskOutput(t *testing.T) {
+	m := failedRun(t, errors.New("exit status 1"))
+	m.installLog[1].output = &taskOutput{lines: []string{"Error: Download failed: Couldn't resolve host"}}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("o")})
+	m = updated.(Model)
+	if !strings.Contains(m.View(), "Couldn't resolve host") {
+		t.Errorf("o on the Done page should show the task's output:\n%s", m.View())
+	}
+}
+
+func TestTaskOutputKeepsTail(t *testing.T) {
+	out := &taskOutput{}
+	for i := range maxOutputLines + 10 {
+		out.add(fmt.Sprint(i))
+	}
+	if len(out.lines) != maxOutputLines || out.dropped != 10 || out.lines[0] != "10" {
+		t.Errorf("lines = %d, dropped = %d, first = %s", len(out.lines), out.dropped, out.lines[0])
+	}
+}
+
+// --- Resume ---
+
+func TestInstallPersistsRunState(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	m := createModelOnPage(PageReview)
+	m.reviewQueue = []installTask{
+		{ID: "a", Name: "A", Fn: func(context.Context) error { return nil }},
+		{ID: "b", Name: "B", Fn: func(context.Context) error { return errors.New("boom") }},
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	m.HandleInstallMsg(InstallMsg{Index: 0, Name: "A"})
+	m.HandleInstallMsg(InstallMsg{Index: 1, Name: "B", Err: errors.New("boom")})
+
+	state, err := tasks.LoadState()
+	if err != nil || state == nil {
+		t.Fatalf("LoadState = %v, %v", state, err)
+	}
+	if state.Tasks[0].Status != tasks.StatusOK || state.Tasks[1].Status != tasks.StatusFailed {
+		t.Errorf("tasks = %+v", state.Tasks)
+	}
+	if loadResumeState() == nil {
+		t.Error("a run with failures should be offered for resume")
+	}
+}
+
+func TestResumePromptOnLanguagePage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	sel := tasks.Selection{SysDefaults: []string{tasks.DefaultEditorZed, tasks.DefaultPlayerIINA}}
+	queue, err := tasks.Build(sel, tasks.Catalog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := tasks.NewRunState(sel, queue)
+	state.Mark(queue[0].ID, tasks.StatusOK, nil)
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewModel(testCatalog())
+	if m.resume == nil {
+		t.Fatal("expected resume prompt")
+	}
+	m.width, m.height = 100, 40
+	if !strings.Contains(m.View(), "Unfinished install") {
+		t.Error("language page should show the resume prompt")
+	}
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = updated.(Model)
+	if m.page != PageLang || !m.resumePending {
+		t.Fatalf("resume should wait for detection, page=%d", m.page)
+	}
+	updated, _ = detected(m).Update(detectDoneMsg{})
+	m = updated.(Model)
+	if m.page != PageReview || len(m.reviewQueue) != 1 || m.reviewQueue[0].Name != queue[1].Name {
+		t.Errorf("resume should review only unfinished tasks, page=%d queue=%v", m.page, m.reviewQueue)
+	}
+	if m.runState == nil {
+		t.Error("resumed run should keep its state")
+	}
+}
+
+func TestResumeAsksForMCPEnvAgain(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("BRAVE_API_KEY", "")
+	m := createModelOnPage(PageLang)
+	sel := tasks.Selection{
+		AITools: []string{"Claude Code"},
+		MCPs:    []string{"Brave Search", "Fetch"},
+		MCPEnv:  map[string]string{"BRAVE_API_KEY": "brave-key-for-tests"},
+	}
+	queue, err := tasks.Build(sel, m.catalog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks.NewRunState(sel, queue).Save()
+	m.resume = loadResumeState()
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = updated.(Model)
+	if m.page != PageMCPEnv || len(m.inputs) != 1 || !strings.Contains(m.View(), "BRAVE_API_KEY") {
+		t.Fatalf("page = %v with %d inputs, want the credentials form", m.page, len(m.inputs))
+	}
+
+	// back returns to the resume prompt
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyShiftTab})
+	m = updated.(Model)
+	if m.page != PageLang || m.resume == nil {
+		t.Fatalf("back went to %v", m.page)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = updated.(Model)
+	m.inputs[0].SetValue("brave-key-typed-again")
+	m, _ = m.nextPage()
+	if m.page != PageReview || len(m.resumeDropped) != 0 {
+		t.Fatalf("page = %v, dropped = %v", m.page, m.resumeDropped)
+	}
+	for _, task := range m.reviewQueue {
+		if task.Name == "MCP servers for Claude Code" {
+			if cmds := strings.Join(task.Commands, "\n"); !strings.Contains(cmds, "Brave") || strings.Contains(cmds, "brave-key-typed-again") {
+				t.Errorf("commands:\n%s", cmds)
+			}
+			return
+		}
+	}
+	t.Errorf("no MCP task in %v", m.reviewQueue)
+}
+
+func TestResumeDiscard(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	tasks.NewRunState(tasks.Selection{}, []installTask{{ID: "x", Name: "X"}}).Save()
+
+	m := NewModel(testCatalog())
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	m = updated.(Model)
+	if m.resume != nil || m.page != PageLang {
+		t.Error("x should dismiss the prompt")
+	}
+	if state, _ := tasks.LoadState(); state != nil {
+		t.Error("x should delete the saved state")
+	}
+}
+
+func TestReviewBackNavigation(t *testing.T) {
+	m := createModelOnPage(PageReview)
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyShiftTab})
+	m = updated.(Model)
+	if m.page != PageSystemDefaults {
+		t.Errorf("shift+tab from review should go back, got %d", m.page)
+	}
+}
+
+// --- Profiles ---
+
+func TestApplyProfile(t *testing.T) {
+	m := detected(NewModel(testCatalog()))
+	for _, item := range m.devTools {
+		item.Status = checker.NotInstalled
+	}
+	m.devTools[1].Status = checker.Installed // Git
+
+	m.ApplyProfile(&profile.Profile{
+		Version:      profile.CurrentVersion,
+		DevTools:     []string{"Git", "Go"},
+		NodeVersions: []string{"v22.11.0"},
+		MCPs:         []string{"SQLite"},
+		ExtraSetup:   []string{},
+		Codex:        profile.AISettings{Model: "o3", BaseURL: "https://gw.local/v1"},
+	})
+
+	if !m.selected["Go"] {
+		t.Error("Go should be selected from profile")
+	}
+	if m.selected["Git"] {
+		t.Error("installed Git should stay locked")
+	}
+	if m.selected["Homebrew"] {
+		t.Error("dev tools not in profile should be deselected")
+	}
+	if !m.fnmSelected["v22.11.0"] {
+		t.Error("node version should be selected")
+	}
+	if !m.mcpSelected["SQLite"] || m.mcpSelected["Playwright"] {
+		t.Errorf("mcpSelected = %v", m.mcpSelected)
+	}
+	for k, on := range m.extraSetup {
+		if on {
+			t.Errorf("extra setup %s should be off for an empty list", k)
+		}
+	}
+	if !m.sysDefaults["browser_chrome"] {
+		t.Error("omitted system_defaults should keep defaults")
+	}
+
+	m.initCodexInputs()
+	if m.inputs[0].Value() != "o3" || m.inputs[2].Value() != "https://gw.local/v1" {
+		t.Errorf("codex inputs not prefilled: %q %q", m.inputs[0].Value(), m.inputs[2].Value())
+	}
+	if m.inputs[1].Value() != "medium" {
+		t.Errorf("unset thinking level should keep default, got %q", m.inputs[1].Value())
+	}
+}
+
+func TestExportProfileFromDonePage(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	m := createModelOnPage(PageDone)
+	m.codexKey = "sk-should-not-export"
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'e'}})
+	m = updated.(Model)
+	if cmd != nil {
+		t.Error("export should not quit")
+	}
+	if m.exportErr != nil {
+		t.Fatalf("export failed: %v", m.exportErr)
+	}
+
+	p, err := profile.Load(filepath.Join(dir, profile.DefaultFileName))
+	if err != nil {
+		t.Fatalf("exported profile does not load: %v", err)
+	}
+	if len(p.ExtraSetup) != 4 {
+		t.Errorf("extra setup = %v, want all 4 defaults", p.ExtraSetup)
+	}
+	data, _ := os.ReadFile(m.exportPath)
+	if strings.Contains(string(data), "sk-should-not-export") {
+		t.Error("exported profile contains an API key")
+	}
+	if !strings.Contains(m.View(), m.t.DoneExported) {
+		t.Error("done page should confirm the export")
+	}
+}
+
+func TestExportProfileKeepsExistingFreshfile(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	existing := filepath.Join(dir, profile.DefaultFileName)
+	os.WriteFile(existing, []byte("# team profile\n"), 0644)
+
+	m := createModelOnPage(PageDone)
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'e'}})
+	m = updated.(Model)
+	if m.exportErr != nil {
+		t.Fatalf("export failed: %v", m.exportErr)
+	}
+	if data, _ := os.ReadFile(existing); string(data) != "# team profile\n" {
+		t.Errorf("export overwrote %s: %s", existing, data)
+	}
+	if filepath.Base(m.exportPath) != "Freshfile-2.toml" {
+		t.Errorf("export path = %s", m.exportPath)
+	}
+	if _, err := profile.Load(m.exportPath); err != nil {
+		t.Errorf("exported profile does not load: %v", err)
+	}
+	if !strings.Contains(m.View(), "Freshfile-2.toml") {
+		t.Error("done page should show where the profile was written")
+	}
+}
+
 // --- i18n ---
 
 func TestGetText(t *testing.T) {
@@ -611,8 +1645,8 @@ func TestGetText(t *testing.T) {
 func TestPageNames(t *testing.T) {
 	en := GetText(LangEN)
 	names := pageNames(en)
-	if len(names) != 13 {
-		t.Errorf("pageNames returned %d items, want 13", len(names))
+	if len(names) != 16 {
+		t.Errorf("pageNames returned %d items, want 16", len(names))
 	}
 	for i, name := range names {
 		if name == "" {
@@ -626,8 +1660,8 @@ func TestPageNames(t *testing.T) {
 func TestPageConstants(t *testing.T) {
 	pages := []Page{
 		PageLang, PageWelcome, PageDevTools, PageApps, PageFnmVersions,
-		PageAITools, PageCodexConfig, PageClaudeConfig, PageMCP,
-		PageExtraSetup, PageSystemDefaults, PageInstalling, PageDone,
+		PageAITools, PageAIProfile, PageCodexConfig, PageClaudeConfig, PageMCP,
+		PageMCPEnv, PageExtraSetup, PageSystemDefaults, PageReview, PageInstalling, PageDone,
 	}
 
 	// Verify they are sequential
@@ -641,7 +1675,7 @@ func TestPageConstants(t *testing.T) {
 // --- Install Done Message ---
 
 func TestInstallDoneMsg(t *testing.T) {
-	m := NewModel()
+	m := NewModel(testCatalog())
 	m.page = PageInstalling
 	m.installing = true
 
@@ -669,8 +1703,30 @@ func TestNewSpinner(t *testing.T) {
 
 // --- Helper ---
 
+// testCatalog returns the built-in catalog, ignoring any local catalog file
+func testCatalog() tasks.Catalog {
+	return tasks.Catalog{
+		DevTools: checker.DevTools(),
+		Apps:     checker.Apps(),
+		AITools:  checker.AITools(),
+		MCPs:     config.AvailableMCPs(),
+	}
+}
+
+// detected runs the model's detection to completion, as Init would
+func detected(m Model) Model {
+	detectItems(m.detectCh, m.catalog().Items())()
+	for {
+		msg := waitForDetected(m.detectCh)()
+		if _, done := msg.(detectDoneMsg); done {
+			return m
+		}
+		m.applyDetected(msg.(detectedMsg).item)
+	}
+}
+
 func createModelOnPage(p Page) Model {
-	m := NewModel()
+	m := detected(NewModel(testCatalog()))
 	m.page = p
 	m.lang = LangEN
 	m.t = GetText(LangEN)
@@ -679,3 +1735,316 @@ func createModelOnPage(p Page) Model {
 	m.cursor = 0
 	return m
 }
+
+// --- Retry ---
+
+// failedRun runs A (ok), B (fails) and C (needs B, skipped) to the Done page
+func failedRun(t *testing.T, bErr error) Model {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	m := createModelOnPage(PageReview)
+	m.width, m.height = 120, 60
+	m.reviewQueue = []installTask{
+		{ID: "a", Name: "A", Fn: func(context.Context) error { return nil }},
+		{ID: "b", Name: "B", Fn: func(context.Context) error { return bErr }},
+		{ID: "c", Name: "C", Needs: []string{"b"}, Fn: func(context.Context) error { return nil }},
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	m.HandleInstallMsg(InstallMsg{Index: 0, Name: "A"})
+	m.HandleInstallMsg(InstallMsg{Index: 1, Name: "B", Err: bErr})
+	updated, _ = m.Update(installDoneMsg{})
+	return updated.(Model)
+}
+
+func TestDoneListsFailedTasksWithFullError(t *testing.T) {
+	long := "brew install failed: " + strings.Repeat("x", 80) + " network unreachable"
+	m := failedRun(t, errors.New(long))
+	if m.page != PageDone {
+		t.Fatalf("page = %d, want PageDone", m.page)
+	}
+	if got := m.retryable(); len(got) != 2 {
+		t.Fatalf("retryable = %v, want B and C", got)
+	}
+	if !m.retrySelected[1] || !m.retrySelected[2] {
+		t.Errorf("failed tasks should start selected: %v", m.retrySelected)
+	}
+
+	view := m.View()
+	if !strings.Contains(view, "network unreachable") {
+		t.Errorf("Done page should show the full error:\n%s", view)
+	}
+	if !strings.Contains(view, "dependency failed: B") {
+		t.Errorf("Done page should list skipped tasks:\n%s", view)
+	}
+	if !strings.Contains(view, m.t.FooterDone) {
+		t.Error("Done page footer should mention retry")
+	}
+}
+
+func TestDoneRetrySelectedTasks(t *testing.T) {
+	m := failedRun(t, errors.New("brew is locked"))
+
+	// keep only B selected
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	m = updated.(Model)
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(" ")})
+	m = updated.(Model)
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = updated.(Model)
+
+	if m.page != PageInstalling || !m.installing || cmd == nil {
+		t.Fatalf("r should start the retry, page = %d", m.page)
+	}
+	if len(m.installQueue) != 1 || m.installQueue[0].Name != "B" {
+		t.Fatalf("installQueue = %v, want only B", m.installQueue)
+	}
+	if len(m.installLog) != 2 || m.installLog[0].name != "A" || m.installLog[1].name != "C" {
+		t.Errorf("unselected entries should be kept: %+v", m.installLog)
+	}
+	if view := m.renderInstallProgress(); !strings.Contains(view, "[0/1]") {
+		t.Errorf("progress should count only the retried tasks:\n%s", view)
+	}
+
+	cmd = m.HandleInstallMsg(InstallMsg{Index: 0, Name: "B"})
+	updated, _ = m.Update(cmd())
+	m = updated.(Model)
+	if m.page != PageDone {
+		t.Fatalf("page = %d, want PageDone", m.page)
+	}
+	if got := m.retryable(); len(got) != 1 || m.installLog[got[0]].name != "C" {
+		t.Errorf("only C should still need a retry: %+v", m.installLog)
+	}
+}
+
+func TestDoneRetrySkippedTaskBringsItsFailedDependency(t *testing.T) {
+	m := failedRun(t, errors.New("offline"))
+
+	// keep only C, skipped because B failed
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	m = updated.(Model)
+	m.cursor = 1
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(" ")})
+	m = updated.(Model)
+	if !m.retrySelected[2] || m.retrySelected[1] {
+		t.Fatalf("retrySelected = %v, want only C", m.retrySelected)
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = updated.(Model)
+	if len(m.installQueue) != 2 || m.installQueue[0].Name != "B" || m.installQueue[1].Name != "C" {
+		t.Fatalf("installQueue = %v, want B then C", m.installQueue)
+	}
+	if got := m.sched.Running(); len(got) != 1 || got[0] != 0 {
+		t.Errorf("C must wait for B, running = %v", got)
+	}
+
+	// B fails again: C is skipped again rather than run without it
+	m.HandleInstallMsg(InstallMsg{Index: 0, Name: "B", Err: errors.New("still offline")})
+	if len(m.installLog) != 3 || !m.installLog[2].skipped || !strings.Contains(m.installLog[2].errMsg, "dependency failed: B") {
+		t.Errorf("installLog = %+v", m.installLog)
+	}
+}
+
+func TestDoneRetryAllClearsRunState(t *testing.T) {
+	m := failedRun(t, errors.New("offline"))
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = updated.(Model)
+	if len(m.installQueue) != 2 || m.installQueue[0].Name != "B" || m.installQueue[1].Name != "C" {
+		t.Fatalf("installQueue = %v, want B then C", m.installQueue)
+	}
+	if got := m.sched.Running(); len(got) != 1 || got[0] != 0 {
+		t.Errorf("C must wait for B, running = %v", got)
+	}
+
+	m.HandleInstallMsg(InstallMsg{Index: 0, Name: "B"})
+	cmd := m.HandleInstallMsg(InstallMsg{Index: 1, Name: "C"})
+	updated, _ = m.Update(cmd())
+	m = updated.(Model)
+	if len(m.retryable()) != 0 || len(m.installLog) != 3 {
+		t.Errorf("installLog = %+v", m.installLog)
+	}
+	if state, _ := tasks.LoadState(); state != nil {
+		t.Error("run state should be cleared once every task succeeded")
+	}
+}
+
+func TestDoneRetryNothingSelected(t *testing.T) {
+	m := failedRun(t, errors.New("offline"))
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n")})
+	m = updated.(Model)
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = updated.(Model)
+	if m.page != PageDone || cmd != nil {
+		t.Error("r with nothing selected should stay on the Done page")
+	}
+}
+
+// --- Run History ---
+
+func TestInstallRecordsRunHistory(t *testing.T) {
+	m := failedRun(t, errors.New("brew is locked"))
+
+	// the retry from the Done page adds to the same run
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r")})
+	m = updated.(Model)
+	m.HandleInstallMsg(InstallMsg{Index: 0, Name: "B"})
+	cmd := m.HandleInstallMsg(InstallMsg{Index: 1, Name: "C"})
+	updated, _ = m.Update(cmd())
+	m = updated.(Model)
+
+	runs, err := history.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("runs = %+v, want one", runs)
+	}
+	if r := runs[0]; r.ID != m.runLog.ID || r.Source != "tui" || r.Tasks != 3 || r.OK != 3 || r.Failed != 0 || r.End.IsZero() {
+		t.Errorf("run summary = %+v, want 3 ok from the tui", r)
+	}
+
+	records, _ := history.Load(m.runLog.ID)
+	var out strings.Builder
+	history.WriteRun(&out, records)
+	for _, want := range []string{"✓ A", "✓ B  (0s, 2 attempts)", "! brew is locked", "✓ C"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("run log missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestInstallRecordsCommands(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer runner.Use(runner.NewFake())()
+
+	m := createModelOnPage(PageReview)
+	m.width, m.height = 120, 60
+	m.reviewQueue = []installTask{{ID: "zed", Name: "Zed", Fn: func(ctx context.Context) error {
+		_, err := runner.Run(ctx, "brew", "install", "--cask", "zed")
+		return err
+	}}}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	m.HandleInstallMsg(InstallMsg{Index: 0, Name: "Zed", Err: m.installQueue[0].Exec(m.taskContext(0))})
+
+	records, err := history.Load("last")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if r.Type == history.TypeCommand {
+			if r.TaskID != "zed" || r.Command != "brew install --cask zed" || r.ExitCode == nil || *r.ExitCode != 0 {
+				t.Errorf("command record = %+v", r)
+			}
+			return
+		}
+	}
+	t.Errorf("no command recorded: %+v", records)
+}
+
+// --- Redaction ---
+
+func TestInstallKeepsKeysOutOfLogsAndView(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	const key = "typed-into-the-claude-form"
+	fake := runner.NewFake().On("brew install --cask zed", runner.Response{Stdout: "using token " + key + "\n", ExitCode: 1})
+	defer runner.Use(fake)()
+
+	m := createModelOnPage(PageClaudeConfig)
+	m.width, m.height = 120, 60
+	m.initClaudeInputs()
+	m.inputs[2].SetValue(key)
+	m.saveClaudeInputs()
+
+	queue, err := tasks.Build(tasks.Selection{Claude: tasks.ClaudeSettings{APIKey: m.claudeKey}}, tasks.Catalog{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.reviewQueue = append(queue, installTask{ID: "zed", Name: "Zed", Fn: func(ctx context.Context) error {
+		if _, err := runner.Run(ctx, "brew", "install", "--cask", "zed"); err != nil {
+			return fmt.Errorf("zed install with %s: %w", key, err)
+		}
+		return nil
+	}})
+	m.page = PageReview
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	for i := range m.installQueue {
+		m.HandleInstallMsg(InstallMsg{Index: i, Name: m.installQueue[i].Name, Err: m.installQueue[i].Exec(m.taskContext(i))})
+	}
+	m = drainOutput(m)
+	updated, _ = m.Update(installDoneMsg{})
+	m = updated.(Model)
+	m.showOutput = true
+
+	if view := m.View(); strings.Contains(view, key) || !strings.Contains(view, "zed install with [REDACTED]") {
+		t.Errorf("Done page should show the error with the key masked:\n%s", view)
+	}
+	if out := m.installLog[1].output.last(5); !strings.Contains(strings.Join(out, "\n"), "using token [REDACTED]") {
+		t.Errorf("output = %v, want the key masked", out)
+	}
+
+	var found []string
+	filepath.WalkDir(home, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if data, _ := os.ReadFile(path); strings.Contains(string(data), key) {
+				rel, _ := filepath.Rel(home, path)
+				found = append(found, rel)
+			}
+		}
+		return err
+	})
+	if len(found) != 1 || found[0] != filepath.Join(".freshbox", "secrets", "claude-api-key") {
+		t.Errorf("key found in %v, want only the secret store", found)
+	}
+}
+
+// --- Uninstall ---
+
+func TestUninstallFromWelcomePage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer runner.Use(runner.NewFake())()
+	m := createModelOnPage(PageWelcome)
+	if strings.Contains(m.View(), "freshbox added") {
+		t.Error("nothing added yet, so no uninstall hint")
+	}
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("u")})
+	if m = updated.(Model); m.page != PageWelcome {
+		t.Fatal("u should do nothing when freshbox added nothing")
+	}
+
+	ledger.Add(context.Background(), ledger.Entry{Kind: ledger.KindCask, Name: "zed", Label: "Zed"})
+	m = createModelOnPage(PageWelcome)
+	if !strings.Contains(m.View(), "remove the 1 items freshbox added") {
+		t.Error("welcome page should offer the uninstall")
+	}
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("u")})
+	m = updated.(Model)
+	if m.page != PageReview || !m.uninstall || len(m.reviewQueue) != 1 {
+		t.Fatalf("page=%d uninstall=%v queue=%v", m.page, m.uninstall, m.reviewQueue)
+	}
+	if view := m.View(); !strings.Contains(view, "Review Uninstall Plan") || !strings.Contains(view, "brew uninstall --cask zed") {
+		t.Error("review page should show the uninstall plan")
+	}
+
+	// back leaves the uninstall for the welcome page
+	back, _ := m.Update(tea.KeyMsg{Type: tea.KeyShiftTab})
+	if b := back.(Model); b.page != PageWelcome || b.uninstall {
+		t.Errorf("shift+tab: page=%d uninstall=%v", b.page, b.uninstall)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	cmd := m.HandleInstallMsg(InstallMsg{Index: 0, Name: "Uninstall Zed", Err: m.installQueue[0].Exec(m.installCtx)})
+	if _, ok := cmd().(installDoneMsg); !ok {
+		t.Fatal("uninstall should finish")
+	}
+	if len(m.added) != 0 {
+		t.Errorf("added = %+v, want it emptied", m.added)
+	}
+	if s, _ := tasks.LoadState(); s != nil {
+		t.Error("an uninstall must not save resumable install state")
+	}
+}
@@ -1,11 +1,15 @@
 package ui
 
 import (
+	"cmp"
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
 	"github.com/kittors/freshbox/internal/checker"
+	"github.com/kittors/freshbox/internal/providers"
+	"github.com/kittors/freshbox/internal/secrets"
 	"github.com/kittors/freshbox/internal/version"
 )
 
@@ -35,16 +39,26 @@ func (m Model) View() string {
 		b.WriteString(m.renderFnmVersions())
 	case PageAITools:
 		b.WriteString(m.renderCheckList("🤖 "+m.t.TitleAITools, m.aiTools))
+	case PageAIProfile:
+		b.WriteString(m.renderAIProfiles())
 	case PageCodexConfig:
 		b.WriteString(m.renderConfigForm("Codex Configuration"))
 	case PageClaudeConfig:
 		b.WriteString(m.renderConfigForm("Claude Code Configuration"))
 	case PageMCP:
-		b.WriteString(m.renderMCPList())
+		if m.addingMCP {
+			b.WriteString(m.renderAddMCPForm())
+		} else {
+			b.WriteString(m.renderMCPList())
+		}
+	case PageMCPEnv:
+		b.WriteString(m.renderMCPEnvForm())
 	case PageExtraSetup:
 		b.WriteString(m.renderExtraSetup())
 	case PageSystemDefaults:
 		b.WriteString(m.renderSystemDefaults())
+	case PageReview:
+		b.WriteString(m.renderReview())
 	case PageInstalling:
 		b.WriteString(m.renderInstallProgress())
 	case PageDone:
@@ -92,6 +106,9 @@ func (m Model) renderWelcome() string {
 	welcome += "  " + arrow + " " + m.t.WelcomeMCP + "\n"
 	welcome += "  " + arrow + " " + m.t.WelcomeSys + "\n"
 	welcome += "\n\n  " + SelectedStyle.Render(m.t.WelcomeStart) + ", " + DimStyle.Render(m.t.WelcomeQuit)
+	if len(m.added) > 0 {
+		welcome += "\n  " + DimStyle.Render(fmt.Sprintf(m.t.WelcomeUninstall, len(m.added)))
+	}
 	return BoxStyle.Render(welcome)
 }
 
@@ -110,11 +127,28 @@ func (m Model) renderCheckList(title string, items []*checker.Item) string {
 			desc = DimStyle.Render(" — " + item.Desc)
 		}
 
-		if item.Status == checker.Installed {
+		switch {
+		case m.detecting[item.Name]:
+			name := NotInstalledStyle.Render(item.Name)
+			b.WriteString(fmt.Sprintf("  %s %s %s %s%s\n", cursor, DimStyle.Render("□"), name, DimStyle.Render(m.t.Detecting), desc))
+		case item.Status == checker.Installed:
 			name := InstalledStyle.Render(item.Name)
 			ver := VersionStyle.Render(" (" + item.Version + ")")
 			b.WriteString(fmt.Sprintf("  %s %s %s%s%s\n", cursor, CheckedStyle.Render("■"), name, ver, desc))
-		} else {
+		case item.Status == checker.Outdated:
+			// selectable, to upgrade it
+			check := UncheckedStyle.Render("□")
+			if m.selected[item.Name] {
+				check = CheckedStyle.Render("■")
+			}
+			name := lipgloss.NewStyle().Foreground(White).Render(item.Name)
+			upgrade := " → " + item.Latest
+			if item.Latest == "" {
+				upgrade = ", " + fmt.Sprintf(m.t.NeedsUpgrade, item.MinVersion)
+			}
+			ver := OutdatedStyle.Render(" (" + item.Version + upgrade + ")")
+			b.WriteString(fmt.Sprintf("  %s %s %s%s%s\n", cursor, check, name, ver, desc))
+		default:
 			check := UncheckedStyle.Render("□")
 			if m.selected[item.Name] {
 				check = CheckedStyle.Render("■")
@@ -175,15 +209,100 @@ func (m Model) renderConfigForm(title string) string {
 		labels = []string{m.t.CfgModel, m.t.CfgBaseURL, m.t.CfgAPIKey}
 	}
 
+	checks := m.formChecks()
 	for i, input := range m.inputs {
 		label := LabelStyle.Render(labels[i] + ":")
 		field := input.View()
+		if i < len(checks) {
+			field += checkMark(checks[i])
+		}
 		if i == m.inputFocus {
 			b.WriteString(fmt.Sprintf("  %s %s  %s\n\n", CursorStyle.Render("▸"), label, field))
 		} else {
 			b.WriteString(fmt.Sprintf("    %s  %s\n\n", label, field))
 		}
 	}
+	switch {
+	case m.verifying:
+		b.WriteString(DimStyle.Render("  "+m.t.CfgVerifying) + "\n")
+	case m.verifyReport != nil && m.verifyReport.Failed():
+		b.WriteString(ErrorStyle.Render("  "+m.t.CfgVerifyFailed) + "\n")
+	}
+
+	where := secrets.Default().Where(secrets.ClaudeAPIKey)
+	if m.inputPage == PageCodexConfig {
+		where = secrets.Default().Where(secrets.CodexAPIKey)
+	}
+	if m.plaintextKeys {
+		b.WriteString(lipgloss.NewStyle().Foreground(Yellow).Render("  "+fmt.Sprintf(m.t.CfgKeyPlain, where)) + "\n")
+	} else {
+		b.WriteString(DimStyle.Render("  "+fmt.Sprintf(m.t.CfgKeyStored, where)) + "\n")
+	}
+
+	return BoxStyle.Render(b.String())
+}
+
+// formChecks returns the endpoint check of each config form field in input
+// order; fields edited since the check get none
+func (m Model) formChecks() []providers.Check {
+	if m.verifyReport == nil {
+		return nil
+	}
+	r := m.verifyReport
+	checks := []providers.Check{r.Model, r.BaseURL, r.APIKey}
+	if m.inputPage == PageCodexConfig {
+		checks = []providers.Check{r.Model, r.ThinkingLevel, r.BaseURL, r.APIKey}
+	}
+	for i := range checks {
+		if i >= len(m.inputs) || i >= len(m.verifyValues) || m.inputs[i].Value() != m.verifyValues[i] {
+			checks[i] = providers.Check{}
+		}
+	}
+	return checks
+}
+
+// checkMark renders a field's check: ✓, ✗ with the reason, or nothing
+func checkMark(c providers.Check) string {
+	switch {
+	case c.Err != nil:
+		return " " + ErrorStyle.Render("✗ "+c.Err.Error())
+	case c.Done:
+		return " " + SuccessStyle.Render("✓")
+	}
+	return ""
+}
+
+func (m Model) renderAIProfiles() string {
+	var b strings.Builder
+	b.WriteString(SubtitleStyle.Render("🔀 "+m.t.TitleAIProfile) + "\n")
+	b.WriteString(DimStyle.Render("  "+m.t.AIProfileDesc) + "\n\n")
+
+	row := func(i int, chosen bool, name string) {
+		cursor := "  "
+		if i == m.cursor {
+			cursor = CursorStyle.Render("▸ ")
+		}
+		radio := UncheckedStyle.Render("○")
+		if chosen {
+			radio = CheckedStyle.Render("●")
+		}
+		b.WriteString(fmt.Sprintf("  %s %s %s\n", cursor, radio, lipgloss.NewStyle().Foreground(White).Render(name)))
+	}
+	row(0, m.aiProfile == "", m.t.AIProfileManual)
+	for i, p := range m.aiProfiles.Profiles {
+		b.WriteString("\n")
+		row(i+1, m.aiProfile == p.Name, p.Name)
+		var active []string
+		for _, tool := range p.Tools() {
+			b.WriteString(DimStyle.Render(fmt.Sprintf("      %-6s %s", tool, p.For(tool))) + "\n")
+			if m.aiProfiles.Active[tool] == p.Name {
+				active = append(active, tool)
+			}
+		}
+		if len(active) > 0 {
+			b.WriteString("      " + InstalledStyle.Render(fmt.Sprintf(m.t.AIProfileActive, strings.Join(active, ", "))) + "\n")
+		}
+	}
 
 	return BoxStyle.Render(b.String())
 }
@@ -204,12 +323,67 @@ func (m Model) renderMCPList() string {
 		}
 		name := lipgloss.NewStyle().Foreground(White).Render(mcp.Name)
 		cmd := DimStyle.Render(fmt.Sprintf(" (%s %s)", mcp.Command, strings.Join(mcp.Args, " ")))
+		if mcp.Remote() {
+			cmd = DimStyle.Render(fmt.Sprintf(" (%s %s)", mcp.Transport, mcp.URL))
+		}
 		b.WriteString(fmt.Sprintf("  %s %s %s%s\n", cursor, check, name, cmd))
 	}
+	cursor := "  "
+	if m.cursor == len(m.mcps) {
+		cursor = CursorStyle.Render("▸ ")
+	}
+	b.WriteString(fmt.Sprintf("\n  %s %s\n", cursor, DimStyle.Render("+ "+m.t.AddMCP)))
 
 	return BoxStyle.Render(b.String())
 }
 
+func (m Model) renderAddMCPForm() string {
+	var b strings.Builder
+	b.WriteString(SubtitleStyle.Render("🔌 "+m.t.TitleAddMCP) + "\n")
+	b.WriteString(DimStyle.Render("  "+m.t.TitleAddMCPDesc) + "\n\n")
+
+	labels := []string{m.t.AddMCPName, m.t.AddMCPURL, m.t.AddMCPTransport, m.t.AddMCPToken}
+	for i, input := range m.inputs {
+		label := LabelStyle.Render(labels[i] + ":")
+		if i == m.inputFocus {
+			b.WriteString(fmt.Sprintf("  %s %s  %s\n\n", CursorStyle.Render("▸"), label, input.View()))
+		} else {
+			b.WriteString(fmt.Sprintf("    %s  %s\n\n", label, input.View()))
+		}
+	}
+	if m.addMCPErr != nil {
+		b.WriteString(ErrorStyle.Render("  "+m.addMCPErr.Error()) + "\n")
+	}
+	return BoxStyle.Render(b.String())
+}
+
+func (m Model) renderMCPEnvForm() string {
+	var b strings.Builder
+	b.WriteString(SubtitleStyle.Render("🔑 "+m.t.TitleMCPEnv) + "\n")
+	b.WriteString(DimStyle.Render("  "+m.t.TitleMCPEnvDesc) + "\n\n")
+
+	for i, f := range m.mcpEnvFields() {
+		if i >= len(m.inputs) {
+			break
+		}
+		label := LabelStyle.Render(f.server + " · " + cmp.Or(f.env.Label, f.env.Name) + ":")
+		field := m.inputs[i].View()
+		if m.mcpEnvMissing && strings.TrimSpace(m.inputs[i].Value()) == "" {
+			field += checkMark(providers.Check{Done: true, Err: errors.New(m.t.MCPEnvRequired)})
+		}
+		cursor := "  "
+		if i == m.inputFocus {
+			cursor = CursorStyle.Render("▸ ")
+		}
+		b.WriteString(fmt.Sprintf("  %s%s  %s\n", cursor, label, field))
+		b.WriteString(DimStyle.Render("      "+f.env.Name) + "\n\n")
+	}
+	if m.mcpEnvMissing {
+		b.WriteString(ErrorStyle.Render("  "+m.t.MCPEnvMissing) + "\n")
+	}
+	return BoxStyle.Render(b.String())
+}
+
 func (m Model) renderExtraSetup() string {
 	var b strings.Builder
 	b.WriteString(SubtitleStyle.Render("🎨 "+m.t.TitleExtraSetup) + "\n")
@@ -274,34 +448,218 @@ func (m Model) renderSystemDefaults() string {
 	return BoxStyle.Render(b.String())
 }
 
+func (m Model) renderReview() string {
+	var b strings.Builder
+	what := m.t.TitleReview
+	if m.uninstall {
+		what = m.t.TitleUninstall
+	}
+	title := fmt.Sprintf("📋 %s  [%d]", what, len(m.reviewQueue))
+	b.WriteString(SubtitleStyle.Render(title) + "\n")
+	b.WriteString(DimStyle.Render("  "+m.t.ReviewDesc) + "\n\n")
+	for _, name := range m.resumeDropped {
+		b.WriteString(ErrorStyle.Render("  ⚠ "+name+": "+m.t.ResumeNeedsKey) + "\n")
+	}
+	if m.reviewErr != nil {
+		b.WriteString(ErrorStyle.Render("  ✗ "+m.reviewErr.Error()) + "\n")
+	}
+
+	if len(m.reviewQueue) == 0 {
+		b.WriteString("  " + m.t.ReviewEmpty + "\n")
+		return BoxStyle.Render(b.String())
+	}
+
+	names := make(map[string]string, len(m.reviewQueue))
+	for _, task := range m.reviewQueue {
+		names[task.ID] = task.Name
+	}
+
+	// Flatten tasks into lines, remembering where each task starts
+	var lines []string
+	starts := make([]int, len(m.reviewQueue))
+	for i, task := range m.reviewQueue {
+		starts[i] = len(lines)
+		cursor := "  "
+		name := lipgloss.NewStyle().Foreground(White).Render(task.Name)
+		if i == m.cursor {
+			cursor = CursorStyle.Render("▸ ")
+			name = SelectedStyle.Render(task.Name)
+		}
+		lines = append(lines, fmt.Sprintf("  %s%2d. %s", cursor, i+1, name))
+		if len(task.Needs) > 0 {
+			var after []string
+			for _, id := range task.Needs {
+				after = append(after, names[id])
+			}
+			lines = append(lines, DimStyle.Render("        ↳ after "+strings.Join(after, ", ")))
+		}
+		for _, c := range task.Commands {
+			lines = append(lines, DimStyle.Render("        $ "+c))
+		}
+		for _, f := range task.Files {
+			lines = append(lines, VersionStyle.Render("        ✎ "+f))
+		}
+	}
+
+	// Scroll so the task under the cursor stays visible
+	visible := max(m.height-20, 5)
+	offset := 0
+	if m.cursor < len(starts) {
+		offset = starts[m.cursor]
+	}
+	if offset+visible > len(lines) {
+		offset = max(len(lines)-visible, 0)
+	}
+	end := min(offset+visible, len(lines))
+
+	if offset > 0 {
+		b.WriteString(DimStyle.Render(fmt.Sprintf("  ... %d more above", offset)) + "\n")
+	}
+	for _, line := range lines[offset:end] {
+		b.WriteString(line + "\n")
+	}
+	if end < len(lines) {
+		b.WriteString(DimStyle.Render(fmt.Sprintf("  ... %d more below", len(lines)-end)) + "\n")
+	}
+
+	return BoxStyle.Render(b.String())
+}
+
 func (m Model) renderDone() string {
 	// count errors
-	errCount := 0
+	errCount, skipCount := 0, 0
 	for _, entry := range m.installLog {
-		if !entry.success {
+		switch {
+		case entry.skipped:
+			skipCount++
+		case !entry.success:
 			errCount++
 		}
 	}
 
+	msg := m.t.DoneMsg
+	if m.uninstall {
+		msg = m.t.DoneUninstalled
+	}
 	var done string
-	if errCount == 0 {
+	if errCount == 0 && skipCount == 0 {
 		done = SuccessStyle.Render("  ✓ "+m.t.DoneReady) + "\n\n"
-		done += "  " + m.t.DoneMsg + "\n"
+		done += "  " + msg + "\n"
 	} else {
 		done = SuccessStyle.Render("  ✓ "+m.t.DoneReady) + "\n\n"
-		done += "  " + m.t.DoneMsg + "\n\n"
+		done += "  " + msg + "\n\n"
 		done += ErrorStyle.Render(fmt.Sprintf("  ⚠ %d errors occurred.", errCount)) + "\n"
+		if skipCount > 0 {
+			done += DimStyle.Render(fmt.Sprintf("  ⊘ %d tasks skipped because a dependency failed.", skipCount)) + "\n"
+		}
 		done += DimStyle.Render("  Full error log: ~/.freshbox/install.log") + "\n"
+		done += "\n" + m.renderRetryList()
+	}
+	switch {
+	case m.uninstall: // nothing to export
+	case m.exportErr != nil:
+		done += "\n" + ErrorStyle.Render("  "+m.t.DoneExportFail+": "+m.exportErr.Error()) + "\n"
+	case m.exportPath != "":
+		done += "\n" + SuccessStyle.Render("  ✓ "+m.t.DoneExported) + " " + DimStyle.Render(m.exportPath) + "\n"
+	default:
+		done += "\n  " + DimStyle.Render(m.t.DoneExportHint) + "\n"
 	}
 	done += "\n  " + m.t.DoneExit
 	return BoxStyle.Render(done)
 }
 
+// renderRetryList lists failed and skipped tasks with their full error so
+// some or all of them can be picked for another attempt
+func (m Model) renderRetryList() string {
+	failed := m.retryable()
+	indent := lipgloss.NewStyle().PaddingLeft(8).Width(max(m.width-8, 40))
+
+	// Flatten entries into lines, remembering where each entry starts
+	var lines []string
+	starts := make([]int, len(failed))
+	for n, i := range failed {
+		entry := m.installLog[i]
+		starts[n] = len(lines)
+		cursor := "  "
+		if n == m.cursor {
+			cursor = CursorStyle.Render("▸ ")
+		}
+		check := UncheckedStyle.Render("□")
+		if m.retrySelected[i] {
+			check = CheckedStyle.Render("■")
+		}
+		mark, name := ErrorStyle.Render("✗"), entry.name
+		if entry.skipped {
+			mark, name = DimStyle.Render("⊘"), DimStyle.Render(entry.name)
+		}
+		lines = append(lines, fmt.Sprintf("  %s%s %s %s", cursor, check, mark, name))
+		style := ErrorStyle
+		if entry.skipped {
+			style = DimStyle
+		}
+		for _, l := range strings.Split(indent.Render(entry.fullErr), "\n") {
+			lines = append(lines, style.Render(l))
+		}
+	}
+
+	// Scroll so the entry under the cursor stays visible, leaving room for
+	// its output when the pane is open
+	paneLines := max(m.height/3, 5)
+	visible := m.height - 26
+	if m.showOutput {
+		visible -= paneLines + 4
+	}
+	visible = max(visible, 5)
+	offset := 0
+	if m.cursor < len(starts) {
+		offset = starts[m.cursor]
+	}
+	if offset+visible > len(lines) {
+		offset = max(len(lines)-visible, 0)
+	}
+	end := min(offset+visible, len(lines))
+
+	var b strings.Builder
+	b.WriteString("  " + m.t.DoneRetry + "\n")
+	if offset > 0 {
+		b.WriteString(DimStyle.Render(fmt.Sprintf("  ... %d more above", offset)) + "\n")
+	}
+	for _, line := range lines[offset:end] {
+		b.WriteString(line + "\n")
+	}
+	if end < len(lines) {
+		b.WriteString(DimStyle.Render(fmt.Sprintf("  ... %d more below", len(lines)-end)) + "\n")
+	}
+	if m.showOutput && m.cursor < len(failed) {
+		entry := m.installLog[failed[m.cursor]]
+		b.WriteString("\n" + m.renderOutputPane(entry.name, entry.output, paneLines) + "\n")
+	}
+	return b.String()
+}
+
 func (m Model) renderFooter() string {
 	help := "  " + m.t.FooterNav
-	if m.page == PageCodexConfig || m.page == PageClaudeConfig {
+	if m.page == PageCodexConfig || m.page == PageClaudeConfig || m.page == PageMCPEnv {
 		help = "  " + m.t.FooterForm
 	}
+	if m.addingMCP {
+		help = "  " + m.t.FooterAddMCP
+	}
+	if m.page == PageReview {
+		help = "  " + m.t.FooterReview
+		if m.uninstall {
+			help = "  " + m.t.FooterUninstall
+		}
+	}
+	if m.page == PageInstalling && m.installing {
+		help = "  " + m.t.FooterInstalling
+	}
+	if m.page == PageDone && len(m.retryable()) > 0 {
+		help = "  " + m.t.FooterDone
+	}
+	if len(m.detecting) > 0 && m.page < PageReview {
+		help += "\n  " + fmt.Sprintf(m.t.FooterDetecting, len(m.detecting))
+	}
 	return HelpStyle.Render(help)
 }
 
@@ -331,5 +689,11 @@ func (m Model) renderLangSelect() string {
 		b.WriteString(fmt.Sprintf("  %s %s %s\n%s\n\n", cursor, radio, name, desc))
 	}
 
+	if m.resume != nil {
+		b.WriteString(SubtitleStyle.Render("⟳ "+m.t.ResumeFound+" "+m.resume.StartedAt.Format("2006-01-02 15:04")) + "\n")
+		b.WriteString(fmt.Sprintf("  %d/%d %s\n", m.resume.Remaining(), len(m.resume.Tasks), m.t.ResumeLeft))
+		b.WriteString("  " + CursorStyle.Render(m.t.ResumeKeys) + "\n")
+	}
+
 	return BoxStyle.Render(b.String())
 }